@@ -46,12 +46,49 @@ cp $WORKING_DIR/src/avalanchego/set.go ./snow/validators/set.go
 cp $WORKING_DIR/src/avalanchego/build_coreth.sh ./scripts/build_coreth.sh
 mkdir ./scripts/coreth_changes
 cp $WORKING_DIR/src/coreth/vm.go ./scripts/coreth_changes/vm.go
+cp $WORKING_DIR/src/coreth/health.go ./scripts/coreth_changes/health.go
 cp $WORKING_DIR/src/coreth/import_tx.go ./scripts/coreth_changes/import_tx.go
 cp $WORKING_DIR/src/coreth/export_tx.go ./scripts/coreth_changes/export_tx.go
 cp $WORKING_DIR/src/coreth/state_transition.go ./scripts/coreth_changes/state_transition.go
+cp $WORKING_DIR/src/coreth/state_transition_test.go ./scripts/coreth_changes/state_transition_test.go
+cp $WORKING_DIR/src/coreth/state_connector_preverify.go ./scripts/coreth_changes/state_connector_preverify.go
+cp $WORKING_DIR/src/coreth/state_connector_outcomes.go ./scripts/coreth_changes/state_connector_outcomes.go
 cp $WORKING_DIR/src/stateco/state_connector.go ./scripts/coreth_changes/state_connector.go
+cp $WORKING_DIR/src/stateco/state_connector_test.go ./scripts/coreth_changes/state_connector_test.go
+cp $WORKING_DIR/src/stateco/state_connector_balance.go ./scripts/coreth_changes/state_connector_balance.go
+cp $WORKING_DIR/src/stateco/state_connector_nonpayment.go ./scripts/coreth_changes/state_connector_nonpayment.go
+cp $WORKING_DIR/src/stateco/state_connector_evm.go ./scripts/coreth_changes/state_connector_evm.go
+cp $WORKING_DIR/src/stateco/state_connector_stellar.go ./scripts/coreth_changes/state_connector_stellar.go
+cp $WORKING_DIR/src/stateco/state_connector_utxo.go ./scripts/coreth_changes/state_connector_utxo.go
+cp $WORKING_DIR/src/stateco/state_connector_esplora.go ./scripts/coreth_changes/state_connector_esplora.go
+cp $WORKING_DIR/src/stateco/state_connector_xrp_websocket.go ./scripts/coreth_changes/state_connector_xrp_websocket.go
+cp $WORKING_DIR/src/stateco/state_connector_hash.go ./scripts/coreth_changes/state_connector_hash.go
+cp $WORKING_DIR/src/stateco/state_connector_txpool.go ./scripts/coreth_changes/state_connector_txpool.go
+cp $WORKING_DIR/src/stateco/state_connector_txpool_test.go ./scripts/coreth_changes/state_connector_txpool_test.go
+cp $WORKING_DIR/src/coreth/tx_pool.patch ./scripts/coreth_changes/tx_pool.patch
+cp $WORKING_DIR/src/stateco/state_connector_audit.go ./scripts/coreth_changes/state_connector_audit.go
+cp $WORKING_DIR/src/stateco/state_connector_audit_test.go ./scripts/coreth_changes/state_connector_audit_test.go
+cp $WORKING_DIR/src/stateco/state_connector_archive.go ./scripts/coreth_changes/state_connector_archive.go
+cp $WORKING_DIR/src/stateco/state_connector_archive_test.go ./scripts/coreth_changes/state_connector_archive_test.go
+cp $WORKING_DIR/src/stateco/state_connector_monitor.go ./scripts/coreth_changes/state_connector_monitor.go
+cp $WORKING_DIR/src/stateco/state_connector_monitor_test.go ./scripts/coreth_changes/state_connector_monitor_test.go
+cp $WORKING_DIR/src/stateco/system_contracts.go ./scripts/coreth_changes/system_contracts.go
+cp $WORKING_DIR/src/stateco/system_contract_bindings.go ./scripts/coreth_changes/system_contract_bindings.go
+cp $WORKING_DIR/src/stateco/system_contracts_test.go ./scripts/coreth_changes/system_contracts_test.go
+cp $WORKING_DIR/src/stateco/upgrade_schedule.go ./scripts/coreth_changes/upgrade_schedule.go
+cp $WORKING_DIR/src/stateco/upgrade_schedule_test.go ./scripts/coreth_changes/upgrade_schedule_test.go
 cp $WORKING_DIR/src/keeper/keeper.go ./scripts/coreth_changes/keeper.go
 cp $WORKING_DIR/src/keeper/keeper_test.go ./scripts/coreth_changes/keeper_test.go
+cp $WORKING_DIR/src/flare-verify/main.go ./scripts/coreth_changes/flare_verify.go
+cp $WORKING_DIR/src/flare-verify/main_test.go ./scripts/coreth_changes/flare_verify_test.go
+cp $WORKING_DIR/src/flare-audit/main.go ./scripts/coreth_changes/flare_audit.go
+cp $WORKING_DIR/src/flare-audit/main_test.go ./scripts/coreth_changes/flare_audit_test.go
+cp $WORKING_DIR/src/flare-backtest/main.go ./scripts/coreth_changes/flare_backtest.go
+cp $WORKING_DIR/src/flare-backtest/main_test.go ./scripts/coreth_changes/flare_backtest_test.go
+cp $WORKING_DIR/src/stateconnector/hash.go ./scripts/coreth_changes/stateconnector_hash.go
+cp $WORKING_DIR/src/stateconnector/client.go ./scripts/coreth_changes/stateconnector_client.go
+cp $WORKING_DIR/src/stateconnector/client_test.go ./scripts/coreth_changes/stateconnector_client_test.go
+cp $WORKING_DIR/bin/src/stateco/StateConnector.json ./scripts/coreth_changes/StateConnector.json
 
 export ROCKSDBALLOWED=1
 ./scripts/build.sh
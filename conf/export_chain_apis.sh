@@ -4,17 +4,31 @@
 #!/bin/bash
 declare -a SUPPORTED_CHAINS=(LTC XRP)
 
+# UTXO chains defined by the utxo_chains.json file next to chain_apis.json need APIs too
+UTXO_CHAINS_FILE=$(dirname $1)/utxo_chains.json
+if [[ -f $UTXO_CHAINS_FILE ]]; then
+    export UTXO_CHAINS=$UTXO_CHAINS_FILE
+    SUPPORTED_CHAINS+=($(cat $UTXO_CHAINS_FILE | jq -r '.[].envPrefix'))
+fi
+
 test_api () {
-    if [[ $1 == LTC ]]; then
-        if [[ $(curl -sd '{"jsonrpc": "1.0", "id": "curltest", "method": "getblockcount", "params": []}' -u $3:$4 $2 | jq .result) == "" ]]; then
-            echo "Invalid LTC API"
+    if [[ $5 == esplora ]]; then
+        if [[ $(curl -s -u $3:$4 ${2%/}/blocks/tip/height) == "" ]]; then
+            echo "Invalid $1 Esplora API"
             exit;
         fi
+    elif [[ $1 == XRP && $2 == ws* ]]; then
+        echo "WebSocket API connections are tested by the node"
     elif [[ $1 == XRP ]]; then
         if [[ $(curl -sH 'Content-Type: application/json' -d '{"method":"server_info","params":[{}]}' -u $3:$4 $2 | jq .result.info.build_version) == "" ]]; then
             echo "Invalid XRP API"
             exit;
         fi
+    else
+        if [[ $(curl -sd '{"jsonrpc": "1.0", "id": "curltest", "method": "getblockcount", "params": []}' -u $3:$4 $2 | jq .result) == "" ]]; then
+            echo "Invalid $1 API"
+            exit;
+        fi
     fi
 }
 
@@ -38,8 +52,9 @@ do
         CURR_API=$(remove_quotes $(echo $CHAIN_APIs | jq .[$i].api))
         CURR_U=$(remove_quotes $(echo $CHAIN_APIs | jq .[$i].u))
         CURR_P=$(remove_quotes $(echo $CHAIN_APIs | jq .[$i].p))
+        CURR_T=$(remove_quotes $(echo $CHAIN_APIs | jq .[$i].type))
         echo "Testing API: " $CURR_API
-        test_api $CURR_CHAIN $CURR_API $CURR_U $CURR_P
+        test_api $CURR_CHAIN $CURR_API $CURR_U $CURR_P $CURR_T
         if [[ $i -eq 0 ]]; then
             declare ${CURR_CHAIN}_APIs=$CURR_API
         else
@@ -53,6 +68,9 @@ do
         declare ${CURR_CHAIN}_P_$CURR_API_CHECKSUM=$CURR_P
         export ${CURR_AUTH_U_EXPORT}=${!CURR_AUTH_U_EXPORT}
         export ${CURR_AUTH_P_EXPORT}=${!CURR_AUTH_P_EXPORT}
+        if [[ $CURR_T != null ]]; then
+            export ${CURR_CHAIN}_T_$CURR_API_CHECKSUM=$CURR_T
+        fi
     done
     export ${CURR_API_EXPORT}=${!CURR_API_EXPORT}
 done
@@ -32,19 +32,75 @@ fi
 echo "Applying Flare-specific changes to Coreth..."
 chmod -R 775 $coreth_path
 cp $AVALANCHE_PATH/scripts/coreth_changes/vm.go $coreth_path/plugin/evm/vm.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/health.go $coreth_path/plugin/evm/health.go
 cp $AVALANCHE_PATH/scripts/coreth_changes/import_tx.go $coreth_path/plugin/evm/import_tx.go
 rm $coreth_path/plugin/evm/import_tx_test.go
 cp $AVALANCHE_PATH/scripts/coreth_changes/export_tx.go $coreth_path/plugin/evm/export_tx.go
 rm $coreth_path/plugin/evm/export_tx_test.go
 cp $AVALANCHE_PATH/scripts/coreth_changes/state_transition.go $coreth_path/core/state_transition.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_transition_test.go $coreth_path/core/state_transition_test.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_preverify.go $coreth_path/core/state_connector_preverify.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_outcomes.go $coreth_path/core/state_connector_outcomes.go
 cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector.go $coreth_path/core/state_connector.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_test.go $coreth_path/core/state_connector_test.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_balance.go $coreth_path/core/state_connector_balance.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_nonpayment.go $coreth_path/core/state_connector_nonpayment.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_evm.go $coreth_path/core/state_connector_evm.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_stellar.go $coreth_path/core/state_connector_stellar.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_utxo.go $coreth_path/core/state_connector_utxo.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_esplora.go $coreth_path/core/state_connector_esplora.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_xrp_websocket.go $coreth_path/core/state_connector_xrp_websocket.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_hash.go $coreth_path/core/state_connector_hash.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_txpool.go $coreth_path/core/state_connector_txpool.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_txpool_test.go $coreth_path/core/state_connector_txpool_test.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_audit.go $coreth_path/core/state_connector_audit.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_audit_test.go $coreth_path/core/state_connector_audit_test.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_archive.go $coreth_path/core/state_connector_archive.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_archive_test.go $coreth_path/core/state_connector_archive_test.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_monitor.go $coreth_path/core/state_connector_monitor.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/state_connector_monitor_test.go $coreth_path/core/state_connector_monitor_test.go
+# Apply the admission control of state connector transactions once the tx pool has validated
+# them, charge it as they enter the pending set, and exempt the transactions it reinjects
+# after a reorg
+if ! grep -q ValidateStateConnectorTx $coreth_path/core/tx_pool.go; then
+    patch -p1 -d $coreth_path < $AVALANCHE_PATH/scripts/coreth_changes/tx_pool.patch
+fi
+cp $AVALANCHE_PATH/scripts/coreth_changes/system_contracts.go $coreth_path/core/system_contracts.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/system_contract_bindings.go $coreth_path/core/system_contract_bindings.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/system_contracts_test.go $coreth_path/core/system_contracts_test.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/upgrade_schedule.go $coreth_path/core/upgrade_schedule.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/upgrade_schedule_test.go $coreth_path/core/upgrade_schedule_test.go
+mkdir -p $coreth_path/core/testdata
+cp $AVALANCHE_PATH/genesis/genesis_testnet.go $coreth_path/core/testdata/genesis_testnet.go
 cp $AVALANCHE_PATH/scripts/coreth_changes/keeper.go $coreth_path/core/keeper.go
 cp $AVALANCHE_PATH/scripts/coreth_changes/keeper_test.go $coreth_path/core/keeper_test.go
+mkdir -p $coreth_path/cmd/flare-verify
+cp $AVALANCHE_PATH/scripts/coreth_changes/flare_verify.go $coreth_path/cmd/flare-verify/main.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/flare_verify_test.go $coreth_path/cmd/flare-verify/main_test.go
+mkdir -p $coreth_path/cmd/flare-audit
+cp $AVALANCHE_PATH/scripts/coreth_changes/flare_audit.go $coreth_path/cmd/flare-audit/main.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/flare_audit_test.go $coreth_path/cmd/flare-audit/main_test.go
+mkdir -p $coreth_path/cmd/flare-backtest
+cp $AVALANCHE_PATH/scripts/coreth_changes/flare_backtest.go $coreth_path/cmd/flare-backtest/main.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/flare_backtest_test.go $coreth_path/cmd/flare-backtest/main_test.go
+mkdir -p $coreth_path/stateconnector/testdata
+cp $AVALANCHE_PATH/scripts/coreth_changes/stateconnector_hash.go $coreth_path/stateconnector/hash.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/stateconnector_client.go $coreth_path/stateconnector/client.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/stateconnector_client_test.go $coreth_path/stateconnector/client_test.go
+cp $AVALANCHE_PATH/scripts/coreth_changes/StateConnector.json $coreth_path/stateconnector/testdata/StateConnector.json
 
 # Build Coreth
 echo "Building Coreth @ ${coreth_version} ..."
 cd "$coreth_path"
+echo "Checking the system contract bindings against the genesis ..."
+go test -run TestSystemContractBindingsMatchGenesis ./core
 go build -ldflags "-X github.com/ava-labs/coreth/plugin/evm.Version=$coreth_version $static_ld_flags" -o "$evm_path" "plugin/"*.go
+echo "Building flare-verify ..."
+go build -o "$AVALANCHE_PATH/build/flare-verify" ./cmd/flare-verify
+echo "Building flare-audit ..."
+go build -o "$AVALANCHE_PATH/build/flare-audit" ./cmd/flare-audit
+echo "Building flare-backtest ..."
+go build -o "$AVALANCHE_PATH/build/flare-backtest" ./cmd/flare-backtest
 cd "$AVALANCHE_PATH"
 
 # Building coreth + using go get can mess with the go.mod file.
@@ -0,0 +1,246 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+// Command bindings generates the Go bindings through which the node calls the contracts that
+// the genesis installs. It reads contract artifacts holding an "abi" and the "functionHashes"
+// computed by solc, and writes one file of package core:
+//
+//	go run src/bindings/main.go -out src/stateco/system_contract_bindings.go \
+//		bin/src/stateco/StateConnector.json src/bindings/abi/FlareKeeper.json src/bindings/abi/PriceSubmitter.json \
+//		src/bindings/abi/StateConnectorProofs.json
+//
+// The sources of the keeper and of the price submitter are not part of this repository, so
+// src/bindings/abi holds the functions of theirs that have been identified in the genesis
+// bytecode. The tests of package core check every bound selector against that bytecode.
+// src/bindings/abi/StateConnectorProofs.json holds the proof functions that an upgrade of the
+// state connector contract installs, which the genesis bytecode does not have yet.
+//
+// abigen is not used because its bindings call contracts through a bind.ContractBackend, while
+// the node calls system contracts from within the state transition, through the EVM of the
+// block. That would leave the abi.ABI packer, which is parsed from JSON when the node starts and
+// unpacks return data into interface{} values that consensus code would have to type assert.
+// The generated bindings instead pack and unpack each function with its Go types, and mark
+// return data that is short or out of range for its type as failed, so that a misbehaving
+// contract cannot panic the node. Packing returns an error for arguments that do not fit their
+// type, such as a negative uint256. The stateconnector client, which runs outside consensus,
+// keeps using accounts/abi.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+type abiParam struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type abiEntry struct {
+	Type            string     `json:"type"`
+	Name            string     `json:"name"`
+	StateMutability string     `json:"stateMutability"`
+	Inputs          []abiParam `json:"inputs"`
+	Outputs         []abiParam `json:"outputs"`
+}
+
+type artifact struct {
+	ContractName   string            `json:"contractName"`
+	ABI            []abiEntry        `json:"abi"`
+	FunctionHashes map[string]string `json:"functionHashes"`
+}
+
+// How a Solidity type is held in Go, packed into an argument and read from return data
+type goType struct {
+	name   string
+	pack   string
+	unpack string
+	static bool
+}
+
+func lookupType(solidityType string) (goType, error) {
+	switch solidityType {
+	case "uint64":
+		return goType{"uint64", "abiUint(%s)", "d.readUint(%d, 64)", true}, nil
+	case "uint8", "uint16", "uint32":
+		bits := strings.TrimPrefix(solidityType, "uint")
+		return goType{solidityType, "abiUint(uint64(%s))", solidityType + "(d.readUint(%d, " + bits + "))", true}, nil
+	case "uint256":
+		return goType{"*big.Int", "abiBig(%s)", "d.readBig(%d)", true}, nil
+	case "bool":
+		return goType{"bool", "abiBool(%s)", "d.readBool(%d)", true}, nil
+	case "address":
+		return goType{"common.Address", "abiAddress(%s)", "d.readAddress(%d)", true}, nil
+	case "bytes32":
+		return goType{"[32]byte", "abiBytes32(%s)", "d.readBytes32(%d)", true}, nil
+	case "string":
+		return goType{"string", "abiString(%s)", "d.readString(%d)", false}, nil
+	case "uint256[]":
+		return goType{"[]*big.Int", "abiBigArray(%s)", "d.readBigArray(%d)", false}, nil
+	case "bytes32[]":
+		return goType{"[][32]byte", "abiBytes32Array(%s)", "d.readBytes32Array(%d)", false}, nil
+	case "address[]":
+		return goType{"[]common.Address", "abiAddressArray(%s)", "d.readAddressArray(%d)", false}, nil
+	}
+	return goType{}, fmt.Errorf("unsupported type %s", solidityType)
+}
+
+func exported(name string) string {
+	name = strings.TrimLeft(name, "_")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func paramName(name string, i int) string {
+	name = strings.TrimLeft(name, "_")
+	if name == "" {
+		return fmt.Sprintf("arg%d", i)
+	}
+	if token.IsKeyword(name) {
+		return name + "_"
+	}
+	return name
+}
+
+func signature(entry abiEntry) string {
+	types := make([]string, len(entry.Inputs))
+	for i, input := range entry.Inputs {
+		types[i] = input.Type
+	}
+	return entry.Name + "(" + strings.Join(types, ",") + ")"
+}
+
+func comment(entry abiEntry) string {
+	if len(entry.Outputs) == 0 {
+		return signature(entry)
+	}
+	outputs := make([]string, len(entry.Outputs))
+	for i, output := range entry.Outputs {
+		outputs[i] = strings.TrimSpace(output.Type + " " + output.Name)
+	}
+	return signature(entry) + " returns (" + strings.Join(outputs, ", ") + ")"
+}
+
+func generateFunction(w *bytes.Buffer, contract string, entry abiEntry, hash string) error {
+	method := contract + exported(entry.Name)
+	selector := make([]string, 4)
+	for i := range selector {
+		selector[i] = "0x" + hash[2*i:2*i+2]
+	}
+	fmt.Fprintf(w, "// %s\nvar %s = ABIMethod{Signature: %q, Selector: [4]byte{%s}}\n\n", comment(entry), method, signature(entry), strings.Join(selector, ", "))
+
+	params := make([]string, len(entry.Inputs))
+	args := []string{method}
+	for i, input := range entry.Inputs {
+		t, err := lookupType(input.Type)
+		if err != nil {
+			return fmt.Errorf("%s: %v", signature(entry), err)
+		}
+		name := paramName(input.Name, i)
+		params[i] = name + " " + t.name
+		args = append(args, fmt.Sprintf(t.pack, name))
+	}
+	fmt.Fprintf(w, "func Pack%s(%s) ([]byte, error) {\n\treturn abiPack(%s)\n}\n\n", method, strings.Join(params, ", "), strings.Join(args, ", "))
+
+	if len(entry.Outputs) == 0 {
+		return nil
+	}
+	static := true
+	reads := make([]string, len(entry.Outputs))
+	types := make([]goType, len(entry.Outputs))
+	for i, output := range entry.Outputs {
+		t, err := lookupType(output.Type)
+		if err != nil {
+			return fmt.Errorf("%s: %v", signature(entry), err)
+		}
+		static = static && t.static
+		reads[i] = fmt.Sprintf(t.unpack, i)
+		types[i] = t
+	}
+	if len(entry.Outputs) == 1 {
+		fmt.Fprintf(w, "func Unpack%s(data []byte) (%s, bool) {\n\td := abiDecoder{data: data}\n\tvalue := %s\n\treturn value, d.end(1, %t)\n}\n\n", method, types[0].name, reads[0], static)
+		return nil
+	}
+	fmt.Fprintf(w, "type %sOutput struct {\n", method)
+	for i, output := range entry.Outputs {
+		fmt.Fprintf(w, "\t%s %s\n", exported(paramName(output.Name, i)), types[i].name)
+	}
+	fmt.Fprintf(w, "}\n\nfunc Unpack%s(data []byte) (%sOutput, bool) {\n\td := abiDecoder{data: data}\n\tvar out %sOutput\n", method, method, method)
+	for i, output := range entry.Outputs {
+		fmt.Fprintf(w, "\tout.%s = %s\n", exported(paramName(output.Name, i)), reads[i])
+	}
+	fmt.Fprintf(w, "\treturn out, d.end(%d, %t)\n}\n\n", len(entry.Outputs), static)
+	return nil
+}
+
+func generateContract(w *bytes.Buffer, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var a artifact
+	if err := json.Unmarshal(data, &a); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if a.ContractName == "" {
+		return fmt.Errorf("%s: no contractName", path)
+	}
+	var functions []abiEntry
+	for _, entry := range a.ABI {
+		if entry.Type == "function" {
+			functions = append(functions, entry)
+		}
+	}
+	sort.Slice(functions, func(i, j int) bool { return functions[i].Name < functions[j].Name })
+
+	fmt.Fprintf(w, "// Bindings of %s, generated from %s\n\n", a.ContractName, path)
+	methods := make([]string, len(functions))
+	for i, entry := range functions {
+		methods[i] = a.ContractName + exported(entry.Name)
+	}
+	fmt.Fprintf(w, "// The functions of %s that have bindings\nvar %sMethods = []ABIMethod{\n\t%s,\n}\n\n", a.ContractName, a.ContractName, strings.Join(methods, ",\n\t"))
+	for _, entry := range functions {
+		hash, ok := a.FunctionHashes[signature(entry)]
+		if !ok || len(hash) != 8 {
+			return fmt.Errorf("%s: no function hash for %s", path, signature(entry))
+		}
+		if err := generateFunction(w, a.ContractName, entry, hash); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func main() {
+	out := flag.String("out", "", "path of the generated Go file")
+	flag.Parse()
+	if *out == "" || flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: bindings -out <file.go> <artifact.json>...")
+		os.Exit(2)
+	}
+	var w bytes.Buffer
+	fmt.Fprintf(&w, "// (c) 2021, Flare Networks Limited. All rights reserved.\n// Please see the file LICENSE for licensing terms.\n\n")
+	fmt.Fprintf(&w, "// Code generated by src/bindings. DO NOT EDIT.\n\npackage core\n\n")
+	fmt.Fprintf(&w, "import (\n\t\"math/big\"\n\n\t\"github.com/ethereum/go-ethereum/common\"\n)\n\n")
+	fmt.Fprintf(&w, "// Reference imports to suppress errors if they are not otherwise used\nvar (\n\t_ = big.NewInt\n\t_ = common.Address{}\n)\n\n")
+	for _, path := range flag.Args() {
+		if err := generateContract(&w, path); err != nil {
+			log.Fatal(err)
+		}
+	}
+	source, err := format.Source(w.Bytes())
+	if err != nil {
+		log.Fatalf("formatting generated code: %v", err)
+	}
+	if err := ioutil.WriteFile(*out, source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,14 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package evm
+
+import "github.com/ava-labs/coreth/core"
+
+// HealthCheck fails while the state connector verdicts of this node have
+// recently diverged from those of accepted blocks, which usually means that
+// its chain APIs are stale or unavailable.
+func (vm *VM) HealthCheck() (interface{}, error) {
+	details, err := core.StateConnectorVerdictHealth()
+	return map[string]interface{}{"stateConnector": details}, err
+}
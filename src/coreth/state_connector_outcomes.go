@@ -0,0 +1,46 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"math/big"
+
+	"github.com/ava-labs/coreth/core/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// StateConnectorProofOutcomes returns the outcomes of the proof transactions of an accepted
+// block, for CheckStateConnectorVerdicts. A proof was accepted if the state connector emitted
+// an event for it. Reverted transactions are left out, as the node gave them no verdict.
+func StateConnectorProofOutcomes(bc *BlockChain, block *types.Block, signer types.Signer) []ProofOutcome {
+	blockTime := new(big.Int).SetUint64(block.Time())
+	contract := common.HexToAddress(GetStateConnectorContractAddr(blockTime))
+	var receipts types.Receipts
+	var outcomes []ProofOutcome
+	for i, tx := range block.Transactions() {
+		if tx.To() == nil || *tx.To() != contract || !IsStateConnectorProofSelector(blockTime, tx.Data()) {
+			continue
+		}
+		if receipts == nil {
+			if receipts = bc.GetReceiptsByHash(block.Hash()); len(receipts) != len(block.Transactions()) {
+				return nil
+			}
+		}
+		if receipts[i].Status != types.ReceiptStatusSuccessful {
+			continue
+		}
+		sender, err := types.Sender(signer, tx)
+		if err != nil {
+			continue
+		}
+		outcome := ProofOutcome{Tx: tx.Hash(), Sender: sender, Data: tx.Data()}
+		for _, log := range receipts[i].Logs {
+			if log.Address == contract {
+				outcome.Accepted = true
+			}
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes
+}
@@ -0,0 +1,52 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ava-labs/coreth/core/types"
+	"github.com/ava-labs/coreth/core/vm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PreVerifyStateConnectorTx starts verifying the proof of a transaction to the state connector
+// while it waits in the tx pool, so that its verdict is usually reached by the time a block
+// commits to it. The checkRet of the proof is decoded by a dry run of the call on top of the
+// current block, as TransitionDb would do in the next block. Only an acceptance is reused: a
+// block whose call returns another checkRet, or whose time runs under other upgrade parameters,
+// verifies the proof again, as does any block committing to a proof rejected in advance.
+func PreVerifyStateConnectorTx(bc *BlockChain, signer types.Signer, tx *types.Transaction) bool {
+	blockTime := big.NewInt(time.Now().Unix())
+	if tx.To() == nil || *tx.To() != common.HexToAddress(GetStateConnectorContractAddr(blockTime)) || !IsStateConnectorProofSelector(blockTime, tx.Data()) {
+		return false
+	}
+	if !GetStateConnectorActivated(bc.Config().ChainID, blockTime) {
+		return false
+	}
+	sender, err := types.Sender(signer, tx)
+	if err != nil {
+		return false
+	}
+	head := bc.CurrentBlock()
+	statedb, err := bc.StateAt(head.Root())
+	if err != nil {
+		return false
+	}
+	blockContext := NewEVMBlockContext(head.Header(), bc, nil)
+	blockContext.BlockNumber = new(big.Int).Add(head.Number(), common.Big1)
+	blockContext.Time = blockTime
+	txContext := vm.TxContext{Origin: sender, GasPrice: tx.GasPrice()}
+	evm := vm.NewEVM(blockContext, txContext, statedb, bc.Config(), vm.Config{})
+	stateConnectorGas := tx.Gas() / GetStateConnectorGasDivisor(blockTime)
+	checkRet, _, checkVmerr := evm.Call(vm.AccountRef(sender), *tx.To(), tx.Data(), stateConnectorGas, tx.Value())
+	if checkVmerr != nil {
+		return false
+	}
+	if head, ok := UnpackCheckRetHead(checkRet); !ok || head.ChainId >= GetMaxAllowedChains(blockTime) {
+		return false
+	}
+	return PreVerifyStateConnectorCall(sender, blockContext.BlockNumber, blockTime, tx.Data()[0:4], checkRet)
+}
@@ -36,7 +36,6 @@ package core
 
 import (
 	"bytes"
-	"encoding/binary"
 	"fmt"
 	"math"
 	"math/big"
@@ -356,6 +355,11 @@ func (st *StateTransition) TransitionDb() (*ExecutionResult, error) {
 		selectProveDataAvailabilityPeriodFinality bool
 		selectProvePaymentFinality                bool
 		selectDisprovePaymentFinality             bool
+		selectProvePaymentReferenceFinality       bool
+		selectProvePaymentSourceFinality          bool
+		selectProvePaymentTimestampFinality       bool
+		selectProveBalanceFinality                bool
+		selectProveNonPaymentFinality             bool
 		prioritisedFTSOContract                   bool
 	)
 
@@ -373,20 +377,39 @@ func (st *StateTransition) TransitionDb() (*ExecutionResult, error) {
 			selectProveDataAvailabilityPeriodFinality = bytes.Equal(st.data[0:4], GetProveDataAvailabilityPeriodFinalitySelector(st.evm.Context.Time))
 			selectProvePaymentFinality = bytes.Equal(st.data[0:4], GetProvePaymentFinalitySelector(st.evm.Context.Time))
 			selectDisprovePaymentFinality = bytes.Equal(st.data[0:4], GetDisprovePaymentFinalitySelector(st.evm.Context.Time))
+			selectProvePaymentReferenceFinality = bytes.Equal(st.data[0:4], GetProvePaymentReferenceFinalitySelector(st.evm.Context.Time))
+			selectProvePaymentSourceFinality = bytes.Equal(st.data[0:4], GetProvePaymentSourceFinalitySelector(st.evm.Context.Time))
+			selectProvePaymentTimestampFinality = bytes.Equal(st.data[0:4], GetProvePaymentTimestampFinalitySelector(st.evm.Context.Time))
+			selectProveBalanceFinality = bytes.Equal(st.data[0:4], GetProveBalanceFinalitySelector(st.evm.Context.Time))
+			selectProveNonPaymentFinality = bytes.Equal(st.data[0:4], GetProveNonPaymentFinalitySelector(st.evm.Context.Time))
 		} else {
 			prioritisedFTSOContract = *msg.To() == common.HexToAddress(GetPrioritisedFTSOContract(st.evm.Context.Time))
 		}
 	}
 
-	if selectProveDataAvailabilityPeriodFinality || selectProvePaymentFinality || selectDisprovePaymentFinality {
+	if selectProveDataAvailabilityPeriodFinality || selectProvePaymentFinality || selectDisprovePaymentFinality || selectProvePaymentReferenceFinality || selectProvePaymentSourceFinality || selectProvePaymentTimestampFinality || selectProveBalanceFinality || selectProveNonPaymentFinality {
 		// Increment the nonce for the next transaction
 		st.state.SetNonce(msg.From(), st.state.GetNonce(sender.Address())+1)
 		stateConnectorGas := st.gas / GetStateConnectorGasDivisor(st.evm.Context.Time)
 		checkRet, _, checkVmerr := st.evm.Call(sender, st.to(), st.data, stateConnectorGas, st.value)
 		if checkVmerr == nil {
 			chainConfig := st.evm.ChainConfig()
-			if GetStateConnectorActivated(chainConfig.ChainID, st.evm.Context.Time) && binary.BigEndian.Uint32(checkRet[28:32]) < GetMaxAllowedChains(st.evm.Context.Time) {
-				if StateConnectorCall(msg.From(), st.evm.Context.Time, st.data[0:4], checkRet) {
+			head, decoded := UnpackCheckRetHead(checkRet)
+			if GetStateConnectorActivated(chainConfig.ChainID, st.evm.Context.Time) && decoded && head.ChainId < GetMaxAllowedChains(st.evm.Context.Time) {
+				var verified bool
+				if msg.IsFake() {
+					// Simulated calls have no side effects and do not wait for chain APIs
+					verified = GetSimulatedProofVerdict()
+				} else {
+					verified = StateConnectorCall(msg.From(), st.evm.Context.BlockNumber, st.evm.Context.Time, st.data[0:4], checkRet)
+					// The state processor sets the hash of the block it executes on the state
+					var blockHash common.Hash
+					if blockState, ok := st.state.(interface{ BlockHash() common.Hash }); ok {
+						blockHash = blockState.BlockHash()
+					}
+					RecordStateConnectorVerdict(st.evm.Context.BlockNumber, blockHash, msg.From(), st.data, checkRet, verified)
+				}
+				if verified {
 					originalCoinbase := st.evm.Context.Coinbase
 					defer func() {
 						st.evm.Context.Coinbase = originalCoinbase
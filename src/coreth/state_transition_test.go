@@ -0,0 +1,178 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ava-labs/coreth/core/rawdb"
+	"github.com/ava-labs/coreth/core/state"
+	"github.com/ava-labs/coreth/core/types"
+	"github.com/ava-labs/coreth/core/vm"
+	"github.com/ava-labs/coreth/params"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	genesisCoinbaseAddr              = common.HexToAddress("0x0100000000000000000000000000000000000000")
+	proofSender                      = common.HexToAddress("0xffC11262622D5069aBad729efF56e5Aa4e9B9c44")
+	proofGasPrice                    = big.NewInt(225000000000)
+	proofBlockGas                    = uint64(8000000)
+	songbirdStateConnectorActivation = uint64(1636070400)
+)
+
+// A state connector that stores block.coinbase in slot 0 and returns a checkRet for a proof on
+// chain 3 whose finalisedLedgerIndex is 0, so that its verification is read from the cache
+const stateConnectorTestCode = "41600055600360005260806000f3"
+
+type proofMessage struct {
+	from common.Address
+	to   *common.Address
+	data []byte
+	fake bool
+}
+
+func (m proofMessage) From() common.Address         { return m.from }
+func (m proofMessage) To() *common.Address          { return m.to }
+func (m proofMessage) GasPrice() *big.Int           { return proofGasPrice }
+func (m proofMessage) GasFeeCap() *big.Int          { return proofGasPrice }
+func (m proofMessage) GasTipCap() *big.Int          { return proofGasPrice }
+func (m proofMessage) Gas() uint64                  { return 1000000 }
+func (m proofMessage) Value() *big.Int              { return new(big.Int) }
+func (m proofMessage) Nonce() uint64                { return 0 }
+func (m proofMessage) IsFake() bool                 { return m.fake }
+func (m proofMessage) Data() []byte                 { return m.data }
+func (m proofMessage) AccessList() types.AccessList { return nil }
+
+// Applies a proveDataAvailabilityPeriodFinality transaction, returning the block.coinbase seen
+// by the state connector. The proof of a transaction has already been verified by the node,
+// while fake messages find no verification in the cache.
+func applyProof(t *testing.T, chainID int64, blockTime uint64, fake bool) common.Address {
+	var config params.ChainConfig
+	if err := json.Unmarshal([]byte(fmt.Sprintf(`{
+		"chainId": %d, "homesteadBlock": 0, "eip150Block": 0, "eip155Block": 0, "eip158Block": 0,
+		"byzantiumBlock": 0, "constantinopleBlock": 0, "petersburgBlock": 0, "istanbulBlock": 0,
+		"muirGlacierBlock": 0, "apricotPhase1BlockTimestamp": 0, "apricotPhase2BlockTimestamp": 0
+	}`, chainID)), &config); err != nil {
+		t.Fatal(err)
+	}
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time := new(big.Int).SetUint64(blockTime)
+	stateConnector := common.HexToAddress(GetStateConnectorContractAddr(time))
+	statedb.SetCode(stateConnector, common.Hex2Bytes(stateConnectorTestCode))
+	statedb.AddBalance(proofSender, new(big.Int).Mul(proofGasPrice, big.NewInt(10000000)))
+
+	selector := GetProveDataAvailabilityPeriodFinalitySelector(time)
+	checkRet := make([]byte, 128)
+	checkRet[31] = 3
+	if !fake {
+		acceptedPath, _ := GetVerificationPaths(selector, checkRet)
+		if err := os.MkdirAll("cache", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(acceptedPath, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blockContext := vm.BlockContext{
+		CanTransfer: CanTransfer,
+		Transfer:    Transfer,
+		Coinbase:    genesisCoinbaseAddr,
+		GasLimit:    proofBlockGas,
+		BlockNumber: big.NewInt(1),
+		Time:        time,
+		Difficulty:  big.NewInt(1),
+	}
+	evm := vm.NewEVM(blockContext, vm.TxContext{Origin: proofSender, GasPrice: proofGasPrice}, statedb, &config, vm.Config{})
+	msg := proofMessage{from: proofSender, to: &stateConnector, data: selector, fake: fake}
+	result, err := ApplyMessage(evm, msg, new(GasPool).AddGas(proofBlockGas))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failed() {
+		t.Fatalf("state connector call failed: %v", result.Err)
+	}
+	return common.BytesToAddress(statedb.GetState(stateConnector, common.Hash{}).Bytes())
+}
+
+// Runs a test in an empty working directory, where the node keeps its verification cache
+func inTempDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "state-connector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestTransitionDbStateConnectorActivation(t *testing.T) {
+	defer inTempDir(t)()
+
+	tests := []struct {
+		name      string
+		chainID   int64
+		blockTime uint64
+		coinbase  common.Address
+	}{
+		// Before activation proofs are not checked, and the state connector cannot finalise them
+		{"songbird before activation", 19, songbirdStateConnectorActivation - 1, genesisCoinbaseAddr},
+		// Once active, a verified proof is finalised by the sender
+		{"songbird at activation", 19, songbirdStateConnectorActivation, proofSender},
+		{"songbird after activation", 19, songbirdStateConnectorActivation + 3600, proofSender},
+		{"local", 16, 0, proofSender},
+		{"scdev", 20210406, songbirdStateConnectorActivation, genesisCoinbaseAddr},
+	}
+	for _, test := range tests {
+		if coinbase := applyProof(t, test.chainID, test.blockTime, false); coinbase != test.coinbase {
+			t.Errorf("%s: state connector saw block.coinbase %s, want %s", test.name, coinbase.Hex(), test.coinbase.Hex())
+		}
+	}
+}
+
+func TestTransitionDbSimulatedProof(t *testing.T) {
+	defer inTempDir(t)()
+	defer os.Unsetenv("SIMULATED_PROOF_VERDICT")
+
+	tests := []struct {
+		verdict  string
+		coinbase common.Address
+	}{
+		{"", genesisCoinbaseAddr},
+		{"rejected", genesisCoinbaseAddr},
+		{"accepted", proofSender},
+	}
+	for _, test := range tests {
+		os.Setenv("SIMULATED_PROOF_VERDICT", test.verdict)
+		start := time.Now()
+		if coinbase := applyProof(t, 16, 0, true); coinbase != test.coinbase {
+			t.Errorf("verdict %q: state connector saw block.coinbase %s, want %s", test.verdict, coinbase.Hex(), test.coinbase.Hex())
+		}
+		// Without a simulated verdict the node would wait for the proof to appear in the cache
+		if elapsed := time.Since(start); elapsed >= apiRetryDelay {
+			t.Errorf("verdict %q: simulated call took %s", test.verdict, elapsed)
+		}
+	}
+	if _, err := os.Stat("cache"); !os.IsNotExist(err) {
+		t.Errorf("simulated calls wrote to the verification cache")
+	}
+}
@@ -103,6 +103,11 @@ const (
 	decidedCacheSize    = 100
 	missingCacheSize    = 50
 	unverifiedCacheSize = 50
+
+	// Buffer of the transactions entering the tx pool that are checked for state connector proofs
+	preVerifyTxsChanSize = 1024
+	// Buffer of the accepted blocks whose state connector proofs are checked against the verdicts of the node
+	acceptedBlocksChanSize = 64
 )
 
 var (
@@ -351,6 +356,22 @@ func (vm *VM) Initialize(
 
 	vm.chainID = g.Config.ChainID
 
+	// Select and validate the state connector and keeper upgrade schedule of this network
+	if err := core.SetUpgradeSchedule(g.Config.ChainID); err != nil {
+		return err
+	}
+
+	// Define the UTXO chains listed in the file at UTXO_CHAINS, and refuse to start without the
+	// definition of a chain the schedule allows
+	if err := core.LoadUTXOChainsFromEnv(); err != nil {
+		return fmt.Errorf("failed to load UTXO chains: %w", err)
+	}
+
+	// Record or replay the responses of chain APIs to proofs if CHAIN_API_ARCHIVE is set
+	if err := core.ArchiveChainAPIsFromEnv(); err != nil {
+		return fmt.Errorf("failed to open chain API archive: %w", err)
+	}
+
 	ethConfig := ethconfig.NewDefaultConfig()
 	ethConfig.Genesis = g
 
@@ -435,6 +456,12 @@ func (vm *VM) Initialize(
 	vm.shutdownWg.Add(1)
 	go vm.ctx.Log.RecoverAndPanic(vm.awaitSubmittedTxs)
 
+	vm.shutdownWg.Add(1)
+	go vm.ctx.Log.RecoverAndPanic(vm.preVerifyStateConnectorTxs)
+
+	vm.shutdownWg.Add(1)
+	go vm.ctx.Log.RecoverAndPanic(vm.monitorStateConnectorVerdicts)
+
 	go vm.ctx.Log.RecoverAndPanic(vm.startContinuousProfiler)
 
 	// The Codec explicitly registers the types it requires from the secp256k1fx
@@ -969,6 +996,51 @@ func (vm *VM) awaitSubmittedTxs() {
 	}
 }
 
+// preVerifyStateConnectorTxs starts verifying the proofs of state connector
+// transactions as they enter the tx pool, rather than when a block executes them.
+func (vm *VM) preVerifyStateConnectorTxs() {
+	defer vm.shutdownWg.Done()
+	txsCh := make(chan core.NewTxsEvent, preVerifyTxsChanSize)
+	txsSub := vm.chain.GetTxPool().SubscribeNewTxsEvent(txsCh)
+	defer txsSub.Unsubscribe()
+	signer := types.LatestSigner(vm.chainConfig)
+	for {
+		select {
+		case event := <-txsCh:
+			for _, tx := range event.Txs {
+				if core.PreVerifyStateConnectorTx(vm.chain.BlockChain(), signer, tx) {
+					log.Debug("Verifying state connector proof in advance", "tx", tx.Hash())
+				}
+			}
+		case <-txsSub.Err():
+			return
+		case <-vm.shutdownChan:
+			return
+		}
+	}
+}
+
+// monitorStateConnectorVerdicts compares the verdicts of this node on state
+// connector proofs with their outcome in each accepted block.
+func (vm *VM) monitorStateConnectorVerdicts() {
+	defer vm.shutdownWg.Done()
+	acceptedCh := make(chan core.ChainEvent, acceptedBlocksChanSize)
+	acceptedSub := vm.chain.BlockChain().SubscribeChainAcceptedEvent(acceptedCh)
+	defer acceptedSub.Unsubscribe()
+	signer := types.LatestSigner(vm.chainConfig)
+	for {
+		select {
+		case event := <-acceptedCh:
+			outcomes := core.StateConnectorProofOutcomes(vm.chain.BlockChain(), event.Block, signer)
+			core.CheckStateConnectorVerdicts(event.Block.Number(), event.Block.Hash(), outcomes)
+		case <-acceptedSub.Err():
+			return
+		case <-vm.shutdownChan:
+			return
+		}
+	}
+}
+
 // ParseAddress takes in an address and produces the ID of the chain it's for
 // the ID of the address
 func (vm *VM) ParseAddress(addrStr string) (ids.ID, ids.ShortID, error) {
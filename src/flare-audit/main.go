@@ -0,0 +1,103 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+// flare-audit searches the audit log that a node writes to STATE_CONNECTOR_AUDIT_LOG, and the
+// files rotated from it, for the decisions on a proof. It prints every matching record.
+//
+//	flare-audit -log audit/state_connector.jsonl -txid <tx hash>
+//	flare-audit -log audit/state_connector.jsonl -hash <verification hash>
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ava-labs/coreth/core"
+)
+
+// Returns the files of an audit log from the oldest to the current one. Rotated files carry
+// the time of their rotation after the path of the log, so they sort in order.
+func LogFiles(path string) ([]string, error) {
+	rotated, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(rotated)
+	if _, err := os.Stat(path); err == nil {
+		rotated = append(rotated, path)
+	}
+	return rotated, nil
+}
+
+// Writes the records of the log files that match a txId or a verification hash, returning how
+// many matched
+func Search(files []string, txId string, verificationHash string, w io.Writer) (int, error) {
+	verificationHash = strings.ToLower(strings.TrimPrefix(verificationHash, "0x"))
+	matches := 0
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			return matches, err
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var record core.AuditRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				file.Close()
+				return matches, fmt.Errorf("%s: %v", path, err)
+			}
+			if (txId != "" && strings.EqualFold(record.TxId, txId)) || (verificationHash != "" && record.VerificationHash == verificationHash) {
+				fmt.Fprintf(w, "%s\n", scanner.Bytes())
+				matches++
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return matches, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return matches, nil
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(2)
+}
+
+func main() {
+	logPath := flag.String("log", os.Getenv("STATE_CONNECTOR_AUDIT_LOG"), "path of the audit log")
+	txId := flag.String("txid", "", "txId, address or non-payment filter string of the proof")
+	verificationHash := flag.String("hash", "", "verification hash of the proof, as in the names of cache files")
+	flag.Parse()
+
+	if *logPath == "" {
+		fail("-log is required")
+	}
+	if *txId == "" && *verificationHash == "" {
+		fail("-txid or -hash is required")
+	}
+	files, err := LogFiles(*logPath)
+	if err != nil {
+		fail("listing %s: %v", *logPath, err)
+	}
+	if len(files) == 0 {
+		fail("no audit log at %s", *logPath)
+	}
+	matches, err := Search(files, *txId, *verificationHash, os.Stdout)
+	if err != nil {
+		fail("%v", err)
+	}
+	if matches == 0 {
+		fmt.Fprintln(os.Stderr, "No matching records")
+		os.Exit(1)
+	}
+}
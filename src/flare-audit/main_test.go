@@ -0,0 +1,71 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ava-labs/coreth/core"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func auditLine(t *testing.T, event string, checkRet []byte) string {
+	record := core.NewAuditRecord(event, common.Address{}, big.NewInt(1), big.NewInt(0), core.GetProvePaymentFinalitySelector(big.NewInt(0)), checkRet)
+	line, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(line) + "\n"
+}
+
+func TestSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flare-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A payment proof whose txId is E0E5FD8D, and a data availability proof
+	payment := make([]byte, 224)
+	payment[31] = 3
+	payment[159] = 160
+	payment[191] = 8
+	copy(payment[192:], "E0E5FD8D")
+	availability := make([]byte, 128)
+	availability[31] = 3
+	availability[63] = 1
+
+	path := filepath.Join(dir, "state_connector.jsonl")
+	ioutil.WriteFile(path+".20211105T000000.000000000Z", []byte(auditLine(t, core.AuditCommit, payment)+auditLine(t, core.AuditVerification, availability)), 0644)
+	ioutil.WriteFile(path, []byte(auditLine(t, core.AuditReveal, payment)), 0644)
+	files, err := LogFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[1] != path {
+		t.Fatalf("got files %v", files)
+	}
+
+	var out bytes.Buffer
+	if matches, err := Search(files, "e0e5fd8d", "", &out); err != nil || matches != 2 {
+		t.Fatalf("got %d matches, %v", matches, err)
+	}
+	// Records are printed from the oldest
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !strings.Contains(lines[0], `"event":"commit"`) || !strings.Contains(lines[1], `"event":"reveal"`) {
+		t.Errorf("unexpected output %s", out.String())
+	}
+
+	out.Reset()
+	if matches, err := Search(files, "", "0x"+core.GetVerificationHash(availability), &out); err != nil || matches != 1 || !strings.Contains(out.String(), `"event":"verification"`) {
+		t.Errorf("got %d matches, %v: %s", matches, err, out.String())
+	}
+}
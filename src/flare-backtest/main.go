@@ -0,0 +1,336 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+// flare-backtest replays the state connector proofs of a range of blocks against the current
+// verifier, to check that an upgrade of the verifier reaches the verdicts the network reached.
+// It reads the blocks from the RPC of an archive node, re-derives the checkRet of each proof
+// from the state before its block, and verifies it against the chain APIs set in the environment
+// by conf/export_chain_apis.sh, live or from responses recorded by flare-verify or a node.
+//
+//	source conf/export_chain_apis.sh conf/local/chain_apis.json
+//	flare-backtest -rpc http://127.0.0.1:9650/ext/bc/C/rpc -from <block> -to <block>
+//	flare-backtest -rpc http://127.0.0.1:9650/ext/bc/C/rpc -from <block> -to <block> -replay <dir>
+//
+// The verdict on a proof is reached when it is committed and applied when it is revealed, so
+// only proofs committed within the range are replayed. Every divergence from the outcome of a
+// reveal on chain is printed, and the command exits with status 1 if there were any.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ava-labs/coreth/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Calls a JSON-RPC method of a node and decodes its result
+type RPC func(method string, params []interface{}, result interface{}) error
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func NodeRPC(url string) RPC {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	return func(method string, params []interface{}, result interface{}) error {
+		payload, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+		if err != nil {
+			return err
+		}
+		resp, err := httpClient.Post(url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		var jsonResp rpcResponse
+		if err := json.Unmarshal(respBody, &jsonResp); err != nil {
+			return fmt.Errorf("%s: %s", method, resp.Status)
+		}
+		if jsonResp.Error != nil {
+			return fmt.Errorf("%s: %s", method, jsonResp.Error.Message)
+		}
+		if string(jsonResp.Result) == "null" {
+			return fmt.Errorf("%s: not found", method)
+		}
+		return json.Unmarshal(jsonResp.Result, result)
+	}
+}
+
+type rpcTransaction struct {
+	Hash  common.Hash     `json:"hash"`
+	From  common.Address  `json:"from"`
+	To    *common.Address `json:"to"`
+	Gas   hexutil.Uint64  `json:"gas"`
+	Value *hexutil.Big    `json:"value"`
+	Input hexutil.Bytes   `json:"input"`
+}
+
+type rpcBlock struct {
+	Number       hexutil.Uint64   `json:"number"`
+	Timestamp    hexutil.Uint64   `json:"timestamp"`
+	Transactions []rpcTransaction `json:"transactions"`
+}
+
+type rpcReceipt struct {
+	Status hexutil.Uint64 `json:"status"`
+	Logs   []struct {
+		Address common.Address `json:"address"`
+	} `json:"logs"`
+}
+
+// A call to a proof function of the state connector, with the checkRet it was verified against
+type Proof struct {
+	Block     uint64
+	BlockTime uint64
+	Tx        common.Hash
+	Sender    common.Address
+	Selector  []byte
+	CheckRet  []byte
+}
+
+func (p *Proof) finalisedLedgerIndex() uint64 {
+	return binary.BigEndian.Uint64(p.CheckRet[88:96])
+}
+
+// Identifies the commit that a reveal applies the verdict of, as the cache of a node does
+func (p *Proof) key() string {
+	return fmt.Sprintf("%x_%s", p.Selector, core.GetVerificationHash(p.CheckRet))
+}
+
+// The outcome of a reveal on chain, and the verdict of the current verifier on its commit. The
+// verdict is empty when the proof could not be replayed, and Reason says why. The checkRet of
+// Reveal is empty when it could not be re-derived, in which case it may also be a commit.
+type Result struct {
+	Reveal  *Proof
+	Commit  *Proof
+	OnChain string
+	Verdict string
+	Reason  string
+}
+
+func (r Result) Diverges() bool {
+	return r.Verdict != "" && r.Verdict != r.OnChain
+}
+
+func (r Result) String() string {
+	if len(r.Reveal.CheckRet) < 128 {
+		return fmt.Sprintf("block %d tx %s: %s on chain, not replayed: %s", r.Reveal.Block, r.Reveal.Tx.Hex(), r.OnChain, r.Reason)
+	}
+	record := core.NewAuditRecord(core.AuditReveal, r.Reveal.Sender, nil, new(big.Int).SetUint64(r.Reveal.BlockTime), r.Reveal.Selector, r.Reveal.CheckRet)
+	proof := fmt.Sprintf("block %d tx %s: chain %d ledger %d", r.Reveal.Block, r.Reveal.Tx.Hex(), record.ChainId, record.Ledger)
+	if record.TxId != "" {
+		proof += " txId " + record.TxId
+	}
+	switch {
+	case r.Verdict == "":
+		return fmt.Sprintf("%s: %s on chain, not replayed: %s", proof, r.OnChain, r.Reason)
+	case r.Diverges():
+		return fmt.Sprintf("%s: %s on chain, %s now (commit in block %d): DIVERGES", proof, r.OnChain, r.Verdict, r.Commit.Block)
+	default:
+		return fmt.Sprintf("%s: %s on chain, %s now (commit in block %d)", proof, r.OnChain, r.Verdict, r.Commit.Block)
+	}
+}
+
+type Summary struct {
+	Proofs      int
+	Reveals     int
+	Replayed    int
+	Divergences int
+	// Proofs whose checkRet could not be re-derived
+	Underived int
+}
+
+type Backtest struct {
+	call RPC
+	// The verifier that proofs are replayed against, ReadChain unless replaced in tests
+	verify  func(sender common.Address, blockTime *big.Int, functionSelector []byte, checkRet []byte) bool
+	commits map[string]*Proof
+}
+
+func NewBacktest(call RPC) *Backtest {
+	return &Backtest{call: call, verify: core.ReadChain, commits: make(map[string]*Proof)}
+}
+
+// Selects the upgrade schedule of the network of the node
+func (b *Backtest) SetUpgradeSchedule() error {
+	var chainID hexutil.Big
+	if err := b.call("eth_chainId", nil, &chainID); err != nil {
+		return err
+	}
+	return core.SetUpgradeSchedule(chainID.ToInt())
+}
+
+// Re-derives the checkRet of a proof by calling the state connector as the node does before
+// verifying it, on the state before its block. The node must not set SIMULATED_PROOF_VERDICT
+// to accepted, which makes the call return the values of a verified proof. The call runs in
+// the context of the block before, so it misses the transactions before the proof in its block
+// and sees the number and time of the block before, and may fail where the proof did not.
+func (b *Backtest) checkRet(block *rpcBlock, tx rpcTransaction) ([]byte, error) {
+	call := map[string]interface{}{
+		"from": tx.From,
+		"to":   tx.To,
+		"gas":  hexutil.Uint64(uint64(tx.Gas) / core.GetStateConnectorGasDivisor(new(big.Int).SetUint64(uint64(block.Timestamp)))),
+		"data": tx.Input,
+	}
+	if tx.Value != nil {
+		call["value"] = tx.Value
+	}
+	var checkRet hexutil.Bytes
+	if err := b.call("eth_call", []interface{}{call, hexutil.EncodeUint64(uint64(block.Number) - 1)}, &checkRet); err != nil {
+		return nil, err
+	}
+	if len(checkRet) < 128 {
+		return nil, fmt.Errorf("the call returned %d bytes", len(checkRet))
+	}
+	return checkRet, nil
+}
+
+// Replays the proofs of blocks from to to, inclusive, reporting in order each reveal and each
+// proof whose checkRet could not be re-derived
+func (b *Backtest) Run(from uint64, to uint64, report func(Result)) (Summary, error) {
+	var summary Summary
+	for number := from; number <= to; number++ {
+		var block rpcBlock
+		if err := b.call("eth_getBlockByNumber", []interface{}{hexutil.EncodeUint64(number), true}, &block); err != nil {
+			return summary, fmt.Errorf("block %d: %v", number, err)
+		}
+		blockTime := new(big.Int).SetUint64(uint64(block.Timestamp))
+		contract := common.HexToAddress(core.GetStateConnectorContractAddr(blockTime))
+		for _, tx := range block.Transactions {
+			if tx.To == nil || *tx.To != contract || !core.IsStateConnectorProofSelector(blockTime, tx.Input) {
+				continue
+			}
+			proof := &Proof{
+				Block:     number,
+				BlockTime: uint64(block.Timestamp),
+				Tx:        tx.Hash,
+				Sender:    tx.From,
+				Selector:  append([]byte{}, tx.Input[0:4]...),
+			}
+			var receipt rpcReceipt
+			if err := b.call("eth_getTransactionReceipt", []interface{}{tx.Hash}, &receipt); err != nil {
+				summary.Proofs++
+				summary.Underived++
+				report(Result{Reveal: proof, OnChain: "unknown", Reason: "no receipt: " + err.Error()})
+				continue
+			}
+			// Reverted proofs are rejected by the contract before they are verified
+			if receipt.Status == 0 {
+				continue
+			}
+			summary.Proofs++
+			// A verified reveal writes to the contract, which emits an event for it
+			result := Result{Reveal: proof, OnChain: core.AuditRejected}
+			for _, log := range receipt.Logs {
+				if log.Address == contract {
+					result.OnChain = core.AuditAccepted
+				}
+			}
+			checkRet, err := b.checkRet(&block, tx)
+			if err != nil {
+				summary.Underived++
+				result.Reason = "checkRet could not be re-derived: " + err.Error()
+				report(result)
+				continue
+			}
+			proof.CheckRet = checkRet
+			if proof.finalisedLedgerIndex() > 0 {
+				b.commits[proof.key()] = proof
+				continue
+			}
+			summary.Reveals++
+			result.Commit = b.commits[proof.key()]
+			if result.Commit == nil {
+				result.Reason = "no commit of the proof in the range"
+			} else {
+				delete(b.commits, proof.key())
+				summary.Replayed++
+				result.Verdict = core.AuditRejected
+				if b.verify(result.Commit.Sender, new(big.Int).SetUint64(result.Commit.BlockTime), result.Commit.Selector, result.Commit.CheckRet) {
+					result.Verdict = core.AuditAccepted
+				}
+				if result.Diverges() {
+					summary.Divergences++
+				}
+			}
+			report(result)
+		}
+	}
+	return summary, nil
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(2)
+}
+
+func printResults(w io.Writer, verbose bool) func(Result) {
+	return func(result Result) {
+		if verbose || result.Verdict == "" || result.Diverges() {
+			fmt.Fprintln(w, result)
+		}
+	}
+}
+
+func main() {
+	rpcURL := flag.String("rpc", "http://127.0.0.1:9650/ext/bc/C/rpc", "RPC endpoint of an archive node")
+	from := flag.Uint64("from", 0, "first block to replay")
+	to := flag.Uint64("to", 0, "last block to replay")
+	replayDir := flag.String("replay", "", "directory of recorded responses to serve in place of the chain APIs")
+	verbose := flag.Bool("v", false, "print every reveal, not only divergences and reveals that were not replayed")
+	flag.Parse()
+
+	if *from == 0 || *to < *from {
+		fail("-from must be at least 1 and -to at least -from")
+	}
+	// Recorded responses are matched by the URL of their request, so replay needs the chain
+	// APIs that they were recorded from
+	if *replayDir != "" {
+		if err := core.ArchiveChainAPIs(*replayDir, core.ChainAPIArchiveReplay); err != nil {
+			fail("replaying from %s: %v", *replayDir, err)
+		}
+	}
+
+	backtest := NewBacktest(NodeRPC(*rpcURL))
+	if err := backtest.SetUpgradeSchedule(); err != nil {
+		fail("%v", err)
+	}
+	// Proofs of the UTXO chains defined by the node are verified with the same definitions
+	if err := core.LoadUTXOChainsFromEnv(); err != nil {
+		fail("loading UTXO chains: %v", err)
+	}
+	summary, err := backtest.Run(*from, *to, printResults(os.Stdout, *verbose))
+	fmt.Printf("%d proofs, %d reveals, %d replayed, %d divergences, %d whose checkRet could not be re-derived\n", summary.Proofs, summary.Reveals, summary.Replayed, summary.Divergences, summary.Underived)
+	if err != nil {
+		fail("%v", err)
+	}
+	if summary.Divergences > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,163 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ava-labs/coreth/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func testCheckRet(ledger uint64, finalised uint64) []byte {
+	checkRet := make([]byte, 128)
+	binary.BigEndian.PutUint32(checkRet[28:32], 3)
+	binary.BigEndian.PutUint64(checkRet[56:64], ledger)
+	binary.BigEndian.PutUint64(checkRet[88:96], finalised)
+	checkRet[127] = byte(ledger)
+	return checkRet
+}
+
+type testTx struct {
+	tx       map[string]interface{}
+	checkRet []byte
+	status   uint64
+	logged   bool
+}
+
+// Serves the blocks of a chain whose proof transactions return checkRet when called on the
+// state before their block
+func newTestNode(t *testing.T, blocks [][]testTx) *httptest.Server {
+	txs := make(map[string]testTx)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		var result interface{}
+		switch req.Method {
+		case "eth_chainId":
+			result = "0x3039"
+		case "eth_getBlockByNumber":
+			var number hexutil.Uint64
+			json.Unmarshal(req.Params[0], &number)
+			var blockTxs []map[string]interface{}
+			for i, tx := range blocks[number-1] {
+				hash := common.BigToHash(big.NewInt(int64(number*100) + int64(i)))
+				tx.tx["hash"] = hash
+				txs[hash.Hex()] = tx
+				blockTxs = append(blockTxs, tx.tx)
+			}
+			result = map[string]interface{}{"number": number, "timestamp": hexutil.Uint64(1000 + number), "transactions": blockTxs}
+		case "eth_getTransactionReceipt":
+			var hash common.Hash
+			json.Unmarshal(req.Params[0], &hash)
+			tx := txs[hash.Hex()]
+			var logs []map[string]interface{}
+			if tx.logged {
+				logs = append(logs, map[string]interface{}{"address": tx.tx["to"]})
+			}
+			result = map[string]interface{}{"status": hexutil.Uint64(tx.status), "logs": logs}
+		case "eth_call":
+			var call struct {
+				Data hexutil.Bytes `json:"data"`
+			}
+			json.Unmarshal(req.Params[0], &call)
+			for _, tx := range txs {
+				if bytes.Equal(tx.tx["input"].(hexutil.Bytes), call.Data) {
+					result = hexutil.Bytes(tx.checkRet)
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result})
+	}))
+}
+
+func TestRun(t *testing.T) {
+	if err := core.SetUpgradeSchedule(big.NewInt(12345)); err != nil {
+		t.Fatal(err)
+	}
+	blockTime := big.NewInt(1000)
+	contract := common.HexToAddress(core.GetStateConnectorContractAddr(blockTime))
+	selector := core.GetProveDataAvailabilityPeriodFinalitySelector(blockTime)
+	sender := common.HexToAddress("0x0100000000000000000000000000000000000000")
+	proofTx := func(data byte, checkRet []byte, status uint64, logged bool) testTx {
+		input := append(append([]byte{}, selector...), data)
+		return testTx{
+			tx:       map[string]interface{}{"from": sender, "to": contract, "gas": hexutil.Uint64(8000000), "input": hexutil.Bytes(input)},
+			checkRet: checkRet,
+			status:   status,
+			logged:   logged,
+		}
+	}
+	other := testTx{tx: map[string]interface{}{"from": sender, "to": sender, "gas": hexutil.Uint64(21000), "input": hexutil.Bytes{}}}
+	node := newTestNode(t, [][]testTx{
+		// Commits of ledgers 1 and 2, and a commit that reverted
+		{proofTx(1, testCheckRet(1, 10), 1, true), other, proofTx(2, testCheckRet(2, 10), 1, true), proofTx(3, testCheckRet(3, 10), 0, false)},
+		// Reveals of ledger 1, accepted, ledger 2, rejected, and ledger 4, committed before the range,
+		// and a proof whose call fails on the state before the block
+		{proofTx(4, testCheckRet(1, 0), 1, true), proofTx(5, testCheckRet(2, 0), 1, false), proofTx(6, testCheckRet(4, 0), 1, true), proofTx(7, nil, 1, true)},
+	})
+	defer node.Close()
+
+	backtest := NewBacktest(NodeRPC(node.URL))
+	// The current verifier accepts both proofs
+	var verified []uint64
+	backtest.verify = func(proofSender common.Address, proofTime *big.Int, functionSelector []byte, checkRet []byte) bool {
+		if proofSender != sender || proofTime.Uint64() != 1001 || !bytes.Equal(functionSelector, selector) {
+			t.Errorf("verified %x from %s at %d", functionSelector, proofSender.Hex(), proofTime)
+		}
+		verified = append(verified, binary.BigEndian.Uint64(checkRet[56:64]))
+		return binary.BigEndian.Uint64(checkRet[88:96]) == 10
+	}
+	if err := backtest.SetUpgradeSchedule(); err != nil {
+		t.Fatal(err)
+	}
+	var results []Result
+	summary, err := backtest.Run(1, 2, func(result Result) { results = append(results, result) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != (Summary{Proofs: 6, Reveals: 3, Replayed: 2, Divergences: 1, Underived: 1}) {
+		t.Errorf("got summary %+v", summary)
+	}
+	if fmt.Sprint(verified) != "[1 2]" {
+		t.Errorf("verified ledgers %v, want the commits of ledgers 1 and 2", verified)
+	}
+	if len(results) != 4 {
+		t.Fatalf("got %d results", len(results))
+	}
+	if results[0].Diverges() || results[0].OnChain != core.AuditAccepted || results[0].Commit.Block != 1 {
+		t.Errorf("unexpected result %s", results[0])
+	}
+	if !results[1].Diverges() || results[1].OnChain != core.AuditRejected || !strings.HasSuffix(results[1].String(), "DIVERGES") {
+		t.Errorf("unexpected result %s", results[1])
+	}
+	if results[2].Verdict != "" || !strings.Contains(results[2].String(), "no commit of the proof in the range") {
+		t.Errorf("unexpected result %s", results[2])
+	}
+	if results[3].Verdict != "" || !strings.Contains(results[3].String(), "not replayed: checkRet could not be re-derived") {
+		t.Errorf("unexpected result %s", results[3])
+	}
+
+	var out bytes.Buffer
+	for _, result := range results {
+		printResults(&out, false)(result)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 3 {
+		t.Errorf("printed %q, want the divergence and the proofs that were not replayed", out.String())
+	}
+}
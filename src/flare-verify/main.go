@@ -0,0 +1,288 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+// flare-verify checks a state connector proof against the chain APIs of a chain_apis.json
+// file, without a node. It runs the verifier of the node, printing every API request and
+// response along with the result of each API and the final verdict.
+//
+//	flare-verify -config conf/local/chain_apis.json -chain 3 -function provePaymentFinality \
+//	    -ledger <ledger> -finalised <finalised ledger index> -hash <payment hash> -txid <tx hash>
+//	flare-verify -config conf/local/chain_apis.json -selector 388492dd -checkret <checkRet hex>
+//
+// With -record <dir> the responses of the chain APIs are saved to an archive, from which
+// -replay <dir> serves them back to verify the proof again without the chain APIs.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ava-labs/coreth/core"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type ChainAPI struct {
+	API  string  `json:"api"`
+	U    *string `json:"u"`
+	P    *string `json:"p"`
+	Type *string `json:"type"`
+}
+
+var functionSelectors = map[string]func(*big.Int) []byte{
+	"proveDataAvailabilityPeriodFinality": core.GetProveDataAvailabilityPeriodFinalitySelector,
+	"provePaymentFinality":                core.GetProvePaymentFinalitySelector,
+	"disprovePaymentFinality":             core.GetDisprovePaymentFinalitySelector,
+	"provePaymentReferenceFinality":       core.GetProvePaymentReferenceFinalitySelector,
+	"provePaymentSourceFinality":          core.GetProvePaymentSourceFinalitySelector,
+	"provePaymentTimestampFinality":       core.GetProvePaymentTimestampFinalitySelector,
+	"proveBalanceFinality":                core.GetProveBalanceFinalitySelector,
+	"proveNonPaymentFinality":             core.GetProveNonPaymentFinalitySelector,
+}
+
+// Exports the chain APIs of a chain_apis.json file, and the path of the utxo_chains.json file
+// next to it if there is one, as conf/export_chain_apis.sh does
+func ExportChainAPIs(configPath string) error {
+	configBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	var config map[string][]ChainAPI
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return err
+	}
+	for chain, chainAPIs := range config {
+		var urls []string
+		for _, chainAPI := range chainAPIs {
+			urls = append(urls, chainAPI.API)
+			chainURLhash := sha256.Sum256([]byte(chainAPI.API))
+			chainURLchecksum := hex.EncodeToString(chainURLhash[0:4])
+			if chainAPI.U != nil {
+				os.Setenv(chain+"_U_"+chainURLchecksum, *chainAPI.U)
+			}
+			if chainAPI.P != nil {
+				os.Setenv(chain+"_P_"+chainURLchecksum, *chainAPI.P)
+			}
+			if chainAPI.Type != nil {
+				os.Setenv(chain+"_T_"+chainURLchecksum, *chainAPI.Type)
+			}
+		}
+		os.Setenv(chain+"_APIs", strings.Join(urls, ","))
+	}
+	utxoChainsPath := filepath.Join(filepath.Dir(configPath), "utxo_chains.json")
+	if _, err := os.Stat(utxoChainsPath); err == nil {
+		os.Setenv("UTXO_CHAINS", utxoChainsPath)
+	}
+	return nil
+}
+
+// Encodes the values returned by the state connector contract, which the verifier is given as
+// checkRet. Non-payment proofs return the start of their ledger range before the string, and
+// timestamp proofs the window they claim.
+func EncodeCheckRet(chainId uint32, ledger uint64, finalised uint64, hash common.Hash, words []uint64, data string) []byte {
+	word := func(value uint64) []byte {
+		return common.LeftPadBytes(new(big.Int).SetUint64(value).Bytes(), 32)
+	}
+	checkRet := append(word(uint64(chainId)), word(ledger)...)
+	checkRet = append(checkRet, word(finalised)...)
+	checkRet = append(checkRet, hash.Bytes()...)
+	for _, value := range words {
+		checkRet = append(checkRet, word(value)...)
+	}
+	checkRet = append(checkRet, word(uint64(len(checkRet)+32))...)
+	checkRet = append(checkRet, word(uint64(len(data)))...)
+	return append(checkRet, common.RightPadBytes([]byte(data), (len(data)+31)/32*32)...)
+}
+
+// Prints every request made to a chain API over HTTP and its response
+type TracingTransport struct {
+	Transport http.RoundTripper
+}
+
+func (t TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fmt.Printf("-> %s %s\n", req.Method, req.URL)
+	if req.Body != nil {
+		reqBody, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("   %s\n", reqBody)
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		fmt.Printf("<- %v\n", err)
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		fmt.Printf("<- %s, %v\n", resp.Status, err)
+		return nil, err
+	}
+	fmt.Printf("<- %s\n   %s\n", resp.Status, bytes.TrimSpace(respBody))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(2)
+}
+
+func main() {
+	configPath := flag.String("config", "", "chain_apis.json file of the chain APIs to verify against")
+	blockTimeFlag := flag.Int64("time", time.Now().Unix(), "block time the proof is verified at, in Unix seconds")
+	functionName := flag.String("function", "", "name of the state connector function proven")
+	selectorHex := flag.String("selector", "", "function selector, in hex, in place of -function")
+	checkRetHex := flag.String("checkret", "", "checkRet bytes, in hex, in place of the fields below")
+	chainId := flag.Uint("chain", 0, "chain ID")
+	ledger := flag.Uint64("ledger", 0, "ledger of the proof, or the end of the ledger range of a non-payment proof")
+	finalised := flag.Uint64("finalised", 0, "finalised ledger index, or the number of confirmations of a data availability proof")
+	hashHex := flag.String("hash", "", "payment, data availability period, balance or non-payment hash, in hex")
+	startLedger := flag.Uint64("start-ledger", 0, "start of the ledger range of a non-payment proof")
+	windowFrom := flag.Uint64("window-from", 0, "start of the window of a timestamp proof, in Unix seconds")
+	windowTo := flag.Uint64("window-to", 0, "end of the window of a timestamp proof, in Unix seconds")
+	txId := flag.String("txid", "", "txId, address or non-payment filter string of the proof")
+	vout := flag.Int("vout", -1, "output index of a payment on a UTXO chain, prepended to the txId")
+	recordDir := flag.String("record", "", "directory to record the responses of the chain APIs over HTTP to")
+	replayDir := flag.String("replay", "", "directory of recorded responses to serve in place of the chain APIs")
+	flag.Parse()
+
+	if *configPath == "" {
+		fail("-config is required")
+	}
+	if err := ExportChainAPIs(*configPath); err != nil {
+		fail("reading %s: %v", *configPath, err)
+	}
+	if err := core.LoadUTXOChainsFromEnv(); err != nil {
+		fail("loading UTXO chains: %v", err)
+	}
+	blockTime := big.NewInt(*blockTimeFlag)
+
+	var selector []byte
+	if *selectorHex != "" {
+		decoded, err := hex.DecodeString(strings.TrimPrefix(*selectorHex, "0x"))
+		if err != nil || len(decoded) != 4 {
+			fail("-selector must be 4 bytes of hex")
+		}
+		selector = decoded
+	} else if getSelector, ok := functionSelectors[*functionName]; ok {
+		selector = getSelector(blockTime)
+		if len(selector) == 0 {
+			fail("%s is not installed in the state connector at block time %d", *functionName, *blockTimeFlag)
+		}
+	} else {
+		fail("-function must be one of the proof functions, or -selector given")
+	}
+	for name, getSelector := range functionSelectors {
+		if bytes.Equal(getSelector(blockTime), selector) {
+			*functionName = name
+		}
+	}
+
+	var checkRet []byte
+	if *checkRetHex != "" {
+		decoded, err := hex.DecodeString(strings.TrimPrefix(*checkRetHex, "0x"))
+		if err != nil || len(decoded) < 128 {
+			fail("-checkret must be at least 128 bytes of hex")
+		}
+		checkRet = decoded
+	} else {
+		hash, err := hex.DecodeString(strings.TrimPrefix(*hashHex, "0x"))
+		if err != nil || len(hash) != 32 {
+			fail("-hash must be 32 bytes of hex")
+		}
+		data := *txId
+		if *vout >= 0 {
+			if *vout > 15 {
+				fail("-vout must be below 16")
+			}
+			data = strconv.FormatInt(int64(*vout), 16) + data
+		}
+		var words []uint64
+		if bytes.Equal(selector, core.GetProveNonPaymentFinalitySelector(blockTime)) {
+			words = []uint64{*startLedger}
+		} else if bytes.Equal(selector, core.GetProvePaymentTimestampFinalitySelector(blockTime)) {
+			words = []uint64{*windowFrom, *windowTo}
+		}
+		checkRet = EncodeCheckRet(uint32(*chainId), *ledger, *finalised, common.BytesToHash(hash), words, data)
+		if bytes.Equal(selector, core.GetProveDataAvailabilityPeriodFinalitySelector(blockTime)) {
+			// Data availability proofs return no string
+			checkRet = checkRet[:128]
+		}
+	}
+
+	head, ok := core.UnpackCheckRetHead(checkRet)
+	if !ok {
+		fail("checkRet does not start with a chainId, ledger, finalised ledger index and hash")
+	}
+	fmt.Printf("Function: %s (%x) at block time %d\n", *functionName, selector, *blockTimeFlag)
+	fmt.Printf("Chain: %d\n", head.ChainId)
+	fmt.Printf("checkRet: %x\n\n", checkRet)
+	if head.ChainId >= core.GetMaxAllowedChains(blockTime) {
+		fmt.Printf("Warning: chain %d is not allowed at this block time, nodes do not verify it\n\n", head.ChainId)
+	}
+	if head.FinalisedLedgerIndex == 0 {
+		fmt.Printf("Warning: nodes read the verdicts of proofs with a zero finalised ledger index from their cache\n\n")
+	}
+
+	switch {
+	case *recordDir != "" && *replayDir != "":
+		fail("-record and -replay cannot be used together")
+	case *recordDir != "":
+		if err := core.ArchiveChainAPIs(*recordDir, core.ChainAPIArchiveRecord); err != nil {
+			fail("recording to %s: %v", *recordDir, err)
+		}
+	case *replayDir != "":
+		if err := core.ArchiveChainAPIs(*replayDir, core.ChainAPIArchiveReplay); err != nil {
+			fail("replaying from %s: %v", *replayDir, err)
+		}
+	}
+	core.WrapChainAPITransport(func(transport http.RoundTripper) http.RoundTripper {
+		return TracingTransport{Transport: transport}
+	})
+	var lastURL string
+	var lastVerified, lastAPIErr, queried bool
+	core.ReadChainTrace = func(chainURL string, verified bool, apiErr bool) {
+		queried = true
+		lastURL, lastVerified, lastAPIErr = chainURL, verified, apiErr
+		if strings.HasPrefix(chainURL, "ws://") || strings.HasPrefix(chainURL, "wss://") {
+			fmt.Printf("(requests to WebSocket APIs are not traced)\n")
+		}
+		switch {
+		case verified:
+			fmt.Printf("API %s: verified the proof\n\n", chainURL)
+		case apiErr:
+			fmt.Printf("API %s: unavailable or inconsistent, trying the next API\n\n", chainURL)
+		default:
+			fmt.Printf("API %s: the proof does not hold\n\n", chainURL)
+		}
+	}
+
+	if core.ReadChain(common.Address{}, blockTime, selector, checkRet) {
+		fmt.Printf("Verdict: ACCEPTED, verified by %s\n", lastURL)
+		return
+	}
+	switch {
+	case !queried:
+		fmt.Printf("Verdict: REJECTED, no APIs are configured for chain %d or the chain is not supported\n", head.ChainId)
+	case lastAPIErr && !lastVerified:
+		fmt.Printf("Verdict: REJECTED, every API was unavailable or inconsistent on every attempt\n")
+	default:
+		fmt.Printf("Verdict: REJECTED, %s answered that the proof does not hold\n", lastURL)
+	}
+	os.Exit(1)
+}
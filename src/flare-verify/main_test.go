@@ -0,0 +1,106 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ava-labs/coreth/core"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestEncodeCheckRet(t *testing.T) {
+	hash := common.HexToHash("716f54bafa5c2314f7d953f84c82efe31d1d6e1cabf41ef94f0eaf4789c46929")
+	checkRet := EncodeCheckRet(3, 62880010, 62880100, hash, nil, "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A")
+	if binary.BigEndian.Uint32(checkRet[28:32]) != 3 || binary.BigEndian.Uint64(checkRet[56:64]) != 62880010 || binary.BigEndian.Uint64(checkRet[88:96]) != 62880100 {
+		t.Errorf("unexpected header %x", checkRet[0:96])
+	}
+	if common.BytesToHash(checkRet[96:128]) != hash {
+		t.Errorf("unexpected hash %x", checkRet[96:128])
+	}
+	blockTime := big.NewInt(0)
+	if txId, ok := core.GetCheckRetString(blockTime, core.GetProvePaymentFinalitySelector(blockTime), checkRet); !ok || txId != "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A" {
+		t.Errorf("got txId %q", txId)
+	}
+	startLedger := uint64(62880000)
+	checkRet = EncodeCheckRet(3, 62880010, 62880100, hash, []uint64{startLedger}, "reference:0102")
+	if binary.BigEndian.Uint64(checkRet[152:160]) != startLedger {
+		t.Errorf("unexpected start ledger %x", checkRet[128:160])
+	}
+	if out, ok := core.UnpackStateConnectorProofsProveNonPaymentFinality(checkRet); !ok || out.StartLedger != startLedger || out.Filter != "reference:0102" {
+		t.Errorf("got outputs %+v", out)
+	}
+	if len(checkRet)%32 != 0 {
+		t.Errorf("expected checkRet to be padded to whole words, got %d bytes", len(checkRet))
+	}
+	checkRet = EncodeCheckRet(3, 62880010, 62880100, hash, []uint64{1636070400, 1636074000}, "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A")
+	out, window, ok := core.GetPaymentCheckRet(checkRet, core.PaymentProofTimestamp)
+	if !ok || window != (core.TimestampWindow{From: 1636070400, To: 1636074000}) {
+		t.Errorf("got window %+v", window)
+	}
+	if out.TxId != "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A" {
+		t.Errorf("got txId %q", out.TxId)
+	}
+}
+
+func TestExportChainAPIs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flare-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "chain_apis.json")
+	ioutil.WriteFile(configPath, []byte(`{
+		"BTC": [
+			{"api": "https://bitcoin.example/", "u": "public", "p": "secret"},
+			{"api": "https://bitcoin.example/api"},
+			{"api": "https://esplora.example/api", "type": "esplora"}
+		]
+	}`), 0644)
+	if err := ExportChainAPIs(configPath); err != nil {
+		t.Fatal(err)
+	}
+	checksum := func(chainURL string) string {
+		chainURLhash := sha256.Sum256([]byte(chainURL))
+		return hex.EncodeToString(chainURLhash[0:4])
+	}
+	defer os.Unsetenv("BTC_APIs")
+	defer os.Unsetenv("BTC_U_" + checksum("https://bitcoin.example/"))
+	defer os.Unsetenv("BTC_P_" + checksum("https://bitcoin.example/"))
+	defer os.Unsetenv("BTC_T_" + checksum("https://esplora.example/api"))
+	if apis := os.Getenv("BTC_APIs"); apis != "https://bitcoin.example/,https://bitcoin.example/api,https://esplora.example/api" {
+		t.Errorf("got BTC_APIs %q", apis)
+	}
+	if username := os.Getenv("BTC_U_" + checksum("https://bitcoin.example/")); username != "public" {
+		t.Errorf("got username %q", username)
+	}
+	if _, set := os.LookupEnv("BTC_U_" + checksum("https://bitcoin.example/api")); set {
+		t.Errorf("expected no username to be exported for an API without one")
+	}
+	if backend := os.Getenv("BTC_T_" + checksum("https://esplora.example/api")); backend != "esplora" {
+		t.Errorf("got API type %q", backend)
+	}
+	if _, set := os.LookupEnv("BTC_T_" + checksum("https://bitcoin.example/")); set {
+		t.Errorf("expected no API type to be exported for a JSON-RPC API")
+	}
+	if _, set := os.LookupEnv("UTXO_CHAINS"); set {
+		t.Errorf("expected UTXO_CHAINS not to be exported without a utxo_chains.json file")
+	}
+	utxoChainsPath := filepath.Join(dir, "utxo_chains.json")
+	ioutil.WriteFile(utxoChainsPath, []byte(`[]`), 0644)
+	if err := ExportChainAPIs(configPath); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("UTXO_CHAINS")
+	if path := os.Getenv("UTXO_CHAINS"); path != utxoChainsPath {
+		t.Errorf("got UTXO_CHAINS %q", path)
+	}
+}
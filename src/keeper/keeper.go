@@ -44,39 +44,23 @@ type EVMCaller interface {
 
 // Define maximums that can change by block height
 func GetKeeperGasMultiplier(blockNumber *big.Int) uint64 {
-	switch {
-	default:
-		return 100
-	}
+	return *GetUpgradeParams(nil, blockNumber).KeeperGasMultiplier
 }
 
 func GetSystemTriggerContractAddr(blockNumber *big.Int) string {
-	switch {
-	default:
-		return "0x1000000000000000000000000000000000000002"
-	}
+	return *GetUpgradeParams(nil, blockNumber).SystemTriggerContract
 }
 
 func GetSystemTriggerSelector(blockNumber *big.Int) []byte {
-	switch {
-	default:
-		return []byte{0x7f, 0xec, 0x8d, 0x38}
-	}
+	return append([]byte{}, GetUpgradeParams(nil, blockNumber).SystemTriggerSelector...)
 }
 
 func GetPrioritisedFTSOContract(blockTime *big.Int) string {
-	switch {
-	default:
-		return "0x1000000000000000000000000000000000000003"
-	}
+	return *GetUpgradeParams(blockTime, nil).PrioritisedFTSOContract
 }
 
 func GetMaximumMintRequest(blockNumber *big.Int) *big.Int {
-	switch {
-	default:
-		maxRequest, _ := new(big.Int).SetString("50000000000000000000000000", 10)
-		return maxRequest
-	}
+	return new(big.Int).Set(GetUpgradeParams(nil, blockNumber).MaximumMintRequest)
 }
 
 func triggerKeeper(evm EVMCaller) (*big.Int, error) {
@@ -92,11 +76,9 @@ func triggerKeeper(evm EVMCaller) (*big.Int, error) {
 		bigZero)
 	// If no error and a value came back...
 	if triggerErr == nil && triggerRet != nil {
-		// Did we get one big int?
-		if len(triggerRet) == 32 {
-			// Convert to big int
-			// Mint request cannot be less than 0 as SetBytes treats value as unsigned
-			mintRequest := new(big.Int).SetBytes(triggerRet)
+		// Did we get one uint256?
+		// Mint request cannot be less than 0 as it is decoded as unsigned
+		if mintRequest, ok := UnpackFlareKeeperTrigger(triggerRet); ok {
 			// return the mint request
 			return mintRequest, nil
 		} else {
@@ -14,8 +14,11 @@ import (
 	"math/big"
 	"net/http"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -24,70 +27,113 @@ import (
 )
 
 var (
-	testingChainID               = new(big.Int).SetUint64(16)
-	stateConnectorActivationTime = new(big.Int).SetUint64(1636070400)
-	tr                           = &http.Transport{
+	tr = &http.Transport{
 		MaxIdleConns:        100,
 		MaxConnsPerHost:     100,
 		MaxIdleConnsPerHost: 100,
 		IdleConnTimeout:     60 * time.Second,
 		DisableCompression:  true,
 	}
-	client = &http.Client{
-		Transport: tr,
+	chainAPIs = newChainAPITransport(tr)
+	client    = &http.Client{
+		Transport: chainAPIs,
 		Timeout:   5 * time.Second,
 	}
 	apiRetries    = 3
 	apiRetryDelay = 1 * time.Second
 )
 
+// The state connector activates at a block time set by the upgrade schedule of each network
 func GetStateConnectorActivated(chainID *big.Int, blockTime *big.Int) bool {
-	// Return true if chainID is 16 or if block.timestamp is greater than the state connector activation time on any chain
-	return chainID.Cmp(testingChainID) == 0
+	upgrades, err := GetUpgradeSchedule(chainID)
+	return err == nil && *upgrades.params(blockTime, nil).StateConnectorActivated
 }
 
 func GetStateConnectorGasDivisor(blockTime *big.Int) uint64 {
-	switch {
-	default:
-		return 3
-	}
+	return *GetUpgradeParams(blockTime, nil).StateConnectorGasDivisor
 }
 
 func GetMaxAllowedChains(blockTime *big.Int) uint32 {
-	switch {
-	default:
-		return 5
-	}
+	return *GetUpgradeParams(blockTime, nil).MaxAllowedChains
 }
 
 func GetStateConnectorContractAddr(blockTime *big.Int) string {
-	switch {
-	default:
-		return "0x1000000000000000000000000000000000000001"
-	}
+	return *GetUpgradeParams(blockTime, nil).StateConnectorContract
 }
 
 func GetProveDataAvailabilityPeriodFinalitySelector(blockTime *big.Int) []byte {
-	switch {
-	default:
-		return []byte{0xc5, 0xd6, 0x4c, 0xd1}
-	}
+	return append([]byte{}, GetUpgradeParams(blockTime, nil).ProveDataAvailabilityPeriodFinalitySelector...)
 }
 
 func GetProvePaymentFinalitySelector(blockTime *big.Int) []byte {
-	switch {
-	default:
-		return []byte{0x38, 0x84, 0x92, 0xdd}
-	}
+	return append([]byte{}, GetUpgradeParams(blockTime, nil).ProvePaymentFinalitySelector...)
 }
 
 func GetDisprovePaymentFinalitySelector(blockTime *big.Int) []byte {
-	switch {
-	default:
-		return []byte{0x7f, 0x58, 0x24, 0x32}
-	}
+	return append([]byte{}, GetUpgradeParams(blockTime, nil).DisprovePaymentFinalitySelector...)
+}
+
+// provePaymentReferenceFinality(uint32,bytes32,uint64,string), empty until an upgrade of the
+// state connector contract installs it
+func GetProvePaymentReferenceFinalitySelector(blockTime *big.Int) []byte {
+	return append([]byte{}, GetUpgradeParams(blockTime, nil).ProvePaymentReferenceFinalitySelector...)
+}
+
+// provePaymentSourceFinality(uint32,bytes32,uint64,string), empty until an upgrade of the
+// state connector contract installs it
+func GetProvePaymentSourceFinalitySelector(blockTime *big.Int) []byte {
+	return append([]byte{}, GetUpgradeParams(blockTime, nil).ProvePaymentSourceFinalitySelector...)
+}
+
+// proveBalanceFinality(uint32,bytes32,uint64,string), empty until an upgrade of the state
+// connector contract installs it
+func GetProveBalanceFinalitySelector(blockTime *big.Int) []byte {
+	return append([]byte{}, GetUpgradeParams(blockTime, nil).ProveBalanceFinalitySelector...)
 }
 
+// provePaymentTimestampFinality(uint32,bytes32,uint64,uint64,uint64,string), empty until an
+// upgrade of the state connector contract installs it
+func GetProvePaymentTimestampFinalitySelector(blockTime *big.Int) []byte {
+	return append([]byte{}, GetUpgradeParams(blockTime, nil).ProvePaymentTimestampFinalitySelector...)
+}
+
+// proveNonPaymentFinality(uint32,bytes32,uint64,uint64,string), empty until an upgrade of the
+// state connector contract installs it
+func GetProveNonPaymentFinalitySelector(blockTime *big.Int) []byte {
+	return append([]byte{}, GetUpgradeParams(blockTime, nil).ProveNonPaymentFinalitySelector...)
+}
+
+// The proof functions of the state connector contract, each with the binding whose selector
+// it has once installed
+var stateConnectorProofFunctions = []struct {
+	method   ABIMethod
+	selector func(blockTime *big.Int) []byte
+}{
+	{StateConnectorProveDataAvailabilityPeriodFinality, GetProveDataAvailabilityPeriodFinalitySelector},
+	{StateConnectorProvePaymentFinality, GetProvePaymentFinalitySelector},
+	{StateConnectorDisprovePaymentFinality, GetDisprovePaymentFinalitySelector},
+	{StateConnectorProofsProvePaymentReferenceFinality, GetProvePaymentReferenceFinalitySelector},
+	{StateConnectorProofsProvePaymentSourceFinality, GetProvePaymentSourceFinalitySelector},
+	{StateConnectorProofsProveBalanceFinality, GetProveBalanceFinalitySelector},
+	{StateConnectorProofsProvePaymentTimestampFinality, GetProvePaymentTimestampFinalitySelector},
+	{StateConnectorProofsProveNonPaymentFinality, GetProveNonPaymentFinalitySelector},
+}
+
+// PaymentProofVariant selects which transaction fields, beyond the txid, destination,
+// amount and currency, are committed to in a payment hash.
+type PaymentProofVariant uint8
+
+const (
+	PaymentProofBasic PaymentProofVariant = iota
+	// Also commit to the payment reference carried by the transaction
+	PaymentProofReference
+	// Also commit to the address or set of addresses that funded the transaction
+	PaymentProofSource
+	// Also commit to a window that the Unix time of the block or ledger that includes the
+	// transaction is within
+	PaymentProofTimestamp
+)
+
 // =======================================================
 // Proof of Work Common
 // =======================================================
@@ -101,7 +147,10 @@ type GetPoWBlockCountResp struct {
 	Error  interface{} `json:"error"`
 }
 
-func GetPoWBlockCount(chainURL string, username string, password string) (uint64, bool) {
+func GetPoWBlockCount(chain UTXOChainConfig, chainURL string, username string, password string) (uint64, bool) {
+	if chain.Backend == powBackendEsplora {
+		return GetEsploraBlockCount(chainURL, username, password)
+	}
 	data := GetPoWRequestPayload{
 		Method: "getblockcount",
 		Params: []string{},
@@ -142,17 +191,74 @@ func GetPoWBlockCount(chainURL string, username string, password string) (uint64
 	return jsonResp.Result, false
 }
 
+type GetPoWRPCRequestPayload struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+type GetPoWRPCResp struct {
+	Result json.RawMessage `json:"result"`
+	Error  interface{}     `json:"error"`
+}
+
+// Calls a bitcoind-compatible JSON-RPC method and decodes its result, returning true on any
+// transport or RPC error
+func CallPoWRPC(method string, params []interface{}, result interface{}, chainURL string, username string, password string) bool {
+	data := GetPoWRPCRequestPayload{
+		Method: method,
+		Params: params,
+	}
+	payloadBytes, err := json.Marshal(data)
+	if err != nil {
+		return true
+	}
+	body := bytes.NewReader(payloadBytes)
+	req, err := http.NewRequest("POST", chainURL, body)
+	if err != nil {
+		return true
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if username != "" && password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return true
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return true
+	}
+	var jsonResp GetPoWRPCResp
+	err = json.Unmarshal(respBody, &jsonResp)
+	if err != nil {
+		return true
+	}
+	if jsonResp.Error != nil {
+		return true
+	}
+	return json.Unmarshal(jsonResp.Result, result) != nil
+}
+
 type GetPoWBlockHeaderResult struct {
 	Hash          string `json:"hash"`
 	Confirmations uint64 `json:"confirmations"`
 	Height        uint64 `json:"height"`
+	Time          uint64 `json:"time"`
+	MedianTime    uint64 `json:"mediantime"`
 }
 type GetPoWBlockHeaderResp struct {
 	Result GetPoWBlockHeaderResult `json:"result"`
 	Error  interface{}             `json:"error"`
 }
 
-func GetPoWBlockHeader(ledgerHash string, requiredConfirmations uint64, chainURL string, username string, password string) (uint64, bool) {
+func GetPoWBlockHeader(ledgerHash string, requiredConfirmations uint64, chain UTXOChainConfig, chainURL string, username string, password string) (uint64, bool) {
+	if chain.Backend == powBackendEsplora {
+		return GetEsploraBlockHeader(ledgerHash, requiredConfirmations, chainURL, username, password)
+	}
 	data := GetPoWRequestPayload{
 		Method: "getblockheader",
 		Params: []string{
@@ -197,20 +303,36 @@ func GetPoWBlockHeader(ledgerHash string, requiredConfirmations uint64, chainURL
 	return jsonResp.Result.Height, false
 }
 
-func ProveDataAvailabilityPeriodFinalityPoW(checkRet []byte, chainURL string, username string, password string) (bool, bool) {
-	blockCount, err := GetPoWBlockCount(chainURL, username, password)
+// Returns the median time past of a block. Unlike the block time set by its miner, the median
+// time of the previous 11 blocks only increases along the chain.
+func GetPoWBlockMedianTime(blockHash string, chain UTXOChainConfig, chainURL string, username string, password string) (uint64, bool) {
+	if chain.Backend == powBackendEsplora {
+		return GetEsploraBlockMedianTime(blockHash, chainURL, username, password)
+	}
+	var header GetPoWBlockHeaderResult
+	if CallPoWRPC("getblockheader", []interface{}{blockHash}, &header, chainURL, username, password) {
+		return 0, true
+	}
+	return header.MedianTime, false
+}
+
+func ProveDataAvailabilityPeriodFinalityPoW(checkRet []byte, chain UTXOChainConfig, chainURL string, username string, password string) (bool, bool) {
+	out, ok := UnpackStateConnectorProveDataAvailabilityPeriodFinality(checkRet)
+	if !ok {
+		return false, false
+	}
+	blockCount, err := GetPoWBlockCount(chain, chainURL, username, password)
 	if err {
 		return false, true
 	}
-	ledger := binary.BigEndian.Uint64(checkRet[56:64])
-	requiredConfirmations := binary.BigEndian.Uint64(checkRet[88:96])
-	if blockCount < ledger+requiredConfirmations {
+	requiredConfirmations := uint64(out.NumConfirmations)
+	if blockCount < out.Ledger+requiredConfirmations {
 		return false, true
 	}
-	ledgerResp, err := GetPoWBlockHeader(hex.EncodeToString(checkRet[96:128]), requiredConfirmations, chainURL, username, password)
+	ledgerResp, err := GetPoWBlockHeader(hex.EncodeToString(out.DataAvailabilityPeriodHash[:]), requiredConfirmations, chain, chainURL, username, password)
 	if err {
 		return false, true
-	} else if ledgerResp > 0 && ledgerResp == ledger {
+	} else if ledgerResp > 0 && ledgerResp == out.Ledger {
 		return true, false
 	} else {
 		return false, false
@@ -225,17 +347,30 @@ type GetPoWTxRequestPayload struct {
 	Method string                `json:"method"`
 	Params GetPoWTxRequestParams `json:"params"`
 }
+type GetPoWScriptPubKey struct {
+	Hex       string   `json:"hex"`
+	Type      string   `json:"type"`
+	Address   string   `json:"address"`
+	Addresses []string `json:"addresses"`
+}
 type GetPoWTxResult struct {
 	TxID          string `json:"txid"`
 	BlockHash     string `json:"blockhash"`
 	Confirmations uint64 `json:"confirmations"`
-	Vout          []struct {
-		Value        float64 `json:"value"`
-		N            uint64  `json:"n"`
-		ScriptPubKey struct {
-			Type      string   `json:"type"`
-			Addresses []string `json:"addresses"`
-		} `json:"scriptPubKey"`
+	Vin           []struct {
+		Coinbase string `json:"coinbase"`
+		TxID     string `json:"txid"`
+		Vout     uint64 `json:"vout"`
+		// Only returned by getblock with verbosity 3 and by Esplora
+		Prevout *struct {
+			Value        float64            `json:"value"`
+			ScriptPubKey GetPoWScriptPubKey `json:"scriptPubKey"`
+		} `json:"prevout"`
+	} `json:"vin"`
+	Vout []struct {
+		Value        float64            `json:"value"`
+		N            uint64             `json:"n"`
+		ScriptPubKey GetPoWScriptPubKey `json:"scriptPubKey"`
 	} `json:"vout"`
 }
 type GetPoWTxResp struct {
@@ -243,22 +378,97 @@ type GetPoWTxResp struct {
 	Error  interface{}    `json:"error"`
 }
 
-func GetPoWTx(txHash string, voutN uint64, latestAvailableBlock uint64, currencyCode string, chainURL string, username string, password string) ([]byte, uint64, bool) {
+// Returns the address of an output that pays a single address. bitcoind 22 and later report it
+// as address, which is only read once the chain reads the address field, and earlier versions
+// as the only entry of addresses.
+func GetPoWScriptPubKeyAddress(scriptPubKey GetPoWScriptPubKey, chain UTXOChainConfig) (string, bool) {
+	if chain.AddressField && scriptPubKey.Address != "" {
+		return scriptPubKey.Address, true
+	}
+	if len(scriptPubKey.Addresses) == 1 {
+		return scriptPubKey.Addresses[0], true
+	}
+	return "", false
+}
+
+// Returns whether an output pays to exactly the given address
+func IsPoWScriptPubKeyAddress(scriptPubKey GetPoWScriptPubKey, address string, chain UTXOChainConfig) bool {
+	scriptPubKeyAddress, ok := GetPoWScriptPubKeyAddress(scriptPubKey, chain)
+	return ok && scriptPubKeyAddress == address
+}
+
+// Returns the data pushed by the single OP_RETURN output of a transaction, transactions
+// without an OP_RETURN output or with more than one of them carry no payment reference
+func GetPoWPaymentReference(tx GetPoWTxResult) ([]byte, bool) {
+	var script []byte
+	for _, vout := range tx.Vout {
+		if vout.ScriptPubKey.Type != "nulldata" {
+			continue
+		}
+		if script != nil {
+			return []byte{}, false
+		}
+		decoded, err := hex.DecodeString(vout.ScriptPubKey.Hex)
+		if err != nil {
+			return []byte{}, false
+		}
+		script = decoded
+	}
+	if len(script) < 2 || script[0] != 0x6a {
+		return []byte{}, false
+	}
+	var reference []byte
+	for i := 1; i < len(script); {
+		opcode := script[i]
+		i++
+		var pushLength int
+		switch {
+		case opcode >= 0x01 && opcode <= 0x4b:
+			pushLength = int(opcode)
+		case opcode == 0x4c && i+1 <= len(script):
+			pushLength = int(script[i])
+			i++
+		case opcode == 0x4d && i+2 <= len(script):
+			pushLength = int(binary.LittleEndian.Uint16(script[i : i+2]))
+			i += 2
+		case opcode == 0x4e && i+4 <= len(script):
+			pushLength = int(binary.LittleEndian.Uint32(script[i : i+4]))
+			i += 4
+		default:
+			// Only data pushes are permitted after OP_RETURN
+			return []byte{}, false
+		}
+		if pushLength > len(script)-i {
+			return []byte{}, false
+		}
+		reference = append(reference, script[i:i+pushLength]...)
+		i += pushLength
+	}
+	if len(reference) == 0 {
+		return []byte{}, false
+	}
+	return reference, true
+}
+
+func GetPoWRawTx(txID string, chain UTXOChainConfig, chainURL string, username string, password string) (GetPoWTxResult, bool) {
+	if chain.Backend == powBackendEsplora {
+		return GetEsploraTx(txID, chain, chainURL, username, password)
+	}
 	data := GetPoWTxRequestPayload{
 		Method: "getrawtransaction",
 		Params: GetPoWTxRequestParams{
-			TxID:    txHash[1:],
+			TxID:    txID,
 			Verbose: true,
 		},
 	}
 	payloadBytes, err := json.Marshal(data)
 	if err != nil {
-		return []byte{}, 0, true
+		return GetPoWTxResult{}, true
 	}
 	body := bytes.NewReader(payloadBytes)
 	req, err := http.NewRequest("POST", chainURL, body)
 	if err != nil {
-		return []byte{}, 0, true
+		return GetPoWTxResult{}, true
 	}
 	req.Header.Set("Content-Type", "application/json")
 	if username != "" && password != "" {
@@ -266,62 +476,147 @@ func GetPoWTx(txHash string, voutN uint64, latestAvailableBlock uint64, currency
 	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return []byte{}, 0, true
+		return GetPoWTxResult{}, true
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return []byte{}, 0, true
+		return GetPoWTxResult{}, true
 	}
 	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return []byte{}, 0, true
+		return GetPoWTxResult{}, true
 	}
 	var jsonResp GetPoWTxResp
 	err = json.Unmarshal(respBody, &jsonResp)
 	if err != nil {
-		return []byte{}, 0, true
+		return GetPoWTxResult{}, true
 	}
 	if jsonResp.Error != nil {
+		return GetPoWTxResult{}, true
+	}
+	return jsonResp.Result, false
+}
+
+// Maximum number of inputs of a transaction whose source is proven, as each input can take a
+// lookup of the transaction it spends
+var maxPoWSourceProofInputs = 16
+
+// Resolves the addresses spent from by each input of a transaction using prevout lookups, and
+// commits to them as a set: sorted, de-duplicated and hashed in order. Coinbase transactions,
+// transactions with more than maxPoWSourceProofInputs inputs and inputs spending outputs that
+// do not pay to exactly one address have no provable source.
+func GetPoWSourceHash(tx GetPoWTxResult, chain UTXOChainConfig, chainURL string, username string, password string) ([]byte, bool, bool) {
+	if len(tx.Vin) == 0 || len(tx.Vin) > maxPoWSourceProofInputs {
+		return []byte{}, false, false
+	}
+	prevTxs := make(map[string]GetPoWTxResult)
+	var sources []string
+	for _, vin := range tx.Vin {
+		if vin.Coinbase != "" || vin.TxID == "" {
+			return []byte{}, false, false
+		}
+		if vin.Prevout != nil {
+			// Esplora reports the spent output alongside each input
+			source, ok := GetPoWScriptPubKeyAddress(vin.Prevout.ScriptPubKey, chain)
+			if !ok {
+				return []byte{}, false, false
+			}
+			sources = append(sources, source)
+			continue
+		}
+		prevTx, cached := prevTxs[vin.TxID]
+		if !cached {
+			var getPrevTxErr bool
+			prevTx, getPrevTxErr = GetPoWRawTx(vin.TxID, chain, chainURL, username, password)
+			if getPrevTxErr {
+				return []byte{}, false, true
+			}
+			prevTxs[vin.TxID] = prevTx
+		}
+		if uint64(len(prevTx.Vout)) <= vin.Vout {
+			return []byte{}, false, false
+		}
+		source, ok := GetPoWScriptPubKeyAddress(prevTx.Vout[vin.Vout].ScriptPubKey, chain)
+		if !ok {
+			return []byte{}, false, false
+		}
+		sources = append(sources, source)
+	}
+	return GetPoWSourceSetHash(sources), true, false
+}
+
+func GetPoWTx(txHash string, voutN uint64, latestAvailableBlock uint64, chain UTXOChainConfig, variant PaymentProofVariant, window TimestampWindow, chainURL string, username string, password string) ([]byte, uint64, bool) {
+	tx, getRawTxErr := GetPoWRawTx(txHash[1:], chain, chainURL, username, password)
+	if getRawTxErr {
 		return []byte{}, 0, true
 	}
-	if uint64(len(jsonResp.Result.Vout)) <= voutN {
+	if uint64(len(tx.Vout)) <= voutN {
 		return []byte{}, 0, false
 	}
-	if jsonResp.Result.Vout[voutN].ScriptPubKey.Type != "pubkeyhash" || len(jsonResp.Result.Vout[voutN].ScriptPubKey.Addresses) != 1 {
+	if _, ok := GetPoWScriptPubKeyAddress(tx.Vout[voutN].ScriptPubKey, chain); !ok || tx.Vout[voutN].ScriptPubKey.Type != "pubkeyhash" {
 		return []byte{}, 0, false
 	}
-	inBlock, getBlockErr := GetPoWBlockHeader(jsonResp.Result.BlockHash, jsonResp.Result.Confirmations, chainURL, username, password)
+	inBlock, getBlockErr := GetPoWBlockHeader(tx.BlockHash, tx.Confirmations, chain, chainURL, username, password)
 	if getBlockErr {
 		return []byte{}, 0, true
 	}
 	if inBlock == 0 || inBlock >= latestAvailableBlock {
 		return []byte{}, 0, false
 	}
-	txIdHash := crypto.Keccak256([]byte(txHash))
-	destinationHash := crypto.Keccak256([]byte(jsonResp.Result.Vout[voutN].ScriptPubKey.Addresses[0]))
-	amountHash := crypto.Keccak256(common.LeftPadBytes(common.FromHex(hexutil.EncodeUint64(uint64(jsonResp.Result.Vout[voutN].Value*math.Pow(10, 8)))), 32))
-	currencyHash := crypto.Keccak256([]byte(currencyCode))
-	return crypto.Keccak256(txIdHash, destinationHash, amountHash, currencyHash), inBlock, false
+	var variantHashes [][]byte
+	if variant == PaymentProofReference {
+		reference, found := GetPoWPaymentReference(tx)
+		if !found {
+			return []byte{}, 0, false
+		}
+		variantHashes = append(variantHashes, crypto.Keccak256(reference))
+	} else if variant == PaymentProofSource {
+		sourceHash, found, getSourceErr := GetPoWSourceHash(tx, chain, chainURL, username, password)
+		if getSourceErr {
+			return []byte{}, 0, true
+		} else if !found {
+			return []byte{}, 0, false
+		}
+		variantHashes = append(variantHashes, sourceHash)
+	} else if variant == PaymentProofTimestamp {
+		medianTime, getMedianTimeErr := GetPoWBlockMedianTime(tx.BlockHash, chain, chainURL, username, password)
+		if getMedianTimeErr {
+			return []byte{}, 0, true
+		} else if medianTime == 0 {
+			return []byte{}, 0, false
+		}
+		windowHash, ok := GetTimestampWindowHash(window, medianTime)
+		if !ok {
+			return []byte{}, 0, false
+		}
+		variantHashes = append(variantHashes, windowHash)
+	}
+	paymentHash, ok := GetPoWPaymentHash(txHash, tx, voutN, chain, variantHashes...)
+	if !ok {
+		return []byte{}, 0, false
+	}
+	return paymentHash, inBlock, false
 }
 
-func ProvePaymentFinalityPoW(checkRet []byte, isDisprove bool, currencyCode string, chainURL string, username string, password string) (bool, bool) {
-	if len(checkRet) < 257 {
+func ProvePaymentFinalityPoW(checkRet []byte, isDisprove bool, variant PaymentProofVariant, chain UTXOChainConfig, chainURL string, username string, password string) (bool, bool) {
+	out, window, ok := GetPaymentCheckRet(checkRet, variant)
+	if !ok || len(out.TxId) < 65 {
 		return false, false
 	}
-	voutN, err := strconv.ParseUint(string(checkRet[192:193]), 16, 64)
+	voutN, err := strconv.ParseUint(out.TxId[0:1], 16, 64)
 	if err != nil {
 		return false, false
 	}
-	paymentHash, inBlock, getPoWTxErr := GetPoWTx(string(checkRet[192:257]), voutN, binary.BigEndian.Uint64(checkRet[88:96]), currencyCode, chainURL, username, password)
+	paymentHash, inBlock, getPoWTxErr := GetPoWTx(out.TxId[0:65], voutN, out.FinalisedLedgerIndex, chain, variant, window, chainURL, username, password)
 	if getPoWTxErr {
 		return false, true
 	}
 	if !isDisprove {
-		if len(paymentHash) > 0 && bytes.Equal(paymentHash, checkRet[96:128]) && inBlock == binary.BigEndian.Uint64(checkRet[56:64]) {
+		if len(paymentHash) > 0 && bytes.Equal(paymentHash, out.PaymentHash[:]) && inBlock == out.Ledger {
 			return true, false
 		}
 	} else {
-		if len(paymentHash) > 0 && bytes.Equal(paymentHash, checkRet[96:128]) && inBlock > binary.BigEndian.Uint64(checkRet[56:64]) {
+		if len(paymentHash) > 0 && bytes.Equal(paymentHash, out.PaymentHash[:]) && inBlock > out.Ledger {
 			return true, false
 		} else if len(paymentHash) == 0 {
 			return true, false
@@ -330,27 +625,32 @@ func ProvePaymentFinalityPoW(checkRet []byte, isDisprove bool, currencyCode stri
 	return false, false
 }
 
-func ProvePoW(sender common.Address, blockTime *big.Int, functionSelector []byte, checkRet []byte, currencyCode string, chainURL string) (bool, bool) {
-	var username, password string
+func ProvePoW(sender common.Address, blockTime *big.Int, functionSelector []byte, checkRet []byte, chain UTXOChainConfig, chainURL string) (bool, bool) {
 	chainURLhash := sha256.Sum256([]byte(chainURL))
 	chainURLchecksum := hex.EncodeToString(chainURLhash[0:4])
-	switch currencyCode {
-	case "btc":
-		username = os.Getenv("BTC_U_" + chainURLchecksum)
-		password = os.Getenv("BTC_P_" + chainURLchecksum)
-	case "ltc":
-		username = os.Getenv("LTC_U_" + chainURLchecksum)
-		password = os.Getenv("LTC_P_" + chainURLchecksum)
-	case "dog":
-		username = os.Getenv("DOGE_U_" + chainURLchecksum)
-		password = os.Getenv("DOGE_P_" + chainURLchecksum)
+	username := os.Getenv(chain.EnvPrefix + "_U_" + chainURLchecksum)
+	password := os.Getenv(chain.EnvPrefix + "_P_" + chainURLchecksum)
+	chain.Backend = os.Getenv(chain.EnvPrefix + "_T_" + chainURLchecksum)
+	if chain.Backend != "" && chain.Backend != powBackendEsplora {
+		// An API of a type the node cannot query
+		return false, true
 	}
 	if bytes.Equal(functionSelector, GetProveDataAvailabilityPeriodFinalitySelector(blockTime)) {
-		return ProveDataAvailabilityPeriodFinalityPoW(checkRet, chainURL, username, password)
+		return ProveDataAvailabilityPeriodFinalityPoW(checkRet, chain, chainURL, username, password)
 	} else if bytes.Equal(functionSelector, GetProvePaymentFinalitySelector(blockTime)) {
-		return ProvePaymentFinalityPoW(checkRet, false, currencyCode, chainURL, username, password)
+		return ProvePaymentFinalityPoW(checkRet, false, PaymentProofBasic, chain, chainURL, username, password)
 	} else if bytes.Equal(functionSelector, GetDisprovePaymentFinalitySelector(blockTime)) {
-		return ProvePaymentFinalityPoW(checkRet, true, currencyCode, chainURL, username, password)
+		return ProvePaymentFinalityPoW(checkRet, true, PaymentProofBasic, chain, chainURL, username, password)
+	} else if bytes.Equal(functionSelector, GetProvePaymentReferenceFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityPoW(checkRet, false, PaymentProofReference, chain, chainURL, username, password)
+	} else if bytes.Equal(functionSelector, GetProvePaymentSourceFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityPoW(checkRet, false, PaymentProofSource, chain, chainURL, username, password)
+	} else if bytes.Equal(functionSelector, GetProvePaymentTimestampFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityPoW(checkRet, false, PaymentProofTimestamp, chain, chainURL, username, password)
+	} else if bytes.Equal(functionSelector, GetProveBalanceFinalitySelector(blockTime)) {
+		return ProveBalanceFinalityPoW(checkRet, chain, chainURL, username, password)
+	} else if bytes.Equal(functionSelector, GetProveNonPaymentFinalitySelector(blockTime)) {
+		return ProveNonPaymentFinalityPoW(checkRet, chain, chainURL, username, password)
 	}
 	return false, false
 }
@@ -359,6 +659,12 @@ func ProvePoW(sender common.Address, blockTime *big.Int, functionSelector []byte
 // XRP
 // =======================================================
 
+const (
+	xrpPartialPaymentFlag = uint32(0x00020000)
+	// Seconds between the Unix epoch and the Ripple epoch of 2000-01-01T00:00:00Z
+	xrpRippleEpochOffset = uint64(946684800)
+)
+
 type GetXRPBlockRequestParams struct {
 	LedgerIndex  uint64 `json:"ledger_index"`
 	Full         bool   `json:"full"`
@@ -374,6 +680,84 @@ type GetXRPBlockRequestPayload struct {
 type CheckXRPErrorResponse struct {
 	Error string `json:"error"`
 }
+type GetXRPRPCRequestPayload struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// Posts a rippled JSON-RPC request, over the shared ledger stream connection for WebSocket
+// URLs, and returns the response body
+func PostXRPRPC(payloadBytes []byte, chainURL string) ([]byte, bool) {
+	if IsXRPWebSocketURL(chainURL) {
+		return GetXRPLedgerStream(chainURL).Request(payloadBytes)
+	}
+	body := bytes.NewReader(payloadBytes)
+	req, err := http.NewRequest("POST", chainURL, body)
+	if err != nil {
+		return nil, true
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, true
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, true
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true
+	}
+	return respBody, false
+}
+
+// Calls a rippled JSON-RPC method and decodes its result, returning the rippled error code of
+// a failed request and true on any transport error
+func CallXRPRPC(method string, params interface{}, result interface{}, chainURL string) (string, bool) {
+	data := GetXRPRPCRequestPayload{
+		Method: method,
+		Params: []interface{}{params},
+	}
+	payloadBytes, err := json.Marshal(data)
+	if err != nil {
+		return "", true
+	}
+	respBody, postErr := PostXRPRPC(payloadBytes, chainURL)
+	if postErr {
+		return "", true
+	}
+	var checkErrorResp map[string]CheckXRPErrorResponse
+	err = json.Unmarshal(respBody, &checkErrorResp)
+	if err != nil {
+		return "", true
+	}
+	if checkErrorResp["result"].Error != "" {
+		return checkErrorResp["result"].Error, false
+	}
+	var jsonResp map[string]json.RawMessage
+	err = json.Unmarshal(respBody, &jsonResp)
+	if err != nil {
+		return "", true
+	}
+	if json.Unmarshal(jsonResp["result"], result) != nil {
+		return "", true
+	}
+	return "", false
+}
+
+// Returns whether a rippled error code reflects the state of the queried server rather than
+// the request, so that another API should be tried
+func IsXRPServerError(respErrString string) bool {
+	return respErrString == "amendmentBlocked" ||
+		respErrString == "failedToForward" ||
+		respErrString == "invalid_API_version" ||
+		respErrString == "noClosed" ||
+		respErrString == "noCurrent" ||
+		respErrString == "noNetwork" ||
+		respErrString == "tooBusy"
+}
+
 type GetXRPBlockResponse struct {
 	LedgerHash  string `json:"ledger_hash"`
 	LedgerIndex int    `json:"ledger_index"`
@@ -381,6 +765,11 @@ type GetXRPBlockResponse struct {
 }
 
 func GetXRPBlock(ledger uint64, chainURL string) (string, bool) {
+	if IsXRPWebSocketURL(chainURL) {
+		if ledgerHash, found, err := GetXRPLedgerStream(chainURL).GetLedgerHash(ledger); err || found {
+			return ledgerHash, err
+		}
+	}
 	data := GetXRPBlockRequestPayload{
 		Method: "ledger",
 		Params: []GetXRPBlockRequestParams{
@@ -398,22 +787,8 @@ func GetXRPBlock(ledger uint64, chainURL string) (string, bool) {
 	if err != nil {
 		return "", true
 	}
-	body := bytes.NewReader(payloadBytes)
-	req, err := http.NewRequest("POST", chainURL, body)
-	if err != nil {
-		return "", true
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", true
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return "", true
-	}
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+	respBody, postErr := PostXRPRPC(payloadBytes, chainURL)
+	if postErr {
 		return "", true
 	}
 	var checkErrorResp map[string]CheckXRPErrorResponse
@@ -436,12 +811,15 @@ func GetXRPBlock(ledger uint64, chainURL string) (string, bool) {
 }
 
 func ProveDataAvailabilityPeriodFinalityXRP(checkRet []byte, chainURL string) (bool, bool) {
-	ledger := binary.BigEndian.Uint64(checkRet[56:64])
-	ledgerHashString, err := GetXRPBlock(ledger, chainURL)
+	out, ok := UnpackStateConnectorProveDataAvailabilityPeriodFinality(checkRet)
+	if !ok {
+		return false, false
+	}
+	ledgerHashString, err := GetXRPBlock(out.Ledger, chainURL)
 	if err {
 		return false, true
 	}
-	if ledgerHashString != "" && bytes.Equal(crypto.Keccak256([]byte(ledgerHashString)), checkRet[96:128]) {
+	if ledgerHashString != "" && bytes.Equal(GetXRPLedgerHashCommitment(ledgerHashString), out.DataAvailabilityPeriodHash[:]) {
 		return true, false
 	}
 	return false, false
@@ -456,25 +834,223 @@ type GetXRPTxRequestPayload struct {
 	Params []GetXRPTxRequestParams `json:"params"`
 }
 type GetXRPTxResponse struct {
-	Destination     string `json:"Destination"`
-	DestinationTag  int    `json:"DestinationTag"`
-	TransactionType string `json:"TransactionType"`
-	Hash            string `json:"hash"`
-	InLedger        int    `json:"inLedger"`
-	Validated       bool   `json:"validated"`
+	Account         string          `json:"Account"`
+	Amount          interface{}     `json:"Amount"`
+	DeliverMax      interface{}     `json:"DeliverMax"`
+	Fee             string          `json:"Fee"`
+	Flags           uint32          `json:"Flags"`
+	Destination     string          `json:"Destination"`
+	DestinationTag  int             `json:"DestinationTag"`
+	SourceTag       int             `json:"SourceTag"`
+	InvoiceID       string          `json:"InvoiceID"`
+	Memos           []GetXRPTxMemos `json:"Memos"`
+	TransactionType string          `json:"TransactionType"`
+	Hash            string          `json:"hash"`
+	Date            uint64          `json:"date"`
+	InLedger        int             `json:"inLedger"`
+	Validated       bool            `json:"validated"`
 	Meta            struct {
-		TransactionResult string      `json:"TransactionResult"`
-		Amount            interface{} `json:"delivered_amount"`
+		TransactionResult string                 `json:"TransactionResult"`
+		Amount            interface{}            `json:"delivered_amount"`
+		AffectedNodes     []GetXRPTxAffectedNode `json:"AffectedNodes"`
 	} `json:"meta"`
 }
 
+type GetXRPTxAffectedNode struct {
+	CreatedNode  *GetXRPTxLedgerNode `json:"CreatedNode"`
+	ModifiedNode *GetXRPTxLedgerNode `json:"ModifiedNode"`
+	DeletedNode  *GetXRPTxLedgerNode `json:"DeletedNode"`
+}
+type GetXRPTxLedgerNode struct {
+	LedgerEntryType string               `json:"LedgerEntryType"`
+	LedgerIndex     string               `json:"LedgerIndex"`
+	FinalFields     GetXRPTxLedgerFields `json:"FinalFields"`
+	PreviousFields  GetXRPTxLedgerFields `json:"PreviousFields"`
+}
+type GetXRPTxLedgerFields struct {
+	Account        string      `json:"Account"`
+	Balance        interface{} `json:"Balance"`
+	Destination    string      `json:"Destination"`
+	DestinationTag int         `json:"DestinationTag"`
+}
+
+type GetXRPTxMemos struct {
+	Memo GetXRPTxMemo `json:"Memo"`
+}
+type GetXRPTxMemo struct {
+	MemoType   string `json:"MemoType"`
+	MemoFormat string `json:"MemoFormat"`
+	MemoData   string `json:"MemoData"`
+}
+
 type GetXRPTxIssuedCurrency struct {
 	Currency string `json:"currency"`
 	Issuer   string `json:"issuer"`
 	Value    string `json:"value"`
 }
 
-func GetXRPTx(txHash string, latestAvailableLedger uint64, chainURL string) ([]byte, uint64, bool) {
+// Commits to the SourceTag, InvoiceID and Memos fields of a transaction, in that order.
+// Absent fields are committed to as zero values, and each memo is committed to as the
+// hash of its MemoType, MemoFormat and MemoData bytes.
+func GetXRPPaymentReferenceHash(tx GetXRPTxResponse) ([]byte, bool) {
+	sourceTagHash := crypto.Keccak256(common.LeftPadBytes(common.FromHex(hexutil.EncodeUint64(uint64(tx.SourceTag))), 32))
+	invoiceID, err := hex.DecodeString(tx.InvoiceID)
+	if err != nil || len(invoiceID) > 32 {
+		return []byte{}, false
+	}
+	invoiceIDHash := crypto.Keccak256(common.LeftPadBytes(invoiceID, 32))
+	var memoHashes [][]byte
+	for _, memo := range tx.Memos {
+		memoType, err := hex.DecodeString(memo.Memo.MemoType)
+		if err != nil {
+			return []byte{}, false
+		}
+		memoFormat, err := hex.DecodeString(memo.Memo.MemoFormat)
+		if err != nil {
+			return []byte{}, false
+		}
+		memoData, err := hex.DecodeString(memo.Memo.MemoData)
+		if err != nil {
+			return []byte{}, false
+		}
+		memoHashes = append(memoHashes, crypto.Keccak256(crypto.Keccak256(memoType), crypto.Keccak256(memoFormat), crypto.Keccak256(memoData)))
+	}
+	memosHash := crypto.Keccak256(memoHashes...)
+	return crypto.Keccak256(sourceTagHash, invoiceIDHash, memosHash), true
+}
+
+// Parses an XRP amount in drops, or an issued-currency amount scaled by 10^15
+func GetXRPAmount(xrpAmount interface{}) (uint64, string, bool) {
+	if stringAmount, ok := xrpAmount.(string); ok {
+		amount, err := strconv.ParseUint(stringAmount, 10, 64)
+		if err != nil {
+			return 0, "", false
+		}
+		return amount, "xrp", true
+	}
+	if _, ok := xrpAmount.(map[string]interface{}); !ok {
+		return 0, "", false
+	}
+	amountStruct, err := json.Marshal(xrpAmount)
+	if err != nil {
+		return 0, "", false
+	}
+	var issuedCurrencyResp GetXRPTxIssuedCurrency
+	err = json.Unmarshal(amountStruct, &issuedCurrencyResp)
+	if err != nil {
+		return 0, "", false
+	}
+	floatAmount, err := strconv.ParseFloat(issuedCurrencyResp.Value, 64)
+	if err != nil || floatAmount < 0 {
+		return 0, "", false
+	}
+	return uint64(floatAmount * math.Pow(10, 15)), issuedCurrencyResp.Currency + issuedCurrencyResp.Issuer, true
+}
+
+// Returns the amount actually received by the destination of a payment. The Amount field (named
+// DeliverMax from rippled API v2) is only an upper bound when tfPartialPayment is set, so a partial
+// payment is only provable when the ledger recorded its delivered_amount. Transactions from ledgers
+// before delivered_amount was introduced report it as "unavailable", and only a full payment can
+// then fall back to the Amount or DeliverMax field.
+func GetXRPDeliveredAmount(tx GetXRPTxResponse) (uint64, string, bool) {
+	if tx.Amount != nil && tx.DeliverMax != nil && !reflect.DeepEqual(tx.Amount, tx.DeliverMax) {
+		return 0, "", false
+	}
+	if deliveredAmount, ok := tx.Meta.Amount.(string); !ok || deliveredAmount != "unavailable" {
+		if tx.Meta.Amount != nil {
+			return GetXRPAmount(tx.Meta.Amount)
+		}
+	}
+	if tx.Flags&xrpPartialPaymentFlag != 0 {
+		return 0, "", false
+	}
+	if tx.Amount != nil {
+		return GetXRPAmount(tx.Amount)
+	}
+	return GetXRPAmount(tx.DeliverMax)
+}
+
+// Returns the net XRP balance change of an account caused by a transaction, excluding the
+// transaction fee when the account itself submitted the transaction
+func GetXRPBalanceDelta(tx GetXRPTxResponse, account string) (int64, bool) {
+	for _, affectedNode := range tx.Meta.AffectedNodes {
+		node := affectedNode.ModifiedNode
+		if node == nil || node.LedgerEntryType != "AccountRoot" || node.FinalFields.Account != account {
+			continue
+		}
+		finalBalance, ok := node.FinalFields.Balance.(string)
+		if !ok {
+			return 0, false
+		}
+		previousBalance, ok := node.PreviousFields.Balance.(string)
+		if !ok {
+			// The balance of this account was not changed by the transaction
+			return 0, false
+		}
+		final, err := strconv.ParseInt(finalBalance, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		previous, err := strconv.ParseInt(previousBalance, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		delta := final - previous
+		if tx.Account == account {
+			fee, err := strconv.ParseInt(tx.Fee, 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			delta += fee
+		}
+		return delta, true
+	}
+	return 0, false
+}
+
+// Returns the destination, destination tag, delivered amount and currency of a transaction that
+// transfers value to a destination account. Payments are read from their transaction fields,
+// while EscrowFinish, CheckCash and PaymentChannelClaim transactions are read from the escrow,
+// check or payment channel they consume and from the balance change of its destination. Escrows
+// and payment channels only hold XRP, and checks cashed for an issued currency are not provable.
+func GetXRPValueTransfer(tx GetXRPTxResponse) (string, int, uint64, string, bool) {
+	var ledgerEntryType string
+	switch tx.TransactionType {
+	case "Payment":
+		amount, currency, ok := GetXRPDeliveredAmount(tx)
+		return tx.Destination, tx.DestinationTag, amount, currency, ok
+	case "EscrowFinish":
+		ledgerEntryType = "Escrow"
+	case "CheckCash":
+		ledgerEntryType = "Check"
+	case "PaymentChannelClaim":
+		ledgerEntryType = "PayChannel"
+	default:
+		return "", 0, 0, "", false
+	}
+	var entry *GetXRPTxLedgerNode
+	for _, affectedNode := range tx.Meta.AffectedNodes {
+		for _, node := range []*GetXRPTxLedgerNode{affectedNode.ModifiedNode, affectedNode.DeletedNode} {
+			if node == nil || node.LedgerEntryType != ledgerEntryType {
+				continue
+			}
+			if entry != nil {
+				return "", 0, 0, "", false
+			}
+			entry = node
+		}
+	}
+	if entry == nil || entry.FinalFields.Destination == "" {
+		return "", 0, 0, "", false
+	}
+	delta, ok := GetXRPBalanceDelta(tx, entry.FinalFields.Destination)
+	if !ok || delta <= 0 {
+		return "", 0, 0, "", false
+	}
+	return entry.FinalFields.Destination, entry.FinalFields.DestinationTag, uint64(delta), "xrp", true
+}
+
+func GetXRPTx(txHash string, latestAvailableLedger uint64, variant PaymentProofVariant, window TimestampWindow, chainURL string) ([]byte, uint64, bool) {
 	data := GetXRPTxRequestPayload{
 		Method: "tx",
 		Params: []GetXRPTxRequestParams{
@@ -488,22 +1064,8 @@ func GetXRPTx(txHash string, latestAvailableLedger uint64, chainURL string) ([]b
 	if err != nil {
 		return []byte{}, 0, true
 	}
-	body := bytes.NewReader(payloadBytes)
-	req, err := http.NewRequest("POST", chainURL, body)
-	if err != nil {
-		return []byte{}, 0, true
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
-	if err != nil {
-		return []byte{}, 0, true
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return []byte{}, 0, true
-	}
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+	respBody, postErr := PostXRPRPC(payloadBytes, chainURL)
+	if postErr {
 		return []byte{}, 0, true
 	}
 	var checkErrorResp map[string]CheckXRPErrorResponse
@@ -513,13 +1075,7 @@ func GetXRPTx(txHash string, latestAvailableLedger uint64, chainURL string) ([]b
 	}
 	respErrString := checkErrorResp["result"].Error
 	if respErrString != "" {
-		if respErrString == "amendmentBlocked" ||
-			respErrString == "failedToForward" ||
-			respErrString == "invalid_API_version" ||
-			respErrString == "noClosed" ||
-			respErrString == "noCurrent" ||
-			respErrString == "noNetwork" ||
-			respErrString == "tooBusy" {
+		if IsXRPServerError(respErrString) {
 			return []byte{}, 0, true
 		} else {
 			return []byte{}, 0, false
@@ -530,58 +1086,32 @@ func GetXRPTx(txHash string, latestAvailableLedger uint64, chainURL string) ([]b
 	if err != nil {
 		return []byte{}, 0, false
 	}
-	if jsonResp["result"].TransactionType != "Payment" || !jsonResp["result"].Validated || jsonResp["result"].Meta.TransactionResult != "tesSUCCESS" {
-		return []byte{}, 0, false
-	}
 	inLedger := uint64(jsonResp["result"].InLedger)
-	if inLedger == 0 || inLedger >= latestAvailableLedger || !jsonResp["result"].Validated {
+	if inLedger == 0 || inLedger >= latestAvailableLedger {
 		return []byte{}, 0, false
 	}
-	var currency string
-	var amount uint64
-	if stringAmount, ok := jsonResp["result"].Meta.Amount.(string); ok {
-		amount, err = strconv.ParseUint(stringAmount, 10, 64)
-		if err != nil {
-			return []byte{}, 0, false
-		}
-		currency = "xrp"
-	} else {
-		amountStruct, err := json.Marshal(jsonResp["result"].Meta.Amount)
-		if err != nil {
-			return []byte{}, 0, false
-		}
-		var issuedCurrencyResp GetXRPTxIssuedCurrency
-		err = json.Unmarshal(amountStruct, &issuedCurrencyResp)
-		if err != nil {
-			return []byte{}, 0, false
-		}
-		floatAmount, err := strconv.ParseFloat(issuedCurrencyResp.Value, 64)
-		if err != nil {
-			return []byte{}, 0, false
-		}
-		amount = uint64(floatAmount * math.Pow(10, 15))
-		currency = issuedCurrencyResp.Currency + issuedCurrencyResp.Issuer
+	paymentHash, ok := GetXRPPaymentHash(jsonResp["result"], variant, window)
+	if !ok {
+		return []byte{}, 0, false
 	}
-	txIdHash := crypto.Keccak256([]byte(jsonResp["result"].Hash))
-	destinationHash := crypto.Keccak256([]byte(jsonResp["result"].Destination))
-	destinationTagHash := crypto.Keccak256(common.LeftPadBytes(common.FromHex(hexutil.EncodeUint64(uint64(jsonResp["result"].DestinationTag))), 32))
-	destinationHash = crypto.Keccak256(destinationHash, destinationTagHash)
-	amountHash := crypto.Keccak256(common.LeftPadBytes(common.FromHex(hexutil.EncodeUint64(uint64(amount))), 32))
-	currencyHash := crypto.Keccak256([]byte(currency))
-	return crypto.Keccak256(txIdHash, destinationHash, amountHash, currencyHash), inLedger, false
+	return paymentHash, inLedger, false
 }
 
-func ProvePaymentFinalityXRP(checkRet []byte, isDisprove bool, chainURL string) (bool, bool) {
-	paymentHash, inLedger, err := GetXRPTx(string(checkRet[192:]), binary.BigEndian.Uint64(checkRet[88:96]), chainURL)
+func ProvePaymentFinalityXRP(checkRet []byte, isDisprove bool, variant PaymentProofVariant, chainURL string) (bool, bool) {
+	out, window, ok := GetPaymentCheckRet(checkRet, variant)
+	if !ok {
+		return false, false
+	}
+	paymentHash, inLedger, err := GetXRPTx(out.TxId, out.FinalisedLedgerIndex, variant, window, chainURL)
 	if err {
 		return false, true
 	}
 	if !isDisprove {
-		if len(paymentHash) > 0 && bytes.Equal(paymentHash, checkRet[96:128]) && inLedger == binary.BigEndian.Uint64(checkRet[56:64]) {
+		if len(paymentHash) > 0 && bytes.Equal(paymentHash, out.PaymentHash[:]) && inLedger == out.Ledger {
 			return true, false
 		}
 	} else {
-		if len(paymentHash) > 0 && bytes.Equal(paymentHash, checkRet[96:128]) && inLedger > binary.BigEndian.Uint64(checkRet[56:64]) {
+		if len(paymentHash) > 0 && bytes.Equal(paymentHash, out.PaymentHash[:]) && inLedger > out.Ledger {
 			return true, false
 		} else if len(paymentHash) == 0 {
 			return true, false
@@ -594,9 +1124,19 @@ func ProveXRP(sender common.Address, blockTime *big.Int, functionSelector []byte
 	if bytes.Equal(functionSelector, GetProveDataAvailabilityPeriodFinalitySelector(blockTime)) {
 		return ProveDataAvailabilityPeriodFinalityXRP(checkRet, chainURL)
 	} else if bytes.Equal(functionSelector, GetProvePaymentFinalitySelector(blockTime)) {
-		return ProvePaymentFinalityXRP(checkRet, false, chainURL)
+		return ProvePaymentFinalityXRP(checkRet, false, PaymentProofBasic, chainURL)
 	} else if bytes.Equal(functionSelector, GetDisprovePaymentFinalitySelector(blockTime)) {
-		return ProvePaymentFinalityXRP(checkRet, true, chainURL)
+		return ProvePaymentFinalityXRP(checkRet, true, PaymentProofBasic, chainURL)
+	} else if bytes.Equal(functionSelector, GetProvePaymentReferenceFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityXRP(checkRet, false, PaymentProofReference, chainURL)
+	} else if bytes.Equal(functionSelector, GetProvePaymentSourceFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityXRP(checkRet, false, PaymentProofSource, chainURL)
+	} else if bytes.Equal(functionSelector, GetProvePaymentTimestampFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityXRP(checkRet, false, PaymentProofTimestamp, chainURL)
+	} else if bytes.Equal(functionSelector, GetProveBalanceFinalitySelector(blockTime)) {
+		return ProveBalanceFinalityXRP(checkRet, chainURL)
+	} else if bytes.Equal(functionSelector, GetProveNonPaymentFinalitySelector(blockTime)) {
+		return ProveNonPaymentFinalityXRP(checkRet, chainURL)
 	}
 	return false, false
 }
@@ -613,55 +1153,194 @@ func ProveALGO(sender common.Address, blockTime *big.Int, functionSelector []byt
 // Common
 // =======================================================
 
+// Decodes the checkRet of a payment proof of a variant, with the window that timestamp proofs
+// carry ahead of their txId. Disproofs return the outputs of basic payment proofs.
+func GetPaymentCheckRet(checkRet []byte, variant PaymentProofVariant) (StateConnectorProvePaymentFinalityOutput, TimestampWindow, bool) {
+	var out StateConnectorProvePaymentFinalityOutput
+	var window TimestampWindow
+	var ok bool
+	switch variant {
+	case PaymentProofReference:
+		var reference StateConnectorProofsProvePaymentReferenceFinalityOutput
+		reference, ok = UnpackStateConnectorProofsProvePaymentReferenceFinality(checkRet)
+		out = StateConnectorProvePaymentFinalityOutput(reference)
+	case PaymentProofSource:
+		var source StateConnectorProofsProvePaymentSourceFinalityOutput
+		source, ok = UnpackStateConnectorProofsProvePaymentSourceFinality(checkRet)
+		out = StateConnectorProvePaymentFinalityOutput(source)
+	case PaymentProofTimestamp:
+		var timestamp StateConnectorProofsProvePaymentTimestampFinalityOutput
+		timestamp, ok = UnpackStateConnectorProofsProvePaymentTimestampFinality(checkRet)
+		out = StateConnectorProvePaymentFinalityOutput{
+			ChainId:              timestamp.ChainId,
+			Ledger:               timestamp.Ledger,
+			FinalisedLedgerIndex: timestamp.FinalisedLedgerIndex,
+			PaymentHash:          timestamp.PaymentHash,
+			TxId:                 timestamp.TxId,
+		}
+		window = TimestampWindow{From: timestamp.WindowFrom, To: timestamp.WindowTo}
+	default:
+		out, ok = UnpackStateConnectorProvePaymentFinality(checkRet)
+	}
+	if !ok || out.TxId == "" || window.From > window.To {
+		return StateConnectorProvePaymentFinalityOutput{}, TimestampWindow{}, false
+	}
+	return out, window, true
+}
+
+// Returns the string that the proof function called by a selector returns last: the txId of a
+// payment proof, the address of a balance proof or the filter of a non-payment proof
+func GetCheckRetString(blockTime *big.Int, functionSelector []byte, checkRet []byte) (string, bool) {
+	switch {
+	case bytes.Equal(functionSelector, GetProveDataAvailabilityPeriodFinalitySelector(blockTime)):
+		return "", false
+	case bytes.Equal(functionSelector, GetProveBalanceFinalitySelector(blockTime)):
+		out, ok := UnpackStateConnectorProofsProveBalanceFinality(checkRet)
+		return out.Address, ok && out.Address != ""
+	case bytes.Equal(functionSelector, GetProveNonPaymentFinalitySelector(blockTime)):
+		out, ok := UnpackStateConnectorProofsProveNonPaymentFinality(checkRet)
+		return out.Filter, ok && out.Filter != ""
+	case bytes.Equal(functionSelector, GetProvePaymentReferenceFinalitySelector(blockTime)):
+		out, _, ok := GetPaymentCheckRet(checkRet, PaymentProofReference)
+		return out.TxId, ok
+	case bytes.Equal(functionSelector, GetProvePaymentSourceFinalitySelector(blockTime)):
+		out, _, ok := GetPaymentCheckRet(checkRet, PaymentProofSource)
+		return out.TxId, ok
+	case bytes.Equal(functionSelector, GetProvePaymentTimestampFinalitySelector(blockTime)):
+		out, _, ok := GetPaymentCheckRet(checkRet, PaymentProofTimestamp)
+		return out.TxId, ok
+	}
+	out, _, ok := GetPaymentCheckRet(checkRet, PaymentProofBasic)
+	return out.TxId, ok
+}
+
 func ProveChain(sender common.Address, blockTime *big.Int, functionSelector []byte, checkRet []byte, chainId uint32, chainURL string) (bool, bool) {
+	if chain, ok := GetUTXOChainConfig(chainId, blockTime); ok {
+		return ProvePoW(sender, blockTime, functionSelector, checkRet, chain, chainURL)
+	}
 	switch chainId {
-	case 0:
-		return ProvePoW(sender, blockTime, functionSelector, checkRet, "btc", chainURL)
-	case 1:
-		return ProvePoW(sender, blockTime, functionSelector, checkRet, "ltc", chainURL)
-	case 2:
-		return ProvePoW(sender, blockTime, functionSelector, checkRet, "dog", chainURL)
 	case 3:
 		return ProveXRP(sender, blockTime, functionSelector, checkRet, chainURL)
 	case 4:
 		return ProveALGO(sender, blockTime, functionSelector, checkRet, chainURL)
+	case 5:
+		return ProveEVM(sender, blockTime, functionSelector, checkRet, "eth", chainURL)
+	case 6:
+		return ProveStellar(sender, blockTime, functionSelector, checkRet, chainURL)
 	default:
 		return false, true
 	}
 }
 
+// Called by ReadChain with the result of each chain API queried, when set by tools that
+// explain verdicts
+var ReadChainTrace func(chainURL string, verified bool, apiErr bool)
+
+// The transport of requests to chain APIs over HTTP. It is wrapped by tools and by the audit
+// log while requests are in flight, so the wrapped transport is swapped atomically.
+type chainAPITransport struct {
+	lock      sync.Mutex
+	transport atomic.Value
+}
+
+// Holds a transport in the atomic value, which only takes values of one concrete type
+type chainAPIRoundTripper struct {
+	http.RoundTripper
+}
+
+func newChainAPITransport(transport http.RoundTripper) *chainAPITransport {
+	t := &chainAPITransport{}
+	t.store(transport)
+	return t
+}
+
+func (t *chainAPITransport) load() http.RoundTripper {
+	return t.transport.Load().(chainAPIRoundTripper).RoundTripper
+}
+
+func (t *chainAPITransport) store(transport http.RoundTripper) {
+	t.transport.Store(chainAPIRoundTripper{transport})
+}
+
+func (t *chainAPITransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.load().RoundTrip(req)
+}
+
+// Wraps the transport of requests to chain APIs over HTTP, so that tools can trace them
+func WrapChainAPITransport(wrap func(http.RoundTripper) http.RoundTripper) {
+	chainAPIs.lock.Lock()
+	defer chainAPIs.lock.Unlock()
+	chainAPIs.store(wrap(chainAPIs.load()))
+}
+
 func ReadChain(sender common.Address, blockTime *big.Int, functionSelector []byte, checkRet []byte) bool {
-	chainId := binary.BigEndian.Uint32(checkRet[28:32])
+	verified, _ := readChain(sender, blockTime, functionSelector, checkRet, nil)
+	return verified
+}
+
+// Verifies a proof against the chain APIs, recording each API queried and the verdict in
+// record unless it is nil. A proof rejected because no chain API answered is an API error.
+func readChain(sender common.Address, blockTime *big.Int, functionSelector []byte, checkRet []byte, record *AuditRecord) (bool, bool) {
+	head, ok := UnpackCheckRetHead(checkRet)
+	if !ok {
+		if record != nil {
+			record.setVerdict(false, "checkRet does not decode")
+		}
+		return false, false
+	}
+	chainId := head.ChainId
 	var chainURLs string
+	if chain, ok := GetUTXOChainConfig(chainId, blockTime); ok {
+		chainURLs = os.Getenv(chain.EnvPrefix + "_APIs")
+	}
 	switch chainId {
-	case 0:
-		chainURLs = os.Getenv("BTC_APIs")
-	case 1:
-		chainURLs = os.Getenv("LTC_APIs")
-	case 2:
-		chainURLs = os.Getenv("DOGE_APIs")
 	case 3:
 		chainURLs = os.Getenv("XRP_APIs")
 	case 4:
 		chainURLs = os.Getenv("ALGO_APIs")
+	case 5:
+		chainURLs = os.Getenv("ETH_APIs")
+	case 6:
+		chainURLs = os.Getenv("XLM_APIs")
 	}
 	if chainURLs == "" {
-		return false
+		if record != nil {
+			record.setVerdict(false, "no chain API configured for chain "+strconv.FormatUint(uint64(chainId), 10))
+		}
+		return false, true
 	}
 	for i := 0; i < apiRetries; i++ {
 		for _, chainURL := range strings.Split(chainURLs, ",") {
 			if chainURL == "" {
 				continue
 			}
+			var collector *auditCollector
+			if record != nil {
+				collector = startAuditCollector(chainURL)
+			}
 			verified, err := ProveChain(sender, blockTime, functionSelector, checkRet, chainId, chainURL)
+			if ReadChainTrace != nil {
+				ReadChainTrace(chainURL, verified, err)
+			}
+			if record != nil {
+				record.Endpoints = append(record.Endpoints, AuditEndpoint{URL: chainURL, Verified: verified, APIError: err, Exchanges: collector.stop()})
+			}
 			if !verified && err {
 				continue
 			}
-			return verified
+			if record != nil && verified {
+				record.setVerdict(true, "verified by "+chainURL)
+			} else if record != nil {
+				record.setVerdict(false, "the proof does not hold according to "+chainURL)
+			}
+			return verified, false
 		}
 		time.Sleep(apiRetryDelay)
 	}
-	return false
+	if record != nil {
+		record.setVerdict(false, "no chain API was available")
+	}
+	return false, true
 }
 
 func GetVerificationPaths(functionSelector []byte, checkRet []byte) (string, string) {
@@ -669,36 +1348,166 @@ func GetVerificationPaths(functionSelector []byte, checkRet []byte) (string, str
 	acceptedPrefix := "ACCEPTED"
 	rejectedPrefix := "REJECTED"
 	functionHash := hex.EncodeToString(functionSelector[:])
-	verificationHash := hex.EncodeToString(crypto.Keccak256(checkRet[0:64], checkRet[96:128]))
-	suffix := "_" + functionHash + "_" + verificationHash
+	suffix := "_" + functionHash + "_" + GetVerificationHash(checkRet)
 	return prefix + acceptedPrefix + suffix, prefix + rejectedPrefix + suffix
 }
 
-// Verify proof against underlying chain
-func StateConnectorCall(sender common.Address, blockTime *big.Int, functionSelector []byte, checkRet []byte) bool {
-	if binary.BigEndian.Uint64(checkRet[88:96]) > 0 {
-		go func() {
-			acceptedPath, rejectedPath := GetVerificationPaths(functionSelector, checkRet)
-			_, errACCEPTED := os.Stat(acceptedPath)
-			_, errREJECTED := os.Stat(rejectedPath)
-			if errACCEPTED != nil && errREJECTED != nil {
-				if ReadChain(sender, blockTime, functionSelector, checkRet) {
-					verificationHashStore, err := os.Create(acceptedPath)
-					verificationHashStore.Close()
-					if err != nil {
-						// Permissions problem
-						panic(err)
-					}
-				} else {
-					verificationHashStore, err := os.Create(rejectedPath)
-					verificationHashStore.Close()
-					if err != nil {
-						// Permissions problem
-						panic(err)
-					}
-				}
+// Identifies a proof in the cache by its chainId, ledger and hash
+func GetVerificationHash(checkRet []byte) string {
+	head, _ := UnpackCheckRetHead(checkRet)
+	return hex.EncodeToString(crypto.Keccak256(abiUintWord(uint64(head.ChainId)), abiUintWord(head.Ledger), head.Hash[:]))
+}
+
+// Verdict on proofs in simulated calls, such as eth_call and eth_estimateGas, which are never
+// verified against chain APIs or the verification cache. Proofs are treated as unverified
+// unless SIMULATED_PROOF_VERDICT is set to "accepted", to estimate gas as if they were verified.
+func GetSimulatedProofVerdict() bool {
+	return os.Getenv("SIMULATED_PROOF_VERDICT") == "accepted"
+}
+
+// Whether the selector of a call to the state connector is that of a proof, whose checkRet the
+// node verifies
+func IsStateConnectorProofSelector(blockTime *big.Int, data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	for _, function := range stateConnectorProofFunctions {
+		if bytes.Equal(data[0:4], function.selector(blockTime)) {
+			return true
+		}
+	}
+	return false
+}
+
+// How long the verdict on a proof verified in advance is kept for the block that commits to it
+var preVerificationTTL = 10 * time.Minute
+
+// Verdict on a proof verified while its transaction waits in the tx pool. It is kept apart from
+// the cache, since it was reached at the time the transaction arrived rather than at the time
+// of the block that commits to the proof.
+type preVerification struct {
+	done    chan struct{}
+	started time.Time
+	// The upgrade parameters the proof was verified under
+	params   UpgradeParams
+	verified bool
+}
+
+var (
+	verificationsLock sync.Mutex
+	// Accepted paths of the proofs being verified
+	verificationsInProgress = make(map[string]bool)
+	// Proofs verified in advance, by their accepted path
+	preVerifications = make(map[string]*preVerification)
+)
+
+// Removes the verdict on a proof verified in advance and reports, once it is reached, whether
+// the proof was accepted within preVerificationTTL under the upgrade parameters of the block
+// time of the commit. A rejection may only reflect a chain that had not caught up yet, such
+// as missing confirmations, so it is never reused and the commit verifies the proof again.
+func takePreVerification(acceptedPath string, blockTime *big.Int) bool {
+	verificationsLock.Lock()
+	pre, ok := preVerifications[acceptedPath]
+	delete(preVerifications, acceptedPath)
+	verificationsLock.Unlock()
+	if !ok || time.Since(pre.started) > preVerificationTTL {
+		return false
+	}
+	<-pre.done
+	return pre.verified && reflect.DeepEqual(pre.params, GetUpgradeParams(blockTime, nil))
+}
+
+// Verifies a proof against the underlying chain and stores the verdict in the cache, unless
+// the cache already holds it or the proof is being verified
+func verifyToCache(sender common.Address, blockNumber *big.Int, blockTime *big.Int, functionSelector []byte, checkRet []byte) {
+	acceptedPath, rejectedPath := GetVerificationPaths(functionSelector, checkRet)
+	verificationsLock.Lock()
+	if verificationsInProgress[acceptedPath] {
+		verificationsLock.Unlock()
+		return
+	}
+	verificationsInProgress[acceptedPath] = true
+	verificationsLock.Unlock()
+	defer func() {
+		verificationsLock.Lock()
+		delete(verificationsInProgress, acceptedPath)
+		verificationsLock.Unlock()
+	}()
+
+	_, errACCEPTED := os.Stat(acceptedPath)
+	_, errREJECTED := os.Stat(rejectedPath)
+	if errACCEPTED != nil && errREJECTED != nil {
+		record := startAuditRecord(AuditVerification, sender, blockNumber, blockTime, functionSelector, checkRet)
+		verified := takePreVerification(acceptedPath, blockTime)
+		if !verified {
+			verified, _ = readChain(sender, blockTime, functionSelector, checkRet, record)
+		} else if record != nil {
+			record.setVerdict(true, "accepted in advance under the upgrade parameters of the block")
+		}
+		writeAuditRecord(record)
+		if verified {
+			verificationHashStore, err := os.Create(acceptedPath)
+			verificationHashStore.Close()
+			if err != nil {
+				// Permissions problem
+				panic(err)
 			}
-		}()
+		} else {
+			verificationHashStore, err := os.Create(rejectedPath)
+			verificationHashStore.Close()
+			if err != nil {
+				// Permissions problem
+				panic(err)
+			}
+		}
+	}
+}
+
+// Starts verifying the proof of a transaction in the tx pool, given the checkRet of a dry run
+// of its call. Only the proofs verified when they are committed to, before they are revealed,
+// can be verified in advance. The verdict is only used by the commit of the proof, and only if
+// it accepted the proof, was started within preVerificationTTL, and the block time of the
+// commit runs under the same upgrade parameters as blockTime.
+func PreVerifyStateConnectorCall(sender common.Address, blockNumber *big.Int, blockTime *big.Int, functionSelector []byte, checkRet []byte) bool {
+	if head, ok := UnpackCheckRetHead(checkRet); !ok || head.FinalisedLedgerIndex == 0 {
+		return false
+	}
+	acceptedPath, _ := GetVerificationPaths(functionSelector, checkRet)
+	now := time.Now()
+	verificationsLock.Lock()
+	for path, pre := range preVerifications {
+		if now.Sub(pre.started) > preVerificationTTL {
+			delete(preVerifications, path)
+		}
+	}
+	if _, ok := preVerifications[acceptedPath]; ok {
+		verificationsLock.Unlock()
+		return true
+	}
+	pre := &preVerification{done: make(chan struct{}), started: now, params: GetUpgradeParams(blockTime, nil)}
+	preVerifications[acceptedPath] = pre
+	verificationsLock.Unlock()
+	go func() {
+		defer close(pre.done)
+		record := startAuditRecord(AuditPreVerification, sender, blockNumber, blockTime, functionSelector, checkRet)
+		pre.verified, _ = readChain(sender, blockTime, functionSelector, checkRet, record)
+		writeAuditRecord(record)
+	}()
+	return true
+}
+
+// Verify proof against underlying chain
+func StateConnectorCall(sender common.Address, blockNumber *big.Int, blockTime *big.Int, functionSelector []byte, checkRet []byte) bool {
+	head, ok := UnpackCheckRetHead(checkRet)
+	if !ok {
+		return false
+	}
+	if head.FinalisedLedgerIndex > 0 {
+		if record := startAuditRecord(AuditCommit, sender, blockNumber, blockTime, functionSelector, checkRet); record != nil {
+			record.setVerdict(true, "committed to, verification started")
+			writeAuditRecord(record)
+		}
+		go verifyToCache(sender, blockNumber, blockTime, functionSelector, checkRet)
 		return true
 	} else {
 		acceptedPath, rejectedPath := GetVerificationPaths(functionSelector, checkRet)
@@ -714,6 +1523,17 @@ func StateConnectorCall(sender common.Address, blockTime *big.Int, functionSelec
 				time.Sleep(apiRetryDelay)
 			}
 		}
+		if record := startAuditRecord(AuditReveal, sender, blockNumber, blockTime, functionSelector, checkRet); record != nil {
+			switch {
+			case errACCEPTED == nil:
+				record.setVerdict(true, "accepted in the cache")
+			case errREJECTED == nil:
+				record.setVerdict(false, "rejected in the cache")
+			default:
+				record.setVerdict(false, "no verdict in the cache")
+			}
+			writeAuditRecord(record)
+		}
 		go func() {
 			removeFulfilledAPIRequests := os.Getenv("REMOVE_FULFILLED_API_REQUESTS")
 			if removeFulfilledAPIRequests == "1" {
@@ -0,0 +1,238 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const (
+	// Modes of a chain API archive
+	ChainAPIArchiveRecord = "record"
+	ChainAPIArchiveReplay = "replay"
+)
+
+// A response of a chain API to a request made over HTTP
+type ChainAPIExchange struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	Request     []byte `json:"request,omitempty"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Response    []byte `json:"response"`
+}
+
+// Identifies a request to a chain API by its method, URL and body, leaving out credentials
+func chainAPIRequestHash(method string, url string, body []byte) string {
+	return sha256Hex([]byte(method+" "+url+"\n"), body)
+}
+
+// Holds the responses of chain APIs in a directory, with a file for each request that lists
+// its responses in the order they were received, one JSON line each. Requests to rippled over
+// ws:// or wss:// URLs do not go through HTTP, so they are neither recorded nor replayed.
+type ChainAPIArchive struct {
+	dir  string
+	lock sync.Mutex
+	// The responses to each request read so far in replay, and the number of them served
+	exchanges map[string][]ChainAPIExchange
+	replayed  map[string]int
+}
+
+func NewChainAPIArchive(dir string) *ChainAPIArchive {
+	return &ChainAPIArchive{dir: dir, exchanges: make(map[string][]ChainAPIExchange), replayed: make(map[string]int)}
+}
+
+func (archive *ChainAPIArchive) path(key string) string {
+	return filepath.Join(archive.dir, key+".jsonl")
+}
+
+// Reads the responses to a request. A last line cut short by a crash while recording is
+// left out.
+func (archive *ChainAPIArchive) read(key string) ([]ChainAPIExchange, error) {
+	data, err := ioutil.ReadFile(archive.path(key))
+	if err != nil {
+		return nil, err
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	var exchanges []ChainAPIExchange
+	for i, line := range lines[:len(lines)-1] {
+		var exchange ChainAPIExchange
+		if err := json.Unmarshal(line, &exchange); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", archive.path(key), i+1, err)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges, nil
+}
+
+// Appends a response to those of its request
+func (archive *ChainAPIArchive) Record(exchange ChainAPIExchange) error {
+	key := chainAPIRequestHash(exchange.Method, exchange.URL, exchange.Request)
+	line, err := json.Marshal(exchange)
+	if err != nil {
+		return err
+	}
+	archive.lock.Lock()
+	defer archive.lock.Unlock()
+	file, err := os.OpenFile(archive.path(key), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Returns the responses to a request in the order they were recorded, and the last one once
+// they have all been served. They are read from the archive on the first replay of the request.
+func (archive *ChainAPIArchive) Replay(method string, url string, body []byte) (ChainAPIExchange, error) {
+	key := chainAPIRequestHash(method, url, body)
+	archive.lock.Lock()
+	defer archive.lock.Unlock()
+	exchanges, ok := archive.exchanges[key]
+	if !ok {
+		var err error
+		exchanges, err = archive.read(key)
+		if err != nil && !os.IsNotExist(err) {
+			return ChainAPIExchange{}, err
+		}
+		archive.exchanges[key] = exchanges
+	}
+	if len(exchanges) == 0 {
+		return ChainAPIExchange{}, fmt.Errorf("no recorded response to %s %s", method, url)
+	}
+	i := archive.replayed[key]
+	if i >= len(exchanges) {
+		i = len(exchanges) - 1
+	}
+	archive.replayed[key] = i + 1
+	return exchanges[i], nil
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// Saves every response of the chain APIs to an archive
+type chainAPIRecorder struct {
+	archive   *ChainAPIArchive
+	transport http.RoundTripper
+}
+
+func (t chainAPIRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	exchange := ChainAPIExchange{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Request:     reqBody,
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Response:    respBody,
+	}
+	if err := t.archive.Record(exchange); err != nil {
+		return nil, fmt.Errorf("recording chain API response: %v", err)
+	}
+	return resp, nil
+}
+
+// Serves the responses of an archive in place of the chain APIs
+type chainAPIReplayer struct {
+	archive *ChainAPIArchive
+}
+
+func (t chainAPIReplayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	exchange, err := t.archive.Replay(req.Method, req.URL.String(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	if exchange.ContentType != "" {
+		header.Set("Content-Type", exchange.ContentType)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(exchange.Status) + " " + http.StatusText(exchange.Status),
+		StatusCode:    exchange.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(exchange.Response)),
+		ContentLength: int64(len(exchange.Response)),
+		Request:       req,
+	}, nil
+}
+
+// Records the responses of chain APIs over HTTP to the archive in dir, or replays them from it
+func ArchiveChainAPIs(dir string, mode string) error {
+	archive := NewChainAPIArchive(dir)
+	switch mode {
+	case ChainAPIArchiveRecord:
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		WrapChainAPITransport(func(transport http.RoundTripper) http.RoundTripper {
+			return chainAPIRecorder{archive: archive, transport: transport}
+		})
+	case ChainAPIArchiveReplay:
+		if _, err := os.Stat(dir); err != nil {
+			return err
+		}
+		WrapChainAPITransport(func(http.RoundTripper) http.RoundTripper {
+			return chainAPIReplayer{archive: archive}
+		})
+	default:
+		return fmt.Errorf("unknown chain API archive mode %q", mode)
+	}
+	return nil
+}
+
+// The node archives chain API responses in the directory CHAIN_API_ARCHIVE, in the mode
+// CHAIN_API_ARCHIVE_MODE, which is record unless set to replay
+func ArchiveChainAPIsFromEnv() error {
+	dir := os.Getenv("CHAIN_API_ARCHIVE")
+	if dir == "" {
+		return nil
+	}
+	mode := os.Getenv("CHAIN_API_ARCHIVE_MODE")
+	if mode == "" {
+		mode = ChainAPIArchiveRecord
+	}
+	return ArchiveChainAPIs(dir, mode)
+}
@@ -0,0 +1,161 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func postChainAPI(url string, body string) (int, string, error) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.SetBasicAuth("user", "secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(respBody), err
+}
+
+func TestChainAPIArchiveRecordAndReplay(t *testing.T) {
+	defer func(transport http.RoundTripper) { chainAPIs.store(transport) }(chainAPIs.load())
+	dir, err := ioutil.TempDir("", "chain-api-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A chain API whose latest ledger advances with each request
+	ledger := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !bytes.Equal(body, []byte(`{"method":"ledger_current"}`)) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ledger++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"result":{"ledger_current_index":%d}}`, ledger)
+	}))
+
+	if err := ArchiveChainAPIs(dir, ChainAPIArchiveRecord); err != nil {
+		t.Fatal(err)
+	}
+	var recorded []string
+	for i := 0; i < 2; i++ {
+		_, body, err := postChainAPI(server.URL, `{"method":"ledger_current"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded = append(recorded, body)
+	}
+	if status, _, err := postChainAPI(server.URL, `{"method":"unknown"}`); err != nil || status != http.StatusNotFound {
+		t.Fatalf("got status %d, %v", status, err)
+	}
+	server.Close()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(files) != 2 {
+		t.Fatalf("got archive files %v, want one for each request", files)
+	}
+	// Each response is appended as a line, and a line cut short by a crash is left out
+	for _, file := range files {
+		data, _ := ioutil.ReadFile(file)
+		if lines := bytes.Count(data, []byte("\n")); lines != 1 && lines != 2 {
+			t.Errorf("%s: got %d lines", file, lines)
+		}
+		if lines := bytes.Count(data, []byte("\n")); lines == 2 {
+			f, _ := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0644)
+			f.Write([]byte(`{"method":"POST","url":`))
+			f.Close()
+		}
+	}
+
+	chainAPIs.store(tr)
+	if err := ArchiveChainAPIs(dir, ChainAPIArchiveReplay); err != nil {
+		t.Fatal(err)
+	}
+	// Responses are served in the order they were recorded, repeating the last one
+	for i, want := range append(recorded, recorded[1]) {
+		if _, body, err := postChainAPI(server.URL, `{"method":"ledger_current"}`); err != nil || body != want {
+			t.Errorf("replay %d: got %q, %v, want %q", i, body, err, want)
+		}
+	}
+	if status, _, err := postChainAPI(server.URL, `{"method":"unknown"}`); err != nil || status != http.StatusNotFound {
+		t.Errorf("got status %d, %v, want the recorded status", status, err)
+	}
+	if _, _, err := postChainAPI(server.URL, `{"method":"ledger_closed"}`); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Errorf("got %v for a request that was not recorded", err)
+	}
+}
+
+func TestChainAPIArchiveFromEnv(t *testing.T) {
+	defer func(transport http.RoundTripper) { chainAPIs.store(transport) }(chainAPIs.load())
+	os.Setenv("CHAIN_API_ARCHIVE", filepath.Join(os.TempDir(), "chain-api-archive-missing"))
+	defer os.Unsetenv("CHAIN_API_ARCHIVE")
+	os.Setenv("CHAIN_API_ARCHIVE_MODE", "replay")
+	defer os.Unsetenv("CHAIN_API_ARCHIVE_MODE")
+	if err := ArchiveChainAPIsFromEnv(); err == nil {
+		t.Errorf("expected replay from a missing archive to fail")
+	}
+	os.Setenv("CHAIN_API_ARCHIVE_MODE", "playback")
+	if err := ArchiveChainAPIsFromEnv(); err == nil {
+		t.Errorf("expected an unknown mode to fail")
+	}
+}
+
+// A past verdict is reached again from the archive once the chain API is gone
+func TestReadChainReplay(t *testing.T) {
+	defer func(transport http.RoundTripper) { chainAPIs.store(transport) }(chainAPIs.load())
+	dir, err := ioutil.TempDir("", "chain-api-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := newXRPFixtureServer(xrpPaymentWithReferenceFixture)
+	os.Setenv("XRP_APIs", server.URL)
+	defer os.Unsetenv("XRP_APIs")
+
+	blockTime := big.NewInt(0)
+	selector := GetProvePaymentFinalitySelector(blockTime)
+	txId := "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A"
+	checkRet := make([]byte, 192+len(txId))
+	binary.BigEndian.PutUint32(checkRet[28:32], 3)
+	binary.BigEndian.PutUint64(checkRet[56:64], 62880010)
+	binary.BigEndian.PutUint64(checkRet[88:96], 62880100)
+	copy(checkRet[96:128], common.HexToHash("716f54bafa5c2314f7d953f84c82efe31d1d6e1cabf41ef94f0eaf4789c46929").Bytes())
+	binary.BigEndian.PutUint64(checkRet[152:160], 160)
+	binary.BigEndian.PutUint64(checkRet[184:192], uint64(len(txId)))
+	copy(checkRet[192:], txId)
+	if err := ArchiveChainAPIs(dir, ChainAPIArchiveRecord); err != nil {
+		t.Fatal(err)
+	}
+	if !ReadChain(common.Address{}, blockTime, selector, checkRet) {
+		t.Fatalf("expected the payment to be verified")
+	}
+	server.Close()
+
+	chainAPIs.store(tr)
+	if err := ArchiveChainAPIs(dir, ChainAPIArchiveReplay); err != nil {
+		t.Fatal(err)
+	}
+	if !ReadChain(common.Address{}, blockTime, selector, checkRet) {
+		t.Errorf("expected the replayed payment to be verified")
+	}
+}
@@ -0,0 +1,303 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// Events of the audit log
+	AuditCommit          = "commit"
+	AuditReveal          = "reveal"
+	AuditVerification    = "verification"
+	AuditPreVerification = "pre-verification"
+
+	AuditAccepted = "accepted"
+	AuditRejected = "rejected"
+
+	defaultAuditLogMaxSize = 100 * 1024 * 1024
+	// Appended to the path of an audit log file when it is rotated
+	auditLogRotationFormat = "20060102T150405.000000000Z"
+)
+
+// A request made to a chain API over HTTP while verifying a proof, and its response. The
+// digest of a request is also the name of its file in a chain API archive.
+type AuditExchange struct {
+	URL            string `json:"url"`
+	RequestSHA256  string `json:"requestSha256"`
+	Status         int    `json:"status,omitempty"`
+	ResponseSHA256 string `json:"responseSha256,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// The result of a chain API queried by ReadChain. Exchanges hold every request made to the
+// API during the query, including those of other proofs verified against it at the same time.
+type AuditEndpoint struct {
+	URL       string          `json:"url"`
+	Verified  bool            `json:"verified"`
+	APIError  bool            `json:"apiError"`
+	Exchanges []AuditExchange `json:"exchanges,omitempty"`
+}
+
+// A decision of the state connector. Commit and reveal records are written when a block
+// executes a proof, verification records when the node verifies a proof against the chain APIs.
+type AuditRecord struct {
+	Time                 time.Time       `json:"time"`
+	Event                string          `json:"event"`
+	Block                *big.Int        `json:"block,omitempty"`
+	BlockTime            *big.Int        `json:"blockTime"`
+	Sender               common.Address  `json:"sender"`
+	ChainId              uint32          `json:"chainId"`
+	Selector             hexutil.Bytes   `json:"selector"`
+	Ledger               uint64          `json:"ledger"`
+	FinalisedLedgerIndex uint64          `json:"finalisedLedgerIndex"`
+	Hash                 common.Hash     `json:"hash"`
+	TxId                 string          `json:"txId,omitempty"`
+	VerificationHash     string          `json:"verificationHash"`
+	CheckRet             hexutil.Bytes   `json:"checkRet"`
+	Endpoints            []AuditEndpoint `json:"endpoints,omitempty"`
+	Verdict              string          `json:"verdict"`
+	Reason               string          `json:"reason"`
+}
+
+func NewAuditRecord(event string, sender common.Address, blockNumber *big.Int, blockTime *big.Int, functionSelector []byte, checkRet []byte) *AuditRecord {
+	head, _ := UnpackCheckRetHead(checkRet)
+	record := &AuditRecord{
+		Time:                 time.Now().UTC(),
+		Event:                event,
+		Block:                blockNumber,
+		BlockTime:            blockTime,
+		Sender:               sender,
+		ChainId:              head.ChainId,
+		Selector:             append([]byte{}, functionSelector...),
+		Ledger:               head.Ledger,
+		FinalisedLedgerIndex: head.FinalisedLedgerIndex,
+		Hash:                 head.Hash,
+		VerificationHash:     GetVerificationHash(checkRet),
+		CheckRet:             append([]byte{}, checkRet...),
+	}
+	// The txId of payment proofs, the address of balance proofs or the filter of non-payment
+	// proofs
+	record.TxId, _ = GetCheckRetString(blockTime, functionSelector, checkRet)
+	return record
+}
+
+func (record *AuditRecord) setVerdict(verified bool, reason string) {
+	record.Verdict = AuditRejected
+	if verified {
+		record.Verdict = AuditAccepted
+	}
+	record.Reason = reason
+}
+
+// Appends records to the JSONL file at path, starting a new file once it reaches maxSize
+type auditLog struct {
+	lock    sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+func (l *auditLog) write(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.file != nil && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		l.file.Close()
+		l.file = nil
+		if err := os.Rename(l.path, l.path+"."+time.Now().UTC().Format(auditLogRotationFormat)); err != nil {
+			return err
+		}
+	}
+	if l.file == nil {
+		if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		l.file, l.size = file, info.Size()
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+var (
+	auditLogLock sync.Mutex
+	// The audit log at STATE_CONNECTOR_AUDIT_LOG, nil while no path is set
+	stateConnectorAuditLog *auditLog
+)
+
+// Audit logging is enabled by setting STATE_CONNECTOR_AUDIT_LOG to the path of the log, whose
+// files are rotated at STATE_CONNECTOR_AUDIT_LOG_MAX_SIZE bytes
+func getAuditLog() *auditLog {
+	path := os.Getenv("STATE_CONNECTOR_AUDIT_LOG")
+	auditLogLock.Lock()
+	defer auditLogLock.Unlock()
+	if stateConnectorAuditLog != nil && stateConnectorAuditLog.path == path {
+		return stateConnectorAuditLog
+	}
+	if stateConnectorAuditLog != nil {
+		stateConnectorAuditLog.lock.Lock()
+		if stateConnectorAuditLog.file != nil {
+			stateConnectorAuditLog.file.Close()
+		}
+		stateConnectorAuditLog.lock.Unlock()
+		stateConnectorAuditLog = nil
+	}
+	if path == "" {
+		return nil
+	}
+	maxSize := int64(defaultAuditLogMaxSize)
+	if size, err := strconv.ParseInt(os.Getenv("STATE_CONNECTOR_AUDIT_LOG_MAX_SIZE"), 10, 64); err == nil && size > 0 {
+		maxSize = size
+	}
+	stateConnectorAuditLog = &auditLog{path: path, maxSize: maxSize}
+	auditTransportOnce.Do(func() {
+		WrapChainAPITransport(func(transport http.RoundTripper) http.RoundTripper {
+			return auditTransport{transport: transport}
+		})
+	})
+	return stateConnectorAuditLog
+}
+
+// Writes a record to the audit log, if enabled. Failing to write it does not affect the decision.
+func writeAuditRecord(record *AuditRecord) {
+	if record == nil {
+		return
+	}
+	if auditLog := getAuditLog(); auditLog != nil {
+		if err := auditLog.write(record); err != nil {
+			log.Error("Failed to write state connector audit log", "path", auditLog.path, "err", err)
+		}
+	}
+}
+
+// Starts a record of a decision if audit logging is enabled, and returns nil otherwise
+func startAuditRecord(event string, sender common.Address, blockNumber *big.Int, blockTime *big.Int, functionSelector []byte, checkRet []byte) *AuditRecord {
+	if getAuditLog() == nil {
+		return nil
+	}
+	return NewAuditRecord(event, sender, blockNumber, blockTime, functionSelector, checkRet)
+}
+
+// Collects the exchanges with a chain API while ReadChain queries it
+type auditCollector struct {
+	chainURL  string
+	exchanges []AuditExchange
+}
+
+var (
+	auditTransportOnce sync.Once
+	auditCollectorLock sync.Mutex
+	auditCollectors    = make(map[*auditCollector]bool)
+)
+
+func startAuditCollector(chainURL string) *auditCollector {
+	collector := &auditCollector{chainURL: strings.TrimSuffix(chainURL, "/")}
+	auditCollectorLock.Lock()
+	auditCollectors[collector] = true
+	auditCollectorLock.Unlock()
+	return collector
+}
+
+func (collector *auditCollector) stop() []AuditExchange {
+	auditCollectorLock.Lock()
+	defer auditCollectorLock.Unlock()
+	delete(auditCollectors, collector)
+	return collector.exchanges
+}
+
+func collectingAuditExchanges(url string) bool {
+	auditCollectorLock.Lock()
+	defer auditCollectorLock.Unlock()
+	for collector := range auditCollectors {
+		if strings.HasPrefix(url, collector.chainURL) {
+			return true
+		}
+	}
+	return false
+}
+
+func addAuditExchange(exchange AuditExchange) {
+	auditCollectorLock.Lock()
+	defer auditCollectorLock.Unlock()
+	for collector := range auditCollectors {
+		if strings.HasPrefix(exchange.URL, collector.chainURL) {
+			collector.exchanges = append(collector.exchanges, exchange)
+		}
+	}
+}
+
+func sha256Hex(data ...[]byte) string {
+	hash := sha256.New()
+	for _, d := range data {
+		hash.Write(d)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Digests the requests to chain APIs that are being audited, and their responses
+type auditTransport struct {
+	transport http.RoundTripper
+}
+
+func (t auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	if !collectingAuditExchanges(url) {
+		return t.transport.RoundTrip(req)
+	}
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	exchange := AuditExchange{URL: url, RequestSHA256: chainAPIRequestHash(req.Method, url, reqBody)}
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		exchange.Error = err.Error()
+		addAuditExchange(exchange)
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	exchange.Status = resp.StatusCode
+	if err != nil {
+		exchange.Error = err.Error()
+		addAuditExchange(exchange)
+		return nil, err
+	}
+	exchange.ResponseSHA256 = sha256Hex(respBody)
+	addAuditExchange(exchange)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
@@ -0,0 +1,199 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func readAuditRecords(t *testing.T, path string) []AuditRecord {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid audit record %s: %v", scanner.Bytes(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// Enables audit logging to a file in a new directory, which is also the working directory
+func enableAuditLog(t *testing.T, maxSize string) (string, func()) {
+	dir, err := ioutil.TempDir("", "state-connector-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "audit", "state_connector.jsonl")
+	os.Setenv("STATE_CONNECTOR_AUDIT_LOG", path)
+	os.Setenv("STATE_CONNECTOR_AUDIT_LOG_MAX_SIZE", maxSize)
+	return path, func() {
+		os.Unsetenv("STATE_CONNECTOR_AUDIT_LOG")
+		os.Unsetenv("STATE_CONNECTOR_AUDIT_LOG_MAX_SIZE")
+		getAuditLog()
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAuditVerification(t *testing.T) {
+	path, cleanup := enableAuditLog(t, "")
+	defer cleanup()
+	if err := os.Mkdir("cache", 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(delay time.Duration) { apiRetryDelay = delay }(apiRetryDelay)
+	apiRetryDelay = 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("unavailable"))
+	}))
+	defer server.Close()
+	os.Setenv("XRP_APIs", server.URL)
+	defer os.Unsetenv("XRP_APIs")
+
+	blockTime := big.NewInt(0)
+	selector := GetProveDataAvailabilityPeriodFinalitySelector(blockTime)
+	sender := common.HexToAddress("0xffC11262622D5069aBad729efF56e5Aa4e9B9c44")
+	// Data availability proofs return the number of confirmations they require in place of a
+	// finalised ledger index
+	checkRet := make([]byte, 128)
+	checkRet[31] = 3
+	binary.BigEndian.PutUint64(checkRet[56:64], 62880010)
+	binary.BigEndian.PutUint64(checkRet[88:96], 6)
+	copy(checkRet[96:128], common.HexToHash("0x716f54ba").Bytes())
+	verifyToCache(sender, big.NewInt(7), blockTime, selector, checkRet)
+	reveal := append([]byte{}, checkRet...)
+	binary.BigEndian.PutUint64(reveal[88:96], 0)
+	// The verdict of the reveal is found by its chainId, ledger and hash
+	if StateConnectorCall(sender, big.NewInt(8), blockTime, selector, reveal) {
+		t.Errorf("expected the reveal to be rejected")
+	}
+
+	records := readAuditRecords(t, path)
+	if len(records) != 2 {
+		t.Fatalf("got %d audit records, want 2", len(records))
+	}
+	verification := records[0]
+	if verification.Event != AuditVerification || verification.Block.Int64() != 7 || verification.Sender != sender || verification.ChainId != 3 ||
+		verification.Ledger != 62880010 || verification.FinalisedLedgerIndex != 6 || verification.Hash != common.HexToHash("0x716f54ba") {
+		t.Errorf("unexpected verification record %+v", verification)
+	}
+	if verification.Verdict != AuditRejected || verification.Reason != "no chain API was available" || verification.VerificationHash != GetVerificationHash(checkRet) {
+		t.Errorf("unexpected verdict %q, reason %q", verification.Verdict, verification.Reason)
+	}
+	if len(verification.Endpoints) != apiRetries {
+		t.Fatalf("got %d endpoints queried, want %d", len(verification.Endpoints), apiRetries)
+	}
+	endpoint := verification.Endpoints[0]
+	if endpoint.URL != server.URL || endpoint.Verified || !endpoint.APIError || len(endpoint.Exchanges) == 0 {
+		t.Fatalf("unexpected endpoint %+v", endpoint)
+	}
+	if exchange := endpoint.Exchanges[0]; exchange.Status != 200 || exchange.ResponseSHA256 != sha256Hex([]byte("unavailable")) {
+		t.Errorf("unexpected exchange %+v", exchange)
+	}
+	if reveal := records[1]; reveal.Event != AuditReveal || reveal.Block.Int64() != 8 || reveal.Verdict != AuditRejected || reveal.Reason != "rejected in the cache" || reveal.VerificationHash != verification.VerificationHash {
+		t.Errorf("unexpected reveal record %+v", reveal)
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	path, cleanup := enableAuditLog(t, "1000")
+	defer cleanup()
+	checkRet := make([]byte, 128)
+	for i := 0; i < 3; i++ {
+		record := startAuditRecord(AuditCommit, common.Address{}, big.NewInt(int64(i)), big.NewInt(0), GetProvePaymentFinalitySelector(big.NewInt(0)), checkRet)
+		record.setVerdict(true, "committed to, verification started")
+		writeAuditRecord(record)
+		time.Sleep(time.Millisecond)
+	}
+	rotated, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each record is over half the maximum size, so every file holds one
+	if len(rotated) != 2 {
+		t.Fatalf("got rotated files %v, want 2", rotated)
+	}
+	for i, file := range append(rotated, path) {
+		if records := readAuditRecords(t, file); len(records) != 1 || records[0].Block.Int64() != int64(i) {
+			t.Errorf("%s: unexpected records %+v", file, records)
+		}
+	}
+}
+
+// Requests to rippled over a WebSocket connection are digested as the JSON-RPC requests they
+// stand for
+func TestAuditXRPWebSocketExchanges(t *testing.T) {
+	stream := NewXRPLedgerStream("wss://xrplcluster.com")
+	close(stream.synced)
+	payload, _ := json.Marshal(GetXRPTxRequestPayload{
+		Method: "tx",
+		Params: []GetXRPTxRequestParams{{Transaction: "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A"}},
+	})
+	collector := startAuditCollector(stream.chainURL)
+	// A disconnected stream fails the request at once
+	if _, err := stream.Request(payload); !err {
+		t.Errorf("expected a request over a disconnected stream to be an API error")
+	}
+	exchanges := collector.stop()
+	if len(exchanges) != 1 {
+		t.Fatalf("got %d exchanges, want 1", len(exchanges))
+	}
+	if exchange := exchanges[0]; exchange.URL != stream.chainURL || exchange.RequestSHA256 != chainAPIRequestHash(http.MethodPost, stream.chainURL, payload) || exchange.Error == "" {
+		t.Errorf("unexpected exchange %+v", exchange)
+	}
+}
+
+// The audit log wraps the transport of chain APIs when it is first enabled, which may happen
+// while other proofs are being verified
+func TestWrapChainAPITransportWhileRequesting(t *testing.T) {
+	defer func(transport http.RoundTripper) { chainAPIs.store(transport) }(chainAPIs.load())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			if resp, err := client.Get(server.URL); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		WrapChainAPITransport(func(transport http.RoundTripper) http.RoundTripper {
+			return auditTransport{transport: transport}
+		})
+	}
+	<-done
+	if resp, err := client.Get(server.URL); err != nil {
+		t.Errorf("got %v through the wrapped transport", err)
+	} else {
+		resp.Body.Close()
+	}
+}
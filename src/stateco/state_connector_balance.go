@@ -0,0 +1,184 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Balance proofs commit to the amount held by an address at a ledger on an underlying chain:
+// keccak256(keccak256(address), keccak256(amount), keccak256(currency)). The checkRet layout
+// matches that of payment proofs, with the address in place of the txId. XRP servers report
+// the balance of an account at any ledger they hold. UTXO chain balances are read from the
+// address index of Esplora at the tip and unwound to the ledger, which bitcoind cannot do
+// without replaying every block since, so only Esplora APIs verify UTXO balance proofs.
+
+var (
+	// Maximum number of Esplora pages of transactions unwound from the tip of a UTXO chain
+	maxPoWBalanceTxPages = 8
+)
+
+func GetBalanceHash(address string, amount uint64, currency string) []byte {
+	addressHash := crypto.Keccak256([]byte(address))
+	amountHash := crypto.Keccak256(common.LeftPadBytes(common.FromHex(hexutil.EncodeUint64(amount)), 32))
+	currencyHash := crypto.Keccak256([]byte(currency))
+	return crypto.Keccak256(addressHash, amountHash, currencyHash)
+}
+
+// =======================================================
+// Proof of Work
+// =======================================================
+
+// Returns the amount an Esplora transaction paid to an address and the amount it spent
+// from it
+func GetEsploraAddressDelta(tx GetEsploraTxResult, address string) (uint64, uint64) {
+	received, spent := uint64(0), uint64(0)
+	for _, vout := range tx.Vout {
+		if vout.ScriptPubKeyAddress == address {
+			received += vout.Value
+		}
+	}
+	for _, vin := range tx.Vin {
+		if vin.Prevout != nil && vin.Prevout.ScriptPubKeyAddress == address {
+			spent += vin.Prevout.Value
+		}
+	}
+	return received, spent
+}
+
+// Reads the balance of an address at the tip and unwinds every transaction confirmed after the
+// ledger, newest first. The tip is read before and after the unwind so that a block or reorg
+// in between cannot mix two states of the index. An address with more transactions after the
+// ledger than fit in maxPoWBalanceTxPages pages has no provable balance.
+func GetEsploraBalance(address string, ledger uint64, chainURL string, username string, password string) (uint64, bool, bool) {
+	tipHash, err := GetEsploraTipHash(chainURL, username, password)
+	if err {
+		return 0, false, true
+	}
+	blockCount, err := GetEsploraBlockCount(chainURL, username, password)
+	if err || blockCount < ledger {
+		return 0, false, true
+	}
+	balance, err := GetEsploraAddressBalance(address, chainURL, username, password)
+	if err {
+		return 0, false, true
+	}
+	lastTxID := ""
+	unwound := false
+	for page := 0; page < maxPoWBalanceTxPages && !unwound; page++ {
+		txs, err := GetEsploraAddressTxs(address, lastTxID, chainURL, username, password)
+		if err {
+			return 0, false, true
+		}
+		for _, tx := range txs {
+			if !tx.Status.Confirmed || tx.Status.BlockHeight > blockCount {
+				return 0, false, true
+			}
+			if tx.Status.BlockHeight <= ledger {
+				unwound = true
+				break
+			}
+			received, spent := GetEsploraAddressDelta(tx, address)
+			if balance+spent < received {
+				return 0, false, true
+			}
+			balance = balance + spent - received
+			lastTxID = tx.TxID
+		}
+		if len(txs) < esploraAddressTxsPageSize {
+			// The whole history of the address was read
+			unwound = true
+		}
+	}
+	if !unwound {
+		return 0, false, false
+	}
+	finalTipHash, err := GetEsploraTipHash(chainURL, username, password)
+	if err || finalTipHash != tipHash {
+		return 0, false, true
+	}
+	return balance, true, false
+}
+
+// Only Esplora APIs can report the balance of an address at a past block, so the JSON-RPC APIs
+// of a chain are unavailable for balance proofs
+func ProveBalanceFinalityPoW(checkRet []byte, chain UTXOChainConfig, chainURL string, username string, password string) (bool, bool) {
+	out, ok := UnpackStateConnectorProofsProveBalanceFinality(checkRet)
+	if !ok || !IsUTXOChainAddress(chain, out.Address) || out.Ledger >= out.FinalisedLedgerIndex {
+		return false, false
+	}
+	if chain.Backend != powBackendEsplora {
+		return false, true
+	}
+	balance, found, err := GetEsploraBalance(out.Address, out.Ledger, chainURL, username, password)
+	if err {
+		return false, true
+	}
+	if found && bytes.Equal(GetBalanceHash(out.Address, balance, chain.CurrencyCode), out.BalanceHash[:]) {
+		return true, false
+	}
+	return false, false
+}
+
+// =======================================================
+// XRP
+// =======================================================
+
+type GetXRPAccountInfoRequestParams struct {
+	Account     string `json:"account"`
+	LedgerIndex uint64 `json:"ledger_index"`
+	Strict      bool   `json:"strict"`
+}
+type GetXRPAccountInfoResponse struct {
+	AccountData struct {
+		Account string `json:"Account"`
+		Balance string `json:"Balance"`
+	} `json:"account_data"`
+	LedgerIndex uint64 `json:"ledger_index"`
+	Validated   bool   `json:"validated"`
+}
+
+func GetXRPBalance(address string, ledger uint64, chainURL string) (uint64, bool, bool) {
+	var accountInfo GetXRPAccountInfoResponse
+	respErrString, err := CallXRPRPC("account_info", GetXRPAccountInfoRequestParams{
+		Account:     address,
+		LedgerIndex: ledger,
+		Strict:      true,
+	}, &accountInfo, chainURL)
+	if err {
+		return 0, false, true
+	}
+	if respErrString != "" {
+		// Servers with a shorter ledger history than the requested ledger report lgrNotFound
+		return 0, false, IsXRPServerError(respErrString) || respErrString == "lgrNotFound"
+	}
+	if !accountInfo.Validated || accountInfo.LedgerIndex != ledger || accountInfo.AccountData.Account != address {
+		return 0, false, false
+	}
+	balance, err2 := strconv.ParseUint(accountInfo.AccountData.Balance, 10, 64)
+	if err2 != nil {
+		return 0, false, false
+	}
+	return balance, true, false
+}
+
+func ProveBalanceFinalityXRP(checkRet []byte, chainURL string) (bool, bool) {
+	out, ok := UnpackStateConnectorProofsProveBalanceFinality(checkRet)
+	if !ok || out.Address == "" || out.Ledger >= out.FinalisedLedgerIndex {
+		return false, false
+	}
+	balance, found, err := GetXRPBalance(out.Address, out.Ledger, chainURL)
+	if err {
+		return false, true
+	}
+	if found && bytes.Equal(GetBalanceHash(out.Address, balance, "xrp"), out.BalanceHash[:]) {
+		return true, false
+	}
+	return false, false
+}
@@ -0,0 +1,279 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PoW APIs are bitcoind JSON-RPC servers unless <prefix>_T_<checksum> selects the Esplora REST
+// API served by electrs. Esplora responses are translated into their bitcoind equivalents, so
+// that data availability proofs and every variant of payment proof reach the verdicts they
+// reach through bitcoind, and both types of API can be mixed within a quorum. Esplora cannot
+// scan blocks, so its APIs are unavailable for non-payment proofs. Its address index is what
+// balance proofs are verified through instead, which bitcoind has no equivalent of.
+
+const (
+	powBackendEsplora = "esplora"
+	// Number of confirmed transactions in each page of /address/<address>/txs/chain
+	esploraAddressTxsPageSize = 25
+)
+
+var (
+	esploraScriptPubKeyTypes = map[string]string{
+		"p2pk":                 "pubkey",
+		"p2pkh":                "pubkeyhash",
+		"p2sh":                 "scripthash",
+		"v0_p2wpkh":            "witness_v0_keyhash",
+		"v0_p2wsh":             "witness_v0_scripthash",
+		"v1_p2tr":              "witness_v1_taproot",
+		"multisig":             "multisig",
+		"op_return":            "nulldata",
+		"unknown":              "nonstandard",
+		"provably_unspendable": "nonstandard",
+	}
+)
+
+// Issues a GET request against an Esplora server, decoding a JSON result or, for a *string
+// result, the plain text body. Returns whether the resource was not found and true on any other
+// failure.
+func CallEsplora(path string, result interface{}, chainURL string, username string, password string) (bool, bool) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(chainURL, "/")+path, nil)
+	if err != nil {
+		return false, true
+	}
+	if username != "" && password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, true
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 {
+		return true, false
+	} else if resp.StatusCode != 200 {
+		return false, true
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, true
+	}
+	if text, ok := result.(*string); ok {
+		*text = strings.TrimSpace(string(respBody))
+		return false, false
+	}
+	return false, json.Unmarshal(respBody, result) != nil
+}
+
+func GetEsploraBlockCount(chainURL string, username string, password string) (uint64, bool) {
+	var tipHeight string
+	notFound, err := CallEsplora("/blocks/tip/height", &tipHeight, chainURL, username, password)
+	if notFound || err {
+		return 0, true
+	}
+	height, parseErr := strconv.ParseUint(tipHeight, 10, 64)
+	if parseErr != nil {
+		return 0, true
+	}
+	return height, false
+}
+
+func GetEsploraTipHash(chainURL string, username string, password string) (string, bool) {
+	var tipHash string
+	notFound, err := CallEsplora("/blocks/tip/hash", &tipHash, chainURL, username, password)
+	if notFound || err || tipHash == "" {
+		return "", true
+	}
+	return tipHash, false
+}
+
+// Mirrors getblockhash, for which a height above the tip is an RPC error
+func GetEsploraBlockHash(height uint64, chainURL string, username string, password string) (string, bool) {
+	var blockHash string
+	notFound, err := CallEsplora("/block-height/"+strconv.FormatUint(height, 10), &blockHash, chainURL, username, password)
+	if notFound || err || blockHash == "" {
+		return "", true
+	}
+	return blockHash, false
+}
+
+type GetEsploraBlockStatusResult struct {
+	InBestChain bool   `json:"in_best_chain"`
+	Height      uint64 `json:"height"`
+}
+
+// Mirrors GetPoWBlockHeader, counting confirmations from the tip of the best chain
+func GetEsploraBlockHeader(blockHash string, requiredConfirmations uint64, chainURL string, username string, password string) (uint64, bool) {
+	if blockHash == "" {
+		return 0, false
+	}
+	var status GetEsploraBlockStatusResult
+	notFound, err := CallEsplora("/block/"+blockHash+"/status", &status, chainURL, username, password)
+	if err {
+		return 0, true
+	} else if notFound || !status.InBestChain {
+		return 0, false
+	}
+	blockCount, err := GetEsploraBlockCount(chainURL, username, password)
+	if err {
+		return 0, true
+	}
+	if blockCount < status.Height || blockCount-status.Height+1 < requiredConfirmations {
+		return 0, false
+	}
+	return status.Height, false
+}
+
+type GetEsploraBlockResult struct {
+	ID         string `json:"id"`
+	Height     uint64 `json:"height"`
+	MedianTime uint64 `json:"mediantime"`
+}
+
+func GetEsploraBlockMedianTime(blockHash string, chainURL string, username string, password string) (uint64, bool) {
+	var block GetEsploraBlockResult
+	notFound, err := CallEsplora("/block/"+blockHash, &block, chainURL, username, password)
+	if notFound || err {
+		return 0, true
+	}
+	return block.MedianTime, false
+}
+
+type GetEsploraOutput struct {
+	ScriptPubKey        string `json:"scriptpubkey"`
+	ScriptPubKeyType    string `json:"scriptpubkey_type"`
+	ScriptPubKeyAddress string `json:"scriptpubkey_address"`
+	Value               uint64 `json:"value"`
+}
+type GetEsploraTxResult struct {
+	TxID string `json:"txid"`
+	Vin  []struct {
+		TxID       string            `json:"txid"`
+		Vout       uint64            `json:"vout"`
+		ScriptSig  string            `json:"scriptsig"`
+		IsCoinbase bool              `json:"is_coinbase"`
+		Prevout    *GetEsploraOutput `json:"prevout"`
+	} `json:"vin"`
+	Vout   []GetEsploraOutput `json:"vout"`
+	Status struct {
+		Confirmed   bool   `json:"confirmed"`
+		BlockHeight uint64 `json:"block_height"`
+		BlockHash   string `json:"block_hash"`
+	} `json:"status"`
+}
+
+// Converts an Esplora output into the scriptPubKey and amount reported by bitcoind
+func GetEsploraScriptPubKey(output GetEsploraOutput, chain UTXOChainConfig) (GetPoWScriptPubKey, float64) {
+	scriptPubKey := GetPoWScriptPubKey{
+		Hex:     output.ScriptPubKey,
+		Type:    esploraScriptPubKeyTypes[output.ScriptPubKeyType],
+		Address: output.ScriptPubKeyAddress,
+	}
+	if output.ScriptPubKeyAddress != "" {
+		// Also in the form of bitcoind before 22, for chains that do not read the address field
+		scriptPubKey.Addresses = []string{output.ScriptPubKeyAddress}
+	}
+	if scriptPubKey.Type == "" {
+		scriptPubKey.Type = "nonstandard"
+	}
+	return scriptPubKey, float64(output.Value) / math.Pow(10, float64(chain.Decimals))
+}
+
+// Mirrors GetPoWRawTx. A transaction unknown to bitcoind is an RPC error, so an unknown
+// transaction is treated as an API error here too.
+func GetEsploraTx(txID string, chain UTXOChainConfig, chainURL string, username string, password string) (GetPoWTxResult, bool) {
+	var esploraTx GetEsploraTxResult
+	notFound, err := CallEsplora("/tx/"+txID, &esploraTx, chainURL, username, password)
+	if notFound || err {
+		return GetPoWTxResult{}, true
+	}
+	tx := GetPoWTxResult{
+		TxID: esploraTx.TxID,
+	}
+	if esploraTx.Status.Confirmed {
+		blockCount, err := GetEsploraBlockCount(chainURL, username, password)
+		if err || blockCount < esploraTx.Status.BlockHeight {
+			return GetPoWTxResult{}, true
+		}
+		tx.BlockHash = esploraTx.Status.BlockHash
+		tx.Confirmations = blockCount - esploraTx.Status.BlockHeight + 1
+	}
+	tx.Vin = make([]struct {
+		Coinbase string `json:"coinbase"`
+		TxID     string `json:"txid"`
+		Vout     uint64 `json:"vout"`
+		Prevout  *struct {
+			Value        float64            `json:"value"`
+			ScriptPubKey GetPoWScriptPubKey `json:"scriptPubKey"`
+		} `json:"prevout"`
+	}, len(esploraTx.Vin))
+	for i, vin := range esploraTx.Vin {
+		if vin.IsCoinbase {
+			tx.Vin[i].Coinbase = vin.ScriptSig
+			continue
+		}
+		tx.Vin[i].TxID = vin.TxID
+		tx.Vin[i].Vout = vin.Vout
+		if vin.Prevout != nil {
+			tx.Vin[i].Prevout = &struct {
+				Value        float64            `json:"value"`
+				ScriptPubKey GetPoWScriptPubKey `json:"scriptPubKey"`
+			}{}
+			tx.Vin[i].Prevout.ScriptPubKey, tx.Vin[i].Prevout.Value = GetEsploraScriptPubKey(*vin.Prevout, chain)
+		}
+	}
+	tx.Vout = make([]struct {
+		Value        float64            `json:"value"`
+		N            uint64             `json:"n"`
+		ScriptPubKey GetPoWScriptPubKey `json:"scriptPubKey"`
+	}, len(esploraTx.Vout))
+	for i, vout := range esploraTx.Vout {
+		tx.Vout[i].N = uint64(i)
+		tx.Vout[i].ScriptPubKey, tx.Vout[i].Value = GetEsploraScriptPubKey(vout, chain)
+	}
+	return tx, false
+}
+
+type GetEsploraAddressResult struct {
+	Address    string `json:"address"`
+	ChainStats struct {
+		FundedTxoSum uint64 `json:"funded_txo_sum"`
+		SpentTxoSum  uint64 `json:"spent_txo_sum"`
+		TxCount      uint64 `json:"tx_count"`
+	} `json:"chain_stats"`
+}
+
+// Returns the confirmed balance of an address at the tip, in the smallest unit of the chain
+func GetEsploraAddressBalance(address string, chainURL string, username string, password string) (uint64, bool) {
+	var addressResult GetEsploraAddressResult
+	notFound, err := CallEsplora("/address/"+address, &addressResult, chainURL, username, password)
+	if notFound || err || addressResult.Address != address {
+		return 0, true
+	}
+	if addressResult.ChainStats.SpentTxoSum > addressResult.ChainStats.FundedTxoSum {
+		return 0, true
+	}
+	return addressResult.ChainStats.FundedTxoSum - addressResult.ChainStats.SpentTxoSum, false
+}
+
+// Returns a page of the confirmed transactions of an address, newest first, following the
+// transaction lastTxID ended the previous page with
+func GetEsploraAddressTxs(address string, lastTxID string, chainURL string, username string, password string) ([]GetEsploraTxResult, bool) {
+	path := "/address/" + address + "/txs/chain"
+	if lastTxID != "" {
+		path += "/" + lastTxID
+	}
+	var txs []GetEsploraTxResult
+	notFound, err := CallEsplora(path, &txs, chainURL, username, password)
+	if notFound || err {
+		return []GetEsploraTxResult{}, true
+	}
+	return txs, false
+}
@@ -0,0 +1,484 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ava-labs/coreth/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Payments on EVM chains are proven from their transaction receipts. The txId is either a
+// lowercase transaction hash, proving the native value sent by the transaction, or a transaction hash
+// followed by ":" and the decimal index of an ERC20 Transfer log within its block, proving the
+// tokens moved by that log. The payment hash follows the scheme used for other chains, with
+// lowercase hex addresses, the amount as a uint256, and for token transfers the lowercase hex
+// address of the token contract as the currency.
+
+// keccak256("Transfer(address,address,uint256)")
+var evmTransferEventTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+type EVMChainConfig struct {
+	Username      string
+	Password      string
+	Confirmations uint64
+	// Recompute the receipts root of the block that includes a payment from all of its receipts
+	VerifyReceiptsTrie bool
+}
+
+// Confirmations that the block of a payment on an EVM chain needs before it is proven
+func GetEVMConfirmations(blockTime *big.Int) uint64 {
+	return *GetUpgradeParams(blockTime, nil).EVMConfirmations
+}
+
+func GetVerifyEVMReceiptsTrie(blockTime *big.Int) bool {
+	return *GetUpgradeParams(blockTime, nil).VerifyEVMReceiptsTrie
+}
+
+// Reads the API credentials of an EVM chain from the environment. The verification settings
+// change verdicts, so they are set by the upgrade schedule.
+func GetEVMChainConfig(chainPrefix string, chainURL string, blockTime *big.Int) EVMChainConfig {
+	chainURLhash := sha256.Sum256([]byte(chainURL))
+	chainURLchecksum := hex.EncodeToString(chainURLhash[0:4])
+	return EVMChainConfig{
+		Username:           os.Getenv(chainPrefix + "_U_" + chainURLchecksum),
+		Password:           os.Getenv(chainPrefix + "_P_" + chainURLchecksum),
+		Confirmations:      GetEVMConfirmations(blockTime),
+		VerifyReceiptsTrie: GetVerifyEVMReceiptsTrie(blockTime),
+	}
+}
+
+type GetEVMRPCRequestPayload struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+type GetEVMRPCResp struct {
+	Result json.RawMessage `json:"result"`
+	Error  interface{}     `json:"error"`
+}
+
+// Calls an Ethereum JSON-RPC method and decodes its result, returning true on any transport or
+// RPC error. A null result, such as for an unknown transaction, leaves a pointer result nil.
+func CallEVMRPC(method string, params []interface{}, result interface{}, chainURL string, config EVMChainConfig) bool {
+	data := GetEVMRPCRequestPayload{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  method,
+		Params:  params,
+	}
+	payloadBytes, err := json.Marshal(data)
+	if err != nil {
+		return true
+	}
+	body := bytes.NewReader(payloadBytes)
+	req, err := http.NewRequest("POST", chainURL, body)
+	if err != nil {
+		return true
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if config.Username != "" && config.Password != "" {
+		req.SetBasicAuth(config.Username, config.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return true
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return true
+	}
+	var jsonResp GetEVMRPCResp
+	err = json.Unmarshal(respBody, &jsonResp)
+	if err != nil || jsonResp.Error != nil {
+		return true
+	}
+	if len(jsonResp.Result) == 0 {
+		return true
+	}
+	return json.Unmarshal(jsonResp.Result, result) != nil
+}
+
+type GetEVMLog struct {
+	Address  string   `json:"address"`
+	Topics   []string `json:"topics"`
+	Data     string   `json:"data"`
+	LogIndex string   `json:"logIndex"`
+	Removed  bool     `json:"removed"`
+}
+type GetEVMReceiptResult struct {
+	TransactionHash string      `json:"transactionHash"`
+	BlockHash       string      `json:"blockHash"`
+	BlockNumber     string      `json:"blockNumber"`
+	From            string      `json:"from"`
+	To              string      `json:"to"`
+	Status          string      `json:"status"`
+	Logs            []GetEVMLog `json:"logs"`
+	// Fields of the consensus encoding of the receipt. Root is only set before Byzantium.
+	Type              string `json:"type"`
+	Root              string `json:"root"`
+	CumulativeGasUsed string `json:"cumulativeGasUsed"`
+	LogsBloom         string `json:"logsBloom"`
+}
+type GetEVMTxResult struct {
+	Hash  string `json:"hash"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"`
+}
+type GetEVMBlockResult struct {
+	Hash         string   `json:"hash"`
+	Number       string   `json:"number"`
+	Timestamp    string   `json:"timestamp"`
+	ReceiptsRoot string   `json:"receiptsRoot"`
+	Transactions []string `json:"transactions"`
+}
+
+func GetEVMBlockNumber(chainURL string, config EVMChainConfig) (uint64, bool) {
+	var blockNumber string
+	if CallEVMRPC("eth_blockNumber", []interface{}{}, &blockNumber, chainURL, config) {
+		return 0, true
+	}
+	number, err := hexutil.DecodeUint64(blockNumber)
+	if err != nil {
+		return 0, true
+	}
+	return number, false
+}
+
+func GetEVMBlock(blockNumber uint64, chainURL string, config EVMChainConfig) (*GetEVMBlockResult, bool) {
+	var block *GetEVMBlockResult
+	if CallEVMRPC("eth_getBlockByNumber", []interface{}{hexutil.EncodeUint64(blockNumber), false}, &block, chainURL, config) {
+		return nil, true
+	}
+	return block, false
+}
+
+// Receipt types whose consensus encoding is known: legacy, access list, dynamic fee, blob and
+// set code transactions. Each typed receipt is its type byte followed by the same RLP list.
+const maxEVMReceiptType = 4
+
+type evmReceiptLog struct {
+	Address common.Address
+	Topics  []common.Hash
+	Data    []byte
+}
+
+// Returns the consensus encoding of a receipt, its EIP-2718 envelope for typed receipts. A
+// receipt of an unknown type, or with malformed fields, is an API error, since its encoding
+// cannot be derived and the receipts root of its block cannot be checked.
+func EncodeEVMReceipt(receipt *GetEVMReceiptResult) ([]byte, bool) {
+	receiptType := uint64(0)
+	if receipt.Type != "" {
+		var err error
+		if receiptType, err = hexutil.DecodeUint64(receipt.Type); err != nil || receiptType > maxEVMReceiptType {
+			return nil, true
+		}
+	}
+	var statusOrRoot []byte
+	if receipt.Root != "" {
+		root, err := hexutil.Decode(receipt.Root)
+		if err != nil || len(root) != common.HashLength {
+			return nil, true
+		}
+		statusOrRoot = root
+	} else if receipt.Status == "0x1" {
+		statusOrRoot = []byte{1}
+	} else if receipt.Status != "0x0" {
+		return nil, true
+	}
+	cumulativeGasUsed, err := hexutil.DecodeUint64(receipt.CumulativeGasUsed)
+	if err != nil {
+		return nil, true
+	}
+	bloom, err := hexutil.Decode(receipt.LogsBloom)
+	if err != nil || len(bloom) != 256 {
+		return nil, true
+	}
+	logs := make([]evmReceiptLog, len(receipt.Logs))
+	for i, txLog := range receipt.Logs {
+		if !common.IsHexAddress(txLog.Address) {
+			return nil, true
+		}
+		logs[i].Address = common.HexToAddress(txLog.Address)
+		for _, topic := range txLog.Topics {
+			topicBytes, err := hexutil.Decode(topic)
+			if err != nil || len(topicBytes) != common.HashLength {
+				return nil, true
+			}
+			logs[i].Topics = append(logs[i].Topics, common.BytesToHash(topicBytes))
+		}
+		if logs[i].Data, err = hexutil.Decode(txLog.Data); err != nil {
+			return nil, true
+		}
+	}
+	payload, err := rlp.EncodeToBytes([]interface{}{statusOrRoot, cumulativeGasUsed, bloom, logs})
+	if err != nil {
+		return nil, true
+	}
+	if receiptType == 0 {
+		return payload, false
+	}
+	return append([]byte{byte(receiptType)}, payload...), false
+}
+
+// Consensus encodings of the receipts of a block, in the order of its transactions
+type evmReceiptEncodings [][]byte
+
+func (encodings evmReceiptEncodings) Len() int { return len(encodings) }
+
+func (encodings evmReceiptEncodings) EncodeIndex(i int, w *bytes.Buffer) {
+	w.Write(encodings[i])
+}
+
+// Rebuilds the receipts trie of a block from the receipts of all of its transactions, fetched
+// at once, and returns the receipt of txHash among them. A receipt served by the API is thus
+// checked against the receipts root committed to by the block header.
+func VerifyEVMReceiptsTrie(block *GetEVMBlockResult, txHash string, chainURL string, config EVMChainConfig) (*GetEVMReceiptResult, bool) {
+	var receipts []*GetEVMReceiptResult
+	if CallEVMRPC("eth_getBlockReceipts", []interface{}{block.Hash}, &receipts, chainURL, config) {
+		return nil, true
+	}
+	if len(receipts) != len(block.Transactions) {
+		return nil, true
+	}
+	var txReceipt *GetEVMReceiptResult
+	encodings := make(evmReceiptEncodings, len(receipts))
+	for i, receipt := range receipts {
+		if receipt == nil || !strings.EqualFold(receipt.TransactionHash, block.Transactions[i]) {
+			return nil, true
+		}
+		encoding, err := EncodeEVMReceipt(receipt)
+		if err {
+			return nil, true
+		}
+		encodings[i] = encoding
+		if receipt.TransactionHash == txHash {
+			txReceipt = receipt
+		}
+	}
+	if types.DeriveSha(encodings, trie.NewStackTrie(nil)) != common.HexToHash(block.ReceiptsRoot) {
+		return nil, false
+	}
+	return txReceipt, false
+}
+
+// Decodes a uint256 from the 32-byte hex word of an ABI-encoded log data field
+func GetEVMWordAmount(data string) (*big.Int, bool) {
+	amountBytes, err := hex.DecodeString(strings.TrimPrefix(data, "0x"))
+	if err != nil || len(amountBytes) != 32 {
+		return nil, false
+	}
+	return new(big.Int).SetBytes(amountBytes), true
+}
+
+// Returns the topic as a lowercase hex address when it holds an ABI-encoded address
+func GetEVMTopicAddress(topic string) (string, bool) {
+	topicBytes, err := hex.DecodeString(strings.TrimPrefix(topic, "0x"))
+	if err != nil || len(topicBytes) != 32 || !bytes.Equal(topicBytes[:12], make([]byte, 12)) {
+		return "", false
+	}
+	return "0x" + hex.EncodeToString(topicBytes[12:]), true
+}
+
+// Returns the source, destination, amount and currency of the value transfer identified by a
+// txId, either the native value of the transaction or an ERC20 Transfer log of its receipt
+func GetEVMValueTransfer(receipt *GetEVMReceiptResult, txHash string, logIndex string, currencyCode string, chainURL string, config EVMChainConfig) (string, string, *big.Int, string, bool, bool) {
+	if logIndex == "" {
+		var tx *GetEVMTxResult
+		if CallEVMRPC("eth_getTransactionByHash", []interface{}{txHash}, &tx, chainURL, config) {
+			return "", "", nil, "", false, true
+		}
+		if tx == nil || tx.To == "" || !strings.EqualFold(tx.Hash, receipt.TransactionHash) {
+			return "", "", nil, "", false, false
+		}
+		amount, err := hexutil.DecodeBig(tx.Value)
+		if err != nil || amount.Sign() <= 0 {
+			return "", "", nil, "", false, false
+		}
+		return strings.ToLower(tx.From), strings.ToLower(tx.To), amount, currencyCode, true, false
+	}
+	index, err := strconv.ParseUint(logIndex, 10, 64)
+	if err != nil || strconv.FormatUint(index, 10) != logIndex {
+		return "", "", nil, "", false, false
+	}
+	for _, txLog := range receipt.Logs {
+		if number, err := hexutil.DecodeUint64(txLog.LogIndex); err != nil || number != index {
+			continue
+		}
+		// ERC721 Transfer events share the signature but index the token ID as a fourth topic
+		if txLog.Removed || len(txLog.Topics) != 3 || !strings.EqualFold(txLog.Topics[0], evmTransferEventTopic) {
+			return "", "", nil, "", false, false
+		}
+		source, ok := GetEVMTopicAddress(txLog.Topics[1])
+		if !ok {
+			return "", "", nil, "", false, false
+		}
+		destination, ok := GetEVMTopicAddress(txLog.Topics[2])
+		if !ok {
+			return "", "", nil, "", false, false
+		}
+		amount, ok := GetEVMWordAmount(txLog.Data)
+		if !ok || amount.Sign() <= 0 {
+			return "", "", nil, "", false, false
+		}
+		return source, destination, amount, strings.ToLower(txLog.Address), true, false
+	}
+	return "", "", nil, "", false, false
+}
+
+func GetEVMTx(txId string, latestAvailableBlock uint64, currencyCode string, variant PaymentProofVariant, window TimestampWindow, chainURL string, config EVMChainConfig) ([]byte, uint64, bool) {
+	if variant == PaymentProofReference {
+		// EVM transactions carry no standard payment reference
+		return []byte{}, 0, false
+	}
+	txHash, logIndex := txId, ""
+	if separator := strings.Index(txId, ":"); separator >= 0 {
+		txHash, logIndex = txId[:separator], txId[separator+1:]
+	}
+	// Only one spelling of each txId is accepted, so that a payment has a single payment hash
+	if decoded, err := hexutil.Decode(txHash); err != nil || len(decoded) != 32 || strings.ToLower(txHash) != txHash {
+		return []byte{}, 0, false
+	}
+	var receipt *GetEVMReceiptResult
+	if CallEVMRPC("eth_getTransactionReceipt", []interface{}{txHash}, &receipt, chainURL, config) {
+		return []byte{}, 0, true
+	}
+	if receipt == nil || receipt.TransactionHash != txHash || receipt.Status != "0x1" || receipt.BlockHash == "" {
+		return []byte{}, 0, false
+	}
+	inBlock, err := hexutil.DecodeUint64(receipt.BlockNumber)
+	if err != nil || inBlock == 0 || inBlock >= latestAvailableBlock {
+		return []byte{}, 0, false
+	}
+	blockNumber, getBlockNumberErr := GetEVMBlockNumber(chainURL, config)
+	if getBlockNumberErr {
+		return []byte{}, 0, true
+	}
+	if blockNumber < inBlock+config.Confirmations {
+		return []byte{}, 0, false
+	}
+	block, getBlockErr := GetEVMBlock(inBlock, chainURL, config)
+	if getBlockErr || block == nil {
+		return []byte{}, 0, true
+	}
+	if !strings.EqualFold(block.Hash, receipt.BlockHash) {
+		// The receipt was served from a block that is no longer canonical
+		return []byte{}, 0, true
+	}
+	if config.VerifyReceiptsTrie {
+		// The payment is read from the receipt committed to by the block
+		blockReceipt, verifyErr := VerifyEVMReceiptsTrie(block, txHash, chainURL, config)
+		if verifyErr {
+			return []byte{}, 0, true
+		} else if blockReceipt == nil || blockReceipt.Status != "0x1" {
+			return []byte{}, 0, false
+		}
+		receipt = blockReceipt
+	}
+	source, destination, amount, currency, ok, getValueTransferErr := GetEVMValueTransfer(receipt, txHash, logIndex, currencyCode, chainURL, config)
+	if getValueTransferErr {
+		return []byte{}, 0, true
+	} else if !ok {
+		return []byte{}, 0, false
+	}
+	destinationHash := GetDestinationHash(destination)
+	if variant == PaymentProofSource {
+		return GetPaymentHash(txId, destinationHash, amount, currency, GetSourceHash(source)), inBlock, false
+	} else if variant == PaymentProofTimestamp {
+		timestamp, err := hexutil.DecodeUint64(block.Timestamp)
+		if err != nil {
+			return []byte{}, 0, false
+		}
+		windowHash, ok := GetTimestampWindowHash(window, timestamp)
+		if !ok {
+			return []byte{}, 0, false
+		}
+		return GetPaymentHash(txId, destinationHash, amount, currency, windowHash), inBlock, false
+	}
+	return GetPaymentHash(txId, destinationHash, amount, currency), inBlock, false
+}
+
+func ProvePaymentFinalityEVM(checkRet []byte, isDisprove bool, variant PaymentProofVariant, currencyCode string, chainURL string, config EVMChainConfig) (bool, bool) {
+	out, window, ok := GetPaymentCheckRet(checkRet, variant)
+	if !ok {
+		return false, false
+	}
+	paymentHash, inBlock, err := GetEVMTx(out.TxId, out.FinalisedLedgerIndex, currencyCode, variant, window, chainURL, config)
+	if err {
+		return false, true
+	}
+	if !isDisprove {
+		if len(paymentHash) > 0 && bytes.Equal(paymentHash, out.PaymentHash[:]) && inBlock == out.Ledger {
+			return true, false
+		}
+	} else {
+		if len(paymentHash) > 0 && bytes.Equal(paymentHash, out.PaymentHash[:]) && inBlock > out.Ledger {
+			return true, false
+		} else if len(paymentHash) == 0 {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+func ProveDataAvailabilityPeriodFinalityEVM(checkRet []byte, chainURL string, config EVMChainConfig) (bool, bool) {
+	out, ok := UnpackStateConnectorProveDataAvailabilityPeriodFinality(checkRet)
+	if !ok {
+		return false, false
+	}
+	blockNumber, err := GetEVMBlockNumber(chainURL, config)
+	if err {
+		return false, true
+	}
+	if blockNumber < out.Ledger+uint64(out.NumConfirmations) {
+		return false, true
+	}
+	block, err := GetEVMBlock(out.Ledger, chainURL, config)
+	if err {
+		return false, true
+	}
+	if block != nil && common.HexToHash(block.Hash) == common.Hash(out.DataAvailabilityPeriodHash) {
+		return true, false
+	}
+	return false, false
+}
+
+func ProveEVM(sender common.Address, blockTime *big.Int, functionSelector []byte, checkRet []byte, currencyCode string, chainURL string) (bool, bool) {
+	var config EVMChainConfig
+	switch currencyCode {
+	case "eth":
+		config = GetEVMChainConfig("ETH", chainURL, blockTime)
+	}
+	if bytes.Equal(functionSelector, GetProveDataAvailabilityPeriodFinalitySelector(blockTime)) {
+		return ProveDataAvailabilityPeriodFinalityEVM(checkRet, chainURL, config)
+	} else if bytes.Equal(functionSelector, GetProvePaymentFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityEVM(checkRet, false, PaymentProofBasic, currencyCode, chainURL, config)
+	} else if bytes.Equal(functionSelector, GetDisprovePaymentFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityEVM(checkRet, true, PaymentProofBasic, currencyCode, chainURL, config)
+	} else if bytes.Equal(functionSelector, GetProvePaymentSourceFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityEVM(checkRet, false, PaymentProofSource, currencyCode, chainURL, config)
+	} else if bytes.Equal(functionSelector, GetProvePaymentTimestampFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityEVM(checkRet, false, PaymentProofTimestamp, currencyCode, chainURL, config)
+	}
+	return false, false
+}
@@ -0,0 +1,151 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"encoding/hex"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Commitments shared by the verifier and by the clients that build proofs for it. A payment
+// hash commits to the txId, destination, amount in the smallest unit and currency of a payment:
+// keccak256(keccak256(txId), destinationHash, keccak256(amount), keccak256(currency)), followed
+// by the commitment of its proof variant when it is not a basic payment proof.
+
+func GetPaymentHash(txId string, destinationHash []byte, amount *big.Int, currency string, variantHashes ...[]byte) []byte {
+	paymentHashes := [][]byte{
+		crypto.Keccak256([]byte(txId)),
+		destinationHash,
+		crypto.Keccak256(common.LeftPadBytes(amount.Bytes(), 32)),
+		crypto.Keccak256([]byte(currency)),
+	}
+	return crypto.Keccak256(append(paymentHashes, variantHashes...)...)
+}
+
+func GetDestinationHash(destination string) []byte {
+	return crypto.Keccak256([]byte(destination))
+}
+
+// XRP destinations are committed to together with their destination tag
+func GetXRPDestinationHash(destination string, destinationTag uint64) []byte {
+	return crypto.Keccak256(GetDestinationHash(destination), GetUint64Hash(destinationTag))
+}
+
+// Commits to the single account a payment is sent from
+func GetSourceHash(source string) []byte {
+	return crypto.Keccak256([]byte(source))
+}
+
+// Commits to the addresses spent from by a UTXO payment as a set: sorted, de-duplicated and
+// hashed in order
+func GetPoWSourceSetHash(sources []string) []byte {
+	sourceSet := make(map[string]bool)
+	for _, source := range sources {
+		sourceSet[source] = true
+	}
+	sortedSources := make([]string, 0, len(sourceSet))
+	for source := range sourceSet {
+		sortedSources = append(sortedSources, source)
+	}
+	sort.Strings(sortedSources)
+	sourceHashes := make([][]byte, len(sortedSources))
+	for i, source := range sortedSources {
+		sourceHashes[i] = GetSourceHash(source)
+	}
+	return crypto.Keccak256(sourceHashes...)
+}
+
+// The window, in Unix seconds and inclusive, that a timestamp proof claims the time of a
+// payment is within
+type TimestampWindow struct {
+	From uint64
+	To   uint64
+}
+
+// Commits to the window claimed for the time of a payment, if the time is within it
+func GetTimestampWindowHash(window TimestampWindow, timestamp uint64) ([]byte, bool) {
+	if timestamp < window.From || timestamp > window.To {
+		return []byte{}, false
+	}
+	return crypto.Keccak256(GetUint64Hash(window.From), GetUint64Hash(window.To)), true
+}
+
+func GetUint64Hash(value uint64) []byte {
+	return crypto.Keccak256(common.LeftPadBytes(common.FromHex(hexutil.EncodeUint64(value)), 32))
+}
+
+// XRP data availability proofs commit to the keccak256 hash of the ledger hash as reported by
+// rippled, the other chains to the bytes of their block or ledger hash
+func GetXRPLedgerHashCommitment(ledgerHash string) []byte {
+	return crypto.Keccak256([]byte(ledgerHash))
+}
+
+// Returns the commitment a data availability proof of a chain carries for a ledger hash
+func GetLedgerHashCommitment(chainId uint32, ledgerHash string) ([]byte, bool) {
+	if chainId == 3 {
+		return GetXRPLedgerHashCommitment(ledgerHash), ledgerHash != ""
+	}
+	hash, err := hex.DecodeString(strings.TrimPrefix(ledgerHash, "0x"))
+	if err != nil || len(hash) != 32 {
+		return []byte{}, false
+	}
+	return hash, true
+}
+
+// Returns the payment hash of an output of a transaction as reported by getrawtransaction. The
+// txId is the output index as a single hex digit followed by the transaction hash.
+func GetPoWPaymentHash(txId string, tx GetPoWTxResult, voutN uint64, chain UTXOChainConfig, variantHashes ...[]byte) ([]byte, bool) {
+	if uint64(len(tx.Vout)) <= voutN {
+		return []byte{}, false
+	}
+	destination, ok := GetPoWScriptPubKeyAddress(tx.Vout[voutN].ScriptPubKey, chain)
+	if !ok || tx.Vout[voutN].ScriptPubKey.Type != "pubkeyhash" {
+		return []byte{}, false
+	}
+	destinationHash := GetDestinationHash(destination)
+	amount := new(big.Int).SetUint64(uint64(GetUTXOChainUnits(chain, tx.Vout[voutN].Value)))
+	return GetPaymentHash(txId, destinationHash, amount, chain.CurrencyCode, variantHashes...), true
+}
+
+// Returns the payment hash of a transaction as reported by the rippled tx method
+func GetXRPPaymentHash(tx GetXRPTxResponse, variant PaymentProofVariant, window TimestampWindow) ([]byte, bool) {
+	if !tx.Validated || tx.Meta.TransactionResult != "tesSUCCESS" {
+		return []byte{}, false
+	}
+	destination, destinationTag, amount, currency, ok := GetXRPValueTransfer(tx)
+	if !ok {
+		return []byte{}, false
+	}
+	destinationHash := GetXRPDestinationHash(destination, uint64(destinationTag))
+	amountInt := new(big.Int).SetUint64(amount)
+	if variant == PaymentProofReference {
+		referenceHash, ok := GetXRPPaymentReferenceHash(tx)
+		if !ok {
+			return []byte{}, false
+		}
+		return GetPaymentHash(tx.Hash, destinationHash, amountInt, currency, referenceHash), true
+	} else if variant == PaymentProofSource {
+		if tx.Account == "" {
+			return []byte{}, false
+		}
+		return GetPaymentHash(tx.Hash, destinationHash, amountInt, currency, GetSourceHash(tx.Account)), true
+	} else if variant == PaymentProofTimestamp {
+		// The date of a validated transaction is the close time of its ledger
+		if tx.Date == 0 {
+			return []byte{}, false
+		}
+		windowHash, ok := GetTimestampWindowHash(window, tx.Date+xrpRippleEpochOffset)
+		if !ok {
+			return []byte{}, false
+		}
+		return GetPaymentHash(tx.Hash, destinationHash, amountInt, currency, windowHash), true
+	}
+	return GetPaymentHash(tx.Hash, destinationHash, amountInt, currency), true
+}
@@ -0,0 +1,210 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var ErrVerdictDiverged = errors.New("state connector verdicts diverged from finalized blocks")
+
+const defaultVerdictDivergenceWindow = time.Hour
+
+var (
+	verdictsCheckedCounter  = metrics.NewRegisteredCounter("state_connector/verdicts/checked", nil)
+	verdictsDivergedCounter = metrics.NewRegisteredCounter("state_connector/verdicts/diverged", nil)
+)
+
+// The outcome of a proof transaction in a finalized block. A verified reveal writes to the
+// state connector contract, which emits an event for it.
+type ProofOutcome struct {
+	Tx       common.Hash
+	Sender   common.Address
+	Data     []byte
+	Accepted bool
+}
+
+// A reveal that this node gave a different verdict than the network finalized
+type VerdictDivergence struct {
+	Time             time.Time      `json:"time"`
+	Block            uint64         `json:"block"`
+	Tx               common.Hash    `json:"tx"`
+	Sender           common.Address `json:"sender"`
+	ChainId          uint32         `json:"chainId"`
+	Ledger           uint64         `json:"ledger"`
+	VerificationHash string         `json:"verificationHash"`
+	LocalVerdict     string         `json:"localVerdict"`
+	Finalized        string         `json:"finalized"`
+}
+
+// The verdicts given to a reveal each time the node executed it in a block
+type localVerdicts struct {
+	checkRet []byte
+	accepted bool
+	rejected bool
+}
+
+// Compares the verdicts of this node on reveals with their outcome in finalized blocks.
+// Blocks are executed before they are finalized, and a block may be executed more than once,
+// or not finalized at all, so verdicts are held by height and block hash until a block of that
+// height is. Only the verdicts given in the finalized block itself are compared with it.
+type verdictMonitor struct {
+	lock     sync.Mutex
+	verdicts map[uint64]map[common.Hash]map[string]*localVerdicts
+	// Divergences within the window, from the oldest
+	divergences []VerdictDivergence
+	window      time.Duration
+}
+
+func newVerdictMonitor(window time.Duration) *verdictMonitor {
+	return &verdictMonitor{verdicts: make(map[uint64]map[common.Hash]map[string]*localVerdicts), window: window}
+}
+
+func proofKey(sender common.Address, data []byte) string {
+	return crypto.Keccak256Hash(sender.Bytes(), data).Hex()
+}
+
+func (m *verdictMonitor) record(blockNumber uint64, blockHash common.Hash, sender common.Address, data []byte, checkRet []byte, verified bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.verdicts[blockNumber] == nil {
+		m.verdicts[blockNumber] = make(map[common.Hash]map[string]*localVerdicts)
+	}
+	if m.verdicts[blockNumber][blockHash] == nil {
+		m.verdicts[blockNumber][blockHash] = make(map[string]*localVerdicts)
+	}
+	key := proofKey(sender, data)
+	verdicts := m.verdicts[blockNumber][blockHash][key]
+	if verdicts == nil {
+		verdicts = &localVerdicts{checkRet: append([]byte{}, checkRet...)}
+		m.verdicts[blockNumber][blockHash][key] = verdicts
+	}
+	if verified {
+		verdicts.accepted = true
+	} else {
+		verdicts.rejected = true
+	}
+}
+
+// Checks the outcomes of the proofs of a finalized block against the verdicts the node gave in
+// that block, and forgets the verdicts given at its height and below
+func (m *verdictMonitor) check(blockNumber uint64, blockHash common.Hash, outcomes []ProofOutcome, now time.Time) []VerdictDivergence {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var divergences []VerdictDivergence
+	for _, outcome := range outcomes {
+		verdicts := m.verdicts[blockNumber][blockHash][proofKey(outcome.Sender, outcome.Data)]
+		if verdicts == nil {
+			continue
+		}
+		verdictsCheckedCounter.Inc(1)
+		head, _ := UnpackCheckRetHead(verdicts.checkRet)
+		divergence := VerdictDivergence{
+			Time:             now,
+			Block:            blockNumber,
+			Tx:               outcome.Tx,
+			Sender:           outcome.Sender,
+			ChainId:          head.ChainId,
+			Ledger:           head.Ledger,
+			VerificationHash: GetVerificationHash(verdicts.checkRet),
+		}
+		switch {
+		case outcome.Accepted && verdicts.rejected:
+			divergence.LocalVerdict, divergence.Finalized = AuditRejected, AuditAccepted
+		case !outcome.Accepted && verdicts.accepted:
+			divergence.LocalVerdict, divergence.Finalized = AuditAccepted, AuditRejected
+		default:
+			continue
+		}
+		divergences = append(divergences, divergence)
+	}
+	for height := range m.verdicts {
+		if height <= blockNumber {
+			delete(m.verdicts, height)
+		}
+	}
+	m.divergences = append(m.divergences, divergences...)
+	m.expire(now)
+	return divergences
+}
+
+func (m *verdictMonitor) expire(now time.Time) {
+	i := 0
+	for i < len(m.divergences) && now.Sub(m.divergences[i].Time) > m.window {
+		i++
+	}
+	m.divergences = m.divergences[i:]
+}
+
+// Fails while there were divergences within the window, reporting the latest
+func (m *verdictMonitor) health(now time.Time) (interface{}, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.expire(now)
+	details := map[string]interface{}{"divergences": len(m.divergences), "window": m.window.String()}
+	if len(m.divergences) == 0 {
+		return details, nil
+	}
+	last := m.divergences[len(m.divergences)-1]
+	details["last"] = last
+	return details, fmt.Errorf("%w: %d in the last %s, the latest %s locally and %s in block %d for chain %d ledger %d",
+		ErrVerdictDiverged, len(m.divergences), m.window, last.LocalVerdict, last.Finalized, last.Block, last.ChainId, last.Ledger)
+}
+
+var (
+	stateConnectorMonitorOnce sync.Once
+	stateConnectorMonitor     *verdictMonitor
+)
+
+// Divergences are reported by the health check for STATE_CONNECTOR_DIVERGENCE_WINDOW, an hour
+// by default
+func getVerdictMonitor() *verdictMonitor {
+	stateConnectorMonitorOnce.Do(func() {
+		window := defaultVerdictDivergenceWindow
+		if duration, err := time.ParseDuration(os.Getenv("STATE_CONNECTOR_DIVERGENCE_WINDOW")); err == nil && duration > 0 {
+			window = duration
+		}
+		stateConnectorMonitor = newVerdictMonitor(window)
+	})
+	return stateConnectorMonitor
+}
+
+// Records the verdict of the node on a proof executed in a block. Only reveals are recorded,
+// as commits are accepted whatever their verdict. Blocks being built have no hash yet, and
+// their verdicts are recorded when the built block is executed again to verify it.
+func RecordStateConnectorVerdict(blockNumber *big.Int, blockHash common.Hash, sender common.Address, data []byte, checkRet []byte, verified bool) {
+	if head, ok := UnpackCheckRetHead(checkRet); blockHash == (common.Hash{}) || !ok || head.FinalisedLedgerIndex > 0 {
+		return
+	}
+	getVerdictMonitor().record(blockNumber.Uint64(), blockHash, sender, data, checkRet, verified)
+}
+
+// Compares the outcomes of the proofs of a finalized block with the verdicts of the node on
+// them in that block, logging each divergence
+func CheckStateConnectorVerdicts(blockNumber *big.Int, blockHash common.Hash, outcomes []ProofOutcome) []VerdictDivergence {
+	divergences := getVerdictMonitor().check(blockNumber.Uint64(), blockHash, outcomes, time.Now().UTC())
+	for _, divergence := range divergences {
+		verdictsDivergedCounter.Inc(1)
+		log.Warn("State connector verdict diverged from the finalized block, check the chain APIs",
+			"block", divergence.Block, "tx", divergence.Tx, "sender", divergence.Sender,
+			"chainId", divergence.ChainId, "ledger", divergence.Ledger, "verificationHash", divergence.VerificationHash,
+			"local", divergence.LocalVerdict, "finalized", divergence.Finalized)
+	}
+	return divergences
+}
+
+// Health check of the verdicts of the node, for the health API
+func StateConnectorVerdictHealth() (interface{}, error) {
+	return getVerdictMonitor().health(time.Now().UTC())
+}
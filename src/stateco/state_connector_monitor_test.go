@@ -0,0 +1,90 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func revealCheckRet(ledger uint64) []byte {
+	checkRet := make([]byte, 128)
+	binary.BigEndian.PutUint32(checkRet[28:32], 3)
+	binary.BigEndian.PutUint64(checkRet[56:64], ledger)
+	return checkRet
+}
+
+func TestVerdictMonitor(t *testing.T) {
+	now := time.Date(2021, 11, 5, 0, 0, 0, 0, time.UTC)
+	monitor := newVerdictMonitor(time.Hour)
+	sender := common.HexToAddress("0x0100000000000000000000000000000000000000")
+
+	finalized, sibling := common.Hash{5}, common.Hash{0x55}
+	// The node rejected the first reveal until its verdict was cached, and rejected the second
+	monitor.record(5, finalized, sender, []byte{1}, revealCheckRet(1), false)
+	monitor.record(5, finalized, sender, []byte{1}, revealCheckRet(1), true)
+	monitor.record(5, finalized, sender, []byte{2}, revealCheckRet(2), false)
+	monitor.record(5, finalized, sender, []byte{3}, revealCheckRet(3), true)
+	// A block of the same height that was not finalized gave the third reveal another verdict
+	monitor.record(5, sibling, sender, []byte{3}, revealCheckRet(3), false)
+	monitor.record(6, common.Hash{6}, sender, []byte{4}, revealCheckRet(4), true)
+
+	if _, err := monitor.health(now); err != nil {
+		t.Fatalf("unhealthy before any divergence: %v", err)
+	}
+	divergences := monitor.check(5, finalized, []ProofOutcome{
+		{Tx: common.Hash{1}, Sender: sender, Data: []byte{1}, Accepted: true},
+		{Tx: common.Hash{2}, Sender: sender, Data: []byte{2}, Accepted: true},
+		{Tx: common.Hash{3}, Sender: sender, Data: []byte{3}, Accepted: true},
+		// Executed by the node with another sender
+		{Tx: common.Hash{4}, Sender: common.Address{}, Data: []byte{3}, Accepted: false},
+	}, now)
+	if len(divergences) != 2 || divergences[0].Ledger != 1 || divergences[1].Ledger != 2 {
+		t.Fatalf("got divergences %+v", divergences)
+	}
+	if divergences[1].LocalVerdict != AuditRejected || divergences[1].Finalized != AuditAccepted || divergences[1].ChainId != 3 || divergences[1].VerificationHash != GetVerificationHash(revealCheckRet(2)) {
+		t.Errorf("unexpected divergence %+v", divergences[1])
+	}
+	if _, ok := monitor.verdicts[5]; ok {
+		t.Errorf("verdicts of a finalized height were kept")
+	}
+	if _, ok := monitor.verdicts[6]; !ok {
+		t.Errorf("verdicts above a finalized height were dropped")
+	}
+
+	if _, err := monitor.health(now.Add(time.Minute)); !errors.Is(err, ErrVerdictDiverged) {
+		t.Errorf("got %v, want ErrVerdictDiverged", err)
+	}
+	if divergences := monitor.check(6, common.Hash{6}, []ProofOutcome{{Sender: sender, Data: []byte{4}, Accepted: false}}, now.Add(2*time.Hour)); len(divergences) != 1 || divergences[0].LocalVerdict != AuditAccepted {
+		t.Fatalf("got divergences %+v", divergences)
+	}
+	if details, err := monitor.health(now.Add(2 * time.Hour)); err == nil || details.(map[string]interface{})["divergences"] != 1 {
+		t.Errorf("got %v, %v, want only the latest divergence within the window", details, err)
+	}
+	if _, err := monitor.health(now.Add(4 * time.Hour)); err != nil {
+		t.Errorf("unhealthy after the window: %v", err)
+	}
+}
+
+func TestRecordStateConnectorVerdictSkipsCommits(t *testing.T) {
+	commitCheckRet := revealCheckRet(7)
+	binary.BigEndian.PutUint64(commitCheckRet[88:96], 10)
+	RecordStateConnectorVerdict(big.NewInt(1), common.Hash{1}, common.Address{}, []byte{7}, commitCheckRet, false)
+	if divergences := CheckStateConnectorVerdicts(big.NewInt(1), common.Hash{1}, []ProofOutcome{{Data: []byte{7}, Accepted: true}}); len(divergences) != 0 {
+		t.Errorf("got divergences %+v for a commit", divergences)
+	}
+}
+
+// Blocks being built have no hash, and their verdicts are recorded when they are verified
+func TestRecordStateConnectorVerdictSkipsBlocksBeingBuilt(t *testing.T) {
+	RecordStateConnectorVerdict(big.NewInt(2), common.Hash{}, common.Address{}, []byte{8}, revealCheckRet(8), false)
+	if divergences := CheckStateConnectorVerdicts(big.NewInt(2), common.Hash{}, []ProofOutcome{{Data: []byte{8}, Accepted: true}}); len(divergences) != 0 {
+		t.Errorf("got divergences %+v for a block being built", divergences)
+	}
+}
@@ -0,0 +1,343 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Non-payment proofs show that no outgoing payment from an address, or no payment carrying a
+// reference, was included in an inclusive range of blocks or ledgers on an underlying chain:
+// keccak256(keccak256(filter), keccak256(startLedger), keccak256(endLedger)), with the filter
+// written as "address:<address>" or "reference:<hex>". checkRet holds the chainId, endLedger,
+// finalisedLedgerIndex and nonPaymentHash in the same slots as payment proofs, followed by
+// the startLedger and the filter string.
+
+var (
+	// Maximum number of blocks or ledgers covered by a single non-payment proof. Each block of
+	// a UTXO chain is requested with the outputs spent by its inputs, and each ledger of XRP
+	// is requested with its transactions for a reference filter, so those scans are shorter.
+	maxPoWNonPaymentProofRange          = uint64(6)
+	maxXRPNonPaymentProofRange          = uint64(1000)
+	maxXRPReferenceNonPaymentProofRange = uint64(20)
+	// Maximum number of account_tx pages of 200 transactions read for an address filter
+	maxXRPAccountTxPages = 5
+)
+
+const (
+	nonPaymentFilterAddress   = "address"
+	nonPaymentFilterReference = "reference"
+)
+
+func GetNonPaymentHash(filter string, startLedger uint64, endLedger uint64) []byte {
+	filterHash := crypto.Keccak256([]byte(filter))
+	startLedgerHash := crypto.Keccak256(common.LeftPadBytes(common.FromHex(hexutil.EncodeUint64(startLedger)), 32))
+	endLedgerHash := crypto.Keccak256(common.LeftPadBytes(common.FromHex(hexutil.EncodeUint64(endLedger)), 32))
+	return crypto.Keccak256(filterHash, startLedgerHash, endLedgerHash)
+}
+
+// Splits a non-payment filter into its type and value, decoding the value of a reference filter
+func ParseNonPaymentFilter(filter string) (string, string, []byte, bool) {
+	separator := strings.Index(filter, ":")
+	if separator <= 0 || separator == len(filter)-1 {
+		return "", "", []byte{}, false
+	}
+	filterType, filterValue := filter[:separator], filter[separator+1:]
+	switch filterType {
+	case nonPaymentFilterAddress:
+		return filterType, filterValue, []byte{}, true
+	case nonPaymentFilterReference:
+		reference, err := hex.DecodeString(filterValue)
+		if err != nil || len(reference) == 0 {
+			return "", "", []byte{}, false
+		}
+		return filterType, filterValue, reference, true
+	}
+	return "", "", []byte{}, false
+}
+
+// Reads and validates the range and filter of a non-payment proof. The whole range must be
+// finalised and no longer than maxRange.
+func GetNonPaymentProofRange(checkRet []byte, maxRange uint64) (uint64, uint64, string, bool) {
+	out, ok := UnpackStateConnectorProofsProveNonPaymentFinality(checkRet)
+	if !ok || out.Filter == "" {
+		return 0, 0, "", false
+	}
+	if out.StartLedger > out.Ledger || out.Ledger >= out.FinalisedLedgerIndex || out.Ledger-out.StartLedger >= maxRange {
+		return 0, 0, "", false
+	}
+	if !bytes.Equal(GetNonPaymentHash(out.Filter, out.StartLedger, out.Ledger), out.NonPaymentHash[:]) {
+		return 0, 0, "", false
+	}
+	return out.StartLedger, out.Ledger, out.Filter, true
+}
+
+// =======================================================
+// Proof of Work
+// =======================================================
+
+// Returns whether a transaction spends from the address, or carries the reference, of a filter
+func IsPoWNonPaymentFilterMatch(tx GetPoWTxResult, filterType string, filterValue string, reference []byte, chain UTXOChainConfig) bool {
+	if filterType == nonPaymentFilterReference {
+		txReference, ok := GetPoWPaymentReference(tx)
+		return ok && bytes.Equal(txReference, reference)
+	}
+	for _, vin := range tx.Vin {
+		if vin.Prevout != nil && IsPoWScriptPubKeyAddress(vin.Prevout.ScriptPubKey, filterValue, chain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scans every block of the range for a matching transaction. Blocks are linked by their
+// previous block hashes so that a reorg during the scan cannot mix two branches, and a node
+// that has pruned any block of the range is treated as an unavailable API. Esplora cannot scan
+// blocks, so its APIs are unavailable for non-payment proofs, which the JSON-RPC APIs of the
+// chain verify instead.
+func GetPoWNonPayment(startLedger uint64, endLedger uint64, filter string, chain UTXOChainConfig, chainURL string, username string, password string) (bool, bool) {
+	filterType, filterValue, reference, ok := ParseNonPaymentFilter(filter)
+	if !ok || chain.AuxPoW {
+		return false, false
+	}
+	if chain.Backend == powBackendEsplora {
+		return false, true
+	}
+	if filterType == nonPaymentFilterAddress && !IsUTXOChainAddress(chain, filterValue) {
+		return false, false
+	}
+	blockCount, err := GetPoWBlockCount(chain, chainURL, username, password)
+	if err {
+		return false, true
+	}
+	if blockCount < endLedger {
+		return false, true
+	}
+	var previousBlockHash string
+	for height := startLedger; height <= endLedger; height++ {
+		blockHash, getBlockHashErr := GetPoWBlockHash(height, chain, chainURL, username, password)
+		if getBlockHashErr {
+			return false, true
+		}
+		block, getBlockErr := GetPoWBlock(blockHash, chain, chainURL, username, password)
+		if getBlockErr {
+			return false, true
+		}
+		if block.Hash != blockHash || block.Height != height {
+			return false, true
+		}
+		if height > startLedger && block.PreviousBlockHash != previousBlockHash {
+			return false, true
+		}
+		previousBlockHash = block.Hash
+		for _, tx := range block.Tx {
+			if IsPoWNonPaymentFilterMatch(tx, filterType, filterValue, reference, chain) {
+				return false, false
+			}
+		}
+	}
+	return true, false
+}
+
+func ProveNonPaymentFinalityPoW(checkRet []byte, chain UTXOChainConfig, chainURL string, username string, password string) (bool, bool) {
+	startLedger, endLedger, filter, ok := GetNonPaymentProofRange(checkRet, maxPoWNonPaymentProofRange)
+	if !ok {
+		return false, false
+	}
+	return GetPoWNonPayment(startLedger, endLedger, filter, chain, chainURL, username, password)
+}
+
+// =======================================================
+// XRP
+// =======================================================
+
+type GetXRPServerInfoResponse struct {
+	Info struct {
+		CompleteLedgers string `json:"complete_ledgers"`
+	} `json:"info"`
+}
+
+// Returns whether the server holds every ledger of the range, from its complete_ledgers
+// field such as "32570-62880100,62880200-62880300"
+func GetXRPLedgerRangeAvailable(startLedger uint64, endLedger uint64, chainURL string) (bool, bool) {
+	var serverInfo GetXRPServerInfoResponse
+	respErrString, err := CallXRPRPC("server_info", struct{}{}, &serverInfo, chainURL)
+	if err || respErrString != "" {
+		return false, true
+	}
+	for _, ledgerRange := range strings.Split(serverInfo.Info.CompleteLedgers, ",") {
+		bounds := strings.Split(ledgerRange, "-")
+		if len(bounds) != 2 {
+			continue
+		}
+		rangeStart, err := strconv.ParseUint(bounds[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		rangeEnd, err := strconv.ParseUint(bounds[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if rangeStart <= startLedger && endLedger <= rangeEnd {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// Returns whether a successful transaction is an outgoing payment from the address, or a value
+// transfer carrying the reference, of a filter. Any transaction submitted by the address that
+// sends a payment or deletes the account, or that lowers its XRP balance by more than the fee,
+// is an outgoing payment.
+func IsXRPNonPaymentFilterMatch(tx GetXRPTxResponse, filterType string, filterValue string, reference []byte) bool {
+	if tx.Meta.TransactionResult != "tesSUCCESS" {
+		return false
+	}
+	if filterType == nonPaymentFilterReference {
+		if _, _, _, _, ok := GetXRPValueTransfer(tx); !ok {
+			return false
+		}
+		referenceHash, ok := GetXRPPaymentReferenceHash(tx)
+		return ok && bytes.Equal(referenceHash, reference)
+	}
+	if tx.Account == filterValue && (tx.TransactionType == "Payment" || tx.TransactionType == "AccountDelete") {
+		return true
+	}
+	delta, ok := GetXRPBalanceDelta(tx, filterValue)
+	return ok && delta < 0
+}
+
+type GetXRPAccountTxRequestParams struct {
+	Account        string      `json:"account"`
+	LedgerIndexMin uint64      `json:"ledger_index_min"`
+	LedgerIndexMax uint64      `json:"ledger_index_max"`
+	Forward        bool        `json:"forward"`
+	Limit          int         `json:"limit"`
+	Marker         interface{} `json:"marker,omitempty"`
+}
+type GetXRPAccountTxResponse struct {
+	LedgerIndexMin uint64      `json:"ledger_index_min"`
+	LedgerIndexMax uint64      `json:"ledger_index_max"`
+	Marker         interface{} `json:"marker"`
+	Transactions   []struct {
+		Meta      json.RawMessage  `json:"meta"`
+		Tx        GetXRPTxResponse `json:"tx"`
+		Validated bool             `json:"validated"`
+	} `json:"transactions"`
+}
+
+// Pages through the transactions affecting an account within the range. An account with more
+// transactions than fit in maxXRPAccountTxPages pages has no provable non-payment.
+func GetXRPAccountNonPayment(startLedger uint64, endLedger uint64, address string, chainURL string) (bool, bool) {
+	var marker interface{}
+	for page := 0; page < maxXRPAccountTxPages; page++ {
+		var accountTx GetXRPAccountTxResponse
+		respErrString, err := CallXRPRPC("account_tx", GetXRPAccountTxRequestParams{
+			Account:        address,
+			LedgerIndexMin: startLedger,
+			LedgerIndexMax: endLedger,
+			Forward:        true,
+			Limit:          200,
+			Marker:         marker,
+		}, &accountTx, chainURL)
+		if err {
+			return false, true
+		}
+		if respErrString == "actNotFound" {
+			// An account that does not exist cannot have made a payment
+			return true, false
+		} else if respErrString != "" {
+			return false, true
+		}
+		if accountTx.LedgerIndexMin > startLedger || accountTx.LedgerIndexMax < endLedger {
+			return false, true
+		}
+		for _, entry := range accountTx.Transactions {
+			if !entry.Validated || json.Unmarshal(entry.Meta, &entry.Tx.Meta) != nil {
+				return false, true
+			}
+			if IsXRPNonPaymentFilterMatch(entry.Tx, nonPaymentFilterAddress, address, []byte{}) {
+				return false, false
+			}
+		}
+		if accountTx.Marker == nil {
+			return true, false
+		}
+		marker = accountTx.Marker
+	}
+	return false, false
+}
+
+type GetXRPLedgerTxsResponse struct {
+	Ledger struct {
+		Transactions []json.RawMessage `json:"transactions"`
+	} `json:"ledger"`
+	LedgerIndex uint64 `json:"ledger_index"`
+	Validated   bool   `json:"validated"`
+}
+
+// Scans the expanded transactions of every ledger in the range
+func GetXRPReferenceNonPayment(startLedger uint64, endLedger uint64, reference []byte, chainURL string) (bool, bool) {
+	for ledger := startLedger; ledger <= endLedger; ledger++ {
+		var ledgerTxs GetXRPLedgerTxsResponse
+		respErrString, err := CallXRPRPC("ledger", GetXRPBlockRequestParams{
+			LedgerIndex:  ledger,
+			Transactions: true,
+			Expand:       true,
+		}, &ledgerTxs, chainURL)
+		if err || respErrString != "" {
+			return false, true
+		}
+		if !ledgerTxs.Validated || ledgerTxs.LedgerIndex != ledger {
+			return false, true
+		}
+		for _, rawTx := range ledgerTxs.Ledger.Transactions {
+			var tx GetXRPTxResponse
+			var txMeta struct {
+				MetaData json.RawMessage `json:"metaData"`
+			}
+			if json.Unmarshal(rawTx, &tx) != nil || json.Unmarshal(rawTx, &txMeta) != nil || json.Unmarshal(txMeta.MetaData, &tx.Meta) != nil {
+				return false, true
+			}
+			if IsXRPNonPaymentFilterMatch(tx, nonPaymentFilterReference, "", reference) {
+				return false, false
+			}
+		}
+	}
+	return true, false
+}
+
+func GetXRPNonPayment(startLedger uint64, endLedger uint64, filter string, chainURL string) (bool, bool) {
+	filterType, filterValue, reference, ok := ParseNonPaymentFilter(filter)
+	if !ok {
+		return false, false
+	}
+	if filterType == nonPaymentFilterReference && (len(reference) != 32 || endLedger-startLedger >= maxXRPReferenceNonPaymentProofRange) {
+		return false, false
+	}
+	available, err := GetXRPLedgerRangeAvailable(startLedger, endLedger, chainURL)
+	if err || !available {
+		return false, true
+	}
+	if filterType == nonPaymentFilterReference {
+		return GetXRPReferenceNonPayment(startLedger, endLedger, reference, chainURL)
+	}
+	return GetXRPAccountNonPayment(startLedger, endLedger, filterValue, chainURL)
+}
+
+func ProveNonPaymentFinalityXRP(checkRet []byte, chainURL string) (bool, bool) {
+	startLedger, endLedger, filter, ok := GetNonPaymentProofRange(checkRet, maxXRPNonPaymentProofRange)
+	if !ok {
+		return false, false
+	}
+	return GetXRPNonPayment(startLedger, endLedger, filter, chainURL)
+}
@@ -0,0 +1,454 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Stellar payments are proven through the Horizon REST API. The txId is a lowercase transaction
+// hash followed by ":" and the decimal index of a payment or path payment operation within the
+// transaction. Amounts are committed to in stroops, and currencies as "xlm" for lumens or as
+// "<asset code>:<issuer>" for issued assets. Stellar is chain 6, which is only allowed once the
+// state connector contract has it.
+
+// Issues a GET request against a Horizon server, returning whether the resource was not found
+// and true on any other failure
+func CallHorizon(path string, result interface{}, chainURL string) (bool, bool) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(chainURL, "/")+path, nil)
+	if err != nil {
+		return false, true
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, true
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 {
+		return true, false
+	} else if resp.StatusCode != 200 {
+		return false, true
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, true
+	}
+	if json.Unmarshal(respBody, result) != nil {
+		return false, true
+	}
+	return false, false
+}
+
+type GetStellarRootResponse struct {
+	HistoryLatestLedger uint64 `json:"history_latest_ledger"`
+	HistoryElderLedger  uint64 `json:"history_elder_ledger"`
+}
+type GetStellarLedgerResponse struct {
+	Hash     string `json:"hash"`
+	Sequence uint64 `json:"sequence"`
+	ClosedAt string `json:"closed_at"`
+}
+
+func GetStellarLatestLedger(chainURL string) (uint64, bool) {
+	var root GetStellarRootResponse
+	notFound, err := CallHorizon("/", &root, chainURL)
+	if notFound || err || root.HistoryLatestLedger == 0 {
+		return 0, true
+	}
+	return root.HistoryLatestLedger, false
+}
+
+func ProveDataAvailabilityPeriodFinalityStellar(checkRet []byte, chainURL string) (bool, bool) {
+	out, ok := UnpackStateConnectorProveDataAvailabilityPeriodFinality(checkRet)
+	if !ok {
+		return false, false
+	}
+	latestLedger, err := GetStellarLatestLedger(chainURL)
+	if err {
+		return false, true
+	}
+	ledger := out.Ledger
+	if latestLedger < ledger+uint64(out.NumConfirmations) {
+		return false, true
+	}
+	var ledgerResp GetStellarLedgerResponse
+	notFound, err := CallHorizon("/ledgers/"+strconv.FormatUint(ledger, 10), &ledgerResp, chainURL)
+	if err {
+		return false, true
+	} else if notFound || ledgerResp.Sequence != ledger {
+		return false, false
+	}
+	ledgerHash, decodeErr := hex.DecodeString(ledgerResp.Hash)
+	if decodeErr == nil && bytes.Equal(ledgerHash, out.DataAvailabilityPeriodHash[:]) {
+		return true, false
+	}
+	return false, false
+}
+
+type GetStellarTxResponse struct {
+	Hash           string `json:"hash"`
+	Ledger         uint64 `json:"ledger"`
+	Successful     bool   `json:"successful"`
+	SourceAccount  string `json:"source_account"`
+	CreatedAt      string `json:"created_at"`
+	EnvelopeXDR    string `json:"envelope_xdr"`
+	OperationCount uint64 `json:"operation_count"`
+}
+type GetStellarOperation struct {
+	Type                 string `json:"type"`
+	TransactionHash      string `json:"transaction_hash"`
+	TransactionSucceeded bool   `json:"transaction_successful"`
+	From                 string `json:"from"`
+	To                   string `json:"to"`
+	Amount               string `json:"amount"`
+	AssetType            string `json:"asset_type"`
+	AssetCode            string `json:"asset_code"`
+	AssetIssuer          string `json:"asset_issuer"`
+}
+type GetStellarOperationsResponse struct {
+	Embedded struct {
+		Records []GetStellarOperation `json:"records"`
+	} `json:"_embedded"`
+}
+
+// Parses a Horizon amount, which always has at most seven decimal places, into stroops
+func GetStellarAmount(amount string) (uint64, bool) {
+	parts := strings.Split(amount, ".")
+	if len(parts) > 2 || parts[0] == "" {
+		return 0, false
+	}
+	fraction := ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+	}
+	if len(fraction) > 7 {
+		return 0, false
+	}
+	stroops, ok := new(big.Int).SetString(parts[0]+fraction+strings.Repeat("0", 7-len(fraction)), 10)
+	if !ok || stroops.Sign() < 0 || !stroops.IsUint64() {
+		return 0, false
+	}
+	return stroops.Uint64(), true
+}
+
+// Returns the currency of an operation, identifying issued assets by both their code and issuer
+func GetStellarCurrency(operation GetStellarOperation) (string, bool) {
+	switch operation.AssetType {
+	case "native":
+		return "xlm", true
+	case "credit_alphanum4", "credit_alphanum12":
+		if operation.AssetCode == "" || operation.AssetIssuer == "" {
+			return "", false
+		}
+		return operation.AssetCode + ":" + operation.AssetIssuer, true
+	}
+	return "", false
+}
+
+// XDR discriminants of the parts of a transaction envelope ahead of its memo
+const (
+	stellarEnvelopeTypeTxV0    = 0
+	stellarEnvelopeTypeTx      = 2
+	stellarEnvelopeTypeFeeBump = 5
+
+	stellarKeyTypeEd25519      = 0
+	stellarKeyTypeMuxedEd25519 = 0x100
+
+	stellarPrecondNone = 0
+	stellarPrecondTime = 1
+	stellarPrecondV2   = 2
+
+	stellarSignerKeyEd25519SignedPayload = 3
+
+	stellarMemoNone   = 0
+	stellarMemoText   = 1
+	stellarMemoID     = 2
+	stellarMemoHash   = 3
+	stellarMemoReturn = 4
+)
+
+// Reads XDR, failing on any read past the end of the data, unknown union arm or out of range
+// length, after which every read returns nothing
+type stellarXDRReader struct {
+	data []byte
+	ok   bool
+}
+
+func (r *stellarXDRReader) next(n int) []byte {
+	if !r.ok || len(r.data) < n {
+		r.ok = false
+		return nil
+	}
+	value := r.data[:n]
+	r.data = r.data[n:]
+	return value
+}
+
+func (r *stellarXDRReader) uint32() uint32 {
+	value := r.next(4)
+	if value == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(value)
+}
+
+// Variable length opaque data of at most max bytes, zero padded to a multiple of four bytes
+func (r *stellarXDRReader) opaque(max uint32) {
+	length := r.uint32()
+	if length > max {
+		r.ok = false
+	}
+	r.next(int(length))
+	for _, padding := range r.next(int((4 - length%4) % 4)) {
+		if padding != 0 {
+			r.ok = false
+		}
+	}
+}
+
+// An optional value of n bytes
+func (r *stellarXDRReader) optional(n int) {
+	switch r.uint32() {
+	case 0:
+	case 1:
+		r.next(n)
+	default:
+		r.ok = false
+	}
+}
+
+func (r *stellarXDRReader) muxedAccount() {
+	switch r.uint32() {
+	case stellarKeyTypeEd25519:
+		r.next(32)
+	case stellarKeyTypeMuxedEd25519:
+		r.next(8 + 32)
+	default:
+		r.ok = false
+	}
+}
+
+// Preconditions replaced the optional time bounds of a transaction with a union whose first two
+// arms have the same encoding
+func (r *stellarXDRReader) preconditions() {
+	switch r.uint32() {
+	case stellarPrecondNone:
+	case stellarPrecondTime:
+		r.next(16)
+	case stellarPrecondV2:
+		// Time bounds, ledger bounds and minimum sequence number
+		r.optional(16)
+		r.optional(8)
+		r.optional(8)
+		// Minimum sequence age and ledger gap
+		r.next(12)
+		extraSigners := r.uint32()
+		if extraSigners > 2 {
+			r.ok = false
+		}
+		for i := uint32(0); i < extraSigners && r.ok; i++ {
+			signerKeyType := r.uint32()
+			r.next(32)
+			if signerKeyType == stellarSignerKeyEd25519SignedPayload {
+				r.opaque(64)
+			} else if signerKeyType > stellarSignerKeyEd25519SignedPayload {
+				r.ok = false
+			}
+		}
+	default:
+		r.ok = false
+	}
+}
+
+// Returns the encoding of a memo
+func (r *stellarXDRReader) memo() []byte {
+	start := r.data
+	switch r.uint32() {
+	case stellarMemoNone:
+	case stellarMemoText:
+		r.opaque(28)
+	case stellarMemoID:
+		r.next(8)
+	case stellarMemoHash, stellarMemoReturn:
+		r.next(32)
+	default:
+		r.ok = false
+	}
+	if !r.ok {
+		return nil
+	}
+	return start[:len(start)-len(r.data)]
+}
+
+// Returns the XDR encoding of the memo of a transaction, given its base64 XDR envelope. The memo
+// of a fee bump transaction is that of the transaction it wraps.
+func GetStellarMemoXDR(envelopeXDR string) ([]byte, bool) {
+	envelope, err := base64.StdEncoding.DecodeString(envelopeXDR)
+	r := &stellarXDRReader{data: envelope, ok: err == nil}
+	envelopeType := r.uint32()
+	if envelopeType == stellarEnvelopeTypeFeeBump {
+		// Fee source and fee
+		r.muxedAccount()
+		r.next(8)
+		envelopeType = r.uint32()
+		if envelopeType != stellarEnvelopeTypeTx {
+			return nil, false
+		}
+	}
+	switch envelopeType {
+	case stellarEnvelopeTypeTxV0:
+		// Source account, fee, sequence number and time bounds
+		r.next(32 + 4 + 8)
+		r.optional(16)
+	case stellarEnvelopeTypeTx:
+		// Source account, fee, sequence number and preconditions
+		r.muxedAccount()
+		r.next(4 + 8)
+		r.preconditions()
+	default:
+		return nil, false
+	}
+	memo := r.memo()
+	return memo, r.ok
+}
+
+// Commits to the memo of a transaction as encoded in its XDR envelope, which unlike the memo
+// returned by Horizon is the same whichever its type
+func GetStellarPaymentReferenceHash(tx GetStellarTxResponse) ([]byte, bool) {
+	memo, ok := GetStellarMemoXDR(tx.EnvelopeXDR)
+	if !ok {
+		return []byte{}, false
+	}
+	return crypto.Keccak256(memo), true
+}
+
+func GetStellarTx(txId string, latestAvailableLedger uint64, variant PaymentProofVariant, window TimestampWindow, chainURL string) ([]byte, uint64, bool) {
+	separator := strings.Index(txId, ":")
+	if separator < 0 {
+		return []byte{}, 0, false
+	}
+	txHash := txId[:separator]
+	operationIndex, parseErr := strconv.ParseUint(txId[separator+1:], 10, 64)
+	// Only one spelling of each txId is accepted, so that a payment has a single payment hash
+	if parseErr != nil || strconv.FormatUint(operationIndex, 10) != txId[separator+1:] {
+		return []byte{}, 0, false
+	}
+	if decoded, decodeErr := hex.DecodeString(txHash); decodeErr != nil || len(decoded) != 32 || strings.ToLower(txHash) != txHash {
+		return []byte{}, 0, false
+	}
+	var tx GetStellarTxResponse
+	notFound, err := CallHorizon("/transactions/"+txHash, &tx, chainURL)
+	if err {
+		return []byte{}, 0, true
+	} else if notFound || !tx.Successful || tx.Hash != txHash {
+		return []byte{}, 0, false
+	}
+	if tx.Ledger == 0 || tx.Ledger >= latestAvailableLedger || operationIndex >= tx.OperationCount {
+		return []byte{}, 0, false
+	}
+	var operations GetStellarOperationsResponse
+	notFound, err = CallHorizon("/transactions/"+txHash+"/operations?order=asc&limit=200", &operations, chainURL)
+	if err {
+		return []byte{}, 0, true
+	} else if notFound || uint64(len(operations.Embedded.Records)) != tx.OperationCount {
+		return []byte{}, 0, false
+	}
+	operation := operations.Embedded.Records[operationIndex]
+	switch operation.Type {
+	case "payment", "path_payment_strict_receive", "path_payment_strict_send":
+	default:
+		return []byte{}, 0, false
+	}
+	if !operation.TransactionSucceeded || operation.TransactionHash != txHash || operation.To == "" {
+		return []byte{}, 0, false
+	}
+	amount, ok := GetStellarAmount(operation.Amount)
+	if !ok || amount == 0 {
+		return []byte{}, 0, false
+	}
+	currency, ok := GetStellarCurrency(operation)
+	if !ok {
+		return []byte{}, 0, false
+	}
+	destinationHash := GetDestinationHash(operation.To)
+	amountInt := new(big.Int).SetUint64(amount)
+	if variant == PaymentProofReference {
+		referenceHash, ok := GetStellarPaymentReferenceHash(tx)
+		if !ok {
+			return []byte{}, 0, false
+		}
+		return GetPaymentHash(txId, destinationHash, amountInt, currency, referenceHash), tx.Ledger, false
+	} else if variant == PaymentProofSource {
+		if operation.From == "" {
+			return []byte{}, 0, false
+		}
+		return GetPaymentHash(txId, destinationHash, amountInt, currency, GetSourceHash(operation.From)), tx.Ledger, false
+	} else if variant == PaymentProofTimestamp {
+		// The creation time of a transaction is the close time of its ledger
+		createdAt, err := time.Parse(time.RFC3339, tx.CreatedAt)
+		if err != nil || createdAt.Unix() <= 0 {
+			return []byte{}, 0, false
+		}
+		windowHash, ok := GetTimestampWindowHash(window, uint64(createdAt.Unix()))
+		if !ok {
+			return []byte{}, 0, false
+		}
+		return GetPaymentHash(txId, destinationHash, amountInt, currency, windowHash), tx.Ledger, false
+	}
+	return GetPaymentHash(txId, destinationHash, amountInt, currency), tx.Ledger, false
+}
+
+func ProvePaymentFinalityStellar(checkRet []byte, isDisprove bool, variant PaymentProofVariant, chainURL string) (bool, bool) {
+	out, window, ok := GetPaymentCheckRet(checkRet, variant)
+	if !ok {
+		return false, false
+	}
+	paymentHash, inLedger, err := GetStellarTx(out.TxId, out.FinalisedLedgerIndex, variant, window, chainURL)
+	if err {
+		return false, true
+	}
+	if !isDisprove {
+		if len(paymentHash) > 0 && bytes.Equal(paymentHash, out.PaymentHash[:]) && inLedger == out.Ledger {
+			return true, false
+		}
+	} else {
+		if len(paymentHash) > 0 && bytes.Equal(paymentHash, out.PaymentHash[:]) && inLedger > out.Ledger {
+			return true, false
+		} else if len(paymentHash) == 0 {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+func ProveStellar(sender common.Address, blockTime *big.Int, functionSelector []byte, checkRet []byte, chainURL string) (bool, bool) {
+	if bytes.Equal(functionSelector, GetProveDataAvailabilityPeriodFinalitySelector(blockTime)) {
+		return ProveDataAvailabilityPeriodFinalityStellar(checkRet, chainURL)
+	} else if bytes.Equal(functionSelector, GetProvePaymentFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityStellar(checkRet, false, PaymentProofBasic, chainURL)
+	} else if bytes.Equal(functionSelector, GetDisprovePaymentFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityStellar(checkRet, true, PaymentProofBasic, chainURL)
+	} else if bytes.Equal(functionSelector, GetProvePaymentReferenceFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityStellar(checkRet, false, PaymentProofReference, chainURL)
+	} else if bytes.Equal(functionSelector, GetProvePaymentSourceFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityStellar(checkRet, false, PaymentProofSource, chainURL)
+	} else if bytes.Equal(functionSelector, GetProvePaymentTimestampFinalitySelector(blockTime)) {
+		return ProvePaymentFinalityStellar(checkRet, false, PaymentProofTimestamp, chainURL)
+	}
+	return false, false
+}
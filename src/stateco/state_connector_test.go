@@ -0,0 +1,1929 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gorilla/websocket"
+)
+
+// Serve a fixed rippled JSON-RPC response for every request
+func newXRPFixtureServer(response string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+}
+
+// Serve a fixed rippled JSON-RPC response for each method
+func newXRPMethodFixtureServer(responses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(responses[request.Method]))
+	}))
+}
+
+const xrpPaymentWithReferenceFixture = `{
+	"result": {
+		"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+		"Amount": "20000000",
+		"Destination": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+		"DestinationTag": 129053196,
+		"Fee": "12",
+		"Flags": 2147483648,
+		"InvoiceID": "6F1DFD1D0FE8A32E40E1F2C05CF1C15545BAB56B617F9C6C2D63A6B704BEF59B",
+		"Memos": [
+			{
+				"Memo": {
+					"MemoData": "72656e74",
+					"MemoFormat": "746578742f706c61696e",
+					"MemoType": "696e766f696365"
+				}
+			},
+			{
+				"Memo": {
+					"MemoData": "0102"
+				}
+			}
+		],
+		"Sequence": 2,
+		"SourceTag": 42,
+		"TransactionType": "Payment",
+		"date": 689303221,
+		"hash": "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A",
+		"inLedger": 62880010,
+		"ledger_index": 62880010,
+		"meta": {
+			"TransactionIndex": 3,
+			"TransactionResult": "tesSUCCESS",
+			"delivered_amount": "20000000"
+		},
+		"status": "success",
+		"validated": true
+	}
+}`
+
+const xrpPaymentWithoutReferenceFixture = `{
+	"result": {
+		"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+		"Amount": "20000000",
+		"Destination": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+		"DestinationTag": 129053196,
+		"Fee": "12",
+		"Flags": 2147483648,
+		"Sequence": 2,
+		"TransactionType": "Payment",
+		"date": 689303221,
+		"hash": "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A",
+		"inLedger": 62880010,
+		"ledger_index": 62880010,
+		"meta": {
+			"TransactionIndex": 3,
+			"TransactionResult": "tesSUCCESS",
+			"delivered_amount": "20000000"
+		},
+		"status": "success",
+		"validated": true
+	}
+}`
+
+// The window claimed by timestamp proofs of the fixtures, the 4th and 5th of November 2021 UTC
+var testTimestampWindow = TimestampWindow{From: 1635984000, To: 1636156800}
+
+func TestXRPPaymentReferenceHashFixtures(t *testing.T) {
+	tests := []struct {
+		name        string
+		fixture     string
+		variant     PaymentProofVariant
+		paymentHash string
+	}{
+		{"basic", xrpPaymentWithReferenceFixture, PaymentProofBasic, "716f54bafa5c2314f7d953f84c82efe31d1d6e1cabf41ef94f0eaf4789c46929"},
+		{"reference", xrpPaymentWithReferenceFixture, PaymentProofReference, "5854f483504317842d9ea2ac8b6f9971a59357672d40a164e3e2ca3c5459faa0"},
+		{"reference without fields", xrpPaymentWithoutReferenceFixture, PaymentProofReference, "4e7c7a2da60b507fd7a7b39a96aae165dd1ec5e5cc5373de3fd997726d42dca0"},
+		{"timestamp", xrpPaymentWithReferenceFixture, PaymentProofTimestamp, "7e7c319927c4c7e5467509e19eacfd57af3808f4e5ba9a9697ee3d100dfbc4df"},
+	}
+	for _, test := range tests {
+		server := newXRPFixtureServer(test.fixture)
+		paymentHash, inLedger, err := GetXRPTx("F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A", 62880100, test.variant, testTimestampWindow, server.URL)
+		server.Close()
+		if err {
+			t.Errorf("%s: unexpected API error", test.name)
+			continue
+		}
+		if inLedger != 62880010 {
+			t.Errorf("%s: got ledger %d want %d", test.name, inLedger, 62880010)
+		}
+		if hex.EncodeToString(paymentHash) != test.paymentHash {
+			t.Errorf("%s: got payment hash %s want %s", test.name, hex.EncodeToString(paymentHash), test.paymentHash)
+		}
+	}
+}
+
+func TestXRPPaymentReferenceHashRejectsInvalidMemo(t *testing.T) {
+	tx := GetXRPTxResponse{
+		Memos: []GetXRPTxMemos{{Memo: GetXRPTxMemo{MemoData: "not hex"}}},
+	}
+	if _, ok := GetXRPPaymentReferenceHash(tx); ok {
+		t.Errorf("expected memo with invalid hex data to be rejected")
+	}
+}
+
+func TestXRPPaymentReferenceHashCommitsToMemoOrder(t *testing.T) {
+	first := GetXRPTxMemos{Memo: GetXRPTxMemo{MemoData: "01"}}
+	second := GetXRPTxMemos{Memo: GetXRPTxMemo{MemoData: "02"}}
+	forward, _ := GetXRPPaymentReferenceHash(GetXRPTxResponse{Memos: []GetXRPTxMemos{first, second}})
+	backward, _ := GetXRPPaymentReferenceHash(GetXRPTxResponse{Memos: []GetXRPTxMemos{second, first}})
+	if hex.EncodeToString(forward) == hex.EncodeToString(backward) {
+		t.Errorf("expected reference hash to depend on memo order")
+	}
+}
+
+// A partial payment that delivered less than its Amount field
+const xrpPartialPaymentFixture = `{
+	"result": {
+		"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+		"Amount": "20000000",
+		"Destination": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+		"DestinationTag": 129053196,
+		"Fee": "12",
+		"Flags": 2147614720,
+		"SendMax": "5000000",
+		"Sequence": 2,
+		"TransactionType": "Payment",
+		"hash": "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A",
+		"inLedger": 62880010,
+		"ledger_index": 62880010,
+		"meta": {
+			"TransactionIndex": 3,
+			"TransactionResult": "tesSUCCESS",
+			"delivered_amount": "4999988"
+		},
+		"status": "success",
+		"validated": true
+	}
+}`
+
+// A full payment from a ledger that predates delivered_amount
+const xrpDeliveredAmountUnavailableFixture = `{
+	"result": {
+		"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+		"Amount": "4999988",
+		"Destination": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+		"DestinationTag": 129053196,
+		"Fee": "12",
+		"Flags": 2147483648,
+		"Sequence": 2,
+		"TransactionType": "Payment",
+		"hash": "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A",
+		"inLedger": 62880010,
+		"ledger_index": 62880010,
+		"meta": {
+			"TransactionIndex": 3,
+			"TransactionResult": "tesSUCCESS",
+			"delivered_amount": "unavailable"
+		},
+		"status": "success",
+		"validated": true
+	}
+}`
+
+// A partial payment from a ledger that predates delivered_amount
+const xrpPartialPaymentDeliveredAmountUnavailableFixture = `{
+	"result": {
+		"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+		"Amount": "20000000",
+		"Destination": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+		"DestinationTag": 129053196,
+		"Fee": "12",
+		"Flags": 131072,
+		"SendMax": "5000000",
+		"Sequence": 2,
+		"TransactionType": "Payment",
+		"hash": "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A",
+		"inLedger": 62880010,
+		"ledger_index": 62880010,
+		"meta": {
+			"TransactionIndex": 3,
+			"TransactionResult": "tesSUCCESS",
+			"delivered_amount": "unavailable"
+		},
+		"status": "success",
+		"validated": true
+	}
+}`
+
+// A full payment as returned by rippled API v2, where Amount is renamed to DeliverMax
+const xrpDeliverMaxFixture = `{
+	"result": {
+		"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+		"DeliverMax": "4999988",
+		"Destination": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+		"DestinationTag": 129053196,
+		"Fee": "12",
+		"Flags": 2147483648,
+		"Sequence": 2,
+		"TransactionType": "Payment",
+		"hash": "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A",
+		"inLedger": 62880010,
+		"ledger_index": 62880010,
+		"meta": {
+			"TransactionIndex": 3,
+			"TransactionResult": "tesSUCCESS",
+			"delivered_amount": "unavailable"
+		},
+		"status": "success",
+		"validated": true
+	}
+}`
+
+// A payment whose Amount and DeliverMax fields disagree
+const xrpDeliverMaxMismatchFixture = `{
+	"result": {
+		"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+		"Amount": "4999988",
+		"DeliverMax": "20000000",
+		"Destination": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+		"DestinationTag": 129053196,
+		"Fee": "12",
+		"Flags": 2147483648,
+		"Sequence": 2,
+		"TransactionType": "Payment",
+		"hash": "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A",
+		"inLedger": 62880010,
+		"ledger_index": 62880010,
+		"meta": {
+			"TransactionIndex": 3,
+			"TransactionResult": "tesSUCCESS",
+			"delivered_amount": "unavailable"
+		},
+		"status": "success",
+		"validated": true
+	}
+}`
+
+func TestXRPDeliveredAmountFixtures(t *testing.T) {
+	// Payment hash of a 4999988 drop payment of F4D1EDBF... to rhub8VRN... with tag 129053196
+	deliveredPaymentHash := "1e152740e9b68ff6f103d5f0ee098ce6148afa90f94ecc11128e9328089a0231"
+	tests := []struct {
+		name        string
+		fixture     string
+		paymentHash string
+	}{
+		{"partial payment", xrpPartialPaymentFixture, deliveredPaymentHash},
+		{"delivered_amount unavailable", xrpDeliveredAmountUnavailableFixture, deliveredPaymentHash},
+		{"partial payment with delivered_amount unavailable", xrpPartialPaymentDeliveredAmountUnavailableFixture, ""},
+		{"DeliverMax", xrpDeliverMaxFixture, deliveredPaymentHash},
+		{"Amount and DeliverMax mismatch", xrpDeliverMaxMismatchFixture, ""},
+	}
+	for _, test := range tests {
+		server := newXRPFixtureServer(test.fixture)
+		paymentHash, _, err := GetXRPTx("F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A", 62880100, PaymentProofBasic, TimestampWindow{}, server.URL)
+		server.Close()
+		if err {
+			t.Errorf("%s: unexpected API error", test.name)
+			continue
+		}
+		if hex.EncodeToString(paymentHash) != test.paymentHash {
+			t.Errorf("%s: got payment hash %s want %s", test.name, hex.EncodeToString(paymentHash), test.paymentHash)
+		}
+	}
+}
+
+// An escrow of 10 XRP to rhub8VRN... released by a third party
+const xrpEscrowFinishFixture = `{
+	"result": {
+		"Account": "rPEPPER7kfTD9w2To4CQk6UCfuHM9c6GDY",
+		"Fee": "12",
+		"Flags": 2147483648,
+		"OfferSequence": 7,
+		"Owner": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+		"Sequence": 12,
+		"TransactionType": "EscrowFinish",
+		"hash": "1E6A1D1D5A6A4B2B6E3E0B0C6E7E4B9F0F5E3F6A6B0E5D7C9B8A7F6E5D4C3B2A",
+		"inLedger": 62880010,
+		"ledger_index": 62880010,
+		"meta": {
+			"AffectedNodes": [
+				{
+					"ModifiedNode": {
+						"FinalFields": {
+							"Account": "rPEPPER7kfTD9w2To4CQk6UCfuHM9c6GDY",
+							"Balance": "99999988",
+							"Sequence": 13
+						},
+						"LedgerEntryType": "AccountRoot",
+						"PreviousFields": {
+							"Balance": "100000000",
+							"Sequence": 12
+						}
+					}
+				},
+				{
+					"DeletedNode": {
+						"FinalFields": {
+							"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+							"Amount": "10000000",
+							"Destination": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+							"DestinationTag": 129053196
+						},
+						"LedgerEntryType": "Escrow"
+					}
+				},
+				{
+					"ModifiedNode": {
+						"FinalFields": {
+							"Account": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+							"Balance": "60000000"
+						},
+						"LedgerEntryType": "AccountRoot",
+						"PreviousFields": {
+							"Balance": "50000000"
+						}
+					}
+				}
+			],
+			"TransactionIndex": 3,
+			"TransactionResult": "tesSUCCESS"
+		},
+		"status": "success",
+		"validated": true
+	}
+}`
+
+// A check for 10 XRP cashed by its destination, which pays the transaction fee
+const xrpCheckCashFixture = `{
+	"result": {
+		"Account": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+		"Amount": "10000000",
+		"CheckID": "838766BA2B995C00744175F69A1B11E32C3DBC40E64801A4056FCBD657F57334",
+		"Fee": "12",
+		"Flags": 2147483648,
+		"Sequence": 5,
+		"TransactionType": "CheckCash",
+		"hash": "1E6A1D1D5A6A4B2B6E3E0B0C6E7E4B9F0F5E3F6A6B0E5D7C9B8A7F6E5D4C3B2A",
+		"inLedger": 62880010,
+		"ledger_index": 62880010,
+		"meta": {
+			"AffectedNodes": [
+				{
+					"ModifiedNode": {
+						"FinalFields": {
+							"Account": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+							"Balance": "59999988",
+							"Sequence": 6
+						},
+						"LedgerEntryType": "AccountRoot",
+						"PreviousFields": {
+							"Balance": "50000000",
+							"Sequence": 5
+						}
+					}
+				},
+				{
+					"DeletedNode": {
+						"FinalFields": {
+							"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+							"Destination": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+							"DestinationTag": 129053196,
+							"SendMax": "10000000"
+						},
+						"LedgerEntryType": "Check"
+					}
+				},
+				{
+					"ModifiedNode": {
+						"FinalFields": {
+							"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+							"Balance": "90000000"
+						},
+						"LedgerEntryType": "AccountRoot",
+						"PreviousFields": {
+							"Balance": "100000000"
+						}
+					}
+				}
+			],
+			"TransactionIndex": 3,
+			"TransactionResult": "tesSUCCESS"
+		},
+		"status": "success",
+		"validated": true
+	}
+}`
+
+// A payment channel claim of 10 XRP submitted by the channel destination
+const xrpPaymentChannelClaimFixture = `{
+	"result": {
+		"Account": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+		"Balance": "10000000",
+		"Channel": "C1AE6DDDEEC05CF2978C0BAD6FE302948E9533691DC749DCDD3B9E5992CA6198",
+		"Fee": "12",
+		"Flags": 2147483648,
+		"Sequence": 5,
+		"TransactionType": "PaymentChannelClaim",
+		"hash": "1E6A1D1D5A6A4B2B6E3E0B0C6E7E4B9F0F5E3F6A6B0E5D7C9B8A7F6E5D4C3B2A",
+		"inLedger": 62880010,
+		"ledger_index": 62880010,
+		"meta": {
+			"AffectedNodes": [
+				{
+					"ModifiedNode": {
+						"FinalFields": {
+							"Account": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+							"Balance": "59999988",
+							"Sequence": 6
+						},
+						"LedgerEntryType": "AccountRoot",
+						"PreviousFields": {
+							"Balance": "50000000",
+							"Sequence": 5
+						}
+					}
+				},
+				{
+					"ModifiedNode": {
+						"FinalFields": {
+							"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+							"Amount": "30000000",
+							"Balance": "10000000",
+							"Destination": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+							"DestinationTag": 129053196
+						},
+						"LedgerEntryType": "PayChannel",
+						"PreviousFields": {
+							"Balance": "0"
+						}
+					}
+				}
+			],
+			"TransactionIndex": 3,
+			"TransactionResult": "tesSUCCESS"
+		},
+		"status": "success",
+		"validated": true
+	}
+}`
+
+func TestXRPValueTransferFixtures(t *testing.T) {
+	// Payment hash of a 10000000 drop payment of 1E6A1D1D... to rhub8VRN... with tag 129053196
+	transferHash := "a6721b5c9d7b6ea188d0e49299563ddea2bfc97c43c62c32ee7a4c952b62733b"
+	tests := []struct {
+		name        string
+		fixture     string
+		paymentHash string
+	}{
+		{"EscrowFinish", xrpEscrowFinishFixture, transferHash},
+		{"CheckCash", xrpCheckCashFixture, transferHash},
+		{"PaymentChannelClaim", xrpPaymentChannelClaimFixture, transferHash},
+	}
+	for _, test := range tests {
+		server := newXRPFixtureServer(test.fixture)
+		paymentHash, _, err := GetXRPTx("1E6A1D1D5A6A4B2B6E3E0B0C6E7E4B9F0F5E3F6A6B0E5D7C9B8A7F6E5D4C3B2A", 62880100, PaymentProofBasic, TimestampWindow{}, server.URL)
+		server.Close()
+		if err {
+			t.Errorf("%s: unexpected API error", test.name)
+			continue
+		}
+		if hex.EncodeToString(paymentHash) != test.paymentHash {
+			t.Errorf("%s: got payment hash %s want %s", test.name, hex.EncodeToString(paymentHash), test.paymentHash)
+		}
+	}
+}
+
+const xrpAccountInfoFixture = `{
+	"result": {
+		"account_data": {
+			"Account": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+			"Balance": "123456789",
+			"Flags": 0,
+			"LedgerEntryType": "AccountRoot",
+			"Sequence": 5
+		},
+		"ledger_index": 62880010,
+		"status": "success",
+		"validated": true
+	}
+}`
+
+const xrpAccountNotFoundFixture = `{
+	"result": {
+		"error": "actNotFound",
+		"ledger_index": 62880010,
+		"status": "error",
+		"validated": true
+	}
+}`
+
+const xrpLedgerNotFoundFixture = `{
+	"result": {
+		"error": "lgrNotFound",
+		"status": "error"
+	}
+}`
+
+func TestXRPBalanceFixtures(t *testing.T) {
+	address := "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq"
+	tests := []struct {
+		name     string
+		fixture  string
+		ledger   uint64
+		balance  uint64
+		found    bool
+		apiError bool
+	}{
+		{"Validated", xrpAccountInfoFixture, 62880010, 123456789, true, false},
+		{"LedgerMismatch", xrpAccountInfoFixture, 62880011, 0, false, false},
+		{"AccountNotFound", xrpAccountNotFoundFixture, 62880010, 0, false, false},
+		{"LedgerNotFound", xrpLedgerNotFoundFixture, 62880010, 0, false, true},
+	}
+	for _, test := range tests {
+		server := newXRPFixtureServer(test.fixture)
+		balance, found, err := GetXRPBalance(address, test.ledger, server.URL)
+		server.Close()
+		if balance != test.balance || found != test.found || err != test.apiError {
+			t.Errorf("%s: got (%d, %t, %t) want (%d, %t, %t)", test.name, balance, found, err, test.balance, test.found, test.apiError)
+		}
+	}
+}
+
+const xrpServerInfoFixture = `{
+	"result": {
+		"info": {
+			"complete_ledgers": "32570-62880000,62880005-62890000"
+		},
+		"status": "success"
+	}
+}`
+
+// An incoming payment to rhub8VRN... followed by an outgoing one
+const xrpAccountTxFixture = `{
+	"result": {
+		"account": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+		"ledger_index_max": 62880100,
+		"ledger_index_min": 62880010,
+		"limit": 200,
+		"status": "success",
+		"transactions": [
+			{
+				"meta": {
+					"AffectedNodes": [
+						{
+							"ModifiedNode": {
+								"FinalFields": {
+									"Account": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+									"Balance": "30000000"
+								},
+								"LedgerEntryType": "AccountRoot",
+								"PreviousFields": {
+									"Balance": "10000000"
+								}
+							}
+						}
+					],
+					"TransactionResult": "tesSUCCESS",
+					"delivered_amount": "20000000"
+				},
+				"tx": {
+					"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+					"Amount": "20000000",
+					"Destination": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+					"Fee": "12",
+					"TransactionType": "Payment",
+					"hash": "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A",
+					"ledger_index": 62880010
+				},
+				"validated": true
+			},
+			{
+				"meta": {
+					"AffectedNodes": [
+						{
+							"ModifiedNode": {
+								"FinalFields": {
+									"Account": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+									"Balance": "19999988"
+								},
+								"LedgerEntryType": "AccountRoot",
+								"PreviousFields": {
+									"Balance": "30000000"
+								}
+							}
+						}
+					],
+					"TransactionResult": "tesSUCCESS",
+					"delivered_amount": "10000000"
+				},
+				"tx": {
+					"Account": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+					"Amount": "10000000",
+					"Destination": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+					"Fee": "12",
+					"TransactionType": "Payment",
+					"hash": "1E6A1D1D5A6A4B2B6E3E0B0C6E7E4B9F0F5E3F6A6B0E5D7C9B8A7F6E5D4C3B2A",
+					"ledger_index": 62880050
+				},
+				"validated": true
+			}
+		],
+		"validated": true
+	}
+}`
+
+func TestXRPNonPaymentFixtures(t *testing.T) {
+	server := newXRPMethodFixtureServer(map[string]string{
+		"server_info": xrpServerInfoFixture,
+		"account_tx":  xrpAccountTxFixture,
+	})
+	defer server.Close()
+	tests := []struct {
+		name        string
+		startLedger uint64
+		endLedger   uint64
+		filter      string
+		nonPayment  bool
+		apiError    bool
+	}{
+		{"SenderOfSecondPayment", 62880010, 62880100, "address:rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq", false, false},
+		{"SenderOfFirstPayment", 62880010, 62880100, "address:rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh", false, false},
+		{"NoMatchingPayment", 62880010, 62880100, "address:rPT1Sjq2YGrBMTttX4GZHjKu9dyfzbpAYe", true, false},
+		{"LedgerGap", 62879990, 62880100, "address:rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq", false, true},
+		{"InvalidFilter", 62880010, 62880100, "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq", false, false},
+		{"ShortReference", 62880010, 62880100, "reference:0102", false, false},
+		{"LongReferenceScan", 62880010, 62880100, "reference:6f1dfd1d0fe8a32e40e1f2c05cf1c15545bab56b617f9c6c2d63a6b704bef59b", false, false},
+	}
+	for _, test := range tests {
+		nonPayment, err := GetXRPNonPayment(test.startLedger, test.endLedger, test.filter, server.URL)
+		if nonPayment != test.nonPayment || err != test.apiError {
+			t.Errorf("%s: got (%t, %t) want (%t, %t)", test.name, nonPayment, err, test.nonPayment, test.apiError)
+		}
+	}
+
+	// An account whose transactions take more pages than are read
+	var accountTxRequests int32
+	paged := newXRPMethodFixtureServer(map[string]string{
+		"server_info": xrpServerInfoFixture,
+		"account_tx":  strings.Replace(xrpAccountTxFixture, `"limit": 200,`, `"limit": 200, "marker": {"ledger": 62880050, "seq": 1},`, 1),
+	})
+	defer paged.Close()
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&accountTxRequests, 1)
+		paged.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	if nonPayment, err := GetXRPNonPayment(62880010, 62880100, "address:rPT1Sjq2YGrBMTttX4GZHjKu9dyfzbpAYe", server.URL); nonPayment || err {
+		t.Errorf("got (%t, %t) for an account with too many transactions", nonPayment, err)
+	}
+	if requests := atomic.LoadInt32(&accountTxRequests); requests != int32(1+maxXRPAccountTxPages) {
+		t.Errorf("made %d requests want %d", requests, 1+maxXRPAccountTxPages)
+	}
+}
+
+// Serve fixed Ethereum JSON-RPC results for each method
+func newEVMFixtureServer(results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + results[request.Method] + `}`))
+	}))
+}
+
+const evmReceiptFixture = `{
+	"blockHash": "0x4a8cd4d9b26f6f1b7ee1e7c1d2b4bb8c5ad3e4d9e7c2e1b0f0e1d2c3b4a59687",
+	"blockNumber": "0xd59f80",
+	"from": "0xa7d9ddbe1f17865597fbd27ec712455208b6b76d",
+	"logs": [
+		{
+			"address": "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+			"data": "0x000000000000000000000000000000000000000000000000000000000ee6b280",
+			"logIndex": "0x7",
+			"removed": false,
+			"topics": [
+				"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef",
+				"0x000000000000000000000000a7d9ddbe1f17865597fbd27ec712455208b6b76d",
+				"0x0000000000000000000000005aaeb6053f3e94c9b9a09f33669435e7ef1beaed"
+			]
+		},
+		{
+			"address": "0x06012c8cf97BEaD5deAe237070F9587f8E7A266d",
+			"data": "0x",
+			"logIndex": "0x8",
+			"removed": false,
+			"topics": [
+				"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef",
+				"0x000000000000000000000000a7d9ddbe1f17865597fbd27ec712455208b6b76d",
+				"0x0000000000000000000000005aaeb6053f3e94c9b9a09f33669435e7ef1beaed",
+				"0x0000000000000000000000000000000000000000000000000000000000000001"
+			]
+		}
+	],
+	"status": "0x1",
+	"to": "0xf02c1c8e6114b1dbe8937a39260b5b0a374432bb",
+	"transactionHash": "0x88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b"
+}`
+
+const evmTxFixture = `{
+	"from": "0xa7d9ddbe1f17865597fbd27ec712455208b6b76d",
+	"hash": "0x88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b",
+	"to": "0xF02c1c8e6114b1Dbe8937a39260b5b0a374432bB",
+	"value": "0x14d1120d7b160000"
+}`
+
+const evmBlockFixture = `{
+	"hash": "0x4a8cd4d9b26f6f1b7ee1e7c1d2b4bb8c5ad3e4d9e7c2e1b0f0e1d2c3b4a59687",
+	"number": "0xd59f80",
+	"timestamp": "0x61847400",
+	"transactions": [
+		"0x88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b"
+	]
+}`
+
+func TestEVMPaymentHashFixtures(t *testing.T) {
+	txHash := "0x88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b"
+	tests := []struct {
+		name        string
+		txId        string
+		blockNumber string
+		variant     PaymentProofVariant
+		paymentHash string
+	}{
+		{"native", txHash, `"0xd59f8c"`, PaymentProofBasic, "4b87bf4cfb2753987618f8ac12416149d63aadd22ae4a2e23b63d5bb7f33fa8d"},
+		{"native source", txHash, `"0xd59f8c"`, PaymentProofSource, "ad3d20d2636c21329805e2277cdcceb89ceece526bc9e7a1339c4b59c03c247c"},
+		{"native timestamp", txHash, `"0xd59f8c"`, PaymentProofTimestamp, "ffd052394900e2da96b861922d761adba67e3e21c400e61576347088ac195524"},
+		{"native reference", txHash, `"0xd59f8c"`, PaymentProofReference, ""},
+		{"token transfer", txHash + ":7", `"0xd59f8c"`, PaymentProofBasic, "3fbdb75e8f62a6ea846aa68ea16f41bb2370f83aa0bc6d3d2f9224de1a71babd"},
+		{"non-fungible token transfer", txHash + ":8", `"0xd59f8c"`, PaymentProofBasic, ""},
+		{"missing log", txHash + ":9", `"0xd59f8c"`, PaymentProofBasic, ""},
+		{"padded log index", txHash + ":07", `"0xd59f8c"`, PaymentProofBasic, ""},
+		{"uppercase transaction hash", "0x88DF016429689C079F3B2F6AD39FA052532C56795B733DA78A91EBE6A713944B", `"0xd59f8c"`, PaymentProofBasic, ""},
+		{"unconfirmed", txHash, `"0xd59f8b"`, PaymentProofBasic, ""},
+	}
+	for _, test := range tests {
+		server := newEVMFixtureServer(map[string]string{
+			"eth_getTransactionReceipt": evmReceiptFixture,
+			"eth_getTransactionByHash":  evmTxFixture,
+			"eth_getBlockByNumber":      evmBlockFixture,
+			"eth_blockNumber":           test.blockNumber,
+		})
+		paymentHash, _, err := GetEVMTx(test.txId, 14000100, "eth", test.variant, testTimestampWindow, server.URL, EVMChainConfig{Confirmations: 12})
+		server.Close()
+		if err {
+			t.Errorf("%s: unexpected API error", test.name)
+			continue
+		}
+		if hex.EncodeToString(paymentHash) != test.paymentHash {
+			t.Errorf("%s: got payment hash %s want %s", test.name, hex.EncodeToString(paymentHash), test.paymentHash)
+		}
+	}
+}
+
+func TestVerifyEVMReceiptsTrie(t *testing.T) {
+	txHash := "0x88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b"
+	blockReceipt := func(receiptType string) string {
+		return strings.Replace(evmReceiptFixture, `"status": "0x1",`, `"status": "0x1",
+	"type": "`+receiptType+`",
+	"cumulativeGasUsed": "0x5208",
+	"logsBloom": "0x`+strings.Repeat("00", 256)+`",`, 1)
+	}
+	tests := []struct {
+		name        string
+		receipts    string
+		paymentHash string
+		apiErr      bool
+	}{
+		{"dynamic fee receipt", `[` + blockReceipt("0x2") + `]`, "4b87bf4cfb2753987618f8ac12416149d63aadd22ae4a2e23b63d5bb7f33fa8d", false},
+		{"blob receipt", `[` + blockReceipt("0x3") + `]`, "4b87bf4cfb2753987618f8ac12416149d63aadd22ae4a2e23b63d5bb7f33fa8d", false},
+		{"unknown receipt type", `[` + blockReceipt("0x7e") + `]`, "", true},
+		{"receipt missing from the block", `[]`, "", true},
+		{"receipt of another transaction", `[` + strings.Replace(blockReceipt("0x2"), txHash, "0x"+strings.Repeat("11", 32), 1) + `]`, "", true},
+	}
+	for _, test := range tests {
+		requests := make(map[string]int)
+		results := map[string]string{
+			"eth_getTransactionReceipt": evmReceiptFixture,
+			"eth_getTransactionByHash":  evmTxFixture,
+			"eth_getBlockByNumber":      evmBlockFixture,
+			"eth_getBlockReceipts":      test.receipts,
+			"eth_blockNumber":           `"0xd59f8c"`,
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var request struct {
+				Method string `json:"method"`
+			}
+			json.NewDecoder(r.Body).Decode(&request)
+			requests[request.Method]++
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + results[request.Method] + `}`))
+		}))
+		paymentHash, _, err := GetEVMTx(txHash, 14000100, "eth", PaymentProofBasic, testTimestampWindow, server.URL, EVMChainConfig{Confirmations: 12, VerifyReceiptsTrie: true})
+		server.Close()
+		if err != test.apiErr || hex.EncodeToString(paymentHash) != test.paymentHash {
+			t.Errorf("%s: got (%x, %t) want (%s, %t)", test.name, paymentHash, err, test.paymentHash, test.apiErr)
+		}
+		// The receipts of the block are fetched at once
+		if requests["eth_getBlockReceipts"] != 1 || requests["eth_getTransactionReceipt"] != 1 {
+			t.Errorf("%s: got requests %v", test.name, requests)
+		}
+	}
+}
+
+func TestEVMChainConfigSchedule(t *testing.T) {
+	defer func(schedule UpgradeSchedule) { activeUpgradeSchedule = schedule }(activeUpgradeSchedule)
+	activeUpgradeSchedule = mustParseUpgradeSchedule(`[` + genesisUpgrades(true) + `,
+		{"name": "ethereum", "time": 1700000000, "params": {"maxAllowedChains": 6, "evmConfirmations": 64, "verifyEVMReceiptsTrie": true}}
+	]`)
+	// Settings in the environment of a node do not change its verdicts
+	os.Setenv("ETH_CONFIRMATIONS", "1")
+	defer os.Unsetenv("ETH_CONFIRMATIONS")
+	before := GetEVMChainConfig("ETH", "http://127.0.0.1:8545", big.NewInt(1699999999))
+	after := GetEVMChainConfig("ETH", "http://127.0.0.1:8545", big.NewInt(1700000000))
+	if before.Confirmations != 12 || before.VerifyReceiptsTrie || GetMaxAllowedChains(big.NewInt(1699999999)) != 5 {
+		t.Errorf("got %+v before the upgrade", before)
+	}
+	if after.Confirmations != 64 || !after.VerifyReceiptsTrie || GetMaxAllowedChains(big.NewInt(1700000000)) != 6 {
+		t.Errorf("got %+v after the upgrade", after)
+	}
+}
+
+func TestEVMTimestampProofs(t *testing.T) {
+	defer func(schedule UpgradeSchedule) { activeUpgradeSchedule = schedule }(activeUpgradeSchedule)
+	activeUpgradeSchedule = mustParseUpgradeSchedule(`[` + genesisUpgrades(true) + `,
+		{"name": "timestamp proofs", "time": 1, "params": {"provePaymentTimestampFinalitySelector": "0x413991ef"}}
+	]`)
+	server := newEVMFixtureServer(map[string]string{
+		"eth_getTransactionReceipt": evmReceiptFixture,
+		"eth_getTransactionByHash":  evmTxFixture,
+		"eth_getBlockByNumber":      evmBlockFixture,
+		"eth_blockNumber":           `"0xd59f8c"`,
+	})
+	defer server.Close()
+	blockTime := big.NewInt(1636070400)
+	selector := GetProvePaymentTimestampFinalitySelector(blockTime)
+	txId := "0x88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b"
+	paymentHash, _ := hex.DecodeString("ffd052394900e2da96b861922d761adba67e3e21c400e61576347088ac195524")
+	// The timestamp of the block of the payment is 1636070400
+	tests := []struct {
+		name     string
+		checkRet []byte
+		verified bool
+	}{
+		{"within the window", proofCheckRet(5, 14000000, 14000100, paymentHash, txId, testTimestampWindow.From, testTimestampWindow.To), true},
+		{"window before the block", proofCheckRet(5, 14000000, 14000100, paymentHash, txId, testTimestampWindow.From, 1636070399), false},
+		{"window after the block", proofCheckRet(5, 14000000, 14000100, paymentHash, txId, 1636070401, testTimestampWindow.To), false},
+		{"window ending before it starts", proofCheckRet(5, 14000000, 14000100, paymentHash, txId, testTimestampWindow.To, testTimestampWindow.From), false},
+		{"payment proof layout", proofCheckRet(5, 14000000, 14000100, paymentHash, txId), false},
+	}
+	for _, test := range tests {
+		if verified, err := ProveChain(common.Address{}, blockTime, selector, test.checkRet, 5, server.URL); verified != test.verified || err {
+			t.Errorf("%s: got (%t, %t) want (%t, false)", test.name, verified, err, test.verified)
+		}
+	}
+}
+
+// Serve fixed REST responses by request path, and 404 for any other path
+func newPathFixtureServer(responses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/hal+json")
+		w.Write([]byte(response))
+	}))
+}
+
+const stellarTxFixture = `{
+	"created_at": "2021-11-05T00:00:00Z",
+	"envelope_xdr": "AAAAAgAAAAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4fIAAAAGQAAAAAAAAAAQAAAAEAAAAAYYNhAAAAAABhhOegAAAAAQAAAAppbnZvaWNlIDQyAAAAAAAAAAAAAAAAAAA=",
+	"hash": "5a5b8ce8e2d0cf1b4bb46ab1e0dd1a3f1bb3a2f3f8c1a3b8d2c5e2f1a7b6c3d4",
+	"ledger": 38115806,
+	"memo": "invoice 42",
+	"memo_type": "text",
+	"operation_count": 3,
+	"source_account": "GAYOLLLUIZE4DZMBB2ZBKGBUBZLIOYU6XFLW37GBP2VZD3ABNXCW4BVA",
+	"successful": true
+}`
+
+const stellarOperationsFixture = `{
+	"_embedded": {
+		"records": [
+			{
+				"amount": "125.0000000",
+				"asset_type": "native",
+				"from": "GAYOLLLUIZE4DZMBB2ZBKGBUBZLIOYU6XFLW37GBP2VZD3ABNXCW4BVA",
+				"to": "GDUKMGUGDZQK6YHYA5Z6AY2G4XDSZPSZ3SW5UN3ARVMO6QSRDWP5YLEX",
+				"transaction_hash": "5a5b8ce8e2d0cf1b4bb46ab1e0dd1a3f1bb3a2f3f8c1a3b8d2c5e2f1a7b6c3d4",
+				"transaction_successful": true,
+				"type": "payment"
+			},
+			{
+				"amount": "0.5000005",
+				"asset_code": "USDC",
+				"asset_issuer": "GA5ZSEJYB37JRC5AVCIA5MOP4RHTM335X2KGX3IHOJAPP5RE34K4KZVN",
+				"asset_type": "credit_alphanum4",
+				"from": "GAYOLLLUIZE4DZMBB2ZBKGBUBZLIOYU6XFLW37GBP2VZD3ABNXCW4BVA",
+				"source_amount": "3.1000000",
+				"source_asset_type": "native",
+				"to": "GDUKMGUGDZQK6YHYA5Z6AY2G4XDSZPSZ3SW5UN3ARVMO6QSRDWP5YLEX",
+				"transaction_hash": "5a5b8ce8e2d0cf1b4bb46ab1e0dd1a3f1bb3a2f3f8c1a3b8d2c5e2f1a7b6c3d4",
+				"transaction_successful": true,
+				"type": "path_payment_strict_send"
+			},
+			{
+				"account": "GCKFBEIYV2U22IO2BJ4KVJOIP7XPWQGQFKKWXR6DOSJBV7STMAQSMTGG",
+				"funder": "GAYOLLLUIZE4DZMBB2ZBKGBUBZLIOYU6XFLW37GBP2VZD3ABNXCW4BVA",
+				"starting_balance": "2.0000000",
+				"transaction_hash": "5a5b8ce8e2d0cf1b4bb46ab1e0dd1a3f1bb3a2f3f8c1a3b8d2c5e2f1a7b6c3d4",
+				"transaction_successful": true,
+				"type": "create_account"
+			}
+		]
+	}
+}`
+
+func TestStellarPaymentHashFixtures(t *testing.T) {
+	server := newPathFixtureServer(map[string]string{
+		"/transactions/5a5b8ce8e2d0cf1b4bb46ab1e0dd1a3f1bb3a2f3f8c1a3b8d2c5e2f1a7b6c3d4":            stellarTxFixture,
+		"/transactions/5a5b8ce8e2d0cf1b4bb46ab1e0dd1a3f1bb3a2f3f8c1a3b8d2c5e2f1a7b6c3d4/operations": stellarOperationsFixture,
+	})
+	defer server.Close()
+	txHash := "5a5b8ce8e2d0cf1b4bb46ab1e0dd1a3f1bb3a2f3f8c1a3b8d2c5e2f1a7b6c3d4"
+	tests := []struct {
+		name        string
+		txId        string
+		variant     PaymentProofVariant
+		paymentHash string
+	}{
+		{"payment", txHash + ":0", PaymentProofBasic, "adac08ea15fca53f18e9b1a91ab15ebfbdaf3ef7ddff503270cd5a3117e292f5"},
+		{"payment memo", txHash + ":0", PaymentProofReference, "c3640c37834634433b19e81e0ac79cbb555a9c635f01b36db26a88bf49515cd2"},
+		{"payment source", txHash + ":0", PaymentProofSource, "0f809903708f91af412a983258a92c9a64bd4e07cf4f226097951cffd355c1d7"},
+		{"payment timestamp", txHash + ":0", PaymentProofTimestamp, "44d2a3794cd455c923f65836078364da9ff87ab8c6a369bc73694ce51a82a8b7"},
+		{"path payment of issued asset", txHash + ":1", PaymentProofBasic, "adc224042b5abef217ff3f23f58806eed2da8c0232ef65eaf32e9a9bbd0a3e5b"},
+		{"create account", txHash + ":2", PaymentProofBasic, ""},
+		{"operation out of range", txHash + ":3", PaymentProofBasic, ""},
+		{"missing operation index", txHash, PaymentProofBasic, ""},
+		{"padded operation index", txHash + ":01", PaymentProofBasic, ""},
+		{"uppercase transaction hash", "5A5B8CE8E2D0CF1B4BB46AB1E0DD1A3F1BB3A2F3F8C1A3B8D2C5E2F1A7B6C3D4:0", PaymentProofBasic, ""},
+		{"unknown transaction", "6a5b8ce8e2d0cf1b4bb46ab1e0dd1a3f1bb3a2f3f8c1a3b8d2c5e2f1a7b6c3d4:0", PaymentProofBasic, ""},
+	}
+	for _, test := range tests {
+		paymentHash, _, err := GetStellarTx(test.txId, 38115900, test.variant, testTimestampWindow, server.URL)
+		if err {
+			t.Errorf("%s: unexpected API error", test.name)
+			continue
+		}
+		if hex.EncodeToString(paymentHash) != test.paymentHash {
+			t.Errorf("%s: got payment hash %s want %s", test.name, hex.EncodeToString(paymentHash), test.paymentHash)
+		}
+	}
+}
+
+func TestStellarAmount(t *testing.T) {
+	tests := []struct {
+		amount  string
+		stroops uint64
+		ok      bool
+	}{
+		{"125.0000000", 1250000000, true},
+		{"0.5000005", 5000005, true},
+		{"7", 70000000, true},
+		{"0.00000001", 0, false},
+		{"-1.0000000", 0, false},
+		{"1.2.3", 0, false},
+	}
+	for _, test := range tests {
+		stroops, ok := GetStellarAmount(test.amount)
+		if stroops != test.stroops || ok != test.ok {
+			t.Errorf("%s: got (%d, %t) want (%d, %t)", test.amount, stroops, ok, test.stroops, test.ok)
+		}
+	}
+}
+
+func TestStellarMemoXDR(t *testing.T) {
+	textMemo := "000000010000000a696e766f6963652034320000"
+	tests := []struct {
+		name        string
+		envelopeXDR string
+		memo        string
+		ok          bool
+	}{
+		{"text memo", "AAAAAgAAAAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4fIAAAAGQAAAAAAAAAAQAAAAEAAAAAYYNhAAAAAABhhOegAAAAAQAAAAppbnZvaWNlIDQyAAAAAAAAAAAAAAAAAAA=", textMemo, true},
+		{"text memo of a v0 envelope", "AAAAAAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gAAAAZAAAAAAAAAABAAAAAQAAAAAAAAABAAAAAAAAAAIAAAABAAAACmludm9pY2UgNDIAAAAAAAAAAAAAAAAAAA==", textMemo, true},
+		{"id memo of a muxed source with v2 preconditions", "AAAAAgAAAQAAAAAAAAAABwECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gAAAAZAAAAAAAAAABAAAAAgAAAAEAAAAAAAAAAAAAAABhhOegAAAAAAAAAAAAAAAAAAAABQAAAAAAAAACAAAAAAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gAAAAAwECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gAAAABWFiY2RlAAAAAAAAAgAAAAAAAAAqAAAAAAAAAAAAAAAA", "00000002000000000000002a", true},
+		{"hash memo of a fee bump", "AAAABQAAAQAAAAAAAAAABwECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gAAAAAAAAAMgAAAACAAAAAAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gAAAAZAAAAAAAAAABAAAAAAAAAAOrq6urq6urq6urq6urq6urq6urq6urq6urq6urq6urqwAAAAAAAAAAAAAAAA==", "00000003" + strings.Repeat("ab", 32), true},
+		{"no memo", "AAAAAgAAAAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4fIAAAAGQAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAAA", "00000000", true},
+		{"text memo above 28 bytes", "AAAAAgAAAAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4fIAAAAGQAAAAAAAAAAQAAAAAAAAABAAAAHXh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4eHh4AAAAAAAAAAAAAAAAAAAA", "", false},
+		{"non-zero padding", "AAAAAgAAAAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4fIAAAAGQAAAAAAAAAAQAAAAAAAAABAAAAAmFiAQAAAAAAAAAAAAAAAAA=", "", false},
+		{"fee bump of a v0 envelope", "AAAABQAAAAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4fIAAAAAAAAADIAAAAAAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8g", "", false},
+		{"unknown preconditions", "AAAAAgAAAAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4fIAAAAGQAAAAAAAAAAQAAAAMAAAAAAAAAAAAAAAAAAAAA", "", false},
+		{"truncated", "AAAAAgAAAAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4fIAAAAGQAAAAAAAAAAQAAAAEAAAAA", "", false},
+		{"not base64", "invoice 42", "", false},
+		{"missing envelope", "", "", false},
+	}
+	for _, test := range tests {
+		memo, ok := GetStellarMemoXDR(test.envelopeXDR)
+		if ok != test.ok || hex.EncodeToString(memo) != test.memo {
+			t.Errorf("%s: got memo %x, %t want %s, %t", test.name, memo, ok, test.memo, test.ok)
+		}
+	}
+}
+
+func TestUTXOChainConfiguration(t *testing.T) {
+	defer func(schedule UpgradeSchedule) { activeUpgradeSchedule = schedule }(activeUpgradeSchedule)
+	defer SetUTXOChains(nil)
+	activeUpgradeSchedule = mustParseUpgradeSchedule(`[` + genesisUpgrades(true) + `,
+		{"name": "more chains", "time": 1700000000, "params": {"maxAllowedChains": 8}},
+		{"name": "address field", "time": 1750000000, "params": {"powAddressField": true}},
+		{"name": "bitcoin cash allowed", "time": 1800000000, "params": {"allowedUTXOChains": [0, 1, 2, 7]}}
+	]`)
+	blockTime := big.NewInt(1636070400)
+	if chain, ok := GetUTXOChainConfig(0, blockTime); !ok || chain.CurrencyCode != "btc" || chain.AddressField {
+		t.Errorf("expected chain 0 to be btc, read without the address field, got %+v", chain)
+	}
+	if chain, ok := GetUTXOChainConfig(0, big.NewInt(1750000000)); !ok || !chain.AddressField {
+		t.Errorf("expected the address field to be read once scheduled, got %+v", chain)
+	}
+	if chain, ok := GetUTXOChainConfig(2, blockTime); !ok || !chain.AuxPoW || !IsUTXOChainAddress(chain, "DH5yaieqoZN36fDVciNyRueRGvGLR3mr7L") || IsUTXOChainAddress(chain, "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq") {
+		t.Errorf("unexpected doge configuration %+v", chain)
+	}
+	if err := CheckAllowedUTXOChains(); err == nil || !strings.Contains(err.Error(), `UTXO chain 7 allowed by upgrade "bitcoin cash allowed" is not defined`) {
+		t.Errorf("expected an allowed chain without a definition to be refused, got %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "utxo_chains.json")
+	if err := ioutil.WriteFile(path, []byte(`[{"chainId": 7, "currencyCode": "bch", "envPrefix": "BCH", "decimals": 8, "addressPrefixes": ["bitcoincash:q", "bitcoincash:p"]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("UTXO_CHAINS", path)
+	defer os.Unsetenv("UTXO_CHAINS")
+	if err := LoadUTXOChainsFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if chains := GetUTXOChains(); len(chains) != 4 || chains[3].CurrencyCode != "bch" {
+		t.Fatalf("expected the genesis chains followed by bch, got %+v", chains)
+	}
+	if _, ok := GetUTXOChainConfig(7, big.NewInt(1700000000)); ok {
+		t.Errorf("expected a defined chain outside the allowlist to be rejected")
+	}
+	if chain, ok := GetUTXOChainConfig(7, big.NewInt(1800000000)); !ok || chain.CurrencyCode != "bch" {
+		t.Errorf("expected bch to be verified once allowed, got %+v", chain)
+	}
+	// Proofs of chains of other verifiers are not taken by the PoW verifier
+	for _, chainId := range []uint32{3, 4, 5, 6} {
+		if _, ok := GetUTXOChainConfig(chainId, big.NewInt(1800000000)); ok {
+			t.Errorf("chain %d was taken as a UTXO chain", chainId)
+		}
+	}
+}
+
+func TestInvalidUTXOChains(t *testing.T) {
+	tests := []struct {
+		name   string
+		chains string
+		err    string
+	}{
+		{"chain of another verifier", `[{"chainId": 3, "currencyCode": "bch", "envPrefix": "BCH", "decimals": 8, "addressPrefixes": ["bitcoincash:q"]}]`, "collides"},
+		{"genesis chain", `[{"chainId": 0, "currencyCode": "bsv", "envPrefix": "BSV", "decimals": 8, "addressPrefixes": ["1"]}]`, "defined more than once"},
+		{"defined twice", `[{"chainId": 7, "currencyCode": "bch", "envPrefix": "BCH", "decimals": 8, "addressPrefixes": ["bitcoincash:q"]},
+			{"chainId": 7, "currencyCode": "bsv", "envPrefix": "BSV", "decimals": 8, "addressPrefixes": ["1"]}]`, "defined more than once"},
+		{"incomplete", `[{"chainId": 7, "currencyCode": "bch"}]`, "needs a currency code"},
+		{"not a list", `{"chainId": 7}`, "cannot unmarshal"},
+	}
+	defer SetUTXOChains(nil)
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "utxo_chains.json")
+		if err := ioutil.WriteFile(path, []byte(test.chains), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadUTXOChains(path); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+		if chains := GetUTXOChains(); len(chains) != 3 {
+			t.Errorf("%s: invalid definitions were loaded: %+v", test.name, chains)
+		}
+	}
+}
+
+// Returns the checkRet of a proof, with words as the static outputs that follow its hash and
+// data as its string output
+func proofCheckRet(chainId uint32, ledger uint64, finalised uint64, hash []byte, data string, words ...uint64) []byte {
+	head := 128 + 32*(len(words)+1)
+	checkRet := make([]byte, head+32+(len(data)+31)/32*32)
+	binary.BigEndian.PutUint32(checkRet[28:32], chainId)
+	binary.BigEndian.PutUint64(checkRet[56:64], ledger)
+	binary.BigEndian.PutUint64(checkRet[88:96], finalised)
+	copy(checkRet[96:128], hash)
+	for i, word := range words {
+		binary.BigEndian.PutUint64(checkRet[152+32*i:160+32*i], word)
+	}
+	binary.BigEndian.PutUint64(checkRet[head-8:head], uint64(head))
+	binary.BigEndian.PutUint64(checkRet[head+24:head+32], uint64(len(data)))
+	copy(checkRet[head+32:], data)
+	return checkRet
+}
+
+// Serve fixed bitcoind JSON-RPC results by method, or by method and txid for getrawtransaction
+// and by method and first parameter for the others
+func newPoWFixtureServer(results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		key := request.Method
+		if request.Method == "getrawtransaction" {
+			var params GetPoWTxRequestParams
+			json.Unmarshal(request.Params, &params)
+			key += ":" + params.TxID
+		} else {
+			var params []json.RawMessage
+			if json.Unmarshal(request.Params, &params) == nil && len(params) > 0 {
+				if _, ok := results[key+":"+strings.Trim(string(params[0]), `"`)]; ok {
+					key += ":" + strings.Trim(string(params[0]), `"`)
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		result, ok := results[key]
+		if !ok {
+			w.Write([]byte(`{"result":null,"error":{"code":-5,"message":"No such mempool or blockchain transaction"}}`))
+			return
+		}
+		w.Write([]byte(`{"result":` + result + `,"error":null}`))
+	}))
+}
+
+const (
+	powTxIDFixture        = "a1075db55d416d3ca199f55b6084e2115b9345e16c5cf302fc80e9d5fbf5d48d"
+	powPrevTxIDFixture    = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+	powBlockHashFixture   = "0000000000000000000590fc0f3eba193a278534220b2b37e9849e1a770ca959"
+	powReferenceFixture   = "6a0a696e766f696365203432"
+	powDestinationFixture = "76a914759d6677091e973b9e9d99f19c68fbf43e3f05f988ac"
+)
+
+var bitcoindFixtures = map[string]string{
+	"getrawtransaction:" + powTxIDFixture: `{
+		"txid": "` + powTxIDFixture + `",
+		"blockhash": "` + powBlockHashFixture + `",
+		"confirmations": 6,
+		"vin": [{"txid": "` + powPrevTxIDFixture + `", "vout": 0}],
+		"vout": [
+			{"value": 0.015, "n": 0, "scriptPubKey": {"hex": "` + powDestinationFixture + `", "type": "pubkeyhash", "address": "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "addresses": ["1BoatSLRHtKNngkdXEeobR76b53LETtpyT"]}},
+			{"value": 0, "n": 1, "scriptPubKey": {"hex": "` + powReferenceFixture + `", "type": "nulldata"}}
+		]
+	}`,
+	"getrawtransaction:" + powPrevTxIDFixture: `{
+		"txid": "` + powPrevTxIDFixture + `",
+		"vin": [{"coinbase": "04ffff001d0104"}],
+		"vout": [
+			{"value": 0.02, "n": 0, "scriptPubKey": {"type": "pubkeyhash", "address": "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "addresses": ["1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"]}}
+		]
+	}`,
+	"getblockheader": `{"hash": "` + powBlockHashFixture + `", "confirmations": 6, "height": 700000, "mediantime": 1636067000}`,
+	"getblockcount":  `700005`,
+}
+
+var esploraFixtures = map[string]string{
+	"/tx/" + powTxIDFixture: `{
+		"txid": "` + powTxIDFixture + `",
+		"vin": [{
+			"txid": "` + powPrevTxIDFixture + `",
+			"vout": 0,
+			"is_coinbase": false,
+			"prevout": {"scriptpubkey_type": "p2pkh", "scriptpubkey_address": "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "value": 2000000}
+		}],
+		"vout": [
+			{"scriptpubkey": "` + powDestinationFixture + `", "scriptpubkey_type": "p2pkh", "scriptpubkey_address": "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "value": 1500000},
+			{"scriptpubkey": "` + powReferenceFixture + `", "scriptpubkey_type": "op_return", "value": 0}
+		],
+		"status": {"confirmed": true, "block_height": 700000, "block_hash": "` + powBlockHashFixture + `"}
+	}`,
+	"/block/" + powBlockHashFixture + "/status": `{"in_best_chain": true, "height": 700000}`,
+	"/block/" + powBlockHashFixture:             `{"id": "` + powBlockHashFixture + `", "height": 700000, "mediantime": 1636067000}`,
+	"/blocks/tip/height":                        `700005`,
+}
+
+// bitcoind 22 and later only report the address of an output in its address field
+var modernBitcoindFixtures = func() map[string]string {
+	fixtures := make(map[string]string)
+	addresses := regexp.MustCompile(`, "addresses": \[[^\]]*\]`)
+	for method, fixture := range bitcoindFixtures {
+		fixtures[method] = addresses.ReplaceAllString(fixture, "")
+	}
+	return fixtures
+}()
+
+// Both PoW backends must reach the same verdicts, so that they can be mixed within a quorum
+func TestPoWBackendPaymentHashFixtures(t *testing.T) {
+	bitcoind := newPoWFixtureServer(bitcoindFixtures)
+	defer bitcoind.Close()
+	// A node that has not seen the block yet
+	behind := newPoWFixtureServer(map[string]string{})
+	defer behind.Close()
+	modernBitcoind := newPoWFixtureServer(modernBitcoindFixtures)
+	defer modernBitcoind.Close()
+	esplora := newPathFixtureServer(esploraFixtures)
+	defer esplora.Close()
+	blockTime := big.NewInt(1636070400)
+	chain, _ := GetUTXOChainConfig(0, blockTime)
+	esploraChain := chain
+	esploraChain.Backend = powBackendEsplora
+	modernChain := chain
+	modernChain.AddressField = true
+	tests := []struct {
+		name                 string
+		txId                 string
+		latestAvailableBlock uint64
+		variant              PaymentProofVariant
+		paymentHash          string
+		apiError             bool
+	}{
+		{"basic", "0" + powTxIDFixture, 700001, PaymentProofBasic, "fbbea4816c6369e28682c399b028e4f2dac4d8542d70c5241962c691df6608f8", false},
+		{"reference", "0" + powTxIDFixture, 700001, PaymentProofReference, "618c55a6ae5d69de672a03f4cc252959a49ae6de1bba4228999454990e9a75b4", false},
+		{"source", "0" + powTxIDFixture, 700001, PaymentProofSource, "5f827c426ddb34791b6bf5d27e612f3d70c4431513f1749a72378e2449e91580", false},
+		{"timestamp", "0" + powTxIDFixture, 700001, PaymentProofTimestamp, "d20c1f88cb1999412bee56e255adca5c4460444522afc7eeb7bf870f1d111a8e", false},
+		{"not yet available", "0" + powTxIDFixture, 700000, PaymentProofBasic, "", false},
+		{"reference output", "1" + powTxIDFixture, 700001, PaymentProofBasic, "", false},
+		{"unknown transaction", "0b3adedfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a", 700001, PaymentProofBasic, "", true},
+	}
+	for _, test := range tests {
+		voutN := uint64(test.txId[0] - '0')
+		for _, backend := range []struct {
+			name  string
+			chain UTXOChainConfig
+			url   string
+		}{{"bitcoind", chain, bitcoind.URL}, {"bitcoind 22", modernChain, modernBitcoind.URL}, {"esplora", esploraChain, esplora.URL}} {
+			paymentHash, _, err := GetPoWTx(test.txId, voutN, test.latestAvailableBlock, backend.chain, test.variant, testTimestampWindow, backend.url, "", "")
+			if err != test.apiError {
+				t.Errorf("%s (%s): got API error %t want %t", test.name, backend.name, err, test.apiError)
+			} else if hex.EncodeToString(paymentHash) != test.paymentHash {
+				t.Errorf("%s (%s): got payment hash %s want %s", test.name, backend.name, hex.EncodeToString(paymentHash), test.paymentHash)
+			}
+		}
+	}
+	// Until the address field is read, outputs reported by bitcoind 22 and later pay no address
+	if paymentHash, _, err := GetPoWTx("0"+powTxIDFixture, 0, 700001, chain, PaymentProofBasic, testTimestampWindow, modernBitcoind.URL, "", ""); err || len(paymentHash) > 0 {
+		t.Errorf("got (%x, %t) from bitcoind 22 before the address field is read", paymentHash, err)
+	}
+
+	checkRet := make([]byte, 128)
+	big.NewInt(700000).FillBytes(checkRet[56:64])
+	checkRet[95] = 5
+	blockHash, _ := hex.DecodeString(powBlockHashFixture)
+	copy(checkRet[96:128], blockHash)
+	for _, backend := range []UTXOChainConfig{chain, esploraChain} {
+		url := bitcoind.URL
+		if backend.Backend == powBackendEsplora {
+			url = esplora.URL
+		}
+		if verified, err := ProveDataAvailabilityPeriodFinalityPoW(checkRet, backend, url, "", ""); !verified || err {
+			t.Errorf("%q backend: got data availability (%t, %t) want (true, false)", backend.Backend, verified, err)
+		}
+	}
+}
+
+func TestPoWBackendPerEndpoint(t *testing.T) {
+	defer func(delay time.Duration) { apiRetryDelay = delay }(apiRetryDelay)
+	apiRetryDelay = 0
+	bitcoind := newPoWFixtureServer(bitcoindFixtures)
+	defer bitcoind.Close()
+	esplora := newPathFixtureServer(esploraFixtures)
+	defer esplora.Close()
+	checksum := func(chainURL string) string {
+		chainURLhash := sha256.Sum256([]byte(chainURL))
+		return hex.EncodeToString(chainURLhash[0:4])
+	}
+	blockTime := big.NewInt(1636070400)
+	selector := GetProveDataAvailabilityPeriodFinalitySelector(blockTime)
+	checkRet := make([]byte, 128)
+	big.NewInt(700000).FillBytes(checkRet[56:64])
+	checkRet[95] = 5
+	blockHash, _ := hex.DecodeString(powBlockHashFixture)
+	copy(checkRet[96:128], blockHash)
+	defer os.Unsetenv("BTC_APIs")
+	defer os.Unsetenv("BTC_T_" + checksum(esplora.URL))
+
+	// Each endpoint of a chain is queried through its own API type
+	var apiErrors []string
+	ReadChainTrace = func(chainURL string, verified bool, apiErr bool) {
+		if apiErr {
+			apiErrors = append(apiErrors, chainURL)
+		}
+	}
+	defer func() { ReadChainTrace = nil }()
+	for _, chainURLs := range []string{esplora.URL + "," + bitcoind.URL, bitcoind.URL + "," + esplora.URL} {
+		os.Setenv("BTC_APIs", chainURLs)
+		os.Setenv("BTC_T_"+checksum(esplora.URL), "esplora")
+		apiErrors = nil
+		if verified, err := readChain(common.Address{}, blockTime, selector, checkRet, nil); !verified || err || len(apiErrors) > 0 {
+			t.Errorf("%s: got (%t, %t) with API errors from %v", chainURLs, verified, err, apiErrors)
+		}
+	}
+	os.Setenv("BTC_APIs", esplora.URL)
+	os.Setenv("BTC_T_"+checksum(esplora.URL), "blockbook")
+	if verified, err := readChain(common.Address{}, blockTime, selector, checkRet, nil); verified || !err {
+		t.Errorf("got (%t, %t) from an API of an unknown type, want an API error", verified, err)
+	}
+}
+
+// Returns a transaction with an output of each script type and hex
+func powTxWithOutputs(scripts ...[2]string) GetPoWTxResult {
+	vout := make([]map[string]interface{}, len(scripts))
+	for i, script := range scripts {
+		vout[i] = map[string]interface{}{"n": i, "scriptPubKey": map[string]string{"type": script[0], "hex": script[1]}}
+	}
+	encoded, _ := json.Marshal(map[string]interface{}{"vout": vout})
+	var tx GetPoWTxResult
+	json.Unmarshal(encoded, &tx)
+	return tx
+}
+
+func TestPoWPaymentReference(t *testing.T) {
+	payment := [2]string{"pubkeyhash", powDestinationFixture}
+	tests := []struct {
+		name      string
+		outputs   [][2]string
+		reference string
+	}{
+		{"direct push", [][2]string{payment, {"nulldata", powReferenceFixture}}, "696e766f696365203432"},
+		{"OP_PUSHDATA1", [][2]string{{"nulldata", "6a4c03aabbcc"}}, "aabbcc"},
+		{"OP_PUSHDATA2", [][2]string{{"nulldata", "6a4d0300aabbcc"}}, "aabbcc"},
+		{"OP_PUSHDATA4", [][2]string{{"nulldata", "6a4e03000000aabbcc"}}, "aabbcc"},
+		{"several pushes", [][2]string{{"nulldata", "6a01aa4c02bbcc"}}, "aabbcc"},
+		{"multiple OP_RETURNs", [][2]string{{"nulldata", "6a01aa"}, payment, {"nulldata", "6a01bb"}}, ""},
+		{"missing OP_RETURN", [][2]string{payment}, ""},
+		{"bare OP_RETURN", [][2]string{{"nulldata", "6a"}}, ""},
+		{"empty push", [][2]string{{"nulldata", "6a00"}}, ""},
+		{"push past the end", [][2]string{{"nulldata", "6a05aabb"}}, ""},
+		{"OP_PUSHDATA2 without a length", [][2]string{{"nulldata", "6a4d03"}}, ""},
+		{"opcode after the data", [][2]string{{"nulldata", "6a01aa51"}}, ""},
+		{"non-standard script", [][2]string{payment, {"nonstandard", "6a51"}}, ""},
+		{"invalid hex", [][2]string{{"nulldata", "6a01a"}}, ""},
+	}
+	for _, test := range tests {
+		reference, ok := GetPoWPaymentReference(powTxWithOutputs(test.outputs...))
+		if ok != (test.reference != "") || hex.EncodeToString(reference) != test.reference {
+			t.Errorf("%s: got (%x, %t) want %q", test.name, reference, ok, test.reference)
+		}
+	}
+}
+
+// Reference proofs commit to the OP_RETURN data of the payment, and are only verified once an
+// upgrade installs their selector
+func TestPoWReferenceProofs(t *testing.T) {
+	defer func(schedule UpgradeSchedule) { activeUpgradeSchedule = schedule }(activeUpgradeSchedule)
+	bitcoind := newPoWFixtureServer(bitcoindFixtures)
+	defer bitcoind.Close()
+	withoutReference := make(map[string]string)
+	for method, fixture := range bitcoindFixtures {
+		withoutReference[method] = strings.Replace(fixture, `,
+			{"value": 0, "n": 1, "scriptPubKey": {"hex": "`+powReferenceFixture+`", "type": "nulldata"}}`, "", 1)
+	}
+	if withoutReference["getrawtransaction:"+powTxIDFixture] == bitcoindFixtures["getrawtransaction:"+powTxIDFixture] {
+		t.Fatal("the reference output was not removed from the payment fixture")
+	}
+	unreferenced := newPoWFixtureServer(withoutReference)
+	defer unreferenced.Close()
+	blockTime := big.NewInt(1636070400)
+	txId := "0" + powTxIDFixture
+	destinationHash := GetDestinationHash("1BoatSLRHtKNngkdXEeobR76b53LETtpyT")
+	amount := big.NewInt(1500000)
+	referenceHash := GetPaymentHash(txId, destinationHash, amount, "btc", crypto.Keccak256([]byte("invoice 42")))
+	otherReferenceHash := GetPaymentHash(txId, destinationHash, amount, "btc", crypto.Keccak256([]byte("invoice 43")))
+	basicHash := GetPaymentHash(txId, destinationHash, amount, "btc")
+	referenceSelector, _ := hex.DecodeString("8e96de1c")
+
+	activeUpgradeSchedule = mustParseUpgradeSchedule(`[` + genesisUpgrades(true) + `]`)
+	if verified, err := ProveChain(common.Address{}, blockTime, referenceSelector, proofCheckRet(0, 700000, 700001, referenceHash, txId), 0, bitcoind.URL); verified || err {
+		t.Errorf("before the upgrade: got (%t, %t) want (false, false)", verified, err)
+	}
+
+	activeUpgradeSchedule = mustParseUpgradeSchedule(`[` + genesisUpgrades(true) + `,
+		{"name": "reference proofs", "time": 1, "params": {"provePaymentReferenceFinalitySelector": "0x8e96de1c"}}
+	]`)
+	tests := []struct {
+		name     string
+		selector []byte
+		checkRet []byte
+		url      string
+		verified bool
+	}{
+		{"reference of the payment", referenceSelector, proofCheckRet(0, 700000, 700001, referenceHash, txId), bitcoind.URL, true},
+		{"another reference", referenceSelector, proofCheckRet(0, 700000, 700001, otherReferenceHash, txId), bitcoind.URL, false},
+		{"basic payment hash", referenceSelector, proofCheckRet(0, 700000, 700001, basicHash, txId), bitcoind.URL, false},
+		{"payment without a reference", referenceSelector, proofCheckRet(0, 700000, 700001, basicHash, txId), unreferenced.URL, false},
+		{"reference output", referenceSelector, proofCheckRet(0, 700000, 700001, referenceHash, "1"+powTxIDFixture), bitcoind.URL, false},
+		{"wrong ledger", referenceSelector, proofCheckRet(0, 699999, 700001, referenceHash, txId), bitcoind.URL, false},
+		{"reference hash as a basic payment", GetProvePaymentFinalitySelector(blockTime), proofCheckRet(0, 700000, 700001, referenceHash, txId), bitcoind.URL, false},
+		{"basic payment still verified", GetProvePaymentFinalitySelector(blockTime), proofCheckRet(0, 700000, 700001, basicHash, txId), unreferenced.URL, true},
+	}
+	for _, test := range tests {
+		if verified, err := ProveChain(common.Address{}, blockTime, test.selector, test.checkRet, 0, test.url); verified != test.verified || err {
+			t.Errorf("%s: got (%t, %t) want (%t, false)", test.name, verified, err, test.verified)
+		}
+	}
+}
+
+func TestPoWSourceHash(t *testing.T) {
+	const multisigPrevTxID = "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"
+	fixtures := map[string]string{
+		"getrawtransaction:" + powPrevTxIDFixture: bitcoindFixtures["getrawtransaction:"+powPrevTxIDFixture],
+		"getrawtransaction:" + multisigPrevTxID: `{
+			"txid": "` + multisigPrevTxID + `",
+			"vout": [
+				{"value": 0.01, "n": 0, "scriptPubKey": {"type": "pubkeyhash", "address": "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "addresses": ["1BoatSLRHtKNngkdXEeobR76b53LETtpyT"]}},
+				{"value": 0.01, "n": 1, "scriptPubKey": {"type": "multisig", "addresses": ["1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"]}}
+			]
+		}`,
+	}
+	var requests int32
+	bitcoind := newPoWFixtureServer(fixtures)
+	defer bitcoind.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		bitcoind.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	chain, _ := GetUTXOChainConfig(0, big.NewInt(1636070400))
+	spending := func(inputs ...string) GetPoWTxResult {
+		var tx GetPoWTxResult
+		json.Unmarshal([]byte(`{"vin": [`+strings.Join(inputs, ",")+`]}`), &tx)
+		return tx
+	}
+	input := func(txID string, vout int) string {
+		return `{"txid": "` + txID + `", "vout": ` + strconv.Itoa(vout) + `}`
+	}
+	tooManyInputs := make([]string, maxPoWSourceProofInputs+1)
+	for i := range tooManyInputs {
+		tooManyInputs[i] = input(powPrevTxIDFixture, 0)
+	}
+	tests := []struct {
+		name     string
+		tx       GetPoWTxResult
+		sources  []string
+		apiError bool
+		requests int32
+	}{
+		{"single input", spending(input(powPrevTxIDFixture, 0)), []string{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"}, false, 1},
+		// Transactions spent from more than once are looked up once
+		{"set of sources", spending(input(multisigPrevTxID, 0), input(powPrevTxIDFixture, 0), input(multisigPrevTxID, 0)), []string{"1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"}, false, 2},
+		{"spent from Esplora prevouts", spending(`{"txid": "` + multisigPrevTxID + `", "vout": 0, "prevout": {"value": 0.01, "scriptPubKey": {"address": "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "addresses": ["1BoatSLRHtKNngkdXEeobR76b53LETtpyT"]}}}`), []string{"1BoatSLRHtKNngkdXEeobR76b53LETtpyT"}, false, 0},
+		{"coinbase", spending(`{"coinbase": "04ffff001d0104"}`), nil, false, 0},
+		{"too many inputs", spending(tooManyInputs...), nil, false, 0},
+		{"multisig output", spending(input(powPrevTxIDFixture, 0), input(multisigPrevTxID, 1)), nil, false, 2},
+		{"missing output", spending(input(powPrevTxIDFixture, 1)), nil, false, 1},
+		{"unknown transaction", spending(input(powTxIDFixture, 0)), nil, true, 1},
+	}
+	for _, test := range tests {
+		atomic.StoreInt32(&requests, 0)
+		sourceHash, found, err := GetPoWSourceHash(test.tx, chain, server.URL, "", "")
+		if err != test.apiError || found != (test.sources != nil) {
+			t.Errorf("%s: got found %t API error %t", test.name, found, err)
+		} else if found && hex.EncodeToString(sourceHash) != hex.EncodeToString(GetPoWSourceSetHash(test.sources)) {
+			t.Errorf("%s: got source hash %x for %v", test.name, sourceHash, test.sources)
+		}
+		if requests := atomic.LoadInt32(&requests); requests != test.requests {
+			t.Errorf("%s: made %d requests want %d", test.name, requests, test.requests)
+		}
+	}
+}
+
+func TestPoWNonPayment(t *testing.T) {
+	blockHashes := []string{
+		"00000000000000000004e3f5a0c9a7b1a5a1b1d1c1e1f1a1b1c1d1e1f1a1b1c1",
+		"00000000000000000002b1c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4",
+		"00000000000000000007c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2",
+	}
+	// Block 700001 spends from 1A1zP1eP..., block 700002 carries a reference and block 700003
+	// does not link to block 700002
+	fixtures := map[string]string{
+		"getblockcount": `700003`,
+		"getblock:" + blockHashes[0]: `{"hash": "` + blockHashes[0] + `", "height": 700001, "previousblockhash": "` + powBlockHashFixture + `", "tx": [
+			{"txid": "` + powTxIDFixture + `", "vin": [{"txid": "` + powPrevTxIDFixture + `", "vout": 0, "prevout": {"value": 0.02, "scriptPubKey": {"type": "pubkeyhash", "address": "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"}}}], "vout": []}
+		]}`,
+		"getblock:" + blockHashes[1]: `{"hash": "` + blockHashes[1] + `", "height": 700002, "previousblockhash": "` + blockHashes[0] + `", "tx": [
+			{"txid": "` + powPrevTxIDFixture + `", "vin": [{"coinbase": "04ffff001d0104"}], "vout": [{"value": 0, "n": 0, "scriptPubKey": {"hex": "` + powReferenceFixture + `", "type": "nulldata"}}]}
+		]}`,
+		"getblock:" + blockHashes[2]: `{"hash": "` + blockHashes[2] + `", "height": 700003, "previousblockhash": "` + blockHashes[0] + `", "tx": []}`,
+	}
+	for i, blockHash := range blockHashes {
+		fixtures["getblockhash:"+strconv.Itoa(700001+i)] = `"` + blockHash + `"`
+	}
+	bitcoind := newPoWFixtureServer(fixtures)
+	defer bitcoind.Close()
+	blockTime := big.NewInt(1636070400)
+	chain, _ := GetUTXOChainConfig(0, blockTime)
+	// Only bitcoind 23 and later serve getblock at verbosity 3, and they report the address field
+	chain.AddressField = true
+	tests := []struct {
+		name        string
+		startLedger uint64
+		endLedger   uint64
+		filter      string
+		nonPayment  bool
+		apiError    bool
+	}{
+		{"no payment from the address", 700001, 700002, "address:1BoatSLRHtKNngkdXEeobR76b53LETtpyT", true, false},
+		{"payment from the address", 700001, 700002, "address:1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", false, false},
+		{"no payment with the reference", 700001, 700002, "reference:aabb", true, false},
+		{"payment with the reference", 700001, 700002, "reference:696e766f696365203432", false, false},
+		{"address of another chain", 700001, 700002, "address:DH5yaieqoZN36fDVciNyRueRGvGLR3mr7L", false, false},
+		{"blocks that do not link", 700002, 700003, "reference:aabb", false, true},
+		{"range beyond the tip", 700003, 700004, "reference:aabb", false, true},
+	}
+	for _, test := range tests {
+		nonPayment, err := GetPoWNonPayment(test.startLedger, test.endLedger, test.filter, chain, bitcoind.URL, "", "")
+		if nonPayment != test.nonPayment || err != test.apiError {
+			t.Errorf("%s: got (%t, %t) want (%t, %t)", test.name, nonPayment, err, test.nonPayment, test.apiError)
+		}
+	}
+
+	nonPaymentCheckRet := func(startLedger uint64, endLedger uint64, filter string) []byte {
+		return proofCheckRet(0, endLedger, endLedger+6, GetNonPaymentHash(filter, startLedger, endLedger), filter, startLedger)
+	}
+	if verified, err := ProveNonPaymentFinalityPoW(nonPaymentCheckRet(700001, 700002, "reference:aabb"), chain, bitcoind.URL, "", ""); !verified || err {
+		t.Errorf("got (%t, %t) for a proof of non-payment", verified, err)
+	}
+	if verified, err := ProveNonPaymentFinalityPoW(nonPaymentCheckRet(700001, 700001+maxPoWNonPaymentProofRange, "reference:aabb"), chain, bitcoind.URL, "", ""); verified || err {
+		t.Errorf("got (%t, %t) for a range longer than the maximum", verified, err)
+	}
+	if dogecoin, _ := GetUTXOChainConfig(2, blockTime); dogecoin.AuxPoW {
+		if verified, err := ProveNonPaymentFinalityPoW(nonPaymentCheckRet(700001, 700002, "reference:aabb"), dogecoin, bitcoind.URL, "", ""); verified || err {
+			t.Errorf("got (%t, %t) for a merge-mined chain", verified, err)
+		}
+	}
+
+	// Block hashes are requested from the backend of the API
+	esplora := newPathFixtureServer(map[string]string{"/block-height/700002": blockHashes[1]})
+	defer esplora.Close()
+	esploraChain := chain
+	esploraChain.Backend = powBackendEsplora
+	if verified, err := ProveNonPaymentFinalityPoW(nonPaymentCheckRet(700001, 700002, "reference:aabb"), esploraChain, esplora.URL, "", ""); verified || !err {
+		t.Errorf("got (%t, %t) from an Esplora API, want an API error", verified, err)
+	}
+
+	for _, backend := range []struct {
+		chain UTXOChainConfig
+		url   string
+	}{{chain, bitcoind.URL}, {esploraChain, esplora.URL}} {
+		if blockHash, err := GetPoWBlockHash(700002, backend.chain, backend.url, "", ""); err || blockHash != blockHashes[1] {
+			t.Errorf("%q backend: got (%s, %t)", backend.chain.Backend, blockHash, err)
+		}
+		if _, err := GetPoWBlockHash(700004, backend.chain, backend.url, "", ""); !err {
+			t.Errorf("%q backend: expected a height above the tip to be an API error", backend.chain.Backend)
+		}
+	}
+}
+
+// Returns an Esplora transaction confirmed at a height, spending the given prevouts and paying
+// the given outputs, each an address and a value
+func esploraTxFixture(txID string, height uint64, prevouts [][2]interface{}, outputs [][2]interface{}) map[string]interface{} {
+	vin := make([]map[string]interface{}, len(prevouts))
+	for i, prevout := range prevouts {
+		vin[i] = map[string]interface{}{"txid": powTxIDFixture, "vout": i, "prevout": map[string]interface{}{"scriptpubkey_address": prevout[0], "value": prevout[1]}}
+	}
+	vout := make([]map[string]interface{}, len(outputs))
+	for i, output := range outputs {
+		vout[i] = map[string]interface{}{"scriptpubkey_address": output[0], "value": output[1]}
+	}
+	return map[string]interface{}{"txid": txID, "vin": vin, "vout": vout, "status": map[string]interface{}{"confirmed": true, "block_height": height}}
+}
+
+func TestPoWBalanceProofs(t *testing.T) {
+	defer func(pages int) { maxPoWBalanceTxPages = pages }(maxPoWBalanceTxPages)
+	address := "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+	other := "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"
+	busy := "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"
+	encode := func(v interface{}) string {
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+	// The address received 2500000 at 700000, spent 1000000 of it with 500000 in change at
+	// 700005 and received 2000000 at 700008
+	fixtures := map[string]string{
+		"/blocks/tip/height":  "700010",
+		"/address/" + address: `{"address": "` + address + `", "chain_stats": {"funded_txo_sum": 5000000, "spent_txo_sum": 1000000, "tx_count": 3}}`,
+		"/address/" + address + "/txs/chain": encode([]interface{}{
+			esploraTxFixture("03", 700008, [][2]interface{}{{other, 2100000}}, [][2]interface{}{{address, 2000000}, {other, 90000}}),
+			esploraTxFixture("02", 700005, [][2]interface{}{{address, 1000000}}, [][2]interface{}{{other, 490000}, {address, 500000}}),
+			esploraTxFixture("01", 700000, [][2]interface{}{{other, 2600000}}, [][2]interface{}{{address, 2500000}}),
+		}),
+	}
+	// The busy address received 1000 in each of a full page of transactions at 700009, and
+	// 7000 at 700001 on the next page
+	var busyTxs []interface{}
+	for i := 0; i < esploraAddressTxsPageSize; i++ {
+		busyTxs = append(busyTxs, esploraTxFixture("b"+strconv.Itoa(i), 700009, [][2]interface{}{{other, 2000}}, [][2]interface{}{{busy, 1000}}))
+	}
+	fixtures["/address/"+busy] = `{"address": "` + busy + `", "chain_stats": {"funded_txo_sum": 32000, "spent_txo_sum": 0, "tx_count": 26}}`
+	fixtures["/address/"+busy+"/txs/chain"] = encode(busyTxs)
+	fixtures["/address/"+busy+"/txs/chain/b24"] = encode([]interface{}{
+		esploraTxFixture("b25", 700001, [][2]interface{}{{other, 8000}}, [][2]interface{}{{busy, 7000}}),
+	})
+	tipHashes := []string{powBlockHashFixture}
+	var tipRequests int32
+	esplora := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/blocks/tip/hash" {
+			request := int(atomic.AddInt32(&tipRequests, 1)) - 1
+			w.Write([]byte(tipHashes[request%len(tipHashes)]))
+			return
+		}
+		response, ok := fixtures[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(response))
+	}))
+	defer esplora.Close()
+	chain, _ := GetUTXOChainConfig(0, big.NewInt(1636070400))
+	chain.Backend = powBackendEsplora
+	tests := []struct {
+		name      string
+		checkRet  []byte
+		pages     int
+		tipHashes []string
+		verified  bool
+		apiErr    bool
+	}{
+		{"balance before the first transaction", proofCheckRet(0, 699999, 700006, GetBalanceHash(address, 0, "btc"), address), 8, nil, true, false},
+		{"balance after the first transaction", proofCheckRet(0, 700004, 700006, GetBalanceHash(address, 2500000, "btc"), address), 8, nil, true, false},
+		{"balance after a spend with change", proofCheckRet(0, 700006, 700008, GetBalanceHash(address, 2000000, "btc"), address), 8, nil, true, false},
+		{"balance at the tip", proofCheckRet(0, 700009, 700010, GetBalanceHash(address, 4000000, "btc"), address), 8, nil, true, false},
+		{"balance of the tip at a past block", proofCheckRet(0, 700004, 700006, GetBalanceHash(address, 4000000, "btc"), address), 8, nil, false, false},
+		{"balance in another currency", proofCheckRet(0, 700004, 700006, GetBalanceHash(address, 2500000, "ltc"), address), 8, nil, false, false},
+		{"ledger not before the finalised ledger", proofCheckRet(0, 700006, 700006, GetBalanceHash(address, 2000000, "btc"), address), 8, nil, false, false},
+		{"ledger above the tip", proofCheckRet(0, 700011, 700012, GetBalanceHash(address, 4000000, "btc"), address), 8, nil, false, true},
+		{"address of another chain", proofCheckRet(0, 700004, 700006, GetBalanceHash("Xpayee", 0, "btc"), "Xpayee"), 8, nil, false, false},
+		{"unwind over two pages", proofCheckRet(0, 700004, 700006, GetBalanceHash(busy, 7000, "btc"), busy), 2, nil, true, false},
+		{"unwind deeper than the page limit", proofCheckRet(0, 700004, 700006, GetBalanceHash(busy, 7000, "btc"), busy), 1, nil, false, false},
+		{"tip changed during the unwind", proofCheckRet(0, 700004, 700006, GetBalanceHash(address, 2500000, "btc"), address), 8, []string{powBlockHashFixture, strings.Repeat("0", 64)}, false, true},
+	}
+	for _, test := range tests {
+		maxPoWBalanceTxPages = test.pages
+		tipHashes = []string{powBlockHashFixture}
+		if test.tipHashes != nil {
+			tipHashes = test.tipHashes
+		}
+		atomic.StoreInt32(&tipRequests, 0)
+		if verified, err := ProveBalanceFinalityPoW(test.checkRet, chain, esplora.URL, "", ""); verified != test.verified || err != test.apiErr {
+			t.Errorf("%s: got (%t, %t) want (%t, %t)", test.name, verified, err, test.verified, test.apiErr)
+		}
+	}
+
+	// JSON-RPC APIs cannot report the balance of an address at a past block
+	defer func(schedule UpgradeSchedule) { activeUpgradeSchedule = schedule }(activeUpgradeSchedule)
+	activeUpgradeSchedule = mustParseUpgradeSchedule(`[` + genesisUpgrades(true) + `,
+		{"name": "balance proofs", "time": 1, "params": {"proveBalanceFinalitySelector": "0x27d798f5"}}
+	]`)
+	blockTime := big.NewInt(1636070400)
+	checkRet := proofCheckRet(0, 700004, 700006, GetBalanceHash(address, 2500000, "btc"), address)
+	if verified, err := ProveChain(common.Address{}, blockTime, GetProveBalanceFinalitySelector(blockTime), checkRet, 0, esplora.URL); verified || !err {
+		t.Errorf("JSON-RPC backend: got (%t, %t) want (false, true)", verified, err)
+	}
+}
+
+func TestPoWTimestampProofs(t *testing.T) {
+	defer func(schedule UpgradeSchedule) { activeUpgradeSchedule = schedule }(activeUpgradeSchedule)
+	activeUpgradeSchedule = mustParseUpgradeSchedule(`[` + genesisUpgrades(true) + `,
+		{"name": "timestamp proofs", "time": 1, "params": {"provePaymentTimestampFinalitySelector": "0x413991ef"}}
+	]`)
+	server := newPoWFixtureServer(bitcoindFixtures)
+	defer server.Close()
+	blockTime := big.NewInt(1636070400)
+	selector := GetProvePaymentTimestampFinalitySelector(blockTime)
+	txId := "0" + powTxIDFixture
+	paymentHash, _ := hex.DecodeString("d20c1f88cb1999412bee56e255adca5c4460444522afc7eeb7bf870f1d111a8e")
+	chain, _ := GetUTXOChainConfig(0, blockTime)
+	// The median time of the block of the payment is 1636067000
+	atMedianTime, _, _ := GetPoWTx(txId, 0, 700001, chain, PaymentProofTimestamp, TimestampWindow{From: 1636067000, To: 1636067000}, server.URL, "", "")
+	tests := []struct {
+		name     string
+		checkRet []byte
+		verified bool
+	}{
+		{"within the window", proofCheckRet(0, 700000, 700001, paymentHash, txId, testTimestampWindow.From, testTimestampWindow.To), true},
+		{"window of the median time only", proofCheckRet(0, 700000, 700001, atMedianTime, txId, 1636067000, 1636067000), true},
+		{"window before the median time", proofCheckRet(0, 700000, 700001, paymentHash, txId, testTimestampWindow.From, 1636066999), false},
+		{"window after the median time", proofCheckRet(0, 700000, 700001, paymentHash, txId, 1636067001, testTimestampWindow.To), false},
+		{"window ending before it starts", proofCheckRet(0, 700000, 700001, paymentHash, txId, testTimestampWindow.To, testTimestampWindow.From), false},
+		{"payment proof layout", proofCheckRet(0, 700000, 700001, paymentHash, txId), false},
+	}
+	for _, test := range tests {
+		if verified, err := ProveChain(common.Address{}, blockTime, selector, test.checkRet, 0, server.URL); verified != test.verified || err {
+			t.Errorf("%s: got (%t, %t) want (%t, false)", test.name, verified, err, test.verified)
+		}
+	}
+	if len(atMedianTime) == 0 || hex.EncodeToString(atMedianTime) == hex.EncodeToString(paymentHash) {
+		t.Errorf("expected the payment hash to commit to the window, got %x", atMedianTime)
+	}
+}
+
+func TestXRPLedgerStreamHistory(t *testing.T) {
+	stream := NewXRPLedgerStream("wss://xrplcluster.com/")
+	stream.HandleMessage([]byte(`{"type": "ledgerClosed", "ledger_index": 62880010, "ledger_hash": "A6E9B9E2B0A5C0C3E1D3F4A5B6C7D8E9F0A1B2C3D4E5F6A7B8C9D0E1F2A3B4C5"}`))
+	stream.HandleMessage([]byte(`{"type": "ledgerClosed", "ledger_index": 62880011, "ledger_hash": "0F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E43302041"}`))
+	if ledgerHash, found, err := stream.GetLedgerHash(62880010); !found || err || ledgerHash != "A6E9B9E2B0A5C0C3E1D3F4A5B6C7D8E9F0A1B2C3D4E5F6A7B8C9D0E1F2A3B4C5" {
+		t.Errorf("got (%s, %t, %t) for a streamed ledger", ledgerHash, found, err)
+	}
+	if _, found, err := stream.GetLedgerHash(62880012); found || err {
+		t.Errorf("expected a ledger beyond a disconnected stream to be requested, got (%t, %t)", found, err)
+	}
+	stream.conn = &websocket.Conn{}
+	if _, found, err := stream.GetLedgerHash(62880012); found || !err {
+		t.Errorf("expected a ledger beyond the latest validated ledger to be an API error, got (%t, %t)", found, err)
+	}
+	// Ledgers that fall out of the history are requested from the API again
+	stream.AddLedger(62880010+xrpLedgerHistoryLength, "6C2D63A6B704BEF59B6F1DFD1D0FE8A32E40E1F2C05CF1C15545BAB56B617F9C")
+	if _, found, err := stream.GetLedgerHash(62880010); found || err {
+		t.Errorf("expected a ledger beyond the history to be requested, got (%t, %t)", found, err)
+	}
+	if _, found, _ := stream.GetLedgerHash(62880011); !found {
+		t.Errorf("expected the oldest ledger within the history to be kept")
+	}
+	response := make(chan []byte, 1)
+	stream.pending[7] = response
+	stream.HandleMessage([]byte(`{"id": 7, "type": "response", "status": "success", "result": {}}`))
+	if _, pending := stream.pending[7]; pending || len(response) != 1 {
+		t.Errorf("expected the response to be delivered to its request")
+	}
+}
+
+func TestXRPWebSocketTranslation(t *testing.T) {
+	payload, _ := json.Marshal(GetXRPTxRequestPayload{
+		Method: "tx",
+		Params: []GetXRPTxRequestParams{{Transaction: "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A"}},
+	})
+	command, ok := GetXRPWebSocketCommand(payload)
+	if !ok || command["command"] != "tx" || command["transaction"] != "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A" || command["binary"] != false {
+		t.Errorf("unexpected command %v", command)
+	}
+	var fixture struct {
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	json.Unmarshal([]byte(xrpPaymentWithReferenceFixture), &fixture)
+	delete(fixture.Result, "status")
+	result, _ := json.Marshal(fixture.Result)
+	respBody, err := GetXRPWebSocketResponseBody([]byte(`{"id": 1, "type": "response", "status": "success", "result": ` + string(result) + `}`))
+	if err {
+		t.Fatalf("unexpected error translating a response")
+	}
+	server := newXRPFixtureServer(string(respBody))
+	defer server.Close()
+	paymentHash, inLedger, err := GetXRPTx("F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A", 62880100, PaymentProofBasic, TimestampWindow{}, server.URL)
+	if err || inLedger != 62880010 || hex.EncodeToString(paymentHash) != "716f54bafa5c2314f7d953f84c82efe31d1d6e1cabf41ef94f0eaf4789c46929" {
+		t.Errorf("got (%x, %d, %t) for a translated response", paymentHash, inLedger, err)
+	}
+	respBody, err = GetXRPWebSocketResponseBody([]byte(`{"id": 2, "type": "response", "status": "error", "error": "txnNotFound", "error_code": 29}`))
+	var checkErrorResp map[string]CheckXRPErrorResponse
+	if err || json.Unmarshal(respBody, &checkErrorResp) != nil || checkErrorResp["result"].Error != "txnNotFound" {
+		t.Errorf("got %s for a translated error", respBody)
+	}
+}
+
+func TestPreVerifyStateConnectorCall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state-connector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir("cache", 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(delay time.Duration) { apiRetryDelay = delay }(apiRetryDelay)
+	apiRetryDelay = 0
+	defer func(schedule UpgradeSchedule) { activeUpgradeSchedule = schedule }(activeUpgradeSchedule)
+	activeUpgradeSchedule = mustParseUpgradeSchedule(`[` + genesisUpgrades(true) + `,
+		{"name": "evm confirmations", "time": 1636070500, "params": {"evmConfirmations": 24}}
+	]`)
+
+	bitcoind := newPoWFixtureServer(bitcoindFixtures)
+	defer bitcoind.Close()
+	// A node that has not seen the block yet
+	behind := newPoWFixtureServer(map[string]string{})
+	defer behind.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("unavailable"))
+	}))
+	defer unavailable.Close()
+	os.Setenv("BTC_APIs", bitcoind.URL)
+	defer os.Unsetenv("BTC_APIs")
+	os.Setenv("XRP_APIs", unavailable.URL)
+	defer os.Unsetenv("XRP_APIs")
+	var traces int32
+	ReadChainTrace = func(chainURL string, verified bool, apiErr bool) { atomic.AddInt32(&traces, 1) }
+	defer func() { ReadChainTrace = nil }()
+
+	blockTime := big.NewInt(1636070400)
+	selector := GetProveDataAvailabilityPeriodFinalitySelector(blockTime)
+	dataAvailability := func(chainId uint32, commit bool) []byte {
+		checkRet := make([]byte, 128)
+		binary.BigEndian.PutUint32(checkRet[28:32], chainId)
+		binary.BigEndian.PutUint64(checkRet[56:64], 700000)
+		if commit {
+			checkRet[95] = 5
+		}
+		blockHash, _ := hex.DecodeString(powBlockHashFixture)
+		copy(checkRet[96:128], blockHash)
+		return checkRet
+	}
+	if PreVerifyStateConnectorCall(common.Address{}, nil, blockTime, selector, dataAvailability(0, false)) {
+		t.Errorf("expected a reveal not to be verified in advance")
+	}
+	if IsStateConnectorProofSelector(blockTime, []byte{0, 0, 0, 0}) || !IsStateConnectorProofSelector(blockTime, selector) {
+		t.Errorf("unexpected proof selectors")
+	}
+
+	tests := []struct {
+		name      string
+		chainId   uint32
+		preVerify bool
+		// BTC_APIs while the proof is verified in advance, if not bitcoind
+		advanceAPIs string
+		// Whether the verdict reached in advance outlives preVerificationTTL
+		expired    bool
+		commitTime int64
+		verified   bool
+		// Chain API calls made by the commit
+		requests int32
+	}{
+		{"verified in advance", 0, true, "", false, 1636070450, true, 0},
+		{"verified in advance under other upgrade parameters", 0, true, "", false, 1636070500, true, 1},
+		{"verified in advance too long ago", 0, true, "", true, 1636070450, true, 1},
+		{"rejected in advance", 0, true, behind.URL, false, 1636070450, true, 1},
+		{"not verified in advance", 0, false, "", false, 1636070450, true, 1},
+		{"chain APIs unavailable in advance", 3, true, "", false, 1636070450, false, int32(apiRetries)},
+	}
+	for _, test := range tests {
+		commit := dataAvailability(test.chainId, true)
+		acceptedPath, rejectedPath := GetVerificationPaths(selector, commit)
+		if test.preVerify {
+			if test.advanceAPIs != "" {
+				os.Setenv("BTC_APIs", test.advanceAPIs)
+			}
+			if !PreVerifyStateConnectorCall(common.Address{}, nil, blockTime, selector, commit) {
+				t.Fatalf("%s: expected a commit to be verified in advance", test.name)
+			}
+			verificationsLock.Lock()
+			pre := preVerifications[acceptedPath]
+			verificationsLock.Unlock()
+			<-pre.done
+			os.Setenv("BTC_APIs", bitcoind.URL)
+			if test.expired {
+				pre.started = pre.started.Add(-2 * preVerificationTTL)
+			}
+			// Verdicts reached in advance are kept out of the cache
+			if _, err := os.Stat(acceptedPath); err == nil {
+				t.Errorf("%s: verdict reached in advance was cached", test.name)
+			}
+		}
+		before := atomic.LoadInt32(&traces)
+		verifyToCache(common.Address{}, big.NewInt(1), big.NewInt(test.commitTime), selector, commit)
+		if requests := atomic.LoadInt32(&traces) - before; requests != test.requests {
+			t.Errorf("%s: commit made %d chain API calls, want %d", test.name, requests, test.requests)
+		}
+		verdictPath := rejectedPath
+		if test.verified {
+			verdictPath = acceptedPath
+		}
+		if _, err := os.Stat(verdictPath); err != nil {
+			t.Errorf("%s: no verdict in the cache: %v", test.name, err)
+		}
+		os.Remove(acceptedPath)
+		os.Remove(rejectedPath)
+	}
+}
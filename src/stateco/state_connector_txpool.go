@@ -0,0 +1,240 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ava-labs/coreth/core/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	ErrProofUnderpriced        = errors.New("state connector transaction underpriced")
+	ErrProofSenderRateExceeded = errors.New("state connector transaction rate of sender exceeded")
+	ErrProofRateExceeded       = errors.New("state connector transaction rate exceeded")
+	ErrProofPoolFull           = errors.New("too many pending state connector transactions")
+)
+
+// Limits on the transactions to the state connector that the tx pool admits, since each proof
+// makes every validator query the underlying-chain APIs. A limit of 0 is not enforced.
+type ProofAdmissionConfig struct {
+	MinGasPrice *big.Int
+	// Transactions per minute, of each sender and of all senders together
+	SenderRate uint64
+	GlobalRate uint64
+	MaxPending int
+}
+
+// Admission limits set by PROOF_TX_MIN_GAS_PRICE (in wei), PROOF_TX_SENDER_RATE and
+// PROOF_TX_GLOBAL_RATE (per minute) and PROOF_TX_MAX_PENDING
+func GetProofAdmissionConfig() ProofAdmissionConfig {
+	config := ProofAdmissionConfig{
+		MinGasPrice: new(big.Int),
+		SenderRate:  20,
+		GlobalRate:  600,
+		MaxPending:  1000,
+	}
+	if minGasPrice, ok := new(big.Int).SetString(os.Getenv("PROOF_TX_MIN_GAS_PRICE"), 10); ok && minGasPrice.Sign() >= 0 {
+		config.MinGasPrice = minGasPrice
+	}
+	if senderRate, err := strconv.ParseUint(os.Getenv("PROOF_TX_SENDER_RATE"), 10, 64); err == nil {
+		config.SenderRate = senderRate
+	}
+	if globalRate, err := strconv.ParseUint(os.Getenv("PROOF_TX_GLOBAL_RATE"), 10, 64); err == nil {
+		config.GlobalRate = globalRate
+	}
+	if maxPending, err := strconv.ParseUint(os.Getenv("PROOF_TX_MAX_PENDING"), 10, 31); err == nil {
+		config.MaxPending = int(maxPending)
+	}
+	return config
+}
+
+// Allows a burst of rate transactions, refilled at rate per minute
+type proofRateBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func (b *proofRateBucket) refill(rate uint64, now time.Time) {
+	b.tokens += now.Sub(b.updated).Minutes() * float64(rate)
+	if b.tokens > float64(rate) {
+		b.tokens = float64(rate)
+	}
+	b.updated = now
+}
+
+type proofAdmission struct {
+	lock    sync.Mutex
+	config  ProofAdmissionConfig
+	now     func() time.Time
+	senders map[common.Address]*proofRateBucket
+	global  proofRateBucket
+	// Transactions charged that may still be in the tx pool
+	pending map[common.Hash]struct{}
+	// Transactions that the tx pool is reinjecting after a reorg
+	reinjected map[common.Hash]struct{}
+}
+
+func newProofAdmission(config ProofAdmissionConfig, now func() time.Time) *proofAdmission {
+	return &proofAdmission{
+		config:  config,
+		now:     now,
+		senders: make(map[common.Address]*proofRateBucket),
+		global:  proofRateBucket{tokens: float64(config.GlobalRate), updated: now()},
+		pending: make(map[common.Hash]struct{}),
+	}
+}
+
+// Reports whether a transaction is within every limit, without counting it against them.
+// isPending tells which of the transactions charged before are still in the tx pool.
+func (a *proofAdmission) check(hash common.Hash, sender common.Address, gasFeeCap *big.Int, isPending func(common.Hash) bool) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if _, ok := a.reinjected[hash]; ok {
+		return nil
+	}
+	if a.config.MinGasPrice != nil && gasFeeCap.Cmp(a.config.MinGasPrice) < 0 {
+		return fmt.Errorf("%w: fee cap %s below %s", ErrProofUnderpriced, gasFeeCap, a.config.MinGasPrice)
+	}
+	for pendingHash := range a.pending {
+		if !isPending(pendingHash) {
+			delete(a.pending, pendingHash)
+		}
+	}
+	// Already counted against the limits
+	if _, ok := a.pending[hash]; ok {
+		return nil
+	}
+	if a.config.MaxPending > 0 && len(a.pending) >= a.config.MaxPending {
+		return fmt.Errorf("%w: %d", ErrProofPoolFull, len(a.pending))
+	}
+
+	now := a.now()
+	// Senders whose buckets have refilled need not be remembered
+	for address, bucket := range a.senders {
+		if bucket.refill(a.config.SenderRate, now); bucket.tokens >= float64(a.config.SenderRate) {
+			delete(a.senders, address)
+		}
+	}
+	if bucket, ok := a.senders[sender]; a.config.SenderRate > 0 && ok && bucket.tokens < 1 {
+		return fmt.Errorf("%w: %s", ErrProofSenderRateExceeded, sender.Hex())
+	}
+	a.global.refill(a.config.GlobalRate, now)
+	if a.config.GlobalRate > 0 && a.global.tokens < 1 {
+		return ErrProofRateExceeded
+	}
+	return nil
+}
+
+// Counts a transaction that entered the pending set against the limits, once. Transactions
+// checked together may overdraw a bucket, which then admits none until it refills.
+func (a *proofAdmission) charge(hash common.Hash, sender common.Address) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if _, ok := a.pending[hash]; ok {
+		return
+	}
+	a.pending[hash] = struct{}{}
+	if _, ok := a.reinjected[hash]; ok {
+		delete(a.reinjected, hash)
+		return
+	}
+	now := a.now()
+	if a.config.SenderRate > 0 {
+		bucket, ok := a.senders[sender]
+		if !ok {
+			bucket = &proofRateBucket{tokens: float64(a.config.SenderRate), updated: now}
+			a.senders[sender] = bucket
+		}
+		bucket.refill(a.config.SenderRate, now)
+		bucket.tokens--
+	}
+	if a.config.GlobalRate > 0 {
+		a.global.refill(a.config.GlobalRate, now)
+		a.global.tokens--
+	}
+}
+
+// Exempts transactions from the limits until they are charged, in place of those exempted
+// before
+func (a *proofAdmission) reinject(hashes []common.Hash) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.reinjected = make(map[common.Hash]struct{}, len(hashes))
+	for _, hash := range hashes {
+		a.reinjected[hash] = struct{}{}
+	}
+}
+
+var (
+	proofAdmissionOnce      sync.Once
+	stateConnectorAdmission *proofAdmission
+)
+
+func getStateConnectorAdmission() *proofAdmission {
+	proofAdmissionOnce.Do(func() {
+		stateConnectorAdmission = newProofAdmission(GetProofAdmissionConfig(), time.Now)
+	})
+	return stateConnectorAdmission
+}
+
+// Returns the sender of a proof transaction to the state connector, or false for any other
+// transaction, which the admission limits do not apply to
+func stateConnectorProofSender(tx *types.Transaction, signer types.Signer, blockTime uint64) (common.Address, bool) {
+	to := tx.To()
+	if to == nil || *to != common.HexToAddress(GetStateConnectorContractAddr(new(big.Int).SetUint64(blockTime))) {
+		return common.Address{}, false
+	}
+	if !IsStateConnectorProofSelector(new(big.Int).SetUint64(blockTime), tx.Data()) {
+		return common.Address{}, false
+	}
+	sender, err := types.Sender(signer, tx)
+	if err != nil {
+		// Rejected by the tx pool as an invalid sender
+		return common.Address{}, false
+	}
+	return sender, true
+}
+
+// Admission control of proof transactions to the state connector, applied by the tx pool once
+// a transaction has passed its own validation. It uses none of the limits, which only
+// ChargeStateConnectorTx counts against. isPending reports whether a transaction is still in
+// the tx pool.
+func ValidateStateConnectorTx(tx *types.Transaction, signer types.Signer, blockTime uint64, isPending func(common.Hash) bool) error {
+	sender, ok := stateConnectorProofSender(tx, signer, blockTime)
+	if !ok {
+		return nil
+	}
+	return getStateConnectorAdmission().check(tx.Hash(), sender, tx.GasFeeCap(), isPending)
+}
+
+// Counts a proof transaction to the state connector against the admission limits, called by
+// the tx pool once the transaction enters its pending set, so that transactions the tx pool
+// discards, or queues without ever promoting, use none of them
+func ChargeStateConnectorTx(tx *types.Transaction, signer types.Signer, blockTime uint64) {
+	if sender, ok := stateConnectorProofSender(tx, signer, blockTime); ok {
+		getStateConnectorAdmission().charge(tx.Hash(), sender)
+	}
+}
+
+// Exempts the transactions that the tx pool reinjects after a reorg from the admission limits,
+// since they were charged before or arrived in a block. The tx pool calls it before it
+// validates them again.
+func ReinjectStateConnectorTxs(txs types.Transactions) {
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	getStateConnectorAdmission().reinject(hashes)
+}
@@ -0,0 +1,198 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ava-labs/coreth/core/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type proofAdmissionClock struct{ now time.Time }
+
+func (c *proofAdmissionClock) Now() time.Time { return c.now }
+
+func allPending(common.Hash) bool { return true }
+
+// Checks a transaction and charges it, as the tx pool does when it promotes the transaction
+func admitProofTx(admission *proofAdmission, hash common.Hash, sender common.Address, gasFeeCap *big.Int, isPending func(common.Hash) bool) error {
+	if err := admission.check(hash, sender, gasFeeCap, isPending); err != nil {
+		return err
+	}
+	admission.charge(hash, sender)
+	return nil
+}
+
+func TestProofAdmissionConfig(t *testing.T) {
+	os.Setenv("PROOF_TX_MIN_GAS_PRICE", "225000000000")
+	defer os.Unsetenv("PROOF_TX_MIN_GAS_PRICE")
+	os.Setenv("PROOF_TX_SENDER_RATE", "0")
+	defer os.Unsetenv("PROOF_TX_SENDER_RATE")
+	os.Setenv("PROOF_TX_MAX_PENDING", "many")
+	defer os.Unsetenv("PROOF_TX_MAX_PENDING")
+
+	config := GetProofAdmissionConfig()
+	if config.MinGasPrice.String() != "225000000000" || config.SenderRate != 0 || config.GlobalRate != 600 || config.MaxPending != 1000 {
+		t.Errorf("unexpected config %+v", config)
+	}
+}
+
+func TestProofAdmissionFeeFloor(t *testing.T) {
+	clock := &proofAdmissionClock{now: time.Unix(1636070400, 0)}
+	admission := newProofAdmission(ProofAdmissionConfig{MinGasPrice: big.NewInt(100)}, clock.Now)
+	sender := common.HexToAddress("0x01")
+	if err := admitProofTx(admission, common.HexToHash("0x01"), sender, big.NewInt(99), allPending); !errors.Is(err, ErrProofUnderpriced) {
+		t.Errorf("got %v, want %v", err, ErrProofUnderpriced)
+	}
+	if err := admitProofTx(admission, common.HexToHash("0x02"), sender, big.NewInt(100), allPending); err != nil {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestProofAdmissionRates(t *testing.T) {
+	clock := &proofAdmissionClock{now: time.Unix(1636070400, 0)}
+	admission := newProofAdmission(ProofAdmissionConfig{SenderRate: 2, GlobalRate: 3}, clock.Now)
+	alice := common.HexToAddress("0x01")
+	bob := common.HexToAddress("0x02")
+	gasPrice := big.NewInt(225000000000)
+	var nonce int64
+	admit := func(sender common.Address) error {
+		nonce++
+		return admitProofTx(admission, common.BigToHash(big.NewInt(nonce)), sender, gasPrice, allPending)
+	}
+
+	if admit(alice) != nil || admit(alice) != nil {
+		t.Fatalf("expected a burst of two transactions from one sender")
+	}
+	if err := admit(alice); !errors.Is(err, ErrProofSenderRateExceeded) {
+		t.Errorf("got %v, want %v", err, ErrProofSenderRateExceeded)
+	}
+	if err := admit(bob); err != nil {
+		t.Errorf("got %v", err)
+	}
+	if err := admit(bob); !errors.Is(err, ErrProofRateExceeded) {
+		t.Errorf("got %v, want %v", err, ErrProofRateExceeded)
+	}
+
+	// Half a minute refills one transaction of each sender and one and a half of all senders
+	clock.now = clock.now.Add(30 * time.Second)
+	if err := admit(alice); err != nil {
+		t.Errorf("got %v", err)
+	}
+	if err := admit(bob); !errors.Is(err, ErrProofRateExceeded) {
+		t.Errorf("got %v, want %v", err, ErrProofRateExceeded)
+	}
+	clock.now = clock.now.Add(time.Minute)
+	if admit(bob) != nil || admit(bob) != nil {
+		t.Errorf("expected the rate of a sender to recover")
+	}
+}
+
+func TestProofAdmissionMaxPending(t *testing.T) {
+	clock := &proofAdmissionClock{now: time.Unix(1636070400, 0)}
+	admission := newProofAdmission(ProofAdmissionConfig{MaxPending: 2}, clock.Now)
+	pending := make(map[common.Hash]bool)
+	isPending := func(hash common.Hash) bool { return pending[hash] }
+	gasPrice := big.NewInt(225000000000)
+
+	for i := int64(1); i <= 2; i++ {
+		hash := common.BigToHash(big.NewInt(i))
+		if err := admitProofTx(admission, hash, common.HexToAddress("0x01"), gasPrice, isPending); err != nil {
+			t.Fatalf("got %v", err)
+		}
+		pending[hash] = true
+	}
+	third := common.BigToHash(big.NewInt(3))
+	if err := admitProofTx(admission, third, common.HexToAddress("0x02"), gasPrice, isPending); !errors.Is(err, ErrProofPoolFull) {
+		t.Errorf("got %v, want %v", err, ErrProofPoolFull)
+	}
+	// Once a transaction leaves the tx pool, another one is admitted
+	delete(pending, common.BigToHash(big.NewInt(1)))
+	if err := admitProofTx(admission, third, common.HexToAddress("0x02"), gasPrice, isPending); err != nil {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestProofAdmissionChargedOnEntry(t *testing.T) {
+	clock := &proofAdmissionClock{now: time.Unix(1636070400, 0)}
+	admission := newProofAdmission(ProofAdmissionConfig{SenderRate: 1}, clock.Now)
+	sender := common.HexToAddress("0x01")
+	gasPrice := big.NewInt(225000000000)
+	first, second := common.HexToHash("0x01"), common.HexToHash("0x02")
+
+	// Transactions checked but never pending use none of the limits
+	for i := 0; i < 3; i++ {
+		if err := admission.check(first, sender, gasPrice, allPending); err != nil {
+			t.Fatalf("got %v", err)
+		}
+	}
+	admission.charge(first, sender)
+	admission.charge(first, sender)
+	if err := admission.check(first, sender, gasPrice, allPending); err != nil {
+		t.Errorf("got %v for a transaction already charged", err)
+	}
+	if err := admission.check(second, sender, gasPrice, allPending); !errors.Is(err, ErrProofSenderRateExceeded) {
+		t.Errorf("got %v, want %v", err, ErrProofSenderRateExceeded)
+	}
+	clock.now = clock.now.Add(time.Minute)
+	if err := admission.check(second, sender, gasPrice, allPending); err != nil {
+		t.Errorf("got %v once a transaction was charged only once", err)
+	}
+}
+
+func TestValidateStateConnectorTx(t *testing.T) {
+	proofAdmissionOnce.Do(func() {})
+	defer func(admission *proofAdmission) { stateConnectorAdmission = admission }(stateConnectorAdmission)
+	clock := &proofAdmissionClock{now: time.Unix(1636070400, 0)}
+	stateConnectorAdmission = newProofAdmission(ProofAdmissionConfig{SenderRate: 1, MaxPending: 10}, clock.Now)
+
+	key, _ := crypto.GenerateKey()
+	blockTime := uint64(1636070400)
+	stateConnector := common.HexToAddress(GetStateConnectorContractAddr(new(big.Int).SetUint64(blockTime)))
+	other := common.HexToAddress("0x01")
+	proof := append(GetProveDataAvailabilityPeriodFinalitySelector(new(big.Int).SetUint64(blockTime)), make([]byte, 128)...)
+	signedTx := func(nonce uint64, to common.Address, data []byte) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: nonce, GasPrice: big.NewInt(225000000000), Gas: 500000, To: &to, Value: new(big.Int), Data: data}), types.HomesteadSigner{}, key)
+		return tx
+	}
+	validate := func(tx *types.Transaction) error {
+		return ValidateStateConnectorTx(tx, types.HomesteadSigner{}, blockTime, allPending)
+	}
+	charge := func(tx *types.Transaction) {
+		ChargeStateConnectorTx(tx, types.HomesteadSigner{}, blockTime)
+	}
+
+	first, second := signedTx(0, stateConnector, proof), signedTx(1, stateConnector, proof)
+	if validate(first) != nil || validate(second) != nil {
+		t.Fatalf("expected transactions not yet pending to use none of the limits")
+	}
+	charge(first)
+	if err := validate(second); !errors.Is(err, ErrProofSenderRateExceeded) {
+		t.Errorf("got %v, want %v", err, ErrProofSenderRateExceeded)
+	}
+	if err := validate(signedTx(1, other, proof)); err != nil {
+		t.Errorf("got %v for a transaction to another contract", err)
+	}
+	nonProof := signedTx(1, stateConnector, []byte{0x01, 0x02, 0x03, 0x04})
+	if err := validate(nonProof); err != nil {
+		t.Errorf("got %v for a transaction to the state connector that proves nothing", err)
+	}
+	charge(nonProof)
+
+	// Transactions reinjected after a reorg are exempt from the limits until charged
+	ReinjectStateConnectorTxs(types.Transactions{first, second})
+	if validate(second) != nil {
+		t.Errorf("expected a reinjected transaction to be admitted")
+	}
+	charge(second)
+	if err := validate(signedTx(2, stateConnector, proof)); !errors.Is(err, ErrProofSenderRateExceeded) {
+		t.Errorf("got %v for a new transaction, want %v", err, ErrProofSenderRateExceeded)
+	}
+}
@@ -0,0 +1,215 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+)
+
+// UTXOChainConfig describes a bitcoind-compatible chain verified by the PoW verifier. Chains
+// other than those of genesisUTXOChains are defined in the JSON file at UTXO_CHAINS, so that
+// adding one needs no release, and are only verified once the upgrade schedule adds their
+// chain ID to GetAllowedUTXOChains. Any of their parameters changes verdicts, so every
+// validator loads the same definition of a chain before it is allowed.
+type UTXOChainConfig struct {
+	ChainID uint32 `json:"chainId"`
+	// Currency code committed to in payment hashes
+	CurrencyCode string `json:"currencyCode"`
+	// Prefix of the <prefix>_APIs, <prefix>_U_<checksum> and <prefix>_P_<checksum> variables
+	EnvPrefix string `json:"envPrefix"`
+	// Decimal places of the unit amounts are reported in by the node
+	Decimals uint8 `json:"decimals"`
+	// Prefixes accepted for the addresses given in balance and non-payment proofs
+	AddressPrefixes []string `json:"addressPrefixes"`
+	// Merge-mined chains run Dogecoin Core derived nodes, whose getblock cannot report the
+	// outputs spent by inputs, so non-payment proofs are not available for them
+	AuxPoW bool `json:"auxPoW,omitempty"`
+	// API type of the chain URL being queried, read by ProvePoW from <prefix>_T_<checksum> and
+	// JSON-RPC when empty. It is a private choice of each validator, like the URL itself.
+	Backend string `json:"-"`
+	// Whether output addresses are read from the address field of bitcoind 22 and later, set by
+	// GetUTXOChainConfig from the upgrade schedule
+	AddressField bool `json:"-"`
+}
+
+// Chain IDs verified by other verifiers, which UTXO chains cannot take
+var nonUTXOChainIds = []uint32{3, 4, 5, 6}
+
+// The UTXO chains of every node
+var genesisUTXOChains = []UTXOChainConfig{
+	{ChainID: 0, CurrencyCode: "btc", EnvPrefix: "BTC", Decimals: 8, AddressPrefixes: []string{"1", "3", "bc1"}},
+	{ChainID: 1, CurrencyCode: "ltc", EnvPrefix: "LTC", Decimals: 8, AddressPrefixes: []string{"L", "M", "3", "ltc1"}},
+	{ChainID: 2, CurrencyCode: "dog", EnvPrefix: "DOGE", Decimals: 8, AddressPrefixes: []string{"D", "A", "9"}, AuxPoW: true},
+}
+
+var (
+	utxoChainsLock sync.RWMutex
+	// UTXO chains defined by the configuration of the node
+	configuredUTXOChains []UTXOChainConfig
+)
+
+// Chain IDs of the UTXO chains that are verified, scheduled by block time like the other
+// consensus parameters. New chain IDs also require GetMaxAllowedChains to be raised.
+func GetAllowedUTXOChains(blockTime *big.Int) []uint32 {
+	return append([]uint32{}, GetUpgradeParams(blockTime, nil).AllowedUTXOChains...)
+}
+
+// Returns the UTXO chains defined on the node, whether or not they are allowed
+func GetUTXOChains() []UTXOChainConfig {
+	utxoChainsLock.RLock()
+	defer utxoChainsLock.RUnlock()
+	return append(append([]UTXOChainConfig{}, genesisUTXOChains...), configuredUTXOChains...)
+}
+
+// Defines UTXO chains beyond those of genesisUTXOChains, in place of those defined before
+func SetUTXOChains(chains []UTXOChainConfig) error {
+	defined := make(map[uint32]bool)
+	for _, chain := range append(append([]UTXOChainConfig{}, genesisUTXOChains...), chains...) {
+		if defined[chain.ChainID] {
+			return fmt.Errorf("UTXO chain %d is defined more than once", chain.ChainID)
+		}
+		defined[chain.ChainID] = true
+		if err := chain.Validate(); err != nil {
+			return err
+		}
+	}
+	utxoChainsLock.Lock()
+	defer utxoChainsLock.Unlock()
+	configuredUTXOChains = append([]UTXOChainConfig{}, chains...)
+	return nil
+}
+
+// Defines the UTXO chains listed in a JSON file
+func LoadUTXOChains(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var chains []UTXOChainConfig
+	if err := json.Unmarshal(data, &chains); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return SetUTXOChains(chains)
+}
+
+// Checks that every chain allowed by an upgrade of the active schedule is defined, since a
+// node without its definition would reject every proof of it
+func CheckAllowedUTXOChains() error {
+	defined := make(map[uint32]bool)
+	for _, chain := range GetUTXOChains() {
+		defined[chain.ChainID] = true
+	}
+	for _, upgrade := range activeUpgradeSchedule {
+		for _, chainId := range upgrade.Params.AllowedUTXOChains {
+			if !defined[chainId] {
+				return fmt.Errorf("UTXO chain %d allowed by upgrade %q is not defined", chainId, upgrade.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// The node defines the UTXO chains listed in the file at UTXO_CHAINS, if set, once the upgrade
+// schedule of its network is set
+func LoadUTXOChainsFromEnv() error {
+	if path := os.Getenv("UTXO_CHAINS"); path != "" {
+		if err := LoadUTXOChains(path); err != nil {
+			return err
+		}
+	}
+	return CheckAllowedUTXOChains()
+}
+
+func GetUTXOChainConfig(chainId uint32, blockTime *big.Int) (UTXOChainConfig, bool) {
+	allowed := false
+	for _, allowedChainId := range GetAllowedUTXOChains(blockTime) {
+		allowed = allowed || allowedChainId == chainId
+	}
+	if !allowed {
+		return UTXOChainConfig{}, false
+	}
+	for _, chain := range GetUTXOChains() {
+		if chain.ChainID == chainId {
+			chain.AddressField = *GetUpgradeParams(blockTime, nil).PoWAddressField
+			return chain, true
+		}
+	}
+	return UTXOChainConfig{}, false
+}
+
+// Checks the definition of a UTXO chain
+func (chain UTXOChainConfig) Validate() error {
+	for _, chainId := range nonUTXOChainIds {
+		if chain.ChainID == chainId {
+			return fmt.Errorf("UTXO chain %d collides with a chain of another verifier", chain.ChainID)
+		}
+	}
+	if chain.CurrencyCode == "" || chain.EnvPrefix == "" || len(chain.AddressPrefixes) == 0 {
+		return fmt.Errorf("UTXO chain %d needs a currency code, an environment prefix and address prefixes", chain.ChainID)
+	}
+	return nil
+}
+
+func IsUTXOChainAddress(chain UTXOChainConfig, address string) bool {
+	for _, prefix := range chain.AddressPrefixes {
+		if strings.HasPrefix(address, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Converts an amount reported by the node into the smallest unit of the chain
+func GetUTXOChainUnits(chain UTXOChainConfig, value float64) float64 {
+	return value * math.Pow(10, float64(chain.Decimals))
+}
+
+type GetPoWBlockResult struct {
+	Hash              string           `json:"hash"`
+	Height            uint64           `json:"height"`
+	PreviousBlockHash string           `json:"previousblockhash"`
+	Tx                []GetPoWTxResult `json:"tx"`
+}
+
+// Returns the hash of the block at a height of the best chain
+func GetPoWBlockHash(height uint64, chain UTXOChainConfig, chainURL string, username string, password string) (string, bool) {
+	if chain.Backend == powBackendEsplora {
+		return GetEsploraBlockHash(height, chainURL, username, password)
+	}
+	var blockHash string
+	if CallPoWRPC("getblockhash", []interface{}{height}, &blockHash, chainURL, username, password) {
+		return "", true
+	}
+	return blockHash, false
+}
+
+// Returns a block with its transactions and the outputs spent by their inputs, which requires
+// getblock verbosity 3
+func GetPoWBlock(blockHash string, chain UTXOChainConfig, chainURL string, username string, password string) (GetPoWBlockResult, bool) {
+	if chain.Backend == powBackendEsplora {
+		// Esplora only returns the transactions of a block in pages of 25, so block scans are
+		// left to the other APIs
+		return GetPoWBlockResult{}, true
+	}
+	var block GetPoWBlockResult
+	if CallPoWRPC("getblock", []interface{}{blockHash, 3}, &block, chainURL, username, password) {
+		return GetPoWBlockResult{}, true
+	}
+	for _, tx := range block.Tx {
+		for _, vin := range tx.Vin {
+			if vin.Coinbase == "" && vin.Prevout == nil {
+				// The API does not support prevout lookups within getblock
+				return GetPoWBlockResult{}, true
+			}
+		}
+	}
+	return block, false
+}
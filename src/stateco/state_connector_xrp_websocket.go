@@ -0,0 +1,340 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// rippled APIs given as ws:// or wss:// URLs are queried over one persistent WebSocket
+// connection per URL. The connection is subscribed to the ledger stream, so that the hashes
+// of recently validated ledgers are known locally, and carries every other request of the
+// verifier in place of one-shot JSON-RPC requests over HTTP.
+
+const (
+	// Validated ledger hashes kept in memory, about four and a half hours of ledgers
+	xrpLedgerHistoryLength = uint64(4096)
+	// Ledgers close every few seconds, so a connection silent for longer is stalled
+	xrpLedgerStreamReadTimeout  = 30 * time.Second
+	xrpLedgerStreamRetryDelay   = 5 * time.Second
+	xrpLedgerStreamWriteTimeout = 5 * time.Second
+)
+
+var (
+	xrpLedgerStreamsLock sync.Mutex
+	xrpLedgerStreams     = make(map[string]*XRPLedgerStream)
+)
+
+type XRPLedgerStream struct {
+	chainURL string
+	// Guards every field below, and serialises writes to the connection
+	lock sync.Mutex
+	conn *websocket.Conn
+	// Closed once the current connection is subscribed to the ledger stream
+	synced  chan struct{}
+	nextID  uint64
+	pending map[uint64]chan []byte
+	// Latest validated ledger seen, and the hashes of the validated ledgers before it
+	latestLedger uint64
+	ledgerHashes map[uint64]string
+}
+
+type GetXRPLedgerStreamMessage struct {
+	ID     *uint64         `json:"id"`
+	Type   string          `json:"type"`
+	Status string          `json:"status"`
+	Error  string          `json:"error"`
+	Result json.RawMessage `json:"result"`
+	// Set on ledgerClosed messages
+	LedgerIndex uint64 `json:"ledger_index"`
+	LedgerHash  string `json:"ledger_hash"`
+}
+
+func IsXRPWebSocketURL(chainURL string) bool {
+	return strings.HasPrefix(chainURL, "ws://") || strings.HasPrefix(chainURL, "wss://")
+}
+
+func NewXRPLedgerStream(chainURL string) *XRPLedgerStream {
+	return &XRPLedgerStream{
+		chainURL:     chainURL,
+		synced:       make(chan struct{}),
+		pending:      make(map[uint64]chan []byte),
+		ledgerHashes: make(map[uint64]string),
+	}
+}
+
+// Returns the ledger stream of a URL, connecting to it on first use
+func GetXRPLedgerStream(chainURL string) *XRPLedgerStream {
+	xrpLedgerStreamsLock.Lock()
+	defer xrpLedgerStreamsLock.Unlock()
+	stream, ok := xrpLedgerStreams[chainURL]
+	if !ok {
+		stream = NewXRPLedgerStream(chainURL)
+		xrpLedgerStreams[chainURL] = stream
+		go stream.Run()
+	}
+	return stream
+}
+
+// Keeps the stream connected, reconnecting after any failure of the connection
+func (stream *XRPLedgerStream) Run() {
+	for {
+		conn, _, err := websocket.DefaultDialer.Dial(stream.chainURL, nil)
+		if err == nil {
+			stream.Serve(conn)
+		}
+		time.Sleep(xrpLedgerStreamRetryDelay)
+	}
+}
+
+// Reads from a connection until it fails. The ledger stream is subscribed to on every new
+// connection, which also resyncs the latest validated ledger after a reconnection. Ledgers
+// validated while disconnected are missing from the history and are requested when needed.
+func (stream *XRPLedgerStream) Serve(conn *websocket.Conn) {
+	stream.lock.Lock()
+	stream.conn = conn
+	stream.lock.Unlock()
+	go stream.Subscribe(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(xrpLedgerStreamReadTimeout))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		stream.HandleMessage(message)
+	}
+	conn.Close()
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	stream.conn = nil
+	select {
+	case <-stream.synced:
+		stream.synced = make(chan struct{})
+	default:
+	}
+	for id, response := range stream.pending {
+		close(response)
+		delete(stream.pending, id)
+	}
+}
+
+func (stream *XRPLedgerStream) Subscribe(conn *websocket.Conn) {
+	id, response, err := stream.Send(conn, map[string]interface{}{
+		"command": "subscribe",
+		"streams": []string{"ledger"},
+	})
+	if err {
+		conn.Close()
+		return
+	}
+	var message GetXRPLedgerStreamMessage
+	select {
+	case respBody, ok := <-response:
+		if !ok || json.Unmarshal(respBody, &message) != nil || message.Status != "success" {
+			conn.Close()
+			return
+		}
+	case <-time.After(client.Timeout):
+		stream.Cancel(id)
+		conn.Close()
+		return
+	}
+	var subscribed GetXRPLedgerStreamMessage
+	if json.Unmarshal(message.Result, &subscribed) != nil || subscribed.LedgerHash == "" {
+		conn.Close()
+		return
+	}
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	if stream.conn != conn {
+		return
+	}
+	stream.AddLedger(subscribed.LedgerIndex, subscribed.LedgerHash)
+	close(stream.synced)
+}
+
+// Routes a response to the request awaiting it, and records ledgers validated by the network
+func (stream *XRPLedgerStream) HandleMessage(message []byte) {
+	var streamMessage GetXRPLedgerStreamMessage
+	if json.Unmarshal(message, &streamMessage) != nil {
+		return
+	}
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	if streamMessage.ID != nil {
+		if response, ok := stream.pending[*streamMessage.ID]; ok {
+			response <- message
+			delete(stream.pending, *streamMessage.ID)
+		}
+	} else if streamMessage.Type == "ledgerClosed" && streamMessage.LedgerHash != "" {
+		// The ledger stream only reports ledgers once they are validated
+		stream.AddLedger(streamMessage.LedgerIndex, streamMessage.LedgerHash)
+	}
+}
+
+// Records a validated ledger, the caller must hold the stream lock
+func (stream *XRPLedgerStream) AddLedger(ledgerIndex uint64, ledgerHash string) {
+	if ledgerIndex+xrpLedgerHistoryLength <= stream.latestLedger {
+		return
+	}
+	stream.ledgerHashes[ledgerIndex] = ledgerHash
+	if ledgerIndex > stream.latestLedger {
+		stream.latestLedger = ledgerIndex
+		for index := range stream.ledgerHashes {
+			if index+xrpLedgerHistoryLength <= stream.latestLedger {
+				delete(stream.ledgerHashes, index)
+			}
+		}
+	}
+}
+
+// Returns the hash of a validated ledger if it is known locally. A ledger beyond the latest
+// validated ledger is an API error, as it would be for a JSON-RPC ledger request.
+func (stream *XRPLedgerStream) GetLedgerHash(ledger uint64) (string, bool, bool) {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	if ledgerHash, ok := stream.ledgerHashes[ledger]; ok {
+		return ledgerHash, true, false
+	}
+	if stream.conn != nil && stream.latestLedger > 0 && ledger > stream.latestLedger {
+		return "", false, true
+	}
+	return "", false, false
+}
+
+// Sends a command on a connection, returning its ID and the channel its response is delivered
+// on. The channel is closed if the connection fails first.
+func (stream *XRPLedgerStream) Send(conn *websocket.Conn, command map[string]interface{}) (uint64, chan []byte, bool) {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	if conn == nil || stream.conn != conn {
+		return 0, nil, true
+	}
+	stream.nextID++
+	id := stream.nextID
+	command["id"] = id
+	message, err := json.Marshal(command)
+	if err != nil {
+		return 0, nil, true
+	}
+	response := make(chan []byte, 1)
+	stream.pending[id] = response
+	conn.SetWriteDeadline(time.Now().Add(xrpLedgerStreamWriteTimeout))
+	if conn.WriteMessage(websocket.TextMessage, message) != nil {
+		delete(stream.pending, id)
+		return 0, nil, true
+	}
+	return id, response, false
+}
+
+func (stream *XRPLedgerStream) Cancel(id uint64) {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	delete(stream.pending, id)
+}
+
+// Sends a JSON-RPC request payload as a WebSocket command once the stream is synced, and
+// returns the response in the form of a JSON-RPC response body. The audit log digests the
+// exchange as the JSON-RPC request and response it stands for, as if it were made over HTTP.
+func (stream *XRPLedgerStream) Request(payloadBytes []byte) ([]byte, bool) {
+	if !collectingAuditExchanges(stream.chainURL) {
+		return stream.request(payloadBytes)
+	}
+	exchange := AuditExchange{URL: stream.chainURL, RequestSHA256: chainAPIRequestHash(http.MethodPost, stream.chainURL, payloadBytes)}
+	respBody, err := stream.request(payloadBytes)
+	if err {
+		exchange.Error = "no response over the WebSocket connection"
+	} else {
+		exchange.ResponseSHA256 = sha256Hex(respBody)
+	}
+	addAuditExchange(exchange)
+	return respBody, err
+}
+
+func (stream *XRPLedgerStream) request(payloadBytes []byte) ([]byte, bool) {
+	command, ok := GetXRPWebSocketCommand(payloadBytes)
+	if !ok {
+		return nil, true
+	}
+	stream.lock.Lock()
+	synced := stream.synced
+	stream.lock.Unlock()
+	select {
+	case <-synced:
+	case <-time.After(client.Timeout):
+		return nil, true
+	}
+	stream.lock.Lock()
+	conn := stream.conn
+	stream.lock.Unlock()
+	id, response, err := stream.Send(conn, command)
+	if err {
+		return nil, true
+	}
+	select {
+	case message, ok := <-response:
+		if !ok {
+			return nil, true
+		}
+		return GetXRPWebSocketResponseBody(message)
+	case <-time.After(client.Timeout):
+		stream.Cancel(id)
+		return nil, true
+	}
+}
+
+// Converts a JSON-RPC request payload into the equivalent WebSocket command, which carries the
+// parameters alongside the method name
+func GetXRPWebSocketCommand(payloadBytes []byte) (map[string]interface{}, bool) {
+	var payload struct {
+		Method string                   `json:"method"`
+		Params []map[string]interface{} `json:"params"`
+	}
+	if json.Unmarshal(payloadBytes, &payload) != nil || payload.Method == "" || len(payload.Params) > 1 {
+		return nil, false
+	}
+	command := make(map[string]interface{})
+	if len(payload.Params) == 1 {
+		for key, value := range payload.Params[0] {
+			command[key] = value
+		}
+	}
+	command["command"] = payload.Method
+	return command, true
+}
+
+// Converts a WebSocket response into the equivalent JSON-RPC response body, which reports the
+// status and any error within the result
+func GetXRPWebSocketResponseBody(message []byte) ([]byte, bool) {
+	var streamMessage GetXRPLedgerStreamMessage
+	if json.Unmarshal(message, &streamMessage) != nil || streamMessage.Type != "response" {
+		return nil, true
+	}
+	result := make(map[string]json.RawMessage)
+	if streamMessage.Status == "error" {
+		errorString, err := json.Marshal(streamMessage.Error)
+		if err != nil {
+			return nil, true
+		}
+		result["error"] = errorString
+	} else if streamMessage.Status != "success" || json.Unmarshal(streamMessage.Result, &result) != nil {
+		return nil, true
+	}
+	status, err := json.Marshal(streamMessage.Status)
+	if err != nil {
+		return nil, true
+	}
+	result["status"] = status
+	respBody, err := json.Marshal(map[string]interface{}{"result": result})
+	if err != nil {
+		return nil, true
+	}
+	return respBody, false
+}
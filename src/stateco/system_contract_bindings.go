@@ -0,0 +1,996 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+// Code generated by src/bindings. DO NOT EDIT.
+
+package core
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Reference imports to suppress errors if they are not otherwise used
+var (
+	_ = big.NewInt
+	_ = common.Address{}
+)
+
+// Bindings of StateConnector, generated from bin/src/stateco/StateConnector.json
+
+// The functions of StateConnector that have bindings
+var StateConnectorMethods = []ABIMethod{
+	StateConnectorChains,
+	StateConnectorCommitRevealLowerBound,
+	StateConnectorCommitRevealUpperBound,
+	StateConnectorDataAvailabilityPeriodsMined,
+	StateConnectorDisprovePaymentFinality,
+	StateConnectorFinalisedDataAvailabilityPeriods,
+	StateConnectorFinalisedPayments,
+	StateConnectorGetDataAvailabilityPeriodIndexFinality,
+	StateConnectorGetDataAvailabilityPeriodsMined,
+	StateConnectorGetLatestIndex,
+	StateConnectorGetPaymentFinality,
+	StateConnectorGetRewardPeriod,
+	StateConnectorGetTotalDataAvailabilityPeriodsMined,
+	StateConnectorInitialiseChains,
+	StateConnectorInitialiseTime,
+	StateConnectorInitialised,
+	StateConnectorNumChains,
+	StateConnectorProposedDataAvailabilityProofs,
+	StateConnectorProposedNonPaymentProofs,
+	StateConnectorProposedPaymentProofs,
+	StateConnectorProveDataAvailabilityPeriodFinality,
+	StateConnectorProvePaymentFinality,
+	StateConnectorRewardPeriodTimespan,
+	StateConnectorSenderBannedUntil,
+	StateConnectorTotalDataAvailabilityPeriodsMined,
+}
+
+// chains(uint32) returns (bool exists, uint64 genesisLedger, uint64 ledgerHistorySize, uint16 dataAvailabilityPeriodLength, uint16 numConfirmations, uint64 finalisedDataAvailabilityPeriodIndex, uint64 finalisedLedgerIndex, uint256 finalisedTimestamp, uint256 timeDiffExpected, uint256 timeDiffAvg)
+var StateConnectorChains = ABIMethod{Signature: "chains(uint32)", Selector: [4]byte{0x8b, 0x20, 0x3d, 0xd4}}
+
+func PackStateConnectorChains(arg0 uint32) ([]byte, error) {
+	return abiPack(StateConnectorChains, abiUint(uint64(arg0)))
+}
+
+type StateConnectorChainsOutput struct {
+	Exists                               bool
+	GenesisLedger                        uint64
+	LedgerHistorySize                    uint64
+	DataAvailabilityPeriodLength         uint16
+	NumConfirmations                     uint16
+	FinalisedDataAvailabilityPeriodIndex uint64
+	FinalisedLedgerIndex                 uint64
+	FinalisedTimestamp                   *big.Int
+	TimeDiffExpected                     *big.Int
+	TimeDiffAvg                          *big.Int
+}
+
+func UnpackStateConnectorChains(data []byte) (StateConnectorChainsOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorChainsOutput
+	out.Exists = d.readBool(0)
+	out.GenesisLedger = d.readUint(1, 64)
+	out.LedgerHistorySize = d.readUint(2, 64)
+	out.DataAvailabilityPeriodLength = uint16(d.readUint(3, 16))
+	out.NumConfirmations = uint16(d.readUint(4, 16))
+	out.FinalisedDataAvailabilityPeriodIndex = d.readUint(5, 64)
+	out.FinalisedLedgerIndex = d.readUint(6, 64)
+	out.FinalisedTimestamp = d.readBig(7)
+	out.TimeDiffExpected = d.readBig(8)
+	out.TimeDiffAvg = d.readBig(9)
+	return out, d.end(10, true)
+}
+
+// commitRevealLowerBound() returns (uint256)
+var StateConnectorCommitRevealLowerBound = ABIMethod{Signature: "commitRevealLowerBound()", Selector: [4]byte{0x74, 0x1d, 0x3c, 0xb4}}
+
+func PackStateConnectorCommitRevealLowerBound() ([]byte, error) {
+	return abiPack(StateConnectorCommitRevealLowerBound)
+}
+
+func UnpackStateConnectorCommitRevealLowerBound(data []byte) (*big.Int, bool) {
+	d := abiDecoder{data: data}
+	value := d.readBig(0)
+	return value, d.end(1, true)
+}
+
+// commitRevealUpperBound() returns (uint256)
+var StateConnectorCommitRevealUpperBound = ABIMethod{Signature: "commitRevealUpperBound()", Selector: [4]byte{0x8a, 0xbd, 0x90, 0xae}}
+
+func PackStateConnectorCommitRevealUpperBound() ([]byte, error) {
+	return abiPack(StateConnectorCommitRevealUpperBound)
+}
+
+func UnpackStateConnectorCommitRevealUpperBound(data []byte) (*big.Int, bool) {
+	d := abiDecoder{data: data}
+	value := d.readBig(0)
+	return value, d.end(1, true)
+}
+
+// dataAvailabilityPeriodsMined(address,uint256) returns (uint64)
+var StateConnectorDataAvailabilityPeriodsMined = ABIMethod{Signature: "dataAvailabilityPeriodsMined(address,uint256)", Selector: [4]byte{0x2b, 0xec, 0x6f, 0x87}}
+
+func PackStateConnectorDataAvailabilityPeriodsMined(arg0 common.Address, arg1 *big.Int) ([]byte, error) {
+	return abiPack(StateConnectorDataAvailabilityPeriodsMined, abiAddress(arg0), abiBig(arg1))
+}
+
+func UnpackStateConnectorDataAvailabilityPeriodsMined(data []byte) (uint64, bool) {
+	d := abiDecoder{data: data}
+	value := d.readUint(0, 64)
+	return value, d.end(1, true)
+}
+
+// disprovePaymentFinality(uint32,bytes32,uint64,string) returns (uint32 _chainId, uint64 _ledger, uint64 _finalisedLedgerIndex, bytes32 _paymentHash, string _txId)
+var StateConnectorDisprovePaymentFinality = ABIMethod{Signature: "disprovePaymentFinality(uint32,bytes32,uint64,string)", Selector: [4]byte{0x7f, 0x58, 0x24, 0x32}}
+
+func PackStateConnectorDisprovePaymentFinality(chainId uint32, paymentHash [32]byte, ledger uint64, txId string) ([]byte, error) {
+	return abiPack(StateConnectorDisprovePaymentFinality, abiUint(uint64(chainId)), abiBytes32(paymentHash), abiUint(ledger), abiString(txId))
+}
+
+type StateConnectorDisprovePaymentFinalityOutput struct {
+	ChainId              uint32
+	Ledger               uint64
+	FinalisedLedgerIndex uint64
+	PaymentHash          [32]byte
+	TxId                 string
+}
+
+func UnpackStateConnectorDisprovePaymentFinality(data []byte) (StateConnectorDisprovePaymentFinalityOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorDisprovePaymentFinalityOutput
+	out.ChainId = uint32(d.readUint(0, 32))
+	out.Ledger = d.readUint(1, 64)
+	out.FinalisedLedgerIndex = d.readUint(2, 64)
+	out.PaymentHash = d.readBytes32(3)
+	out.TxId = d.readString(4)
+	return out, d.end(5, false)
+}
+
+// finalisedDataAvailabilityPeriods(bytes32) returns (bool exists, bytes32 dataAvailabilityPeriodHash, bytes32 commitHash, uint256 commitTime, uint256 permittedRevealTime, bytes32 revealHash, uint64 index, uint64 indexSearchRegion, bool proven, address provenBy)
+var StateConnectorFinalisedDataAvailabilityPeriods = ABIMethod{Signature: "finalisedDataAvailabilityPeriods(bytes32)", Selector: [4]byte{0x4b, 0xdc, 0x9c, 0x8f}}
+
+func PackStateConnectorFinalisedDataAvailabilityPeriods(arg0 [32]byte) ([]byte, error) {
+	return abiPack(StateConnectorFinalisedDataAvailabilityPeriods, abiBytes32(arg0))
+}
+
+type StateConnectorFinalisedDataAvailabilityPeriodsOutput struct {
+	Exists                     bool
+	DataAvailabilityPeriodHash [32]byte
+	CommitHash                 [32]byte
+	CommitTime                 *big.Int
+	PermittedRevealTime        *big.Int
+	RevealHash                 [32]byte
+	Index                      uint64
+	IndexSearchRegion          uint64
+	Proven                     bool
+	ProvenBy                   common.Address
+}
+
+func UnpackStateConnectorFinalisedDataAvailabilityPeriods(data []byte) (StateConnectorFinalisedDataAvailabilityPeriodsOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorFinalisedDataAvailabilityPeriodsOutput
+	out.Exists = d.readBool(0)
+	out.DataAvailabilityPeriodHash = d.readBytes32(1)
+	out.CommitHash = d.readBytes32(2)
+	out.CommitTime = d.readBig(3)
+	out.PermittedRevealTime = d.readBig(4)
+	out.RevealHash = d.readBytes32(5)
+	out.Index = d.readUint(6, 64)
+	out.IndexSearchRegion = d.readUint(7, 64)
+	out.Proven = d.readBool(8)
+	out.ProvenBy = d.readAddress(9)
+	return out, d.end(10, true)
+}
+
+// finalisedPayments(bytes32) returns (bool exists, bytes32 dataAvailabilityPeriodHash, bytes32 commitHash, uint256 commitTime, uint256 permittedRevealTime, bytes32 revealHash, uint64 index, uint64 indexSearchRegion, bool proven, address provenBy)
+var StateConnectorFinalisedPayments = ABIMethod{Signature: "finalisedPayments(bytes32)", Selector: [4]byte{0xee, 0x2d, 0x87, 0x37}}
+
+func PackStateConnectorFinalisedPayments(arg0 [32]byte) ([]byte, error) {
+	return abiPack(StateConnectorFinalisedPayments, abiBytes32(arg0))
+}
+
+type StateConnectorFinalisedPaymentsOutput struct {
+	Exists                     bool
+	DataAvailabilityPeriodHash [32]byte
+	CommitHash                 [32]byte
+	CommitTime                 *big.Int
+	PermittedRevealTime        *big.Int
+	RevealHash                 [32]byte
+	Index                      uint64
+	IndexSearchRegion          uint64
+	Proven                     bool
+	ProvenBy                   common.Address
+}
+
+func UnpackStateConnectorFinalisedPayments(data []byte) (StateConnectorFinalisedPaymentsOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorFinalisedPaymentsOutput
+	out.Exists = d.readBool(0)
+	out.DataAvailabilityPeriodHash = d.readBytes32(1)
+	out.CommitHash = d.readBytes32(2)
+	out.CommitTime = d.readBig(3)
+	out.PermittedRevealTime = d.readBig(4)
+	out.RevealHash = d.readBytes32(5)
+	out.Index = d.readUint(6, 64)
+	out.IndexSearchRegion = d.readUint(7, 64)
+	out.Proven = d.readBool(8)
+	out.ProvenBy = d.readAddress(9)
+	return out, d.end(10, true)
+}
+
+// getDataAvailabilityPeriodIndexFinality(uint32,uint64) returns (bool finality)
+var StateConnectorGetDataAvailabilityPeriodIndexFinality = ABIMethod{Signature: "getDataAvailabilityPeriodIndexFinality(uint32,uint64)", Selector: [4]byte{0x3f, 0x57, 0x98, 0x7d}}
+
+func PackStateConnectorGetDataAvailabilityPeriodIndexFinality(chainId uint32, dataAvailabilityPeriodIndex uint64) ([]byte, error) {
+	return abiPack(StateConnectorGetDataAvailabilityPeriodIndexFinality, abiUint(uint64(chainId)), abiUint(dataAvailabilityPeriodIndex))
+}
+
+func UnpackStateConnectorGetDataAvailabilityPeriodIndexFinality(data []byte) (bool, bool) {
+	d := abiDecoder{data: data}
+	value := d.readBool(0)
+	return value, d.end(1, true)
+}
+
+// getDataAvailabilityPeriodsMined(address,uint256) returns (uint64 numMined)
+var StateConnectorGetDataAvailabilityPeriodsMined = ABIMethod{Signature: "getDataAvailabilityPeriodsMined(address,uint256)", Selector: [4]byte{0xdc, 0xcb, 0x2d, 0x32}}
+
+func PackStateConnectorGetDataAvailabilityPeriodsMined(miner common.Address, rewardSchedule *big.Int) ([]byte, error) {
+	return abiPack(StateConnectorGetDataAvailabilityPeriodsMined, abiAddress(miner), abiBig(rewardSchedule))
+}
+
+func UnpackStateConnectorGetDataAvailabilityPeriodsMined(data []byte) (uint64, bool) {
+	d := abiDecoder{data: data}
+	value := d.readUint(0, 64)
+	return value, d.end(1, true)
+}
+
+// getLatestIndex(uint32) returns (uint64 genesisLedger, uint64 finalisedDataAvailabilityPeriodIndex, uint16 dataAvailabilityPeriodLength, uint64 finalisedLedgerIndex, uint256 finalisedTimestamp, uint256 timeDiffAvg)
+var StateConnectorGetLatestIndex = ABIMethod{Signature: "getLatestIndex(uint32)", Selector: [4]byte{0x2a, 0x24, 0x34, 0xa2}}
+
+func PackStateConnectorGetLatestIndex(chainId uint32) ([]byte, error) {
+	return abiPack(StateConnectorGetLatestIndex, abiUint(uint64(chainId)))
+}
+
+type StateConnectorGetLatestIndexOutput struct {
+	GenesisLedger                        uint64
+	FinalisedDataAvailabilityPeriodIndex uint64
+	DataAvailabilityPeriodLength         uint16
+	FinalisedLedgerIndex                 uint64
+	FinalisedTimestamp                   *big.Int
+	TimeDiffAvg                          *big.Int
+}
+
+func UnpackStateConnectorGetLatestIndex(data []byte) (StateConnectorGetLatestIndexOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorGetLatestIndexOutput
+	out.GenesisLedger = d.readUint(0, 64)
+	out.FinalisedDataAvailabilityPeriodIndex = d.readUint(1, 64)
+	out.DataAvailabilityPeriodLength = uint16(d.readUint(2, 16))
+	out.FinalisedLedgerIndex = d.readUint(3, 64)
+	out.FinalisedTimestamp = d.readBig(4)
+	out.TimeDiffAvg = d.readBig(5)
+	return out, d.end(6, true)
+}
+
+// getPaymentFinality(uint32,bytes32,bytes32,uint64,bytes32) returns (uint64 ledger, uint64 indexSearchRegion, bool finality)
+var StateConnectorGetPaymentFinality = ABIMethod{Signature: "getPaymentFinality(uint32,bytes32,bytes32,uint64,bytes32)", Selector: [4]byte{0x71, 0xe8, 0xd6, 0x1a}}
+
+func PackStateConnectorGetPaymentFinality(chainId uint32, txId [32]byte, destinationHash [32]byte, amount uint64, currencyHash [32]byte) ([]byte, error) {
+	return abiPack(StateConnectorGetPaymentFinality, abiUint(uint64(chainId)), abiBytes32(txId), abiBytes32(destinationHash), abiUint(amount), abiBytes32(currencyHash))
+}
+
+type StateConnectorGetPaymentFinalityOutput struct {
+	Ledger            uint64
+	IndexSearchRegion uint64
+	Finality          bool
+}
+
+func UnpackStateConnectorGetPaymentFinality(data []byte) (StateConnectorGetPaymentFinalityOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorGetPaymentFinalityOutput
+	out.Ledger = d.readUint(0, 64)
+	out.IndexSearchRegion = d.readUint(1, 64)
+	out.Finality = d.readBool(2)
+	return out, d.end(3, true)
+}
+
+// getRewardPeriod() returns (uint256 rewardSchedule)
+var StateConnectorGetRewardPeriod = ABIMethod{Signature: "getRewardPeriod()", Selector: [4]byte{0xad, 0xc8, 0x90, 0x32}}
+
+func PackStateConnectorGetRewardPeriod() ([]byte, error) {
+	return abiPack(StateConnectorGetRewardPeriod)
+}
+
+func UnpackStateConnectorGetRewardPeriod(data []byte) (*big.Int, bool) {
+	d := abiDecoder{data: data}
+	value := d.readBig(0)
+	return value, d.end(1, true)
+}
+
+// getTotalDataAvailabilityPeriodsMined(uint256) returns (uint64 numMined)
+var StateConnectorGetTotalDataAvailabilityPeriodsMined = ABIMethod{Signature: "getTotalDataAvailabilityPeriodsMined(uint256)", Selector: [4]byte{0x47, 0x45, 0x3f, 0x37}}
+
+func PackStateConnectorGetTotalDataAvailabilityPeriodsMined(rewardSchedule *big.Int) ([]byte, error) {
+	return abiPack(StateConnectorGetTotalDataAvailabilityPeriodsMined, abiBig(rewardSchedule))
+}
+
+func UnpackStateConnectorGetTotalDataAvailabilityPeriodsMined(data []byte) (uint64, bool) {
+	d := abiDecoder{data: data}
+	value := d.readUint(0, 64)
+	return value, d.end(1, true)
+}
+
+// initialiseChains() returns (bool success)
+var StateConnectorInitialiseChains = ABIMethod{Signature: "initialiseChains()", Selector: [4]byte{0xef, 0x4c, 0x16, 0x9e}}
+
+func PackStateConnectorInitialiseChains() ([]byte, error) {
+	return abiPack(StateConnectorInitialiseChains)
+}
+
+func UnpackStateConnectorInitialiseChains(data []byte) (bool, bool) {
+	d := abiDecoder{data: data}
+	value := d.readBool(0)
+	return value, d.end(1, true)
+}
+
+// initialiseTime() returns (uint256)
+var StateConnectorInitialiseTime = ABIMethod{Signature: "initialiseTime()", Selector: [4]byte{0xf9, 0xc4, 0x90, 0xee}}
+
+func PackStateConnectorInitialiseTime() ([]byte, error) {
+	return abiPack(StateConnectorInitialiseTime)
+}
+
+func UnpackStateConnectorInitialiseTime(data []byte) (*big.Int, bool) {
+	d := abiDecoder{data: data}
+	value := d.readBig(0)
+	return value, d.end(1, true)
+}
+
+// initialised() returns (bool)
+var StateConnectorInitialised = ABIMethod{Signature: "initialised()", Selector: [4]byte{0x07, 0x00, 0x3b, 0xb4}}
+
+func PackStateConnectorInitialised() ([]byte, error) {
+	return abiPack(StateConnectorInitialised)
+}
+
+func UnpackStateConnectorInitialised(data []byte) (bool, bool) {
+	d := abiDecoder{data: data}
+	value := d.readBool(0)
+	return value, d.end(1, true)
+}
+
+// numChains() returns (uint32)
+var StateConnectorNumChains = ABIMethod{Signature: "numChains()", Selector: [4]byte{0xd3, 0xfb, 0x3e, 0x9f}}
+
+func PackStateConnectorNumChains() ([]byte, error) {
+	return abiPack(StateConnectorNumChains)
+}
+
+func UnpackStateConnectorNumChains(data []byte) (uint32, bool) {
+	d := abiDecoder{data: data}
+	value := uint32(d.readUint(0, 32))
+	return value, d.end(1, true)
+}
+
+// proposedDataAvailabilityProofs(address,bytes32) returns (bool exists, bytes32 dataAvailabilityPeriodHash, bytes32 commitHash, uint256 commitTime, uint256 permittedRevealTime, bytes32 revealHash, uint64 index, uint64 indexSearchRegion, bool proven, address provenBy)
+var StateConnectorProposedDataAvailabilityProofs = ABIMethod{Signature: "proposedDataAvailabilityProofs(address,bytes32)", Selector: [4]byte{0x7e, 0xc9, 0x3e, 0x9f}}
+
+func PackStateConnectorProposedDataAvailabilityProofs(arg0 common.Address, arg1 [32]byte) ([]byte, error) {
+	return abiPack(StateConnectorProposedDataAvailabilityProofs, abiAddress(arg0), abiBytes32(arg1))
+}
+
+type StateConnectorProposedDataAvailabilityProofsOutput struct {
+	Exists                     bool
+	DataAvailabilityPeriodHash [32]byte
+	CommitHash                 [32]byte
+	CommitTime                 *big.Int
+	PermittedRevealTime        *big.Int
+	RevealHash                 [32]byte
+	Index                      uint64
+	IndexSearchRegion          uint64
+	Proven                     bool
+	ProvenBy                   common.Address
+}
+
+func UnpackStateConnectorProposedDataAvailabilityProofs(data []byte) (StateConnectorProposedDataAvailabilityProofsOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorProposedDataAvailabilityProofsOutput
+	out.Exists = d.readBool(0)
+	out.DataAvailabilityPeriodHash = d.readBytes32(1)
+	out.CommitHash = d.readBytes32(2)
+	out.CommitTime = d.readBig(3)
+	out.PermittedRevealTime = d.readBig(4)
+	out.RevealHash = d.readBytes32(5)
+	out.Index = d.readUint(6, 64)
+	out.IndexSearchRegion = d.readUint(7, 64)
+	out.Proven = d.readBool(8)
+	out.ProvenBy = d.readAddress(9)
+	return out, d.end(10, true)
+}
+
+// proposedNonPaymentProofs(bytes32,uint64) returns (bool exists, bytes32 dataAvailabilityPeriodHash, bytes32 commitHash, uint256 commitTime, uint256 permittedRevealTime, bytes32 revealHash, uint64 index, uint64 indexSearchRegion, bool proven, address provenBy)
+var StateConnectorProposedNonPaymentProofs = ABIMethod{Signature: "proposedNonPaymentProofs(bytes32,uint64)", Selector: [4]byte{0x79, 0xfd, 0x4e, 0x1a}}
+
+func PackStateConnectorProposedNonPaymentProofs(arg0 [32]byte, arg1 uint64) ([]byte, error) {
+	return abiPack(StateConnectorProposedNonPaymentProofs, abiBytes32(arg0), abiUint(arg1))
+}
+
+type StateConnectorProposedNonPaymentProofsOutput struct {
+	Exists                     bool
+	DataAvailabilityPeriodHash [32]byte
+	CommitHash                 [32]byte
+	CommitTime                 *big.Int
+	PermittedRevealTime        *big.Int
+	RevealHash                 [32]byte
+	Index                      uint64
+	IndexSearchRegion          uint64
+	Proven                     bool
+	ProvenBy                   common.Address
+}
+
+func UnpackStateConnectorProposedNonPaymentProofs(data []byte) (StateConnectorProposedNonPaymentProofsOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorProposedNonPaymentProofsOutput
+	out.Exists = d.readBool(0)
+	out.DataAvailabilityPeriodHash = d.readBytes32(1)
+	out.CommitHash = d.readBytes32(2)
+	out.CommitTime = d.readBig(3)
+	out.PermittedRevealTime = d.readBig(4)
+	out.RevealHash = d.readBytes32(5)
+	out.Index = d.readUint(6, 64)
+	out.IndexSearchRegion = d.readUint(7, 64)
+	out.Proven = d.readBool(8)
+	out.ProvenBy = d.readAddress(9)
+	return out, d.end(10, true)
+}
+
+// proposedPaymentProofs(bytes32,uint64) returns (bool exists, bytes32 dataAvailabilityPeriodHash, bytes32 commitHash, uint256 commitTime, uint256 permittedRevealTime, bytes32 revealHash, uint64 index, uint64 indexSearchRegion, bool proven, address provenBy)
+var StateConnectorProposedPaymentProofs = ABIMethod{Signature: "proposedPaymentProofs(bytes32,uint64)", Selector: [4]byte{0x55, 0xd1, 0x4c, 0x15}}
+
+func PackStateConnectorProposedPaymentProofs(arg0 [32]byte, arg1 uint64) ([]byte, error) {
+	return abiPack(StateConnectorProposedPaymentProofs, abiBytes32(arg0), abiUint(arg1))
+}
+
+type StateConnectorProposedPaymentProofsOutput struct {
+	Exists                     bool
+	DataAvailabilityPeriodHash [32]byte
+	CommitHash                 [32]byte
+	CommitTime                 *big.Int
+	PermittedRevealTime        *big.Int
+	RevealHash                 [32]byte
+	Index                      uint64
+	IndexSearchRegion          uint64
+	Proven                     bool
+	ProvenBy                   common.Address
+}
+
+func UnpackStateConnectorProposedPaymentProofs(data []byte) (StateConnectorProposedPaymentProofsOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorProposedPaymentProofsOutput
+	out.Exists = d.readBool(0)
+	out.DataAvailabilityPeriodHash = d.readBytes32(1)
+	out.CommitHash = d.readBytes32(2)
+	out.CommitTime = d.readBig(3)
+	out.PermittedRevealTime = d.readBig(4)
+	out.RevealHash = d.readBytes32(5)
+	out.Index = d.readUint(6, 64)
+	out.IndexSearchRegion = d.readUint(7, 64)
+	out.Proven = d.readBool(8)
+	out.ProvenBy = d.readAddress(9)
+	return out, d.end(10, true)
+}
+
+// proveDataAvailabilityPeriodFinality(uint32,uint64,bytes32,bytes32) returns (uint32 _chainId, uint64 _ledger, uint16 _numConfirmations, bytes32 _dataAvailabilityPeriodHash)
+var StateConnectorProveDataAvailabilityPeriodFinality = ABIMethod{Signature: "proveDataAvailabilityPeriodFinality(uint32,uint64,bytes32,bytes32)", Selector: [4]byte{0xc5, 0xd6, 0x4c, 0xd1}}
+
+func PackStateConnectorProveDataAvailabilityPeriodFinality(chainId uint32, ledger uint64, dataAvailabilityPeriodHash [32]byte, chainTipHash [32]byte) ([]byte, error) {
+	return abiPack(StateConnectorProveDataAvailabilityPeriodFinality, abiUint(uint64(chainId)), abiUint(ledger), abiBytes32(dataAvailabilityPeriodHash), abiBytes32(chainTipHash))
+}
+
+type StateConnectorProveDataAvailabilityPeriodFinalityOutput struct {
+	ChainId                    uint32
+	Ledger                     uint64
+	NumConfirmations           uint16
+	DataAvailabilityPeriodHash [32]byte
+}
+
+func UnpackStateConnectorProveDataAvailabilityPeriodFinality(data []byte) (StateConnectorProveDataAvailabilityPeriodFinalityOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorProveDataAvailabilityPeriodFinalityOutput
+	out.ChainId = uint32(d.readUint(0, 32))
+	out.Ledger = d.readUint(1, 64)
+	out.NumConfirmations = uint16(d.readUint(2, 16))
+	out.DataAvailabilityPeriodHash = d.readBytes32(3)
+	return out, d.end(4, true)
+}
+
+// provePaymentFinality(uint32,bytes32,uint64,string) returns (uint32 _chainId, uint64 _ledger, uint64 _finalisedLedgerIndex, bytes32 _paymentHash, string _txId)
+var StateConnectorProvePaymentFinality = ABIMethod{Signature: "provePaymentFinality(uint32,bytes32,uint64,string)", Selector: [4]byte{0x38, 0x84, 0x92, 0xdd}}
+
+func PackStateConnectorProvePaymentFinality(chainId uint32, paymentHash [32]byte, ledger uint64, txId string) ([]byte, error) {
+	return abiPack(StateConnectorProvePaymentFinality, abiUint(uint64(chainId)), abiBytes32(paymentHash), abiUint(ledger), abiString(txId))
+}
+
+type StateConnectorProvePaymentFinalityOutput struct {
+	ChainId              uint32
+	Ledger               uint64
+	FinalisedLedgerIndex uint64
+	PaymentHash          [32]byte
+	TxId                 string
+}
+
+func UnpackStateConnectorProvePaymentFinality(data []byte) (StateConnectorProvePaymentFinalityOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorProvePaymentFinalityOutput
+	out.ChainId = uint32(d.readUint(0, 32))
+	out.Ledger = d.readUint(1, 64)
+	out.FinalisedLedgerIndex = d.readUint(2, 64)
+	out.PaymentHash = d.readBytes32(3)
+	out.TxId = d.readString(4)
+	return out, d.end(5, false)
+}
+
+// rewardPeriodTimespan() returns (uint64)
+var StateConnectorRewardPeriodTimespan = ABIMethod{Signature: "rewardPeriodTimespan()", Selector: [4]byte{0x9c, 0x53, 0x1f, 0x8c}}
+
+func PackStateConnectorRewardPeriodTimespan() ([]byte, error) {
+	return abiPack(StateConnectorRewardPeriodTimespan)
+}
+
+func UnpackStateConnectorRewardPeriodTimespan(data []byte) (uint64, bool) {
+	d := abiDecoder{data: data}
+	value := d.readUint(0, 64)
+	return value, d.end(1, true)
+}
+
+// senderBannedUntil(address) returns (uint256)
+var StateConnectorSenderBannedUntil = ABIMethod{Signature: "senderBannedUntil(address)", Selector: [4]byte{0x22, 0xce, 0x73, 0x87}}
+
+func PackStateConnectorSenderBannedUntil(arg0 common.Address) ([]byte, error) {
+	return abiPack(StateConnectorSenderBannedUntil, abiAddress(arg0))
+}
+
+func UnpackStateConnectorSenderBannedUntil(data []byte) (*big.Int, bool) {
+	d := abiDecoder{data: data}
+	value := d.readBig(0)
+	return value, d.end(1, true)
+}
+
+// totalDataAvailabilityPeriodsMined(uint256) returns (uint64)
+var StateConnectorTotalDataAvailabilityPeriodsMined = ABIMethod{Signature: "totalDataAvailabilityPeriodsMined(uint256)", Selector: [4]byte{0xd3, 0xb9, 0x29, 0x26}}
+
+func PackStateConnectorTotalDataAvailabilityPeriodsMined(arg0 *big.Int) ([]byte, error) {
+	return abiPack(StateConnectorTotalDataAvailabilityPeriodsMined, abiBig(arg0))
+}
+
+func UnpackStateConnectorTotalDataAvailabilityPeriodsMined(data []byte) (uint64, bool) {
+	d := abiDecoder{data: data}
+	value := d.readUint(0, 64)
+	return value, d.end(1, true)
+}
+
+// Bindings of FlareKeeper, generated from src/bindings/abi/FlareKeeper.json
+
+// The functions of FlareKeeper that have bindings
+var FlareKeeperMethods = []ABIMethod{
+	FlareKeeperClaimGovernance,
+	FlareKeeperGovernance,
+	FlareKeeperInitialise,
+	FlareKeeperInitialiseFixedAddress,
+	FlareKeeperProposeGovernance,
+	FlareKeeperProposedGovernance,
+	FlareKeeperTransferGovernance,
+	FlareKeeperTrigger,
+}
+
+// claimGovernance()
+var FlareKeeperClaimGovernance = ABIMethod{Signature: "claimGovernance()", Selector: [4]byte{0x5d, 0x36, 0xb1, 0x90}}
+
+func PackFlareKeeperClaimGovernance() ([]byte, error) {
+	return abiPack(FlareKeeperClaimGovernance)
+}
+
+// governance() returns (address)
+var FlareKeeperGovernance = ABIMethod{Signature: "governance()", Selector: [4]byte{0x5a, 0xa6, 0xe6, 0x75}}
+
+func PackFlareKeeperGovernance() ([]byte, error) {
+	return abiPack(FlareKeeperGovernance)
+}
+
+func UnpackFlareKeeperGovernance(data []byte) (common.Address, bool) {
+	d := abiDecoder{data: data}
+	value := d.readAddress(0)
+	return value, d.end(1, true)
+}
+
+// initialise(address)
+var FlareKeeperInitialise = ABIMethod{Signature: "initialise(address)", Selector: [4]byte{0x9d, 0x6a, 0x89, 0x0f}}
+
+func PackFlareKeeperInitialise(governance common.Address) ([]byte, error) {
+	return abiPack(FlareKeeperInitialise, abiAddress(governance))
+}
+
+// initialiseFixedAddress() returns (address)
+var FlareKeeperInitialiseFixedAddress = ABIMethod{Signature: "initialiseFixedAddress()", Selector: [4]byte{0xc9, 0xf9, 0x60, 0xeb}}
+
+func PackFlareKeeperInitialiseFixedAddress() ([]byte, error) {
+	return abiPack(FlareKeeperInitialiseFixedAddress)
+}
+
+func UnpackFlareKeeperInitialiseFixedAddress(data []byte) (common.Address, bool) {
+	d := abiDecoder{data: data}
+	value := d.readAddress(0)
+	return value, d.end(1, true)
+}
+
+// proposeGovernance(address)
+var FlareKeeperProposeGovernance = ABIMethod{Signature: "proposeGovernance(address)", Selector: [4]byte{0xc3, 0x73, 0xa0, 0x8e}}
+
+func PackFlareKeeperProposeGovernance(governance common.Address) ([]byte, error) {
+	return abiPack(FlareKeeperProposeGovernance, abiAddress(governance))
+}
+
+// proposedGovernance() returns (address)
+var FlareKeeperProposedGovernance = ABIMethod{Signature: "proposedGovernance()", Selector: [4]byte{0x60, 0xf7, 0xac, 0x97}}
+
+func PackFlareKeeperProposedGovernance() ([]byte, error) {
+	return abiPack(FlareKeeperProposedGovernance)
+}
+
+func UnpackFlareKeeperProposedGovernance(data []byte) (common.Address, bool) {
+	d := abiDecoder{data: data}
+	value := d.readAddress(0)
+	return value, d.end(1, true)
+}
+
+// transferGovernance(address)
+var FlareKeeperTransferGovernance = ABIMethod{Signature: "transferGovernance(address)", Selector: [4]byte{0xd3, 0x8b, 0xff, 0xf4}}
+
+func PackFlareKeeperTransferGovernance(governance common.Address) ([]byte, error) {
+	return abiPack(FlareKeeperTransferGovernance, abiAddress(governance))
+}
+
+// trigger() returns (uint256 _toMint)
+var FlareKeeperTrigger = ABIMethod{Signature: "trigger()", Selector: [4]byte{0x7f, 0xec, 0x8d, 0x38}}
+
+func PackFlareKeeperTrigger() ([]byte, error) {
+	return abiPack(FlareKeeperTrigger)
+}
+
+func UnpackFlareKeeperTrigger(data []byte) (*big.Int, bool) {
+	d := abiDecoder{data: data}
+	value := d.readBig(0)
+	return value, d.end(1, true)
+}
+
+// Bindings of PriceSubmitter, generated from src/bindings/abi/PriceSubmitter.json
+
+// The functions of PriceSubmitter that have bindings
+var PriceSubmitterMethods = []ABIMethod{
+	PriceSubmitterClaimGovernance,
+	PriceSubmitterGetFtsoManager,
+	PriceSubmitterGetFtsoRegistry,
+	PriceSubmitterGetTrustedAddresses,
+	PriceSubmitterGetVoterWhitelister,
+	PriceSubmitterGovernance,
+	PriceSubmitterInitialise,
+	PriceSubmitterInitialiseFixedAddress,
+	PriceSubmitterProposeGovernance,
+	PriceSubmitterProposedGovernance,
+	PriceSubmitterRevealPrices,
+	PriceSubmitterSetContractAddresses,
+	PriceSubmitterSetTrustedAddresses,
+	PriceSubmitterSubmitPriceHashes,
+	PriceSubmitterTransferGovernance,
+	PriceSubmitterVoterWhitelistBitmap,
+}
+
+// claimGovernance()
+var PriceSubmitterClaimGovernance = ABIMethod{Signature: "claimGovernance()", Selector: [4]byte{0x5d, 0x36, 0xb1, 0x90}}
+
+func PackPriceSubmitterClaimGovernance() ([]byte, error) {
+	return abiPack(PriceSubmitterClaimGovernance)
+}
+
+// getFtsoManager() returns (address)
+var PriceSubmitterGetFtsoManager = ABIMethod{Signature: "getFtsoManager()", Selector: [4]byte{0xb3, 0x9c, 0x68, 0x58}}
+
+func PackPriceSubmitterGetFtsoManager() ([]byte, error) {
+	return abiPack(PriceSubmitterGetFtsoManager)
+}
+
+func UnpackPriceSubmitterGetFtsoManager(data []byte) (common.Address, bool) {
+	d := abiDecoder{data: data}
+	value := d.readAddress(0)
+	return value, d.end(1, true)
+}
+
+// getFtsoRegistry() returns (address)
+var PriceSubmitterGetFtsoRegistry = ABIMethod{Signature: "getFtsoRegistry()", Selector: [4]byte{0x8c, 0x9d, 0x28, 0xb6}}
+
+func PackPriceSubmitterGetFtsoRegistry() ([]byte, error) {
+	return abiPack(PriceSubmitterGetFtsoRegistry)
+}
+
+func UnpackPriceSubmitterGetFtsoRegistry(data []byte) (common.Address, bool) {
+	d := abiDecoder{data: data}
+	value := d.readAddress(0)
+	return value, d.end(1, true)
+}
+
+// getTrustedAddresses() returns (address[])
+var PriceSubmitterGetTrustedAddresses = ABIMethod{Signature: "getTrustedAddresses()", Selector: [4]byte{0xff, 0xac, 0xb8, 0x4e}}
+
+func PackPriceSubmitterGetTrustedAddresses() ([]byte, error) {
+	return abiPack(PriceSubmitterGetTrustedAddresses)
+}
+
+func UnpackPriceSubmitterGetTrustedAddresses(data []byte) ([]common.Address, bool) {
+	d := abiDecoder{data: data}
+	value := d.readAddressArray(0)
+	return value, d.end(1, false)
+}
+
+// getVoterWhitelister() returns (address)
+var PriceSubmitterGetVoterWhitelister = ABIMethod{Signature: "getVoterWhitelister()", Selector: [4]byte{0x71, 0xe1, 0xfa, 0xd9}}
+
+func PackPriceSubmitterGetVoterWhitelister() ([]byte, error) {
+	return abiPack(PriceSubmitterGetVoterWhitelister)
+}
+
+func UnpackPriceSubmitterGetVoterWhitelister(data []byte) (common.Address, bool) {
+	d := abiDecoder{data: data}
+	value := d.readAddress(0)
+	return value, d.end(1, true)
+}
+
+// governance() returns (address)
+var PriceSubmitterGovernance = ABIMethod{Signature: "governance()", Selector: [4]byte{0x5a, 0xa6, 0xe6, 0x75}}
+
+func PackPriceSubmitterGovernance() ([]byte, error) {
+	return abiPack(PriceSubmitterGovernance)
+}
+
+func UnpackPriceSubmitterGovernance(data []byte) (common.Address, bool) {
+	d := abiDecoder{data: data}
+	value := d.readAddress(0)
+	return value, d.end(1, true)
+}
+
+// initialise(address)
+var PriceSubmitterInitialise = ABIMethod{Signature: "initialise(address)", Selector: [4]byte{0x9d, 0x6a, 0x89, 0x0f}}
+
+func PackPriceSubmitterInitialise(governance common.Address) ([]byte, error) {
+	return abiPack(PriceSubmitterInitialise, abiAddress(governance))
+}
+
+// initialiseFixedAddress() returns (address)
+var PriceSubmitterInitialiseFixedAddress = ABIMethod{Signature: "initialiseFixedAddress()", Selector: [4]byte{0xc9, 0xf9, 0x60, 0xeb}}
+
+func PackPriceSubmitterInitialiseFixedAddress() ([]byte, error) {
+	return abiPack(PriceSubmitterInitialiseFixedAddress)
+}
+
+func UnpackPriceSubmitterInitialiseFixedAddress(data []byte) (common.Address, bool) {
+	d := abiDecoder{data: data}
+	value := d.readAddress(0)
+	return value, d.end(1, true)
+}
+
+// proposeGovernance(address)
+var PriceSubmitterProposeGovernance = ABIMethod{Signature: "proposeGovernance(address)", Selector: [4]byte{0xc3, 0x73, 0xa0, 0x8e}}
+
+func PackPriceSubmitterProposeGovernance(governance common.Address) ([]byte, error) {
+	return abiPack(PriceSubmitterProposeGovernance, abiAddress(governance))
+}
+
+// proposedGovernance() returns (address)
+var PriceSubmitterProposedGovernance = ABIMethod{Signature: "proposedGovernance()", Selector: [4]byte{0x60, 0xf7, 0xac, 0x97}}
+
+func PackPriceSubmitterProposedGovernance() ([]byte, error) {
+	return abiPack(PriceSubmitterProposedGovernance)
+}
+
+func UnpackPriceSubmitterProposedGovernance(data []byte) (common.Address, bool) {
+	d := abiDecoder{data: data}
+	value := d.readAddress(0)
+	return value, d.end(1, true)
+}
+
+// revealPrices(uint256,uint256[],uint256[],uint256[])
+var PriceSubmitterRevealPrices = ABIMethod{Signature: "revealPrices(uint256,uint256[],uint256[],uint256[])", Selector: [4]byte{0x60, 0x84, 0x8b, 0x44}}
+
+func PackPriceSubmitterRevealPrices(epochId *big.Int, ftsoIndices []*big.Int, prices []*big.Int, randoms []*big.Int) ([]byte, error) {
+	return abiPack(PriceSubmitterRevealPrices, abiBig(epochId), abiBigArray(ftsoIndices), abiBigArray(prices), abiBigArray(randoms))
+}
+
+// setContractAddresses(address,address,address)
+var PriceSubmitterSetContractAddresses = ABIMethod{Signature: "setContractAddresses(address,address,address)", Selector: [4]byte{0x8a, 0xb6, 0x33, 0x80}}
+
+func PackPriceSubmitterSetContractAddresses(ftsoRegistry common.Address, voterWhitelister common.Address, ftsoManager common.Address) ([]byte, error) {
+	return abiPack(PriceSubmitterSetContractAddresses, abiAddress(ftsoRegistry), abiAddress(voterWhitelister), abiAddress(ftsoManager))
+}
+
+// setTrustedAddresses(address[])
+var PriceSubmitterSetTrustedAddresses = ABIMethod{Signature: "setTrustedAddresses(address[])", Selector: [4]byte{0x9e, 0xc2, 0xb5, 0x81}}
+
+func PackPriceSubmitterSetTrustedAddresses(trustedAddresses []common.Address) ([]byte, error) {
+	return abiPack(PriceSubmitterSetTrustedAddresses, abiAddressArray(trustedAddresses))
+}
+
+// submitPriceHashes(uint256,uint256[],bytes32[])
+var PriceSubmitterSubmitPriceHashes = ABIMethod{Signature: "submitPriceHashes(uint256,uint256[],bytes32[])", Selector: [4]byte{0xc5, 0xad, 0xc5, 0x39}}
+
+func PackPriceSubmitterSubmitPriceHashes(epochId *big.Int, ftsoIndices []*big.Int, hashes [][32]byte) ([]byte, error) {
+	return abiPack(PriceSubmitterSubmitPriceHashes, abiBig(epochId), abiBigArray(ftsoIndices), abiBytes32Array(hashes))
+}
+
+// transferGovernance(address)
+var PriceSubmitterTransferGovernance = ABIMethod{Signature: "transferGovernance(address)", Selector: [4]byte{0xd3, 0x8b, 0xff, 0xf4}}
+
+func PackPriceSubmitterTransferGovernance(governance common.Address) ([]byte, error) {
+	return abiPack(PriceSubmitterTransferGovernance, abiAddress(governance))
+}
+
+// voterWhitelistBitmap(address) returns (uint256)
+var PriceSubmitterVoterWhitelistBitmap = ABIMethod{Signature: "voterWhitelistBitmap(address)", Selector: [4]byte{0x7a, 0xc4, 0x20, 0xad}}
+
+func PackPriceSubmitterVoterWhitelistBitmap(voter common.Address) ([]byte, error) {
+	return abiPack(PriceSubmitterVoterWhitelistBitmap, abiAddress(voter))
+}
+
+func UnpackPriceSubmitterVoterWhitelistBitmap(data []byte) (*big.Int, bool) {
+	d := abiDecoder{data: data}
+	value := d.readBig(0)
+	return value, d.end(1, true)
+}
+
+// Bindings of StateConnectorProofs, generated from src/bindings/abi/StateConnectorProofs.json
+
+// The functions of StateConnectorProofs that have bindings
+var StateConnectorProofsMethods = []ABIMethod{
+	StateConnectorProofsProveBalanceFinality,
+	StateConnectorProofsProveNonPaymentFinality,
+	StateConnectorProofsProvePaymentReferenceFinality,
+	StateConnectorProofsProvePaymentSourceFinality,
+	StateConnectorProofsProvePaymentTimestampFinality,
+}
+
+// proveBalanceFinality(uint32,bytes32,uint64,string) returns (uint32 _chainId, uint64 _ledger, uint64 _finalisedLedgerIndex, bytes32 _balanceHash, string _address)
+var StateConnectorProofsProveBalanceFinality = ABIMethod{Signature: "proveBalanceFinality(uint32,bytes32,uint64,string)", Selector: [4]byte{0x27, 0xd7, 0x98, 0xf5}}
+
+func PackStateConnectorProofsProveBalanceFinality(chainId uint32, balanceHash [32]byte, ledger uint64, address string) ([]byte, error) {
+	return abiPack(StateConnectorProofsProveBalanceFinality, abiUint(uint64(chainId)), abiBytes32(balanceHash), abiUint(ledger), abiString(address))
+}
+
+type StateConnectorProofsProveBalanceFinalityOutput struct {
+	ChainId              uint32
+	Ledger               uint64
+	FinalisedLedgerIndex uint64
+	BalanceHash          [32]byte
+	Address              string
+}
+
+func UnpackStateConnectorProofsProveBalanceFinality(data []byte) (StateConnectorProofsProveBalanceFinalityOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorProofsProveBalanceFinalityOutput
+	out.ChainId = uint32(d.readUint(0, 32))
+	out.Ledger = d.readUint(1, 64)
+	out.FinalisedLedgerIndex = d.readUint(2, 64)
+	out.BalanceHash = d.readBytes32(3)
+	out.Address = d.readString(4)
+	return out, d.end(5, false)
+}
+
+// proveNonPaymentFinality(uint32,bytes32,uint64,uint64,string) returns (uint32 _chainId, uint64 _ledger, uint64 _finalisedLedgerIndex, bytes32 _nonPaymentHash, uint64 _startLedger, string _filter)
+var StateConnectorProofsProveNonPaymentFinality = ABIMethod{Signature: "proveNonPaymentFinality(uint32,bytes32,uint64,uint64,string)", Selector: [4]byte{0xa4, 0xa5, 0xd3, 0x5d}}
+
+func PackStateConnectorProofsProveNonPaymentFinality(chainId uint32, nonPaymentHash [32]byte, ledger uint64, startLedger uint64, filter string) ([]byte, error) {
+	return abiPack(StateConnectorProofsProveNonPaymentFinality, abiUint(uint64(chainId)), abiBytes32(nonPaymentHash), abiUint(ledger), abiUint(startLedger), abiString(filter))
+}
+
+type StateConnectorProofsProveNonPaymentFinalityOutput struct {
+	ChainId              uint32
+	Ledger               uint64
+	FinalisedLedgerIndex uint64
+	NonPaymentHash       [32]byte
+	StartLedger          uint64
+	Filter               string
+}
+
+func UnpackStateConnectorProofsProveNonPaymentFinality(data []byte) (StateConnectorProofsProveNonPaymentFinalityOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorProofsProveNonPaymentFinalityOutput
+	out.ChainId = uint32(d.readUint(0, 32))
+	out.Ledger = d.readUint(1, 64)
+	out.FinalisedLedgerIndex = d.readUint(2, 64)
+	out.NonPaymentHash = d.readBytes32(3)
+	out.StartLedger = d.readUint(4, 64)
+	out.Filter = d.readString(5)
+	return out, d.end(6, false)
+}
+
+// provePaymentReferenceFinality(uint32,bytes32,uint64,string) returns (uint32 _chainId, uint64 _ledger, uint64 _finalisedLedgerIndex, bytes32 _paymentHash, string _txId)
+var StateConnectorProofsProvePaymentReferenceFinality = ABIMethod{Signature: "provePaymentReferenceFinality(uint32,bytes32,uint64,string)", Selector: [4]byte{0x8e, 0x96, 0xde, 0x1c}}
+
+func PackStateConnectorProofsProvePaymentReferenceFinality(chainId uint32, paymentHash [32]byte, ledger uint64, txId string) ([]byte, error) {
+	return abiPack(StateConnectorProofsProvePaymentReferenceFinality, abiUint(uint64(chainId)), abiBytes32(paymentHash), abiUint(ledger), abiString(txId))
+}
+
+type StateConnectorProofsProvePaymentReferenceFinalityOutput struct {
+	ChainId              uint32
+	Ledger               uint64
+	FinalisedLedgerIndex uint64
+	PaymentHash          [32]byte
+	TxId                 string
+}
+
+func UnpackStateConnectorProofsProvePaymentReferenceFinality(data []byte) (StateConnectorProofsProvePaymentReferenceFinalityOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorProofsProvePaymentReferenceFinalityOutput
+	out.ChainId = uint32(d.readUint(0, 32))
+	out.Ledger = d.readUint(1, 64)
+	out.FinalisedLedgerIndex = d.readUint(2, 64)
+	out.PaymentHash = d.readBytes32(3)
+	out.TxId = d.readString(4)
+	return out, d.end(5, false)
+}
+
+// provePaymentSourceFinality(uint32,bytes32,uint64,string) returns (uint32 _chainId, uint64 _ledger, uint64 _finalisedLedgerIndex, bytes32 _paymentHash, string _txId)
+var StateConnectorProofsProvePaymentSourceFinality = ABIMethod{Signature: "provePaymentSourceFinality(uint32,bytes32,uint64,string)", Selector: [4]byte{0x4e, 0x08, 0x0a, 0x6f}}
+
+func PackStateConnectorProofsProvePaymentSourceFinality(chainId uint32, paymentHash [32]byte, ledger uint64, txId string) ([]byte, error) {
+	return abiPack(StateConnectorProofsProvePaymentSourceFinality, abiUint(uint64(chainId)), abiBytes32(paymentHash), abiUint(ledger), abiString(txId))
+}
+
+type StateConnectorProofsProvePaymentSourceFinalityOutput struct {
+	ChainId              uint32
+	Ledger               uint64
+	FinalisedLedgerIndex uint64
+	PaymentHash          [32]byte
+	TxId                 string
+}
+
+func UnpackStateConnectorProofsProvePaymentSourceFinality(data []byte) (StateConnectorProofsProvePaymentSourceFinalityOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorProofsProvePaymentSourceFinalityOutput
+	out.ChainId = uint32(d.readUint(0, 32))
+	out.Ledger = d.readUint(1, 64)
+	out.FinalisedLedgerIndex = d.readUint(2, 64)
+	out.PaymentHash = d.readBytes32(3)
+	out.TxId = d.readString(4)
+	return out, d.end(5, false)
+}
+
+// provePaymentTimestampFinality(uint32,bytes32,uint64,uint64,uint64,string) returns (uint32 _chainId, uint64 _ledger, uint64 _finalisedLedgerIndex, bytes32 _paymentHash, uint64 _windowFrom, uint64 _windowTo, string _txId)
+var StateConnectorProofsProvePaymentTimestampFinality = ABIMethod{Signature: "provePaymentTimestampFinality(uint32,bytes32,uint64,uint64,uint64,string)", Selector: [4]byte{0x41, 0x39, 0x91, 0xef}}
+
+func PackStateConnectorProofsProvePaymentTimestampFinality(chainId uint32, paymentHash [32]byte, ledger uint64, windowFrom uint64, windowTo uint64, txId string) ([]byte, error) {
+	return abiPack(StateConnectorProofsProvePaymentTimestampFinality, abiUint(uint64(chainId)), abiBytes32(paymentHash), abiUint(ledger), abiUint(windowFrom), abiUint(windowTo), abiString(txId))
+}
+
+type StateConnectorProofsProvePaymentTimestampFinalityOutput struct {
+	ChainId              uint32
+	Ledger               uint64
+	FinalisedLedgerIndex uint64
+	PaymentHash          [32]byte
+	WindowFrom           uint64
+	WindowTo             uint64
+	TxId                 string
+}
+
+func UnpackStateConnectorProofsProvePaymentTimestampFinality(data []byte) (StateConnectorProofsProvePaymentTimestampFinalityOutput, bool) {
+	d := abiDecoder{data: data}
+	var out StateConnectorProofsProvePaymentTimestampFinalityOutput
+	out.ChainId = uint32(d.readUint(0, 32))
+	out.Ledger = d.readUint(1, 64)
+	out.FinalisedLedgerIndex = d.readUint(2, 64)
+	out.PaymentHash = d.readBytes32(3)
+	out.WindowFrom = d.readUint(4, 64)
+	out.WindowTo = d.readUint(5, 64)
+	out.TxId = d.readString(6)
+	return out, d.end(7, false)
+}
@@ -0,0 +1,257 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Calls to the contracts installed by the genesis are encoded, and their return data decoded,
+// through the bindings in system_contract_bindings.go. The bindings are generated from the
+// contract ABIs by src/bindings and are not edited by hand. The checkRet of a proof is decoded
+// by the binding of its proof function, or by UnpackCheckRetHead where only the outputs that
+// every proof function returns first are needed.
+
+// A function of a system contract, identified by its four-byte selector
+type ABIMethod struct {
+	Signature string
+	Selector  [4]byte
+}
+
+// Returns a copy of the selector, so that callers may modify it
+func (m ABIMethod) ID() []byte {
+	return m.Selector[:]
+}
+
+// The head word of a static argument, or the tail encoding of a dynamic one, or why the
+// argument cannot be encoded
+type abiArg struct {
+	word    []byte
+	dynamic []byte
+	err     error
+}
+
+func abiPack(method ABIMethod, args ...abiArg) ([]byte, error) {
+	data := method.ID()
+	var tail []byte
+	for i, arg := range args {
+		if arg.err != nil {
+			return nil, fmt.Errorf("%s: argument %d: %v", method.Signature, i, arg.err)
+		}
+		if arg.word != nil {
+			data = append(data, arg.word...)
+		} else {
+			data = append(data, abiUintWord(uint64(32*len(args)+len(tail)))...)
+			tail = append(tail, arg.dynamic...)
+		}
+	}
+	return append(data, tail...), nil
+}
+
+func abiUintWord(value uint64) []byte {
+	word := make([]byte, 32)
+	binary.BigEndian.PutUint64(word[24:], value)
+	return word
+}
+
+func abiBigWord(value *big.Int) ([]byte, error) {
+	if value.Sign() < 0 {
+		return nil, fmt.Errorf("negative value %s for uint256", value)
+	}
+	if value.BitLen() > 256 {
+		return nil, fmt.Errorf("value %s does not fit in uint256", value)
+	}
+	return value.FillBytes(make([]byte, 32)), nil
+}
+
+func abiUint(value uint64) abiArg {
+	return abiArg{word: abiUintWord(value)}
+}
+
+func abiBig(value *big.Int) abiArg {
+	word, err := abiBigWord(value)
+	return abiArg{word: word, err: err}
+}
+
+func abiBool(value bool) abiArg {
+	if value {
+		return abiUint(1)
+	}
+	return abiUint(0)
+}
+
+func abiAddress(value common.Address) abiArg {
+	return abiArg{word: common.LeftPadBytes(value.Bytes(), 32)}
+}
+
+func abiBytes32(value [32]byte) abiArg {
+	return abiArg{word: append([]byte{}, value[:]...)}
+}
+
+func abiString(value string) abiArg {
+	padded := make([]byte, (len(value)+31)/32*32)
+	copy(padded, value)
+	return abiArg{dynamic: append(abiUintWord(uint64(len(value))), padded...)}
+}
+
+func abiBigArray(values []*big.Int) abiArg {
+	dynamic := abiUintWord(uint64(len(values)))
+	for _, value := range values {
+		word, err := abiBigWord(value)
+		if err != nil {
+			return abiArg{err: err}
+		}
+		dynamic = append(dynamic, word...)
+	}
+	return abiArg{dynamic: dynamic}
+}
+
+func abiBytes32Array(values [][32]byte) abiArg {
+	dynamic := abiUintWord(uint64(len(values)))
+	for _, value := range values {
+		dynamic = append(dynamic, value[:]...)
+	}
+	return abiArg{dynamic: dynamic}
+}
+
+func abiAddressArray(values []common.Address) abiArg {
+	dynamic := abiUintWord(uint64(len(values)))
+	for _, value := range values {
+		dynamic = append(dynamic, common.LeftPadBytes(value.Bytes(), 32)...)
+	}
+	return abiArg{dynamic: dynamic}
+}
+
+// Reads return data word by word, remembering whether any word was missing or held a value
+// that does not fit the type of its output
+type abiDecoder struct {
+	data   []byte
+	failed bool
+}
+
+func (d *abiDecoder) wordAt(offset uint64) []byte {
+	if d.failed || offset > uint64(len(d.data)) || uint64(len(d.data))-offset < 32 {
+		d.failed = true
+		return make([]byte, 32)
+	}
+	return d.data[offset : offset+32]
+}
+
+func (d *abiDecoder) uintAt(offset uint64, bits uint) uint64 {
+	word := d.wordAt(offset)
+	value := binary.BigEndian.Uint64(word[24:])
+	if new(big.Int).SetBytes(word[:24]).Sign() != 0 || (bits < 64 && value>>bits != 0) {
+		d.failed = true
+		return 0
+	}
+	return value
+}
+
+// Returns the offset of the first element of a dynamic value whose head is at slot, and its
+// number of elements of elementSize bytes
+func (d *abiDecoder) tail(slot int, elementSize uint64) (uint64, uint64) {
+	offset := d.uintAt(uint64(32*slot), 64)
+	count := d.uintAt(offset, 64)
+	if d.failed || count > (uint64(len(d.data))-offset-32)/elementSize {
+		d.failed = true
+		return 0, 0
+	}
+	return offset + 32, count
+}
+
+func (d *abiDecoder) readUint(slot int, bits uint) uint64 {
+	return d.uintAt(uint64(32*slot), bits)
+}
+
+func (d *abiDecoder) readBig(slot int) *big.Int {
+	return new(big.Int).SetBytes(d.wordAt(uint64(32 * slot)))
+}
+
+func (d *abiDecoder) readBool(slot int) bool {
+	return d.readUint(slot, 1) == 1
+}
+
+func (d *abiDecoder) addressAt(offset uint64) common.Address {
+	word := d.wordAt(offset)
+	if new(big.Int).SetBytes(word[:12]).Sign() != 0 {
+		d.failed = true
+		return common.Address{}
+	}
+	return common.BytesToAddress(word[12:])
+}
+
+func (d *abiDecoder) readAddress(slot int) common.Address {
+	return d.addressAt(uint64(32 * slot))
+}
+
+func (d *abiDecoder) readBytes32(slot int) [32]byte {
+	var value [32]byte
+	copy(value[:], d.wordAt(uint64(32*slot)))
+	return value
+}
+
+func (d *abiDecoder) readString(slot int) string {
+	start, length := d.tail(slot, 1)
+	return string(d.data[start : start+length])
+}
+
+func (d *abiDecoder) readBigArray(slot int) []*big.Int {
+	start, count := d.tail(slot, 32)
+	values := make([]*big.Int, count)
+	for i := range values {
+		values[i] = new(big.Int).SetBytes(d.wordAt(start + 32*uint64(i)))
+	}
+	return values
+}
+
+func (d *abiDecoder) readBytes32Array(slot int) [][32]byte {
+	start, count := d.tail(slot, 32)
+	values := make([][32]byte, count)
+	for i := range values {
+		copy(values[i][:], d.wordAt(start+32*uint64(i)))
+	}
+	return values
+}
+
+func (d *abiDecoder) readAddressArray(slot int) []common.Address {
+	start, count := d.tail(slot, 32)
+	values := make([]common.Address, count)
+	for i := range values {
+		values[i] = d.addressAt(start + 32*uint64(i))
+	}
+	return values
+}
+
+// Returns whether all outputs were read. Functions with only static outputs return exactly one
+// word per output.
+func (d *abiDecoder) end(slots int, static bool) bool {
+	if static {
+		return !d.failed && len(d.data) == 32*slots
+	}
+	return !d.failed && len(d.data) >= 32*slots
+}
+
+// The outputs that every proof function of the state connector returns first, whichever of
+// them returned the checkRet. Data availability proofs return the number of confirmations they
+// require in place of FinalisedLedgerIndex.
+type CheckRetHead struct {
+	ChainId              uint32
+	Ledger               uint64
+	FinalisedLedgerIndex uint64
+	Hash                 [32]byte
+}
+
+func UnpackCheckRetHead(data []byte) (CheckRetHead, bool) {
+	d := abiDecoder{data: data}
+	var out CheckRetHead
+	out.ChainId = uint32(d.readUint(0, 32))
+	out.Ledger = d.readUint(1, 64)
+	out.FinalisedLedgerIndex = d.readUint(2, 64)
+	out.Hash = d.readBytes32(3)
+	return out, d.end(4, false)
+}
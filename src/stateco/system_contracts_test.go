@@ -0,0 +1,262 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// The genesis the node is built with, copied here by build_coreth.sh
+const genesisTestdata = "testdata/genesis_testnet.go"
+
+// Returns the selectors dispatched by the bytecode that the genesis installs at each address.
+// solc compares the selector of a call against each function with DUP1 PUSH4 <selector> EQ.
+func genesisSelectors(t *testing.T) map[common.Address]map[[4]byte]bool {
+	genesis, err := ioutil.ReadFile(genesisTestdata)
+	if err != nil {
+		t.Fatalf("reading genesis: %v", err)
+	}
+	alloc := regexp.MustCompile(`"([0-9a-fA-F]{40})": \{\s*"balance": "[^"]*",\s*"code": "0x([0-9a-fA-F]*)"`)
+	dispatch := regexp.MustCompile(`8063([0-9a-f]{8})14`)
+	selectors := make(map[common.Address]map[[4]byte]bool)
+	for _, contract := range alloc.FindAllStringSubmatch(string(genesis), -1) {
+		address := common.HexToAddress(contract[1])
+		selectors[address] = make(map[[4]byte]bool)
+		for _, match := range dispatch.FindAllStringSubmatch(strings.ToLower(contract[2]), -1) {
+			var selector [4]byte
+			hex.Decode(selector[:], []byte(match[1]))
+			selectors[address][selector] = true
+		}
+	}
+	return selectors
+}
+
+func TestSystemContractBindingsMatchGenesis(t *testing.T) {
+	selectors := genesisSelectors(t)
+	blockTime := big.NewInt(0)
+	contracts := []struct {
+		name    string
+		address string
+		methods []ABIMethod
+		// Whether the bindings cover every function of the contract
+		complete bool
+	}{
+		{"StateConnector", GetStateConnectorContractAddr(blockTime), StateConnectorMethods, true},
+		{"FlareKeeper", GetSystemTriggerContractAddr(blockTime), FlareKeeperMethods, false},
+		{"PriceSubmitter", GetPrioritisedFTSOContract(blockTime), PriceSubmitterMethods, false},
+	}
+	for _, contract := range contracts {
+		dispatched, ok := selectors[common.HexToAddress(contract.address)]
+		if !ok || len(dispatched) == 0 {
+			t.Errorf("%s: no bytecode at %s in the genesis", contract.name, contract.address)
+			continue
+		}
+		bound := make(map[[4]byte]bool)
+		for _, method := range contract.methods {
+			bound[method.Selector] = true
+			if !bytes.Equal(method.ID(), crypto.Keccak256([]byte(method.Signature))[:4]) {
+				t.Errorf("%s: selector %x does not match %s", contract.name, method.Selector, method.Signature)
+			}
+			if !dispatched[method.Selector] {
+				t.Errorf("%s: genesis bytecode has no function %s", contract.name, method.Signature)
+			}
+		}
+		if contract.complete {
+			for selector := range dispatched {
+				if !bound[selector] {
+					t.Errorf("%s: genesis bytecode has function %x without a binding", contract.name, selector)
+				}
+			}
+		}
+	}
+	// The genesis bytecode dispatches every proof function with a selector at genesis, and none
+	// of those left uninstalled
+	stateConnector := selectors[common.HexToAddress(GetStateConnectorContractAddr(blockTime))]
+	for _, function := range stateConnectorProofFunctions {
+		var selector [4]byte
+		copy(selector[:], crypto.Keccak256([]byte(function.method.Signature)))
+		installed := len(function.selector(blockTime)) != 0
+		if installed && !bytes.Equal(function.selector(blockTime), selector[:]) {
+			t.Errorf("%s: got selector %x at genesis", function.method.Signature, function.selector(blockTime))
+		}
+		if stateConnector[selector] != installed {
+			t.Errorf("%s: installed %t but dispatched by the genesis bytecode %t", function.method.Signature, installed, stateConnector[selector])
+		}
+	}
+}
+
+func TestSelectorGettersUseBindings(t *testing.T) {
+	blockTime := big.NewInt(0)
+	getters := []struct {
+		selector []byte
+		method   ABIMethod
+	}{
+		{GetProveDataAvailabilityPeriodFinalitySelector(blockTime), StateConnectorProveDataAvailabilityPeriodFinality},
+		{GetProvePaymentFinalitySelector(blockTime), StateConnectorProvePaymentFinality},
+		{GetDisprovePaymentFinalitySelector(blockTime), StateConnectorDisprovePaymentFinality},
+		{GetSystemTriggerSelector(blockTime), FlareKeeperTrigger},
+	}
+	for _, getter := range getters {
+		if !bytes.Equal(getter.selector, getter.method.ID()) {
+			t.Errorf("got selector %x for %s", getter.selector, getter.method.Signature)
+		}
+	}
+	// Proof functions installed at genesis use their binding, and those that are not have none
+	bindings := make(map[string]ABIMethod)
+	for _, method := range StateConnectorMethods {
+		bindings[method.Signature] = method
+	}
+	var uninstalled []string
+	for _, function := range stateConnectorProofFunctions {
+		if !bytes.Equal(function.method.ID(), crypto.Keccak256([]byte(function.method.Signature))[:4]) {
+			t.Errorf("%s: binding has selector %x", function.method.Signature, function.method.Selector)
+		}
+		selector := function.selector(blockTime)
+		method, bound := bindings[function.method.Signature]
+		if len(selector) == 0 {
+			uninstalled = append(uninstalled, `"`+strings.ToLower(function.method.Signature[:1])+function.method.Signature[1:strings.Index(function.method.Signature, "(")]+`Selector": "`+hexutil.Encode(crypto.Keccak256([]byte(function.method.Signature))[:4])+`"`)
+			if bound {
+				t.Errorf("%s has a binding but no selector at genesis", function.method.Signature)
+			}
+		} else if !bound || !bytes.Equal(selector, method.ID()) {
+			t.Errorf("got selector %x for %s", selector, function.method.Signature)
+		}
+		if IsStateConnectorProofSelector(blockTime, crypto.Keccak256([]byte(function.method.Signature))[:4]) != (len(selector) != 0) {
+			t.Errorf("%s: accepted as a proof selector while its selector at genesis is %x", function.method.Signature, selector)
+		}
+	}
+	// Each upgrade that installs a proof function sets the selector of its signature
+	defer func(schedule UpgradeSchedule) { activeUpgradeSchedule = schedule }(activeUpgradeSchedule)
+	activeUpgradeSchedule = mustParseUpgradeSchedule(`[` + genesisUpgrades(true) + `,
+		{"name": "proof functions", "time": 1, "params": {` + strings.Join(uninstalled, ", ") + `}}
+	]`)
+	for _, function := range stateConnectorProofFunctions {
+		selector := crypto.Keccak256([]byte(function.method.Signature))[:4]
+		if !bytes.Equal(function.selector(big.NewInt(1)), selector) || !IsStateConnectorProofSelector(big.NewInt(1), selector) {
+			t.Errorf("%s: got selector %x once installed", function.method.Signature, function.selector(big.NewInt(1)))
+		}
+	}
+	// Selectors handed out by getters are copies
+	GetProvePaymentFinalitySelector(blockTime)[0] = 0
+	if StateConnectorProvePaymentFinality.Selector[0] != 0x38 {
+		t.Errorf("modifying a selector changed the binding")
+	}
+}
+
+func TestPackProvePaymentFinality(t *testing.T) {
+	paymentHash := common.HexToHash("0x716f54ba")
+	data, err := PackStateConnectorProvePaymentFinality(3, paymentHash, 62880010, "E0E5FD8D")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 4+6*32 || !bytes.Equal(data[0:4], GetProvePaymentFinalitySelector(big.NewInt(0))) {
+		t.Fatalf("unexpected encoding %x", data)
+	}
+	if binary.BigEndian.Uint32(data[32:36]) != 3 || !bytes.Equal(data[36:68], paymentHash[:]) || binary.BigEndian.Uint64(data[92:100]) != 62880010 {
+		t.Errorf("unexpected static arguments in %x", data)
+	}
+	if binary.BigEndian.Uint64(data[124:132]) != 128 || binary.BigEndian.Uint64(data[156:164]) != 8 || string(data[164:172]) != "E0E5FD8D" {
+		t.Errorf("unexpected txId encoding in %x", data)
+	}
+}
+
+// checkRet is laid out as the outputs of provePaymentFinality, whose head every proof function
+// shares
+func TestUnpackProvePaymentFinalityCheckRet(t *testing.T) {
+	checkRet := make([]byte, 192+32)
+	binary.BigEndian.PutUint32(checkRet[28:32], 3)
+	binary.BigEndian.PutUint64(checkRet[56:64], 62880010)
+	binary.BigEndian.PutUint64(checkRet[88:96], 62880100)
+	copy(checkRet[96:128], common.HexToHash("0x716f54ba").Bytes())
+	binary.BigEndian.PutUint64(checkRet[152:160], 160)
+	binary.BigEndian.PutUint64(checkRet[184:192], 8)
+	copy(checkRet[192:], "E0E5FD8D")
+
+	out, ok := UnpackStateConnectorProvePaymentFinality(checkRet)
+	if !ok {
+		t.Fatalf("failed to decode checkRet")
+	}
+	if out.ChainId != 3 || out.Ledger != 62880010 || out.FinalisedLedgerIndex != 62880100 || common.Hash(out.PaymentHash) != common.HexToHash("0x716f54ba") {
+		t.Errorf("unexpected outputs %+v", out)
+	}
+	if txId, _ := GetCheckRetString(big.NewInt(0), GetProvePaymentFinalitySelector(big.NewInt(0)), checkRet); out.TxId != txId {
+		t.Errorf("got txId %q want %q", out.TxId, txId)
+	}
+	if head, ok := UnpackCheckRetHead(checkRet); !ok || head.ChainId != out.ChainId || head.Ledger != out.Ledger || head.FinalisedLedgerIndex != out.FinalisedLedgerIndex || head.Hash != out.PaymentHash {
+		t.Errorf("got head %+v of outputs %+v", head, out)
+	}
+	if _, ok := UnpackCheckRetHead(checkRet[:127]); ok {
+		t.Errorf("expected a checkRet shorter than its head to be rejected")
+	}
+
+	dirty := append([]byte{}, checkRet...)
+	dirty[27] = 1
+	if _, ok := UnpackStateConnectorProvePaymentFinality(dirty); ok {
+		t.Errorf("expected a chainId above 32 bits to be rejected")
+	}
+	truncated := checkRet[:196]
+	if _, ok := UnpackStateConnectorProvePaymentFinality(truncated); ok {
+		t.Errorf("expected a truncated txId to be rejected")
+	}
+}
+
+func TestPriceSubmitterArrayRoundTrip(t *testing.T) {
+	data, err := PackPriceSubmitterSubmitPriceHashes(big.NewInt(7), []*big.Int{big.NewInt(1), big.NewInt(2)}, [][32]byte{{0xaa}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 4+3*32+3*32+2*32 || binary.BigEndian.Uint64(data[60:68]) != 96 || binary.BigEndian.Uint64(data[92:100]) != 192 {
+		t.Fatalf("unexpected encoding %x", data)
+	}
+
+	trusted := []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0xffC11262622D5069aBad729efF56e5Aa4e9B9c44")}
+	ret, err := abiPack(ABIMethod{}, abiAddressArray(trusted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret = ret[4:]
+	addresses, ok := UnpackPriceSubmitterGetTrustedAddresses(ret)
+	if !ok || len(addresses) != 2 || addresses[0] != trusted[0] || addresses[1] != trusted[1] {
+		t.Errorf("got %v want %v", addresses, trusted)
+	}
+	// An element count past the end of the return data
+	binary.BigEndian.PutUint64(ret[56:64], 3)
+	if _, ok := UnpackPriceSubmitterGetTrustedAddresses(ret); ok {
+		t.Errorf("expected an array longer than the return data to be rejected")
+	}
+}
+
+func TestPackRejectsValuesOutsideUint256(t *testing.T) {
+	tooLarge := new(big.Int).Lsh(big.NewInt(1), 256)
+	tests := []struct {
+		name    string
+		epoch   *big.Int
+		indices []*big.Int
+	}{
+		{"negative argument", big.NewInt(-7), nil},
+		{"argument above 256 bits", tooLarge, nil},
+		{"negative element", big.NewInt(7), []*big.Int{big.NewInt(1), big.NewInt(-2)}},
+		{"element above 256 bits", big.NewInt(7), []*big.Int{tooLarge}},
+	}
+	for _, test := range tests {
+		if data, err := PackPriceSubmitterSubmitPriceHashes(test.epoch, test.indices, nil); err == nil {
+			t.Errorf("%s: got encoding %x", test.name, data)
+		}
+	}
+	maximum := new(big.Int).Sub(tooLarge, big.NewInt(1))
+	if data, err := PackPriceSubmitterSubmitPriceHashes(maximum, nil, nil); err != nil || !bytes.Equal(data[4:36], bytes.Repeat([]byte{0xff}, 32)) {
+		t.Errorf("got encoding %x, error %v of the largest uint256", data, err)
+	}
+}
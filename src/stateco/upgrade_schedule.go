@@ -0,0 +1,314 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// The consensus parameters of the state connector and the keeper change through upgrades that
+// activate at a block time or at a block height. Each network has its own schedule, and the
+// parameters of a block are those set by the latest upgrade that is active at it.
+
+// Parameters set by an upgrade, where nil leaves a parameter as it was. The schedule tag names
+// whether the getter of a parameter is given a block time or a block height. An empty selector,
+// "0x", of a proof function that the state connector contract does not have leaves it
+// uninstalled, and no call is verified as that proof.
+type UpgradeParams struct {
+	StateConnectorActivated                     *bool         `json:"stateConnectorActivated,omitempty" schedule:"time"`
+	StateConnectorGasDivisor                    *uint64       `json:"stateConnectorGasDivisor,omitempty" schedule:"time"`
+	MaxAllowedChains                            *uint32       `json:"maxAllowedChains,omitempty" schedule:"time"`
+	AllowedUTXOChains                           []uint32      `json:"allowedUTXOChains,omitempty" schedule:"time"`
+	PoWAddressField                             *bool         `json:"powAddressField,omitempty" schedule:"time"`
+	EVMConfirmations                            *uint64       `json:"evmConfirmations,omitempty" schedule:"time"`
+	VerifyEVMReceiptsTrie                       *bool         `json:"verifyEVMReceiptsTrie,omitempty" schedule:"time"`
+	StateConnectorContract                      *string       `json:"stateConnectorContract,omitempty" schedule:"time"`
+	ProveDataAvailabilityPeriodFinalitySelector hexutil.Bytes `json:"proveDataAvailabilityPeriodFinalitySelector,omitempty" schedule:"time"`
+	ProvePaymentFinalitySelector                hexutil.Bytes `json:"provePaymentFinalitySelector,omitempty" schedule:"time"`
+	DisprovePaymentFinalitySelector             hexutil.Bytes `json:"disprovePaymentFinalitySelector,omitempty" schedule:"time"`
+	ProvePaymentReferenceFinalitySelector       hexutil.Bytes `json:"provePaymentReferenceFinalitySelector,omitempty" schedule:"time"`
+	ProvePaymentSourceFinalitySelector          hexutil.Bytes `json:"provePaymentSourceFinalitySelector,omitempty" schedule:"time"`
+	ProveBalanceFinalitySelector                hexutil.Bytes `json:"proveBalanceFinalitySelector,omitempty" schedule:"time"`
+	ProvePaymentTimestampFinalitySelector       hexutil.Bytes `json:"provePaymentTimestampFinalitySelector,omitempty" schedule:"time"`
+	ProveNonPaymentFinalitySelector             hexutil.Bytes `json:"proveNonPaymentFinalitySelector,omitempty" schedule:"time"`
+	PrioritisedFTSOContract                     *string       `json:"prioritisedFTSOContract,omitempty" schedule:"time"`
+	KeeperGasMultiplier                         *uint64       `json:"keeperGasMultiplier,omitempty" schedule:"height"`
+	SystemTriggerContract                       *string       `json:"systemTriggerContract,omitempty" schedule:"height"`
+	SystemTriggerSelector                       hexutil.Bytes `json:"systemTriggerSelector,omitempty" schedule:"height"`
+	MaximumMintRequest                          *big.Int      `json:"maximumMintRequest,omitempty" schedule:"height"`
+}
+
+// An upgrade activates at exactly one of a block time or a block height
+type Upgrade struct {
+	Name   string        `json:"name"`
+	Time   *uint64       `json:"time,omitempty"`
+	Height *uint64       `json:"height,omitempty"`
+	Params UpgradeParams `json:"params"`
+}
+
+// The upgrades of a network. The first upgrade of each kind activates at 0 and sets every
+// parameter of that kind.
+type UpgradeSchedule []Upgrade
+
+// The parameters in force before the first upgrade of any network. The state connector contract
+// only has chains 0 to 4, so Ethereum (5) and Stellar (6) stay disallowed until an upgrade that
+// installs them in the contract raises maxAllowedChains at the same time.
+func genesisUpgrades(stateConnectorActivated bool) string {
+	return `
+	{
+		"name": "genesis",
+		"time": 0,
+		"params": {
+			"stateConnectorActivated": ` + strconv.FormatBool(stateConnectorActivated) + `,
+			"stateConnectorGasDivisor": 3,
+			"maxAllowedChains": 5,
+			"allowedUTXOChains": [0, 1, 2],
+			"powAddressField": false,
+			"evmConfirmations": 12,
+			"verifyEVMReceiptsTrie": false,
+			"stateConnectorContract": "0x1000000000000000000000000000000000000001",
+			"proveDataAvailabilityPeriodFinalitySelector": "0xc5d64cd1",
+			"provePaymentFinalitySelector": "0x388492dd",
+			"disprovePaymentFinalitySelector": "0x7f582432",
+			"provePaymentReferenceFinalitySelector": "0x",
+			"provePaymentSourceFinalitySelector": "0x",
+			"proveBalanceFinalitySelector": "0x",
+			"provePaymentTimestampFinalitySelector": "0x",
+			"proveNonPaymentFinalitySelector": "0x",
+			"prioritisedFTSOContract": "0x1000000000000000000000000000000000000003"
+		}
+	},
+	{
+		"name": "genesis",
+		"height": 0,
+		"params": {
+			"keeperGasMultiplier": 100,
+			"systemTriggerContract": "0x1000000000000000000000000000000000000002",
+			"systemTriggerSelector": "0x7fec8d38",
+			"maximumMintRequest": 50000000000000000000000000
+		}
+	}`
+}
+
+// Upgrade schedules by chain ID. Networks without a schedule of their own use the default one.
+var (
+	defaultUpgradeSchedule = `[` + genesisUpgrades(false) + `]`
+	upgradeSchedules       = map[uint64]string{
+		// local
+		16: `[` + genesisUpgrades(true) + `]`,
+		// songbird
+		19: `[` + genesisUpgrades(false) + `,
+			{"name": "state connector", "time": 1636070400, "params": {"stateConnectorActivated": true}}
+		]`,
+		// scdev
+		20210406: `[` + genesisUpgrades(false) + `]`,
+	}
+	activeUpgradeSchedule = mustParseUpgradeSchedule(defaultUpgradeSchedule)
+	// A block time and height at which every upgrade is active
+	latestBlock = new(big.Int).SetUint64(math.MaxUint64)
+
+	parsedUpgradeSchedules     = make(map[string]UpgradeSchedule)
+	parsedUpgradeSchedulesLock sync.Mutex
+)
+
+func mustParseUpgradeSchedule(schedule string) UpgradeSchedule {
+	upgrades, err := ParseUpgradeSchedule(schedule)
+	if err != nil {
+		panic(err)
+	}
+	return upgrades
+}
+
+// Parses and validates an upgrade schedule
+func ParseUpgradeSchedule(schedule string) (UpgradeSchedule, error) {
+	var upgrades UpgradeSchedule
+	if err := json.Unmarshal([]byte(schedule), &upgrades); err != nil {
+		return nil, err
+	}
+	if err := upgrades.Validate(); err != nil {
+		return nil, err
+	}
+	return upgrades, nil
+}
+
+// Returns the upgrade schedule of a network, which is parsed and validated once
+func GetUpgradeSchedule(chainID *big.Int) (UpgradeSchedule, error) {
+	schedule, ok := upgradeSchedules[chainID.Uint64()]
+	if !ok || !chainID.IsUint64() {
+		schedule = defaultUpgradeSchedule
+	}
+	parsedUpgradeSchedulesLock.Lock()
+	defer parsedUpgradeSchedulesLock.Unlock()
+	if upgrades, ok := parsedUpgradeSchedules[schedule]; ok {
+		return upgrades, nil
+	}
+	upgrades, err := ParseUpgradeSchedule(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upgrade schedule for chain %s: %v", chainID, err)
+	}
+	parsedUpgradeSchedules[schedule] = upgrades
+	return upgrades, nil
+}
+
+// Selects the upgrade schedule of a network. It is called once at startup, before any block is
+// processed, and fails if the schedule is invalid.
+func SetUpgradeSchedule(chainID *big.Int) error {
+	if _, ok := upgradeSchedules[chainID.Uint64()]; !ok || !chainID.IsUint64() {
+		log.Warn("No upgrade schedule for this network, using the default one", "chainID", chainID)
+	}
+	upgrades, err := GetUpgradeSchedule(chainID)
+	if err != nil {
+		return err
+	}
+	activeUpgradeSchedule = upgrades
+	return nil
+}
+
+func (u Upgrade) kind() string {
+	if u.Time != nil {
+		return "time"
+	}
+	return "height"
+}
+
+func (u Upgrade) activation() uint64 {
+	if u.Time != nil {
+		return *u.Time
+	}
+	return *u.Height
+}
+
+// Checks that upgrades of each kind activate in increasing order starting at 0, that each
+// sets only parameters of its kind, that the first sets all of them, and that the values in
+// force after every upgrade are usable
+func (s UpgradeSchedule) Validate() error {
+	params := reflect.TypeOf(UpgradeParams{})
+	latest := make(map[string]uint64)
+	for i, upgrade := range s {
+		if (upgrade.Time == nil) == (upgrade.Height == nil) {
+			return fmt.Errorf("upgrade %d (%s) must activate at exactly one of a time or a height", i, upgrade.Name)
+		}
+		kind := upgrade.kind()
+		previous, seen := latest[kind]
+		if !seen && upgrade.activation() != 0 {
+			return fmt.Errorf("the first %s upgrade (%s) must activate at 0", kind, upgrade.Name)
+		} else if seen && upgrade.activation() <= previous {
+			return fmt.Errorf("upgrade %d (%s) activates at %s %d, not after %d", i, upgrade.Name, kind, upgrade.activation(), previous)
+		}
+		latest[kind] = upgrade.activation()
+
+		value := reflect.ValueOf(upgrade.Params)
+		set := 0
+		for j := 0; j < params.NumField(); j++ {
+			field := params.Field(j)
+			if value.Field(j).IsNil() {
+				if !seen && field.Tag.Get("schedule") == kind {
+					return fmt.Errorf("the first %s upgrade (%s) does not set %s", kind, upgrade.Name, field.Name)
+				}
+				continue
+			}
+			if field.Tag.Get("schedule") != kind {
+				return fmt.Errorf("upgrade %d (%s) activates at a %s but sets %s, which is scheduled by %s", i, upgrade.Name, kind, field.Name, field.Tag.Get("schedule"))
+			}
+			set++
+		}
+		if set == 0 {
+			return fmt.Errorf("upgrade %d (%s) sets no parameters", i, upgrade.Name)
+		}
+		if err := s[:i+1].params(latestBlock, latestBlock).check(); err != nil {
+			return fmt.Errorf("after upgrade %d (%s): %v", i, upgrade.Name, err)
+		}
+	}
+	for _, kind := range []string{"time", "height"} {
+		if _, seen := latest[kind]; !seen {
+			return fmt.Errorf("no %s upgrades", kind)
+		}
+	}
+	return nil
+}
+
+// Checks the values of the parameters that are set
+func (p UpgradeParams) check() error {
+	if p.StateConnectorGasDivisor != nil && *p.StateConnectorGasDivisor == 0 {
+		return fmt.Errorf("stateConnectorGasDivisor must not be 0")
+	}
+	if p.EVMConfirmations != nil && *p.EVMConfirmations == 0 {
+		return fmt.Errorf("evmConfirmations must not be 0")
+	}
+	if p.KeeperGasMultiplier != nil && *p.KeeperGasMultiplier == 0 {
+		return fmt.Errorf("keeperGasMultiplier must not be 0")
+	}
+	if p.MaximumMintRequest != nil && p.MaximumMintRequest.Sign() < 0 {
+		return fmt.Errorf("maximumMintRequest must not be negative")
+	}
+	if p.MaxAllowedChains != nil {
+		for _, chainId := range p.AllowedUTXOChains {
+			if chainId >= *p.MaxAllowedChains {
+				return fmt.Errorf("allowed UTXO chain %d is not below maxAllowedChains", chainId)
+			}
+		}
+	}
+	for _, address := range []*string{p.StateConnectorContract, p.PrioritisedFTSOContract, p.SystemTriggerContract} {
+		if address != nil && !common.IsHexAddress(*address) {
+			return fmt.Errorf("invalid contract address %q", *address)
+		}
+	}
+	for _, selector := range []hexutil.Bytes{
+		p.ProveDataAvailabilityPeriodFinalitySelector, p.ProvePaymentFinalitySelector, p.DisprovePaymentFinalitySelector, p.SystemTriggerSelector,
+	} {
+		if selector != nil && len(selector) != 4 {
+			return fmt.Errorf("invalid selector %x", []byte(selector))
+		}
+	}
+	for _, selector := range []hexutil.Bytes{
+		p.ProvePaymentReferenceFinalitySelector, p.ProvePaymentSourceFinalitySelector, p.ProveBalanceFinalitySelector,
+		p.ProvePaymentTimestampFinalitySelector, p.ProveNonPaymentFinalitySelector,
+	} {
+		if selector != nil && len(selector) != 0 && len(selector) != 4 {
+			return fmt.Errorf("invalid selector %x", []byte(selector))
+		}
+	}
+	return nil
+}
+
+// Returns the parameters set by the upgrades active at a block time and block height. A nil
+// time or height only activates the first upgrade of that kind.
+func (s UpgradeSchedule) params(blockTime *big.Int, blockNumber *big.Int) UpgradeParams {
+	var params UpgradeParams
+	merged := reflect.ValueOf(&params).Elem()
+	seen := make(map[string]bool)
+	for _, upgrade := range s {
+		at := blockNumber
+		if upgrade.Time != nil {
+			at = blockTime
+		}
+		if seen[upgrade.kind()] && (at == nil || new(big.Int).SetUint64(upgrade.activation()).Cmp(at) > 0) {
+			continue
+		}
+		seen[upgrade.kind()] = true
+		value := reflect.ValueOf(upgrade.Params)
+		for j := 0; j < value.NumField(); j++ {
+			if !value.Field(j).IsNil() {
+				merged.Field(j).Set(value.Field(j))
+			}
+		}
+	}
+	return params
+}
+
+// Returns the parameters in force at a block of the network the node runs. Getters pass the
+// block time or height that their parameter is scheduled by, and nil for the other.
+func GetUpgradeParams(blockTime *big.Int, blockNumber *big.Int) UpgradeParams {
+	return activeUpgradeSchedule.params(blockTime, blockNumber)
+}
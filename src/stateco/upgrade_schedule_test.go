@@ -0,0 +1,180 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestUpgradeSchedulesAreValid(t *testing.T) {
+	if _, err := ParseUpgradeSchedule(defaultUpgradeSchedule); err != nil {
+		t.Errorf("default: %v", err)
+	}
+	for chainID, schedule := range upgradeSchedules {
+		if _, err := ParseUpgradeSchedule(schedule); err != nil {
+			t.Errorf("chain %d: %v", chainID, err)
+		}
+	}
+}
+
+func TestGenesisUpgradeParams(t *testing.T) {
+	defer func(schedule UpgradeSchedule) { activeUpgradeSchedule = schedule }(activeUpgradeSchedule)
+	if err := SetUpgradeSchedule(big.NewInt(19)); err != nil {
+		t.Fatal(err)
+	}
+	blockTime := big.NewInt(1636070400)
+	blockNumber := big.NewInt(1000000)
+	if GetStateConnectorGasDivisor(blockTime) != 3 || GetMaxAllowedChains(blockTime) != 5 || GetKeeperGasMultiplier(blockNumber) != 100 {
+		t.Errorf("unexpected gas parameters")
+	}
+	if GetStateConnectorContractAddr(blockTime) != "0x1000000000000000000000000000000000000001" ||
+		GetSystemTriggerContractAddr(blockNumber) != "0x1000000000000000000000000000000000000002" ||
+		GetPrioritisedFTSOContract(blockTime) != "0x1000000000000000000000000000000000000003" {
+		t.Errorf("unexpected contract addresses")
+	}
+	if !bytes.Equal(GetProveDataAvailabilityPeriodFinalitySelector(blockTime), []byte{0xc5, 0xd6, 0x4c, 0xd1}) {
+		t.Errorf("unexpected selector %x", GetProveDataAvailabilityPeriodFinalitySelector(blockTime))
+	}
+	// Proof functions that the state connector contract does not have are not installed
+	for _, selector := range [][]byte{
+		GetProvePaymentReferenceFinalitySelector(blockTime),
+		GetProvePaymentSourceFinalitySelector(blockTime),
+		GetProveBalanceFinalitySelector(blockTime),
+		GetProvePaymentTimestampFinalitySelector(blockTime),
+		GetProveNonPaymentFinalitySelector(blockTime),
+	} {
+		if len(selector) != 0 {
+			t.Errorf("unexpected selector %x of a function the contract does not have", selector)
+		}
+	}
+	if IsStateConnectorProofSelector(blockTime, []byte{0x8e, 0x96, 0xde, 0x1c}) || IsStateConnectorProofSelector(blockTime, []byte{0xa4, 0xa5, 0xd3, 0x5d}) ||
+		IsStateConnectorProofSelector(blockTime, []byte{0xb1, 0x29, 0xaf, 0xed}) {
+		t.Errorf("expected the selectors of functions the contract does not have to be rejected")
+	}
+	if chains := GetAllowedUTXOChains(blockTime); len(chains) != 3 || chains[2] != 2 {
+		t.Errorf("unexpected UTXO chains %v", chains)
+	}
+	if GetMaximumMintRequest(blockNumber).String() != "50000000000000000000000000" {
+		t.Errorf("unexpected maximum mint request %s", GetMaximumMintRequest(blockNumber))
+	}
+	// Values handed out by getters are copies
+	GetMaximumMintRequest(blockNumber).SetUint64(0)
+	GetAllowedUTXOChains(blockTime)[0] = 6
+	if GetMaximumMintRequest(blockNumber).Sign() == 0 || GetAllowedUTXOChains(blockTime)[0] != 0 {
+		t.Errorf("modifying a returned value changed the schedule")
+	}
+}
+
+func TestUpgradeActivation(t *testing.T) {
+	defer func(schedule UpgradeSchedule) { activeUpgradeSchedule = schedule }(activeUpgradeSchedule)
+	schedule, err := ParseUpgradeSchedule(`[` + genesisUpgrades(false) + `,
+		{"name": "bitcoin cash", "time": 1700000000, "params": {"maxAllowedChains": 8, "allowedUTXOChains": [0, 1, 2, 7]}},
+		{"name": "keeper gas", "height": 500, "params": {"keeperGasMultiplier": 50}},
+		{"name": "gas divisor", "time": 1800000000, "params": {"stateConnectorGasDivisor": 4}}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	activeUpgradeSchedule = schedule
+	tests := []struct {
+		blockTime        int64
+		maxAllowedChains uint32
+		utxoChains       int
+		gasDivisor       uint64
+	}{
+		{1699999999, 5, 3, 3},
+		{1700000000, 8, 4, 3},
+		{1800000000, 8, 4, 4},
+	}
+	for _, test := range tests {
+		blockTime := big.NewInt(test.blockTime)
+		if GetMaxAllowedChains(blockTime) != test.maxAllowedChains || len(GetAllowedUTXOChains(blockTime)) != test.utxoChains || GetStateConnectorGasDivisor(blockTime) != test.gasDivisor {
+			t.Errorf("at %d: got %d chains, %v, divisor %d", test.blockTime, GetMaxAllowedChains(blockTime), GetAllowedUTXOChains(blockTime), GetStateConnectorGasDivisor(blockTime))
+		}
+	}
+	if GetKeeperGasMultiplier(big.NewInt(499)) != 100 || GetKeeperGasMultiplier(big.NewInt(500)) != 50 {
+		t.Errorf("keeper gas multiplier did not change at height 500")
+	}
+	// Upgrades by time do not activate at a height of the same value
+	if GetKeeperGasMultiplier(big.NewInt(1800000000)) != 50 {
+		t.Errorf("unexpected keeper gas multiplier")
+	}
+}
+
+func TestInvalidUpgradeSchedules(t *testing.T) {
+	tests := []struct {
+		name     string
+		upgrades string
+		err      string
+	}{
+		{"no height upgrades", `[{"name": "genesis", "time": 0, "params": {"stateConnectorGasDivisor": 3}}]`, "does not set"},
+		{"incomplete genesis", strings.Replace(genesisUpgrades(false), `"keeperGasMultiplier": 100,`, "", 1), "does not set KeeperGasMultiplier"},
+		{"late genesis", strings.Replace(genesisUpgrades(false), `"time": 0`, `"time": 1`, 1), "must activate at 0"},
+		{"not monotonic", genesisUpgrades(false) + `,
+			{"name": "a", "time": 20, "params": {"stateConnectorGasDivisor": 4}},
+			{"name": "b", "time": 20, "params": {"stateConnectorGasDivisor": 5}}`, "not after 20"},
+		{"both activations", genesisUpgrades(false) + `,
+			{"name": "a", "time": 20, "height": 20, "params": {"stateConnectorGasDivisor": 4}}`, "exactly one"},
+		{"wrong kind", genesisUpgrades(false) + `,
+			{"name": "a", "time": 20, "params": {"keeperGasMultiplier": 4}}`, "scheduled by height"},
+		{"empty", genesisUpgrades(false) + `,
+			{"name": "a", "height": 20, "params": {}}`, "sets no parameters"},
+		{"zero divisor", genesisUpgrades(false) + `,
+			{"name": "a", "time": 20, "params": {"stateConnectorGasDivisor": 0}}`, "must not be 0"},
+		{"zero confirmations", genesisUpgrades(false) + `,
+			{"name": "a", "time": 20, "params": {"evmConfirmations": 0}}`, "must not be 0"},
+		{"selector length", genesisUpgrades(false) + `,
+			{"name": "a", "time": 20, "params": {"provePaymentFinalitySelector": "0x388492"}}`, "invalid selector"},
+		{"empty selector", genesisUpgrades(false) + `,
+			{"name": "a", "time": 20, "params": {"provePaymentFinalitySelector": "0x"}}`, "invalid selector"},
+		{"chain above maximum", genesisUpgrades(false) + `,
+			{"name": "a", "time": 20, "params": {"allowedUTXOChains": [0, 1, 2, 7]}}`, "not below maxAllowedChains"},
+		{"invalid address", genesisUpgrades(false) + `,
+			{"name": "a", "height": 20, "params": {"systemTriggerContract": "0x10"}}`, "invalid contract address"},
+	}
+	for _, test := range tests {
+		upgrades := test.upgrades
+		if !strings.HasPrefix(upgrades, "[") {
+			upgrades = "[" + upgrades + "]"
+		}
+		_, err := ParseUpgradeSchedule(upgrades)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestUnknownNetworkUsesDefaultUpgradeSchedule(t *testing.T) {
+	defer func(schedule UpgradeSchedule) { activeUpgradeSchedule = schedule }(activeUpgradeSchedule)
+	if err := SetUpgradeSchedule(big.NewInt(43112)); err != nil {
+		t.Fatal(err)
+	}
+	if GetStateConnectorGasDivisor(big.NewInt(0)) != 3 {
+		t.Errorf("unexpected gas divisor")
+	}
+}
+
+func TestStateConnectorActivation(t *testing.T) {
+	tests := []struct {
+		chainID   int64
+		blockTime int64
+		activated bool
+	}{
+		{16, 0, true},
+		{16, 1636070399, true},
+		{19, 0, false},
+		{19, 1636070399, false},
+		{19, 1636070400, true},
+		{20210406, 1636070400, false},
+		{43112, 1636070400, false},
+	}
+	for _, test := range tests {
+		if activated := GetStateConnectorActivated(big.NewInt(test.chainID), big.NewInt(test.blockTime)); activated != test.activated {
+			t.Errorf("chain %d at %d: got activated %t", test.chainID, test.blockTime, activated)
+		}
+	}
+}
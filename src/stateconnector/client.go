@@ -0,0 +1,409 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package stateconnector
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Payment proofs are committed to and then revealed in two transactions. The contract records
+// either one only if a node verified the proof against its chain APIs, and accepts the reveal
+// within the contract's commitRevealLowerBound and commitRevealUpperBound seconds of the commit.
+
+const (
+	StateConnectorAddress = "0x1000000000000000000000000000000000000001"
+)
+
+var (
+	defaultGasLimit     = uint64(6000000)
+	defaultGasPrice     = big.NewInt(225000000000)
+	defaultPollInterval = 2 * time.Second
+
+	ErrNotVerified   = errors.New("the proof was not verified by the chain APIs of the node")
+	ErrRevealTooLate = errors.New("the reveal period of the commit has passed")
+)
+
+type Client struct {
+	nodeURL    string
+	httpClient *http.Client
+	abi        abi.ABI
+	contract   common.Address
+	key        *ecdsa.PrivateKey
+	sender     common.Address
+	chainID    *big.Int
+	GasLimit   uint64
+	GasPrice   *big.Int
+	// Interval between polls of the node for receipts and contract state
+	PollInterval time.Duration
+}
+
+type PaymentProof struct {
+	ChainId     uint32
+	Ledger      uint64
+	TxId        string
+	PaymentHash common.Hash
+}
+
+// Mirrors the HashExists struct of the state connector contract
+type HashExists struct {
+	Exists                     bool
+	DataAvailabilityPeriodHash common.Hash
+	CommitHash                 common.Hash
+	CommitTime                 *big.Int
+	PermittedRevealTime        *big.Int
+	RevealHash                 common.Hash
+	Index                      uint64
+	IndexSearchRegion          uint64
+	Proven                     bool
+	ProvenBy                   common.Address
+}
+
+type NodeRPCRequestPayload struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+type NodeRPCResp struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+type NodeCallParams struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Gas  string `json:"gas"`
+	Data string `json:"data"`
+}
+type NodeReceipt struct {
+	TransactionHash string `json:"transactionHash"`
+	BlockNumber     string `json:"blockNumber"`
+	Status          string `json:"status"`
+}
+
+// Reads the ABI of a compiled contract artifact, such as bin/src/stateco/StateConnector.json
+func LoadABI(artifactPath string) (abi.ABI, error) {
+	artifactBytes, err := ioutil.ReadFile(artifactPath)
+	if err != nil {
+		return abi.ABI{}, err
+	}
+	var artifact struct {
+		ABI json.RawMessage `json:"abi"`
+	}
+	if err := json.Unmarshal(artifactBytes, &artifact); err != nil {
+		return abi.ABI{}, err
+	}
+	return abi.JSON(bytes.NewReader(artifact.ABI))
+}
+
+// Connects to the C-chain JSON-RPC API of a node, at http://<host>:9650/ext/bc/C/rpc, sending
+// transactions signed with the given key
+func NewClient(nodeURL string, artifactPath string, key *ecdsa.PrivateKey) (*Client, error) {
+	contractABI, err := LoadABI(artifactPath)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		nodeURL:      nodeURL,
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		abi:          contractABI,
+		contract:     common.HexToAddress(StateConnectorAddress),
+		key:          key,
+		sender:       crypto.PubkeyToAddress(key.PublicKey),
+		GasLimit:     defaultGasLimit,
+		GasPrice:     defaultGasPrice,
+		PollInterval: defaultPollInterval,
+	}
+	var chainID hexutil.Big
+	if err := c.CallNode("eth_chainId", []interface{}{}, &chainID); err != nil {
+		return nil, err
+	}
+	c.chainID = chainID.ToInt()
+	return c, nil
+}
+
+func (c *Client) Sender() common.Address {
+	return c.sender
+}
+
+// Calls a JSON-RPC method of the node and decodes its result
+func (c *Client) CallNode(method string, params []interface{}, result interface{}) error {
+	payloadBytes, err := json.Marshal(NodeRPCRequestPayload{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Post(c.nodeURL, "application/json", bytes.NewReader(payloadBytes))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var jsonResp NodeRPCResp
+	if err := json.Unmarshal(respBody, &jsonResp); err != nil {
+		return fmt.Errorf("%s: %s", method, resp.Status)
+	}
+	if jsonResp.Error != nil {
+		return fmt.Errorf("%s: %s", method, jsonResp.Error.Message)
+	}
+	return json.Unmarshal(jsonResp.Result, result)
+}
+
+// Location of a payment in the finalisedPayments and proposed proof mappings of the contract
+func LocationHash(chainId uint32, paymentHash common.Hash) common.Hash {
+	chainIdBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(chainIdBytes, chainId)
+	return crypto.Keccak256Hash(chainIdBytes, paymentHash.Bytes())
+}
+
+func (c *Client) EncodeProvePaymentFinality(proof PaymentProof) ([]byte, error) {
+	return c.abi.Pack("provePaymentFinality", proof.ChainId, [32]byte(proof.PaymentHash), proof.Ledger, proof.TxId)
+}
+
+func (c *Client) EncodeDisprovePaymentFinality(proof PaymentProof) ([]byte, error) {
+	return c.abi.Pack("disprovePaymentFinality", proof.ChainId, [32]byte(proof.PaymentHash), proof.Ledger, proof.TxId)
+}
+
+// Data availability proofs commit to keccak256(sender, chainTipHash) and reveal chainTipHash
+func (c *Client) EncodeProveDataAvailabilityPeriodFinality(chainId uint32, ledger uint64, dataAvailabilityPeriodHash common.Hash, chainTipHash common.Hash) ([]byte, error) {
+	return c.abi.Pack("proveDataAvailabilityPeriodFinality", chainId, ledger, [32]byte(dataAvailabilityPeriodHash), [32]byte(chainTipHash))
+}
+
+func (c *Client) callParams(data []byte) NodeCallParams {
+	return NodeCallParams{
+		From: c.sender.Hex(),
+		To:   c.contract.Hex(),
+		Gas:  hexutil.EncodeUint64(c.GasLimit),
+		Data: hexutil.Encode(data),
+	}
+}
+
+// Calls a view function of the contract at the latest block
+func (c *Client) CallView(method string, args ...interface{}) ([]interface{}, error) {
+	data, err := c.abi.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	var result hexutil.Bytes
+	if err := c.CallNode("eth_call", []interface{}{c.callParams(data), "latest"}, &result); err != nil {
+		return nil, err
+	}
+	return c.abi.Unpack(method, result)
+}
+
+// Runs a call without sending it, returning the revert reason of a call that would fail. Nodes
+// run the verifier on calls as well, against their own chain APIs.
+func (c *Client) DryRun(data []byte) error {
+	var result hexutil.Bytes
+	return c.CallNode("eth_call", []interface{}{c.callParams(data), "latest"}, &result)
+}
+
+func GetHashExists(values []interface{}) (HashExists, error) {
+	if len(values) != 10 {
+		return HashExists{}, fmt.Errorf("unexpected number of HashExists fields: %d", len(values))
+	}
+	var (
+		h  HashExists
+		ok = make([]bool, 10)
+	)
+	h.Exists, ok[0] = values[0].(bool)
+	var hash [32]byte
+	hash, ok[1] = values[1].([32]byte)
+	h.DataAvailabilityPeriodHash = hash
+	hash, ok[2] = values[2].([32]byte)
+	h.CommitHash = hash
+	h.CommitTime, ok[3] = values[3].(*big.Int)
+	h.PermittedRevealTime, ok[4] = values[4].(*big.Int)
+	hash, ok[5] = values[5].([32]byte)
+	h.RevealHash = hash
+	h.Index, ok[6] = values[6].(uint64)
+	h.IndexSearchRegion, ok[7] = values[7].(uint64)
+	h.Proven, ok[8] = values[8].(bool)
+	h.ProvenBy, ok[9] = values[9].(common.Address)
+	for i := range ok {
+		if !ok[i] {
+			return HashExists{}, fmt.Errorf("unexpected type of HashExists field %d", i)
+		}
+	}
+	return h, nil
+}
+
+// Returns the finalisedPayments entry of a payment hash. Proven payments have Proven set, and
+// disproven ones only Exists, with the ledger they were disproven at as their Index.
+func (c *Client) GetFinalisedPayment(chainId uint32, paymentHash common.Hash) (HashExists, error) {
+	values, err := c.CallView("finalisedPayments", [32]byte(LocationHash(chainId, paymentHash)))
+	if err != nil {
+		return HashExists{}, err
+	}
+	return GetHashExists(values)
+}
+
+// Returns the commit of a proof, if any
+func (c *Client) GetProposedProof(proof PaymentProof, isDisprove bool) (HashExists, error) {
+	method := "proposedPaymentProofs"
+	if isDisprove {
+		method = "proposedNonPaymentProofs"
+	}
+	values, err := c.CallView(method, [32]byte(LocationHash(proof.ChainId, proof.PaymentHash)), proof.Ledger)
+	if err != nil {
+		return HashExists{}, err
+	}
+	return GetHashExists(values)
+}
+
+// Signs and sends a call to the contract, returning its transaction hash
+func (c *Client) Send(data []byte) (common.Hash, error) {
+	var nonce hexutil.Uint64
+	if err := c.CallNode("eth_getTransactionCount", []interface{}{c.sender.Hex(), "pending"}, &nonce); err != nil {
+		return common.Hash{}, err
+	}
+	tx := types.NewTransaction(uint64(nonce), c.contract, big.NewInt(0), c.GasLimit, c.GasPrice, data)
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(c.chainID), c.key)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	rawTx, err := signedTx.MarshalBinary()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var txHash common.Hash
+	if err := c.CallNode("eth_sendRawTransaction", []interface{}{hexutil.Encode(rawTx)}, &txHash); err != nil {
+		return common.Hash{}, err
+	}
+	return txHash, nil
+}
+
+func (c *Client) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.PollInterval):
+		return nil
+	}
+}
+
+// Waits for a transaction to be accepted, failing if it reverted
+func (c *Client) WaitForReceipt(ctx context.Context, txHash common.Hash) (NodeReceipt, error) {
+	for {
+		var receipt *NodeReceipt
+		if err := c.CallNode("eth_getTransactionReceipt", []interface{}{txHash.Hex()}, &receipt); err != nil {
+			return NodeReceipt{}, err
+		}
+		if receipt != nil {
+			if receipt.Status != "0x1" {
+				return *receipt, fmt.Errorf("transaction %s reverted", txHash.Hex())
+			}
+			return *receipt, nil
+		}
+		if err := c.wait(ctx); err != nil {
+			return NodeReceipt{}, err
+		}
+	}
+}
+
+func (c *Client) sendAndWait(ctx context.Context, data []byte) error {
+	txHash, err := c.Send(data)
+	if err != nil {
+		return err
+	}
+	_, err = c.WaitForReceipt(ctx, txHash)
+	return err
+}
+
+// Proves or disproves a payment, committing to the proof, revealing it once permitted and
+// waiting until the payment is finalised. An existing commit to the proof is revealed in place
+// of a new one, so that an interrupted submission can be resumed.
+func (c *Client) Submit(ctx context.Context, proof PaymentProof, isDisprove bool) (HashExists, error) {
+	finalised, err := c.GetFinalisedPayment(proof.ChainId, proof.PaymentHash)
+	if err != nil {
+		return HashExists{}, err
+	}
+	if finalised.Proven {
+		if isDisprove {
+			return finalised, errors.New("the payment is already proven")
+		}
+		return finalised, nil
+	}
+	var data []byte
+	if isDisprove {
+		data, err = c.EncodeDisprovePaymentFinality(proof)
+	} else {
+		data, err = c.EncodeProvePaymentFinality(proof)
+	}
+	if err != nil {
+		return HashExists{}, err
+	}
+	if err := c.DryRun(data); err != nil {
+		return HashExists{}, err
+	}
+
+	proposed, err := c.GetProposedProof(proof, isDisprove)
+	if err != nil {
+		return HashExists{}, err
+	}
+	if !proposed.Exists {
+		if err := c.sendAndWait(ctx, data); err != nil {
+			return HashExists{}, err
+		}
+		proposed, err = c.GetProposedProof(proof, isDisprove)
+		if err != nil {
+			return HashExists{}, err
+		}
+		if !proposed.Exists {
+			return HashExists{}, ErrNotVerified
+		}
+	}
+
+	upperBoundValues, err := c.CallView("commitRevealUpperBound")
+	if err != nil {
+		return HashExists{}, err
+	}
+	upperBound, ok := upperBoundValues[0].(*big.Int)
+	if !ok {
+		return HashExists{}, errors.New("unexpected type of commitRevealUpperBound")
+	}
+	revealDeadline := new(big.Int).Add(proposed.CommitTime, upperBound)
+	// Blocks are only produced when there are transactions, so the reveal is timed by the local
+	// clock rather than by the timestamp of the latest block
+	for big.NewInt(time.Now().Unix()).Cmp(proposed.PermittedRevealTime) < 0 {
+		if err := c.wait(ctx); err != nil {
+			return HashExists{}, err
+		}
+	}
+	if big.NewInt(time.Now().Unix()).Cmp(revealDeadline) >= 0 {
+		return HashExists{}, ErrRevealTooLate
+	}
+	if err := c.sendAndWait(ctx, data); err != nil {
+		return HashExists{}, err
+	}
+
+	finalised, err = c.GetFinalisedPayment(proof.ChainId, proof.PaymentHash)
+	if err != nil {
+		return HashExists{}, err
+	}
+	if !finalised.Exists || finalised.Proven == isDisprove || finalised.Index != proof.Ledger {
+		return finalised, ErrNotVerified
+	}
+	return finalised, nil
+}
@@ -0,0 +1,285 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+package stateconnector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ava-labs/coreth/core"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Copied next to the tests by build_coreth.sh from bin/src/stateco/StateConnector.json
+const stateConnectorArtifact = "testdata/StateConnector.json"
+
+var blockTime = big.NewInt(1636070400)
+
+const (
+	powTxIDFixture      = "a1075db55d416d3ca199f55b6084e2115b9345e16c5cf302fc80e9d5fbf5d48d"
+	powBlockHashFixture = "0000000000000000000590fc0f3eba193a278534220b2b37e9849e1a770ca959"
+	powTxFixture        = `{
+		"txid": "` + powTxIDFixture + `",
+		"blockhash": "` + powBlockHashFixture + `",
+		"confirmations": 6,
+		"vin": [{"txid": "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b", "vout": 0}],
+		"vout": [
+			{"value": 0.015, "n": 0, "scriptPubKey": {"type": "pubkeyhash", "addresses": ["1BoatSLRHtKNngkdXEeobR76b53LETtpyT"]}},
+			{"value": 0, "n": 1, "scriptPubKey": {"hex": "6a0a696e766f696365203432", "type": "nulldata"}}
+		]
+	}`
+	xrpTxFixture = `{
+		"Account": "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh",
+		"Amount": "20000000",
+		"Destination": "rhub8VRN55s94qWKDv6jmDy1pUykJzF3wq",
+		"DestinationTag": 129053196,
+		"TransactionType": "Payment",
+		"date": 689303221,
+		"hash": "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A",
+		"inLedger": 62880010,
+		"meta": {"TransactionResult": "tesSUCCESS", "delivered_amount": "20000000"},
+		"status": "success",
+		"validated": true
+	}`
+)
+
+// Serve fixed JSON-RPC results by method
+func newRPCFixtureServer(results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"result":` + results[request.Method] + `,"error":null}`))
+	}))
+}
+
+// Hashes computed from raw chain data must match those the verifier computes from chain APIs
+func TestPaymentHashesMatchVerifier(t *testing.T) {
+	bitcoind := newRPCFixtureServer(map[string]string{
+		"getrawtransaction": powTxFixture,
+		"getblockheader":    `{"hash": "` + powBlockHashFixture + `", "confirmations": 6, "height": 700000}`,
+		"getblockcount":     `700005`,
+	})
+	defer bitcoind.Close()
+	rippled := newRPCFixtureServer(map[string]string{"tx": xrpTxFixture})
+	defer rippled.Close()
+
+	txId, paymentHash, err := PoWPaymentHash(0, blockTime, []byte(powTxFixture), 0)
+	if err != nil || txId != "0"+powTxIDFixture || paymentHash.Hex() != "0xfbbea4816c6369e28682c399b028e4f2dac4d8542d70c5241962c691df6608f8" {
+		t.Errorf("unexpected PoW payment %s %s %v", txId, paymentHash.Hex(), err)
+	}
+	verifierHash, ledger, err := FetchPaymentHash(0, blockTime, core.PaymentProofBasic, core.TimestampWindow{}, txId, bitcoind.URL)
+	if err != nil || verifierHash != paymentHash || ledger != 700000 {
+		t.Errorf("verifier computed %s at %d, %v", verifierHash.Hex(), ledger, err)
+	}
+	if _, _, err := PoWPaymentHash(0, blockTime, []byte(powTxFixture), 1); err != ErrNoPayment {
+		t.Errorf("expected the reference output to have no payment hash, got %v", err)
+	}
+
+	txId, paymentHash, err = XRPPaymentHash([]byte(xrpTxFixture), core.PaymentProofBasic, core.TimestampWindow{})
+	if err != nil || paymentHash.Hex() != "0x716f54bafa5c2314f7d953f84c82efe31d1d6e1cabf41ef94f0eaf4789c46929" {
+		t.Errorf("unexpected XRP payment %s %s %v", txId, paymentHash.Hex(), err)
+	}
+	verifierHash, ledger, err = FetchPaymentHash(3, blockTime, core.PaymentProofBasic, core.TimestampWindow{}, txId, rippled.URL)
+	if err != nil || verifierHash != paymentHash || ledger != 62880010 {
+		t.Errorf("verifier computed %s at %d, %v", verifierHash.Hex(), ledger, err)
+	}
+
+	if commitment, err := LedgerHashCommitment(0, powBlockHashFixture); err != nil || commitment != common.HexToHash(powBlockHashFixture) {
+		t.Errorf("unexpected PoW ledger hash commitment %s %v", commitment.Hex(), err)
+	}
+	xrpLedgerHash := "F8A87917637D476E871A04FD5BD7A2C6F5E7A0C1A33F1B4A3B1F0E0E7FA9C4B1"
+	if commitment, err := LedgerHashCommitment(3, xrpLedgerHash); err != nil || commitment != crypto.Keccak256Hash([]byte(xrpLedgerHash)) {
+		t.Errorf("unexpected XRP ledger hash commitment %s %v", commitment.Hex(), err)
+	}
+}
+
+// The calls encoded from the contract ABI must carry the selectors the node verifies
+func TestEncodeProofCalls(t *testing.T) {
+	contractABI, err := LoadABI(stateConnectorArtifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{abi: contractABI}
+	proof := PaymentProof{ChainId: 3, Ledger: 62880010, TxId: "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A", PaymentHash: common.HexToHash("0x716f54bafa5c2314f7d953f84c82efe31d1d6e1cabf41ef94f0eaf4789c46929")}
+	prove, err := c.EncodeProvePaymentFinality(proof)
+	if err != nil || !bytes.Equal(prove[0:4], core.GetProvePaymentFinalitySelector(blockTime)) {
+		t.Fatalf("unexpected provePaymentFinality call %x %v", prove, err)
+	}
+	disprove, err := c.EncodeDisprovePaymentFinality(proof)
+	if err != nil || !bytes.Equal(disprove[0:4], core.GetDisprovePaymentFinalitySelector(blockTime)) {
+		t.Fatalf("unexpected disprovePaymentFinality call %x %v", disprove, err)
+	}
+	dataAvailability, err := c.EncodeProveDataAvailabilityPeriodFinality(3, 62880100, common.Hash{1}, common.Hash{2})
+	if err != nil || !bytes.Equal(dataAvailability[0:4], core.GetProveDataAvailabilityPeriodFinalitySelector(blockTime)) {
+		t.Fatalf("unexpected proveDataAvailabilityPeriodFinality call %x %v", dataAvailability, err)
+	}
+	// chainId, paymentHash, ledger, offset, length and the txId padded to two words
+	if len(prove) != 4+7*32 || !bytes.Equal(prove[36:68], proof.PaymentHash.Bytes()) || string(prove[164:228]) != proof.TxId {
+		t.Errorf("unexpected provePaymentFinality layout %x", prove)
+	}
+}
+
+// Models the commit and reveal of payment proofs by the state connector contract, with every
+// proof verified when verified is set
+type nodeFixture struct {
+	t        *testing.T
+	abi      abi.ABI
+	lock     sync.Mutex
+	verified bool
+	senders  []common.Address
+	proposed map[common.Hash]HashExists
+	final    map[common.Hash]HashExists
+}
+
+func (node *nodeFixture) hashExists(h HashExists) []interface{} {
+	if h.CommitTime == nil {
+		h.CommitTime, h.PermittedRevealTime = new(big.Int), new(big.Int)
+	}
+	return []interface{}{h.Exists, [32]byte(h.DataAvailabilityPeriodHash), [32]byte(h.CommitHash), h.CommitTime, h.PermittedRevealTime, [32]byte(h.RevealHash), h.Index, h.IndexSearchRegion, h.Proven, h.ProvenBy}
+}
+
+func (node *nodeFixture) call(data []byte) (interface{}, string) {
+	method, err := node.abi.MethodById(data)
+	if err != nil {
+		return nil, "execution reverted"
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, "execution reverted"
+	}
+	var outputs []interface{}
+	switch method.Name {
+	case "finalisedPayments":
+		outputs = node.hashExists(node.final[common.Hash(args[0].([32]byte))])
+	case "proposedPaymentProofs":
+		outputs = node.hashExists(node.proposed[common.Hash(args[0].([32]byte))])
+	case "commitRevealUpperBound":
+		outputs = []interface{}{big.NewInt(300)}
+	case "provePaymentFinality":
+		outputs = []interface{}{args[0], args[2], uint64(62880100), args[1], args[3]}
+	default:
+		return nil, "execution reverted"
+	}
+	packed, err := method.Outputs.Pack(outputs...)
+	if err != nil {
+		node.t.Errorf("packing %s outputs: %v", method.Name, err)
+	}
+	return hexutil.Encode(packed), ""
+}
+
+func (node *nodeFixture) send(rawTx []byte) (interface{}, string) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(rawTx); err != nil {
+		return nil, "invalid transaction"
+	}
+	sender, err := types.Sender(types.NewEIP155Signer(big.NewInt(16)), tx)
+	if err != nil {
+		return nil, "invalid sender"
+	}
+	node.senders = append(node.senders, sender)
+	args, err := node.abi.Methods["provePaymentFinality"].Inputs.Unpack(tx.Data()[4:])
+	if err != nil {
+		return nil, "execution reverted"
+	}
+	chainId, paymentHash, ledger := args[0].(uint32), common.Hash(args[1].([32]byte)), args[2].(uint64)
+	locationHash := LocationHash(chainId, paymentHash)
+	now := big.NewInt(time.Now().Unix())
+	if node.verified {
+		if !node.proposed[locationHash].Exists {
+			node.proposed[locationHash] = HashExists{Exists: true, CommitTime: now, PermittedRevealTime: now, RevealHash: paymentHash, Index: ledger, ProvenBy: sender}
+		} else {
+			node.final[locationHash] = HashExists{Exists: true, CommitTime: new(big.Int), PermittedRevealTime: now, RevealHash: paymentHash, Index: ledger, Proven: true, ProvenBy: sender}
+		}
+	}
+	return tx.Hash().Hex(), ""
+}
+
+func (node *nodeFixture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	var request struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	var (
+		result   interface{}
+		errorMsg string
+	)
+	switch request.Method {
+	case "eth_chainId":
+		result = "0x10"
+	case "eth_getTransactionCount":
+		result = hexutil.EncodeUint64(uint64(len(node.senders)))
+	case "eth_getTransactionReceipt":
+		result = map[string]string{"status": "0x1", "blockNumber": "0x1"}
+	case "eth_call":
+		var params NodeCallParams
+		json.Unmarshal(request.Params[0], &params)
+		data, _ := hexutil.Decode(params.Data)
+		result, errorMsg = node.call(data)
+	case "eth_sendRawTransaction":
+		var rawTx hexutil.Bytes
+		json.Unmarshal(request.Params[0], &rawTx)
+		result, errorMsg = node.send(rawTx)
+	}
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result}
+	if errorMsg != "" {
+		response["error"] = map[string]interface{}{"code": -32000, "message": errorMsg}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func TestSubmitPaymentProof(t *testing.T) {
+	contractABI, err := LoadABI(stateConnectorArtifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := crypto.HexToECDSA("d77b743a0b9170c230e4a4be446b8605aa45f1d00da3d8cd5e5f778c287e1f22")
+	proof := PaymentProof{ChainId: 3, Ledger: 62880010, TxId: "F4D1EDBFB578A8C96CF12D90E9ADEDF22F556420276A1D0F13245E433020416A", PaymentHash: common.HexToHash("0x716f54bafa5c2314f7d953f84c82efe31d1d6e1cabf41ef94f0eaf4789c46929")}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, verified := range []bool{true, false} {
+		node := &nodeFixture{t: t, abi: contractABI, verified: verified, proposed: make(map[common.Hash]HashExists), final: make(map[common.Hash]HashExists)}
+		server := httptest.NewServer(node)
+		c, err := NewClient(server.URL, stateConnectorArtifact, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.PollInterval = 10 * time.Millisecond
+		finalised, err := c.Submit(ctx, proof, false)
+		server.Close()
+		if !verified {
+			if err != ErrNotVerified || len(node.senders) != 1 {
+				t.Errorf("expected an unverified commit to stop the submission, got %v after %d transactions", err, len(node.senders))
+			}
+			continue
+		}
+		if err != nil || !finalised.Proven || finalised.Index != proof.Ledger || finalised.ProvenBy != c.Sender() {
+			t.Errorf("unexpected submission result %+v %v", finalised, err)
+		}
+		// One commit and one reveal, both signed by the client key
+		if len(node.senders) != 2 || node.senders[0] != c.Sender() || node.senders[1] != c.Sender() {
+			t.Errorf("unexpected transactions from %v", node.senders)
+		}
+		if c.Sender() != common.HexToAddress("0xffC11262622D5069aBad729efe84a95C169d9c06") {
+			t.Errorf("unexpected sender %s", c.Sender().Hex())
+		}
+	}
+}
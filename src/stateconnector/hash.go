@@ -0,0 +1,117 @@
+// (c) 2021, Flare Networks Limited. All rights reserved.
+// Please see the file LICENSE for licensing terms.
+
+// Package stateconnector builds state connector proofs and submits them to a node. Payment
+// hashes and ledger hash commitments are computed by the hashing code of the verifier that
+// nodes run, so that proofs built here are exactly the ones nodes accept.
+package stateconnector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+
+	"github.com/ava-labs/coreth/core"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	ErrNoPayment = errors.New("no provable payment with this txId")
+)
+
+// Returns the txId and payment hash of an output of a UTXO chain transaction, given the result
+// of getrawtransaction with verbose set
+func PoWPaymentHash(chainId uint32, blockTime *big.Int, rawTx []byte, voutN uint64) (string, common.Hash, error) {
+	chain, ok := core.GetUTXOChainConfig(chainId, blockTime)
+	if !ok {
+		return "", common.Hash{}, fmt.Errorf("chain %d is not a UTXO chain", chainId)
+	}
+	if voutN > 15 {
+		return "", common.Hash{}, errors.New("output index must be below 16")
+	}
+	var tx core.GetPoWTxResult
+	if err := json.Unmarshal(rawTx, &tx); err != nil {
+		return "", common.Hash{}, err
+	}
+	txId := strconv.FormatUint(voutN, 16) + tx.TxID
+	paymentHash, ok := core.GetPoWPaymentHash(txId, tx, voutN, chain)
+	if !ok {
+		return "", common.Hash{}, ErrNoPayment
+	}
+	return txId, common.BytesToHash(paymentHash), nil
+}
+
+// Returns the txId and payment hash of an XRP transaction, given the result of the rippled tx
+// method. The window is only committed to by timestamp proofs.
+func XRPPaymentHash(rawTx []byte, variant core.PaymentProofVariant, window core.TimestampWindow) (string, common.Hash, error) {
+	var tx core.GetXRPTxResponse
+	if err := json.Unmarshal(rawTx, &tx); err != nil {
+		return "", common.Hash{}, err
+	}
+	paymentHash, ok := core.GetXRPPaymentHash(tx, variant, window)
+	if !ok {
+		return "", common.Hash{}, ErrNoPayment
+	}
+	return tx.Hash, common.BytesToHash(paymentHash), nil
+}
+
+// Returns the dataAvailabilityPeriodHash of a ledger hash as reported by the API of a chain
+func LedgerHashCommitment(chainId uint32, ledgerHash string) (common.Hash, error) {
+	commitment, ok := core.GetLedgerHashCommitment(chainId, ledgerHash)
+	if !ok {
+		return common.Hash{}, fmt.Errorf("invalid ledger hash %q", ledgerHash)
+	}
+	return common.BytesToHash(commitment), nil
+}
+
+// Looks up a payment through a chain API with the getters of the verifier, returning its
+// payment hash and the ledger it is in. Credentials and API types are read from the same
+// environment variables as on a node, see conf/export_chain_apis.sh. PoW txIds are the output
+// index as a single hex digit followed by the transaction hash. The window is only committed to
+// by timestamp proofs.
+func FetchPaymentHash(chainId uint32, blockTime *big.Int, variant core.PaymentProofVariant, window core.TimestampWindow, txId string, chainURL string) (common.Hash, uint64, error) {
+	var (
+		paymentHash []byte
+		ledger      uint64
+		apiErr      bool
+	)
+	if chain, ok := core.GetUTXOChainConfig(chainId, blockTime); ok {
+		if len(txId) != 65 {
+			return common.Hash{}, 0, errors.New("PoW txIds are the output index followed by the transaction hash")
+		}
+		voutN, err := strconv.ParseUint(txId[0:1], 16, 64)
+		if err != nil {
+			return common.Hash{}, 0, err
+		}
+		chainURLhash := sha256.Sum256([]byte(chainURL))
+		chainURLchecksum := hex.EncodeToString(chainURLhash[0:4])
+		username := os.Getenv(chain.EnvPrefix + "_U_" + chainURLchecksum)
+		password := os.Getenv(chain.EnvPrefix + "_P_" + chainURLchecksum)
+		chain.Backend = os.Getenv(chain.EnvPrefix + "_T_" + chainURLchecksum)
+		paymentHash, ledger, apiErr = core.GetPoWTx(txId, voutN, math.MaxUint64, chain, variant, window, chainURL, username, password)
+	} else {
+		switch chainId {
+		case 3:
+			paymentHash, ledger, apiErr = core.GetXRPTx(txId, math.MaxUint64, variant, window, chainURL)
+		case 5:
+			paymentHash, ledger, apiErr = core.GetEVMTx(txId, math.MaxUint64, "eth", variant, window, chainURL, core.GetEVMChainConfig("ETH", chainURL, blockTime))
+		case 6:
+			paymentHash, ledger, apiErr = core.GetStellarTx(txId, math.MaxUint64, variant, window, chainURL)
+		default:
+			return common.Hash{}, 0, fmt.Errorf("payments on chain %d cannot be proven", chainId)
+		}
+	}
+	if apiErr {
+		return common.Hash{}, 0, fmt.Errorf("chain API %s is unavailable or inconsistent", chainURL)
+	}
+	if len(paymentHash) == 0 {
+		return common.Hash{}, 0, ErrNoPayment
+	}
+	return common.BytesToHash(paymentHash), ledger, nil
+}